@@ -0,0 +1,442 @@
+package gcb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// makes sure the round trippers can be administered
+var _ AdminTarget = (*tripper)(nil)
+
+type (
+	// BreakerSource lists breakers, the round trippers of NewRoundTripper
+	// are one
+	BreakerSource interface {
+		Summaries() []BreakerSummary
+	}
+
+	// AdminTarget is a transport the admin handler inspects and controls,
+	// the round trippers of NewRoundTripper are
+	AdminTarget interface {
+		BreakerSource
+		ForceState(name string, state State) bool
+		ResetBreaker(name string) bool
+		Reload(opts ...Option)
+		RateLimit() (rate.Limit, int, bool)
+		SetRateLimit(limit rate.Limit, burst int) bool
+		LogLevel() LogLevel
+		SetLogLevel(level LogLevel)
+		DebugHost(host string, d time.Duration)
+		DebugHosts() map[string]time.Time
+		// As returns the transport recording the interventions made
+		// through it under the principal
+		As(principal string) AdminTarget
+	}
+
+	// AdminAuth tells whether a request to the admin handler is allowed,
+	// e.g. by checking a token
+	AdminAuth func(r *http.Request) bool
+
+	// Registry holds the transports exposed by the admin handler, by name
+	Registry struct {
+		mu         sync.RWMutex
+		transports map[string]AdminTarget
+	}
+
+	// AdminBreaker is a breaker as listed by the admin handler
+	AdminBreaker struct {
+		Transport string `json:"transport"`
+		BreakerSummary
+	}
+
+	// AdminRateLimit is the rate limit of the retries of a transport, in
+	// retries per second
+	AdminRateLimit struct {
+		Limit rate.Limit `json:"limit"`
+		Burst int        `json:"burst"`
+	}
+
+	// AdminLogLevel is the log level of a transport
+	AdminLogLevel struct {
+		Level LogLevel `json:"level"`
+	}
+
+	// AdminDebugHost is a host whose requests are dumped, until when
+	AdminDebugHost struct {
+		Host  string    `json:"host"`
+		Until time.Time `json:"until"`
+	}
+
+	adminHandler struct {
+		registry *Registry
+		auth     AdminAuth
+	}
+)
+
+const (
+	// defaultDebugDuration is how long a host is debugged by default, and
+	// maxDebugDuration how long it can be through the admin handler
+	defaultDebugDuration = 5 * time.Minute
+	maxDebugDuration     = time.Hour
+)
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{transports: make(map[string]AdminTarget)}
+}
+
+// Register adds the transport under the name, replacing any other
+func (r *Registry) Register(name string, transport AdminTarget) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.transports[name] = transport
+}
+
+// Unregister removes the transport of the name
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.transports, name)
+}
+
+// lookup returns the transport of the name
+func (r *Registry) lookup(name string) (AdminTarget, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transport, ok := r.transports[name]
+	return transport, ok
+}
+
+// names returns the names of the transports, sorted
+func (r *Registry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.transports))
+	for name := range r.transports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AdminHandler serves the breakers and the rate limits of the registered
+// transports, in JSON:
+//
+//	GET    /breakers                              lists every breaker
+//	GET    /breakers/{transport}                  lists those of a transport
+//	GET    /breakers/{transport}/{breaker}        shows a breaker
+//	POST   /breakers/{transport}/{breaker}/open   forces it open
+//	POST   /breakers/{transport}/{breaker}/close  forces it closed
+//	POST   /breakers/{transport}/{breaker}/reset  releases and clears it
+//	GET    /ratelimit/{transport}                 shows the retry rate limit
+//	PUT    /ratelimit/{transport}                 sets it, {"limit":100,"burst":10}
+//	GET    /stats                                 shows the Stats, in the versioned schema
+//	GET    /loglevel/{transport}                  shows the log level
+//	PUT    /loglevel/{transport}                  sets it, {"level":"debug"}
+//	GET    /debug/{transport}                     lists the debugged hosts
+//	PUT    /debug/{transport}/{host}?for=10m      dumps the requests to the host, 5m by default
+//	DELETE /debug/{transport}/{host}              stops dumping them
+//
+// The names are path escaped, an unnamed breaker is an empty segment as in
+// /breakers/payments//open. Every request goes through auth first, nil
+// lets them all through: the handler then belongs on an internal listener.
+// The changes are recorded in the audit trail of the transport under the
+// principal set with ContextWithPrincipal, or the remote address.
+//
+//	http.Handle("/gcb/", http.StripPrefix("/gcb", gcb.AdminHandler(registry, auth)))
+func AdminHandler(registry *Registry, auth AdminAuth) http.Handler {
+	return &adminHandler{registry: registry, auth: auth}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.auth != nil && !h.auth(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	path, err := adminPath(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(path) == 1 && path[0] == "breakers":
+		h.breakers(w, r)
+	case len(path) == 2 && path[0] == "breakers":
+		h.transportBreakers(w, r, path[1])
+	case len(path) >= 3 && path[0] == "breakers":
+		h.breaker(w, r, path[1], path[2], path[3:])
+	case len(path) == 2 && path[0] == "ratelimit":
+		h.rateLimit(w, r, path[1])
+	case len(path) == 1 && path[0] == "stats":
+		h.stats(w, r)
+	case len(path) == 2 && path[0] == "loglevel":
+		h.logLevel(w, r, path[1])
+	case len(path) == 2 && path[0] == "debug":
+		h.debugHosts(w, r, path[1])
+	case len(path) == 3 && path[0] == "debug":
+		h.debugHost(w, r, path[1], path[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// breakers lists the breakers of every transport
+func (h *adminHandler) breakers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		adminMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	breakers := []AdminBreaker{}
+	for _, name := range h.registry.names() {
+		if transport, ok := h.registry.lookup(name); ok {
+			breakers = appendAdminBreakers(breakers, name, transport)
+		}
+	}
+	writeAdminJSON(w, breakers)
+}
+
+// transportBreakers lists the breakers of a transport
+func (h *adminHandler) transportBreakers(w http.ResponseWriter, r *http.Request, name string) {
+	transport, ok := h.registry.lookup(name)
+	if !ok {
+		http.Error(w, "unknown transport", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		adminMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeAdminJSON(w, appendAdminBreakers([]AdminBreaker{}, name, transport))
+}
+
+// breaker shows a breaker, or runs an action on it
+func (h *adminHandler) breaker(w http.ResponseWriter, r *http.Request, name, breaker string, action []string) {
+	transport, ok := h.registry.lookup(name)
+	if !ok {
+		http.Error(w, "unknown transport", http.StatusNotFound)
+		return
+	}
+
+	if len(action) == 0 {
+		if r.Method != http.MethodGet {
+			adminMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		summary, ok := summaryNamed(transport, breaker)
+		if !ok {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
+		writeAdminJSON(w, AdminBreaker{Transport: name, BreakerSummary: summary})
+		return
+	}
+
+	if len(action) > 1 {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		adminMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var found bool
+	switch action[0] {
+	case "open":
+		found = transport.As(requestPrincipal(r)).ForceState(breaker, Open)
+	case "close":
+		found = transport.As(requestPrincipal(r)).ForceState(breaker, Close)
+	case "reset":
+		found = transport.As(requestPrincipal(r)).ResetBreaker(breaker)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if !found {
+		http.Error(w, "unknown breaker", http.StatusNotFound)
+		return
+	}
+
+	summary, _ := summaryNamed(transport, breaker)
+	writeAdminJSON(w, AdminBreaker{Transport: name, BreakerSummary: summary})
+}
+
+// stats shows the stats of every transport
+func (h *adminHandler) stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		adminMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeAdminJSON(w, NewStats(h.registry, time.Now()))
+}
+
+// rateLimit shows or sets the retry rate limit of a transport
+func (h *adminHandler) rateLimit(w http.ResponseWriter, r *http.Request, name string) {
+	transport, ok := h.registry.lookup(name)
+	if !ok {
+		http.Error(w, "unknown transport", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var limit AdminRateLimit
+		if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if limit.Limit < 0 || limit.Burst < 0 {
+			http.Error(w, "negative rate limit", http.StatusBadRequest)
+			return
+		}
+		if !transport.As(requestPrincipal(r)).SetRateLimit(limit.Limit, limit.Burst) {
+			http.Error(w, "the rate limit can't be adjusted", http.StatusConflict)
+			return
+		}
+	default:
+		adminMethodNotAllowed(w, http.MethodGet+", "+http.MethodPut)
+		return
+	}
+
+	limit, burst, ok := transport.RateLimit()
+	if !ok {
+		http.Error(w, "the rate limit can't be read", http.StatusConflict)
+		return
+	}
+	writeAdminJSON(w, AdminRateLimit{Limit: limit, Burst: burst})
+}
+
+// logLevel shows or sets the log level of a transport
+func (h *adminHandler) logLevel(w http.ResponseWriter, r *http.Request, name string) {
+	transport, ok := h.registry.lookup(name)
+	if !ok {
+		http.Error(w, "unknown transport", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var level AdminLogLevel
+		if err := json.NewDecoder(r.Body).Decode(&level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		transport.As(requestPrincipal(r)).SetLogLevel(level.Level)
+	default:
+		adminMethodNotAllowed(w, http.MethodGet+", "+http.MethodPut)
+		return
+	}
+	writeAdminJSON(w, AdminLogLevel{Level: transport.LogLevel()})
+}
+
+// debugHosts lists the debugged hosts of a transport
+func (h *adminHandler) debugHosts(w http.ResponseWriter, r *http.Request, name string) {
+	transport, ok := h.registry.lookup(name)
+	if !ok {
+		http.Error(w, "unknown transport", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		adminMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeAdminJSON(w, adminDebugHosts(transport))
+}
+
+// debugHost starts or stops the dumps of the requests to a host
+func (h *adminHandler) debugHost(w http.ResponseWriter, r *http.Request, name, host string) {
+	transport, ok := h.registry.lookup(name)
+	if !ok {
+		http.Error(w, "unknown transport", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		d := defaultDebugDuration
+		if value := r.URL.Query().Get("for"); value != "" {
+			var err error
+			if d, err = time.ParseDuration(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if d <= 0 || d > maxDebugDuration {
+			http.Error(w, "the duration must be positive and at most "+maxDebugDuration.String(), http.StatusBadRequest)
+			return
+		}
+		transport.As(requestPrincipal(r)).DebugHost(host, d)
+	case http.MethodDelete:
+		transport.As(requestPrincipal(r)).DebugHost(host, 0)
+	default:
+		adminMethodNotAllowed(w, http.MethodPut+", "+http.MethodDelete)
+		return
+	}
+	writeAdminJSON(w, adminDebugHosts(transport))
+}
+
+// adminDebugHosts lists the debugged hosts of the transport, sorted
+func adminDebugHosts(transport AdminTarget) []AdminDebugHost {
+	hosts := []AdminDebugHost{}
+	for host, until := range transport.DebugHosts() {
+		hosts = append(hosts, AdminDebugHost{Host: host, Until: until})
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Host < hosts[j].Host
+	})
+	return hosts
+}
+
+// adminPath splits the path in its unescaped segments, so that the names
+// can hold slashes
+func adminPath(u *url.URL) ([]string, error) {
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+	return segments, nil
+}
+
+func appendAdminBreakers(breakers []AdminBreaker, name string, transport AdminTarget) []AdminBreaker {
+	for _, summary := range transport.Summaries() {
+		breakers = append(breakers, AdminBreaker{Transport: name, BreakerSummary: summary})
+	}
+	return breakers
+}
+
+// summaryNamed returns the summary of the named breaker of the transport
+func summaryNamed(transport BreakerSource, name string) (BreakerSummary, bool) {
+	for _, summary := range transport.Summaries() {
+		if summary.Name == name {
+			return summary, true
+		}
+	}
+	return BreakerSummary{}, false
+}
+
+func adminMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,99 @@
+package gcb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	registry := NewRegistry()
+	payments := NewRoundTripper(WithPerKeyBreakers())
+	payments.RoundTripper.(*circuit).breakers.get("api.example")
+	registry.Register("payments", payments)
+	registry.Register("search", NewRoundTripper(WithoutRateLimit()))
+	handler := AdminHandler(registry, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer admin"
+	})
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		response           string
+	}{
+		{http.MethodPost, "/breakers/payments/api.example/open", "", http.StatusOK, `"state":"Open"`},
+		{http.MethodGet, "/breakers/payments/api.example", "", http.StatusOK, `"state":"Open"`},
+		{http.MethodPost, "/breakers/payments/api.example/close", "", http.StatusOK, `"state":"Close"`},
+		{http.MethodPost, "/breakers/payments/api.example/reset", "", http.StatusOK, `"state":"Close"`},
+		{http.MethodPost, "/breakers/search//open", "", http.StatusOK, `"name":"","state":"Open"`},
+		{http.MethodGet, "/breakers", "", http.StatusOK, `"transport":"search"`},
+		{http.MethodGet, "/breakers/payments", "", http.StatusOK, `"name":"api.example"`},
+		{http.MethodGet, "/ratelimit/payments", "", http.StatusOK, `{"limit":200,"burst":200}`},
+		{http.MethodPut, "/ratelimit/payments", `{"limit":10,"burst":5}`, http.StatusOK, `{"limit":10,"burst":5}`},
+		{http.MethodPut, "/ratelimit/payments", `{"limit":-1}`, http.StatusBadRequest, "negative"},
+		{http.MethodPut, "/ratelimit/search", `{"limit":10,"burst":5}`, http.StatusConflict, "adjusted"},
+		{http.MethodGet, "/stats", "", http.StatusOK, `"version":1`},
+		{http.MethodPost, "/stats", "", http.StatusMethodNotAllowed, "method"},
+		{http.MethodPut, "/loglevel/payments", `{"level":"error"}`, http.StatusOK, `{"level":"error"}`},
+		{http.MethodGet, "/loglevel/payments", "", http.StatusOK, `{"level":"error"}`},
+		{http.MethodPut, "/loglevel/payments", `{"level":"verbose"}`, http.StatusBadRequest, "unknown log level"},
+		{http.MethodPut, "/debug/payments/api.example?for=1m", "", http.StatusOK, `"host":"api.example"`},
+		{http.MethodGet, "/debug/payments", "", http.StatusOK, `"host":"api.example"`},
+		{http.MethodDelete, "/debug/payments/api.example", "", http.StatusOK, `[]`},
+		{http.MethodPut, "/debug/payments/api.example?for=2h", "", http.StatusBadRequest, "at most 1h0m0s"},
+		{http.MethodPost, "/debug/payments/api.example", "", http.StatusMethodNotAllowed, "method"},
+		{http.MethodGet, "/breakers/billing", "", http.StatusNotFound, "unknown transport"},
+		{http.MethodGet, "/breakers/payments/other.example", "", http.StatusNotFound, "unknown breaker"},
+		{http.MethodPost, "/breakers/payments/other.example/open", "", http.StatusNotFound, "unknown breaker"},
+		{http.MethodPost, "/breakers/payments/other.example/reset", "", http.StatusNotFound, "unknown breaker"},
+		{http.MethodGet, "/breakers/payments", "", http.StatusOK, `[{"transport":"payments","name":"api.example"`},
+		{http.MethodGet, "/breakers/payments/api.example/open", "", http.StatusMethodNotAllowed, "method"},
+		{http.MethodPost, "/breakers/payments/api.example/drop", "", http.StatusNotFound, "not found"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer admin")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: Expected %d, got %d", tt.method, tt.path, tt.status, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), tt.response) {
+			t.Errorf("%s %s: Expected %q in %q", tt.method, tt.path, tt.response, rec.Body.String())
+		}
+	}
+}
+
+func TestAdminHandler_Auth(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("payments", NewRoundTripper())
+	handler := AdminHandler(registry, func(r *http.Request) bool { return false })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/breakers/payments//open", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestAdminHandler_Reset(t *testing.T) {
+	transport := NewRoundTripper(WithReadyToTrip(func(counts Counts) bool { return true }))
+	registry := NewRegistry()
+	registry.Register("payments", transport)
+	trip(transport.RoundTripper.(*circuit).breaker)
+
+	rec := httptest.NewRecorder()
+	AdminHandler(registry, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/breakers/payments//reset", nil))
+
+	var breaker AdminBreaker
+	if err := json.NewDecoder(rec.Body).Decode(&breaker); err != nil {
+		t.Fatal(err)
+	}
+	if breaker.State != Close || breaker.Counts != (Counts{}) {
+		t.Errorf("Expected a cleared closed breaker, got %+v", breaker)
+	}
+}
@@ -0,0 +1,152 @@
+package gcb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultAuditSize is the number of interventions kept by default
+	defaultAuditSize = 64
+	// unknownPrincipal is recorded for the interventions made without As
+	unknownPrincipal = "unknown"
+)
+
+type (
+	// AuditEntry is a manual intervention on a transport: who made it,
+	// when, and what it did
+	AuditEntry struct {
+		Time      time.Time `json:"time"`
+		Principal string    `json:"principal"`
+		// Action is one of force, reset, reload, ratelimit, loglevel,
+		// debug and maintenance
+		Action string `json:"action"`
+		// Target is the breaker, the host or the key acted on, if any
+		Target string `json:"target,omitempty"`
+		Detail string `json:"detail,omitempty"`
+	}
+
+	// auditLog keeps the last interventions in a ring
+	auditLog struct {
+		mu      sync.Mutex
+		entries []AuditEntry
+		next    int
+		full    bool
+	}
+
+	principalKey struct{}
+)
+
+// WithAuditSize sets the number of manual interventions kept in the audit
+// trail of the transport, 64 by default
+func WithAuditSize(n int) Option {
+	return func(config *Config) {
+		config.auditSize = n
+	}
+}
+
+// As returns the transport acting on behalf of the principal: the manual
+// interventions made through it, forcing or resetting a breaker, reloading
+// options or changing the rate limit, the log level, the debugged hosts or
+// the maintenance keys, are recorded in the audit trail under its name. The
+// interventions made on the transport itself are recorded as unknown.
+//
+//	transport.As("alice@example.com").ForceState("payments", gcb.Open)
+func (t *tripper) As(principal string) AdminTarget {
+	return &tripper{RoundTripper: t.RoundTripper, principal: principal}
+}
+
+// Audit returns the last manual interventions on the transport, oldest
+// first
+func (t *tripper) Audit() []AuditEntry {
+	return t.RoundTripper.(*circuit).audit.list()
+}
+
+// audit records an intervention on behalf of the principal of the transport
+func (t *tripper) audit(action, target, detail string) {
+	principal := t.principal
+	if principal == "" {
+		principal = unknownPrincipal
+	}
+	t.RoundTripper.(*circuit).audit.record(AuditEntry{
+		Time:      time.Now(),
+		Principal: principal,
+		Action:    action,
+		Target:    target,
+		Detail:    detail,
+	})
+}
+
+// ContextWithPrincipal returns a context naming the principal the admin
+// handler records the interventions of the request under, e.g. set by the
+// authentication middleware
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// requestPrincipal returns the principal of an admin request: the one of
+// its context, or its remote address
+func requestPrincipal(r *http.Request) string {
+	if principal, ok := r.Context().Value(principalKey{}).(string); ok && principal != "" {
+		return principal
+	}
+	return r.RemoteAddr
+}
+
+func newAuditLog(size int) *auditLog {
+	if size <= 0 {
+		size = defaultAuditSize
+	}
+	return &auditLog{entries: make([]AuditEntry, size)}
+}
+
+func (a *auditLog) record(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries[a.next] = entry
+	a.next = (a.next + 1) % len(a.entries)
+	if a.next == 0 {
+		a.full = true
+	}
+}
+
+// list returns the entries, oldest first
+func (a *auditLog) list() []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var entries []AuditEntry
+	if a.full {
+		entries = append(entries, a.entries[a.next:]...)
+	}
+	return append(entries, a.entries[:a.next]...)
+}
+
+// describeReload describes the reloadable options set by opts
+func describeReload(opts []Option) string {
+	// the sentinels tell the options set to zero from those not set
+	config := &Config{maxRetries: ^uint32(0), timeout: -1}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	var changes []string
+	if config.maxRetries != ^uint32(0) {
+		changes = append(changes, fmt.Sprintf("maxRetries=%d", config.maxRetries))
+	}
+	if config.timeout != -1 {
+		changes = append(changes, fmt.Sprintf("timeout=%s", config.timeout))
+	}
+	if config.readyToTrip != nil {
+		changes = append(changes, "readyToTrip")
+	}
+	if len(config.maintenanceKeys) > 0 {
+		changes = append(changes, "maintenance="+strings.Join(config.maintenanceKeys, ","))
+	}
+	return strings.Join(changes, " ")
+}
@@ -0,0 +1,105 @@
+package gcb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTripper_Audit(t *testing.T) {
+	transport := NewRoundTripper(WithName("api"))
+	alice := transport.As("alice")
+
+	alice.ForceState("api", Open)
+	alice.ForceState("api", 0)
+	transport.ResetBreaker("api")
+	alice.Reload(WithMaxRetries(0), WithTimeout(time.Minute), WithMaintenance("down"))
+	alice.SetRateLimit(10, 5)
+	alice.SetLogLevel(LevelError)
+	alice.DebugHost("api.example", time.Minute)
+	alice.DebugHost("api.example", 0)
+	transport.SetMaintenance("down", false)
+	// unknown breakers aren't acted on
+	alice.ForceState("other", Open)
+
+	type intervention struct{ principal, action, target, detail string }
+	want := []intervention{
+		{"alice", "force", "api", "Open"},
+		{"alice", "force", "api", "release"},
+		{"unknown", "reset", "api", ""},
+		{"alice", "reload", "", "maxRetries=0 timeout=1m0s maintenance=down"},
+		{"alice", "ratelimit", "", "limit=10 burst=5"},
+		{"alice", "loglevel", "", "error"},
+		{"alice", "debug", "api.example", "1m0s"},
+		{"alice", "debug", "api.example", "stop"},
+		{"unknown", "maintenance", "down", "off"},
+	}
+
+	var got []intervention
+	for _, entry := range transport.Audit() {
+		if entry.Time.IsZero() {
+			t.Errorf("Expected the time of %+v", entry)
+		}
+		got = append(got, intervention{entry.Principal, entry.Action, entry.Target, entry.Detail})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestAuditLog_Ring(t *testing.T) {
+	transport := NewRoundTripper(WithAuditSize(2))
+
+	for _, key := range []string{"a", "b", "c"} {
+		transport.SetMaintenance(key, true)
+	}
+
+	audit := transport.Audit()
+	if len(audit) != 2 || audit[0].Target != "b" || audit[1].Target != "c" {
+		t.Errorf("Expected the last 2 interventions, got %+v", audit)
+	}
+	if stats := transport.Stats(); !reflect.DeepEqual(stats.Audit, audit) {
+		t.Errorf("Expected %+v, got %+v", audit, stats.Audit)
+	}
+
+	var buf bytes.Buffer
+	if err := transport.DumpState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "audit (2)\n") || !strings.Contains(buf.String(), "unknown  maintenance  c  on") {
+		t.Errorf("Expected the audit trail in\n%s", buf.String())
+	}
+}
+
+func TestAdminHandler_Principal(t *testing.T) {
+	transport := NewRoundTripper(WithName("api"))
+	registry := NewRegistry()
+	registry.Register("payments", transport)
+	handler := AdminHandler(registry, nil)
+
+	tests := []struct {
+		name      string
+		principal string
+		expected  string
+	}{
+		{"context", "alice", "alice"},
+		{"remote address", "", "192.0.2.1:1234"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/breakers/payments/api/open", nil)
+		if tt.principal != "" {
+			req = req.WithContext(ContextWithPrincipal(req.Context(), tt.principal))
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		audit := transport.Audit()
+		if last := audit[len(audit)-1]; last.Principal != tt.expected || last.Action != "force" {
+			t.Errorf("%s: Expected %s, got %+v", tt.name, tt.expected, last)
+		}
+	}
+}
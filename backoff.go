@@ -18,6 +18,17 @@ type (
 	// that should pass before trying again.
 	Backoff func(min, max time.Duration, attemptNum uint32, resp *http.Response) time.Duration
 
+	// JitterBackoff is a Backoff drawing its jitter from rnd, the retrier
+	// passes it the source set by WithRandSource
+	JitterBackoff func(min, max time.Duration, attemptNum uint32, resp *http.Response, rnd *rand.Rand) time.Duration
+
+	// backoffTable holds the waits of DefaultBackoff between min and max,
+	// computed once for the retries of a retrier
+	backoffTable struct {
+		min, max time.Duration
+		waits    []time.Duration
+	}
+
 	// BackOff is a backoff policy for retrying an operation.
 	BackOff interface {
 		// NextBackOff returns the duration to wait before retrying the operation,
@@ -51,6 +62,87 @@ func DefaultBackoff(min, max time.Duration, attemptNum uint32, resp *http.Respon
 	return sleep
 }
 
+// maxBackoffTable bounds the waits precomputed, the exponential wait
+// overflows well before
+const maxBackoffTable = 64
+
+// newBackoffTable precomputes the waits of DefaultBackoff for up to
+// retryMax retries, the table stops at the first wait reaching max
+func newBackoffTable(min, max time.Duration, retryMax uint32) *backoffTable {
+	t := &backoffTable{min: min, max: max}
+	for attempt := uint32(0); attempt < retryMax && attempt < maxBackoffTable; attempt++ {
+		wait := DefaultBackoff(min, max, attempt, nil)
+		t.waits = append(t.waits, wait)
+		if wait == max {
+			break
+		}
+	}
+	return t
+}
+
+// backoff is DefaultBackoff reading the waits from the table, it computes
+// them when the bounds or the retries went past the table, e.g. reloaded
+func (t *backoffTable) backoff(min, max time.Duration, attemptNum uint32, resp *http.Response) time.Duration {
+	n := uint32(len(t.waits))
+	if min != t.min || max != t.max || n == 0 {
+		return DefaultBackoff(min, max, attemptNum, resp)
+	}
+	if attemptNum < n {
+		return t.waits[attemptNum]
+	}
+	if t.waits[n-1] == max {
+		return max
+	}
+	return DefaultBackoff(min, max, attemptNum, resp)
+}
+
+// WithRandSource sets the source the jittered backoffs draw from, so that a
+// test or a bug report can replay an exact retry schedule. The faults of
+// WithFaultInjection are seeded from it too. The source is seeded from the
+// time by default.
+func WithRandSource(src rand.Source) Option {
+	return func(config *Config) {
+		config.randSource = src
+	}
+}
+
+// WithJitterBackoff sets a jittered backoff in place of DefaultBackoff
+func WithJitterBackoff(backoff JitterBackoff) Option {
+	return func(config *Config) {
+		config.jitterBackoff = backoff
+	}
+}
+
+// ExponentialJitter is DefaultBackoff with full jitter, the wait is drawn
+// between min and the exponential wait.
+func ExponentialJitter(min, max time.Duration, attemptNum uint32, resp *http.Response, rnd *rand.Rand) time.Duration {
+	sleep := DefaultBackoff(min, max, attemptNum, resp)
+	if sleep <= min {
+		return sleep
+	}
+	return min + time.Duration(rnd.Int63n(int64(sleep-min)+1))
+}
+
+// LinearJitter is the JitterBackoff of LinearJitterBackoff
+func LinearJitter(min, max time.Duration, attemptNum uint32, resp *http.Response, rnd *rand.Rand) time.Duration {
+	// attemptNum always starts at zero but we want to start at 1 for multiplication
+	attempt := time.Duration(attemptNum) + 1
+
+	if max <= min {
+		// Unclear what to do here, or they are the same, so return min *
+		// attemptNum
+		return min * attempt
+	}
+
+	// Pick a random number that lies somewhere between the min and max and
+	// multiply by the attemptNum. attemptNum starts at zero so we always
+	// increment here. We first get a random percentage, then apply that to the
+	// difference between min and max, and add to min.
+	jitter := rnd.Float64() * float64(max-min)
+	jitterMin := int64(jitter) + int64(min)
+	return time.Duration(jitterMin) * attempt
+}
+
 // LinearJitterBackoff provides a callback for Client.Backoff which will
 // perform linear backoff based on the attempt number and with jitter to
 // prevent a thundering herd.
@@ -67,24 +159,11 @@ func DefaultBackoff(min, max time.Duration, attemptNum uint32, resp *http.Respon
 // (892ms, 2102ms, 2945ms, 4312ms, ...)
 // * To get extreme jitter, set to a very wide spread, such as a min of 100ms
 // and a max of 20s (15382ms, 292ms, 51321ms, 35234ms, ...)
+//
+// It draws from the time, WithJitterBackoff(LinearJitter) draws from the
+// source of WithRandSource.
 func LinearJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
-	// attemptNum always starts at zero but we want to start at 1 for multiplication
-	attemptNum++
-
-	if max <= min {
-		// Unclear what to do here, or they are the same, so return min *
-		// attemptNum
-		return min * time.Duration(attemptNum)
-	}
-
 	// Seed rnd; doing this every time is fine
 	rnd := rand.New(rand.NewSource(int64(time.Now().Nanosecond())))
-
-	// Pick a random number that lies somewhere between the min and max and
-	// multiply by the attemptNum. attemptNum starts at zero so we always
-	// increment here. We first get a random percentage, then apply that to the
-	// difference between min and max, and add to min.
-	jitter := rnd.Float64() * float64(max-min)
-	jitterMin := int64(jitter) + int64(min)
-	return time.Duration(jitterMin * int64(attemptNum))
+	return LinearJitter(min, max, uint32(attemptNum), resp, rnd)
 }
@@ -0,0 +1,66 @@
+package gcb
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithRandSource(t *testing.T) {
+	schedule := func(seed int64, backoff JitterBackoff) []time.Duration {
+		retrier := NewRetrier(WithRandSource(rand.NewSource(seed)), WithJitterBackoff(backoff))
+		var waits []time.Duration
+		for attempt := uint32(0); attempt < 5; attempt++ {
+			waits = append(waits, retrier.Backoff(time.Second, 30*time.Second, attempt, nil))
+		}
+		return waits
+	}
+
+	for _, backoff := range []JitterBackoff{ExponentialJitter, LinearJitter} {
+		first, again, other := schedule(42, backoff), schedule(42, backoff), schedule(7, backoff)
+		if !reflect.DeepEqual(first, again) {
+			t.Errorf("Expected the same seed to replay %v, got %v", first, again)
+		}
+		if reflect.DeepEqual(first, other) {
+			t.Errorf("Expected another seed to draw another schedule, got %v", other)
+		}
+	}
+}
+
+func TestExponentialJitter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for attempt := uint32(0); attempt < 10; attempt++ {
+		wait := ExponentialJitter(time.Second, 30*time.Second, attempt, nil, rnd)
+		if ceiling := DefaultBackoff(time.Second, 30*time.Second, attempt, nil); wait < time.Second || wait > ceiling {
+			t.Errorf("Expected a wait between %s and %s, got %s", time.Second, ceiling, wait)
+		}
+	}
+}
+
+func TestBackoffTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max time.Duration
+		retryMax uint32
+	}{
+		{"capped", time.Second, 30 * time.Second, 10},
+		{"uncapped", time.Millisecond, time.Hour, 4},
+		{"zero", 0, time.Second, 4},
+		{"none", time.Second, 30 * time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		table := newBackoffTable(tt.min, tt.max, tt.retryMax)
+		// past the table and with other bounds, e.g. reloaded, the waits
+		// are computed
+		for attempt := uint32(0); attempt < 70; attempt++ {
+			for _, bounds := range [][2]time.Duration{{tt.min, tt.max}, {2 * tt.min, tt.max}} {
+				expected := DefaultBackoff(bounds[0], bounds[1], attempt, nil)
+				if wait := table.backoff(bounds[0], bounds[1], attempt, nil); wait != expected {
+					t.Errorf("%s: Expected %v for attempt %d, got %v", tt.name, expected, attempt, wait)
+				}
+			}
+		}
+	}
+}
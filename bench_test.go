@@ -0,0 +1,368 @@
+package gcb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+// The baselines are in testdata/bench/baseline.txt, compare against them with
+//
+//	go test -run '^$' -bench RoundTrip -benchmem -count 5 . > new.txt
+//	benchstat testdata/bench/baseline.txt new.txt
+//
+// The in-memory benchmarks go through a FaultTransport, which records every
+// request, that cost is part of their figures.
+
+// benchTransport returns a transport retrying right away and without limit
+func benchTransport(b *testing.B, opts ...Option) *tripper {
+	b.Helper()
+
+	transport := NewRoundTripper(opts...)
+	retrier := transport.RoundTripper.(*circuit).retrier
+	retrier.Backoff = func(min, max time.Duration, attempt uint32, resp *http.Response) time.Duration {
+		return 0
+	}
+	retrier.Limiter = testutil.AllowAll()
+
+	// the retries are logged
+	out := log.Writer()
+	log.SetOutput(ioutil.Discard)
+	b.Cleanup(func() { log.SetOutput(out) })
+	return transport
+}
+
+// roundTrip sends b.N requests and fails on the unexpected outcomes
+func roundTrip(b *testing.B, transport http.RoundTripper, url string, wantErr bool) {
+	b.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := transport.RoundTrip(req)
+		if (err != nil) != wantErr {
+			b.Fatalf("Unexpected error %v", err)
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+	}
+}
+
+func BenchmarkRoundTrip_Success(b *testing.B) {
+	transport := benchTransport(b, WithTransport(testutil.NewFaultTransport()))
+	roundTrip(b, transport, "http://upstream.example", false)
+}
+
+func BenchmarkRoundTrip_Retried(b *testing.B) {
+	// every other attempt fails
+	var calls int64
+	fault := testutil.NewFaultTransport()
+	transport := benchTransport(b, WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt64(&calls, 1)%2 == 1 {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		}
+		return fault.RoundTrip(req)
+	})))
+	roundTrip(b, transport, "http://upstream.example", false)
+}
+
+func BenchmarkRoundTrip_BreakerOpen(b *testing.B) {
+	transport := benchTransport(b,
+		WithTransport(testutil.NewFaultTransport()),
+		WithReadyToTrip(func(counts Counts) bool { return true }),
+	)
+	trip(transport.RoundTripper.(*circuit).breaker)
+	roundTrip(b, transport, "http://upstream.example", true)
+}
+
+// BenchmarkRoundTrip_Disabled skips the breaker and the retries, what's
+// left is the cost of gcb kept in place
+func BenchmarkRoundTrip_Disabled(b *testing.B) {
+	transport := benchTransport(b,
+		WithTransport(testutil.NewFaultTransport()),
+		WithoutBreaker(),
+		WithoutRetries(),
+		WithoutAttemptContext(),
+	)
+	roundTrip(b, transport, "http://upstream.example", false)
+}
+
+func BenchmarkRoundTrip_Loopback(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	transport := benchTransport(b)
+	roundTrip(b, transport, server.URL, false)
+}
+
+func BenchmarkRoundTrip_LoopbackRetried(b *testing.B) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	transport := benchTransport(b)
+	roundTrip(b, transport, server.URL, false)
+}
+
+// BenchmarkRoundTrip_LoopbackDrain retries responses of every other request
+// with bodies around the drain limit, drained against closed. The new
+// connections per request are the price of closing, with the versions of
+// net/http which don't drain the closed bodies themselves.
+func BenchmarkRoundTrip_LoopbackDrain(b *testing.B) {
+	for _, size := range []int{2 << 10, 64 << 10} {
+		payload := bytes.Repeat([]byte("x"), size)
+		for _, threshold := range []int64{0, 1 << 10} {
+			b.Run(fmt.Sprintf("size-%d-threshold-%d", size, threshold), func(b *testing.B) {
+				var calls, conns int64
+				server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if atomic.AddInt64(&calls, 1)%2 == 1 {
+						w.WriteHeader(http.StatusServiceUnavailable)
+					}
+					_, _ = w.Write(payload)
+				}))
+				server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+					if state == http.StateNew {
+						atomic.AddInt64(&conns, 1)
+					}
+				}
+				server.Start()
+				defer server.Close()
+
+				transport := benchTransport(b, WithDrainThreshold(threshold))
+				roundTrip(b, transport, server.URL, false)
+				b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+			})
+		}
+	}
+}
+
+// BenchmarkRoundTrip_Baseline is the transport alone, the cost of gcb is the
+// difference with BenchmarkRoundTrip_Loopback
+func BenchmarkRoundTrip_Baseline(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	roundTrip(b, http.DefaultTransport, server.URL, false)
+}
+
+// BenchmarkBreaker_Parallel runs the closed state requests from many
+// goroutines, the counts are updated without taking the breaker lock. The
+// coarse clock saves reading the system clock on every request, the striped
+// counts spare the cores updating the same counters.
+func BenchmarkBreaker_Parallel(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"system", nil},
+		{"coarse", []Option{WithCoarseClock(time.Millisecond)}},
+		{"striped", []Option{WithCoarseClock(time.Millisecond), WithStripedCounts(0)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			cb := NewBreaker(bench.opts...)
+			ok := func() (*http.Response, error) { return nil, nil }
+
+			b.SetParallelism(16)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, _ = cb.Execute(ok)
+				}
+			})
+		})
+	}
+}
+
+// benchKeys are the keys of a client talking to hundreds of hosts
+var benchKeys = func() []string {
+	keys := make([]string, 512)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("host-%d.example.com", i)
+	}
+	return keys
+}()
+
+// benchBreakerMap looks the keys up from many goroutines
+func benchBreakerMap(b *testing.B, idleTTL time.Duration, maxEntries int) {
+	m := newBreakerMap(func(key string) *Breaker { return NewBreaker(WithName(key)) })
+	m.idleTTL = idleTTL
+	m.maxEntries = maxEntries
+	for _, key := range benchKeys {
+		m.get(key)
+	}
+
+	var seed int64
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&seed, 1))
+		for pb.Next() {
+			m.get(benchKeys[i%len(benchKeys)])
+			i += 7
+		}
+	})
+}
+
+func BenchmarkBreakerMap_Get(b *testing.B) {
+	benchBreakerMap(b, 0, 0)
+}
+
+func BenchmarkBreakerMap_GetEviction(b *testing.B) {
+	benchBreakerMap(b, time.Hour, 1024)
+}
+
+// BenchmarkReplayBody buffers JSON sized bodies for two attempts, pooled
+// against read into a fresh slice every time
+func BenchmarkReplayBody(b *testing.B) {
+	for _, size := range []int{512, 4 << 10, 32 << 10} {
+		payload := bytes.Repeat([]byte("x"), size)
+		req, _ := http.NewRequest(http.MethodPost, "http://upstream.example", nil)
+
+		b.Run(fmt.Sprintf("pooled-%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req.Body, req.GetBody = ioutil.NopCloser(bytes.NewReader(payload)), nil
+				body, err := newReplayBody(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for attempt := 0; attempt < 2; attempt++ {
+					sent, _ := body.rewind(nil, req, attempt == 0)
+					_, _ = io.Copy(ioutil.Discard, sent.Body)
+					_ = sent.Body.Close()
+				}
+				body.release()
+			}
+		})
+
+		b.Run(fmt.Sprintf("readall-%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req.Body, req.GetBody = ioutil.NopCloser(bytes.NewReader(payload)), nil
+				reader, _, err := getBodyReaderAndContentLength(io.Reader(req.Body))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for attempt := 0; attempt < 2; attempt++ {
+					body, _ := reader()
+					_, _ = io.Copy(ioutil.Discard, body)
+					_ = body.Close()
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRetrier_Wait is a backoff wait on the system clock, the timers
+// are reused
+func BenchmarkRetrier_Wait(b *testing.B) {
+	retrier := NewRetrier()
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = retrier.Wait(ctx, 0)
+	}
+}
+
+// BenchmarkMetrics_Record counts requests from many goroutines, they add to
+// the counters of their processor
+func BenchmarkMetrics_Record(b *testing.B) {
+	m := newMetrics(func(Metrics) {}, time.Second)
+
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.record(nil, nil, false)
+		}
+	})
+}
+
+// BenchmarkCloneRetry clones a request with the usual headers for a retry,
+// afresh against reusing the clone of the previous retry
+func BenchmarkCloneRetry(b *testing.B) {
+	req, _ := http.NewRequest(http.MethodGet, "http://upstream.example/items?page=2", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("User-Agent", "gcb")
+	ctx := req.Context()
+
+	b.Run("clone", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = req.Clone(ctx)
+		}
+	})
+
+	b.Run("reuse", func(b *testing.B) {
+		reuse := cloneRetry(ctx, req, nil)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			reuse = cloneRetry(ctx, req, reuse)
+		}
+	})
+}
+
+// BenchmarkEventQueue_Listen emits events from many goroutines, the queue
+// drops the oldest ones the listener can't keep up with
+func BenchmarkEventQueue_Listen(b *testing.B) {
+	queue := NewEventQueue(func(Event) {}, 1024)
+	defer queue.Close()
+	event := Event{Type: EventStateChange, Name: "payments", From: Close, To: Open}
+
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			queue.Listen(event)
+		}
+	})
+}
+
+// BenchmarkBackoff is the exponential wait of a retry, computed against
+// read from the table of the retrier
+func BenchmarkBackoff(b *testing.B) {
+	table := newBackoffTable(time.Second, 30*time.Second, 4)
+
+	b.Run("computed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = DefaultBackoff(time.Second, 30*time.Second, uint32(i&3), nil)
+		}
+	})
+
+	b.Run("table", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = table.backoff(time.Second, 30*time.Second, uint32(i&3), nil)
+		}
+	})
+}
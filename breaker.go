@@ -1,9 +1,13 @@
 package gcb
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,6 +16,11 @@ var (
 	ErrTooManyRequests = errors.New("too many requests")
 	// ErrOpenState is returned when the CB state is open
 	ErrOpenState = errors.New("circuit breaker is open")
+	// ErrPanicked is matched by the errors returned for contained panics
+	ErrPanicked = errors.New("panic in request")
+
+	// errRequestFailed describes the failures without an error
+	errRequestFailed = errors.New("request failed")
 )
 
 type (
@@ -27,14 +36,49 @@ type (
 		TotalFailures        uint32
 		ConsecutiveSuccesses uint32
 		ConsecutiveFailures  uint32
+		// TotalAbandoned are the requests the caller cancelled, left out of
+		// Requests like the ignored errors
+		TotalAbandoned uint32
 	}
 
 	ReadyToTrip func(counts Counts) bool
 
 	OnStateChange func(name string, from State, to State)
 
+	// IsIgnorable reports whether an error must be left out of the
+	// breaker accounting
+	IsIgnorable func(err error) bool
+
+	// PanicError is returned in place of a panic when panics are contained,
+	// it holds the recovered value and the stack of the panicking goroutine.
+	PanicError struct {
+		Value interface{}
+		Stack []byte
+	}
+
+	// counts are the Counts updated without the lock, a load may interleave
+	// with the updates of concurrent requests
+	counts struct {
+		requests             uint32
+		totalSuccesses       uint32
+		totalFailures        uint32
+		consecutiveSuccesses uint32
+		consecutiveFailures  uint32
+		totalAbandoned       uint32
+		// striped takes the requests and the successes, if enabled
+		striped *stripedCounts
+	}
+
 	// Breaker is a state machine to prevent sending requests that are likely to fail.
 	Breaker struct {
+		// published is the generation and the state, and expiresAt the
+		// expiry of the state in unix nanoseconds, 0 for none. They are
+		// written under the lock and read without it by the closed state
+		// requests and the state reads. They come first to be aligned for
+		// the atomics.
+		published uint64
+		expiresAt int64
+
 		// Name is the name of the CircuitBreaker.
 		name          string
 		// MaxRequests is the maximum number of requests allowed to pass through
@@ -45,6 +89,9 @@ type (
 		// for the CircuitBreaker to clear the internal Counts.
 		// If Interval is 0, the CircuitBreaker doesn't clear internal Counts during the closed state.
 		interval      time.Duration
+		// AlignInterval aligns the intervals to the wall clock and reports
+		// them with EventRollover.
+		alignInterval bool
 		// Timeout is the period of the open state,
 		// after which the state of the CircuitBreaker becomes half-open.
 		// If Timeout is 0, the timeout value of the CircuitBreaker is set to 60 seconds.
@@ -56,18 +103,77 @@ type (
 		readyToTrip   func(counts Counts) bool
 		// OnStateChange is called whenever the state of the CircuitBreaker changes.
 		onStateChange func(name string, from State, to State)
+		// PanicAsError converts panics in the request into errors instead of
+		// causing the panic again.
+		panicAsError bool
+		// IgnoredErrors and IsIgnorable exclude errors from the accounting,
+		// they are neither successes nor failures.
+		// By default context.Canceled and context.DeadlineExceeded are ignored,
+		// those come from the caller and say nothing about the upstream. The
+		// transport timeouts matching them while the caller still waits are
+		// failures nonetheless.
+		ignoredErrors []error
+		ignorable     IsIgnorable
+		// Classifier classifies the outcomes ahead of the ignored errors and
+		// the failure check of the caller.
+		classifier *ErrorClassifier
+		// Prober selects the requests probing the breaker while half-open.
+		prober HalfOpenProber
+		// PeerView and PeerWeight blend the peer observations into the
+		// counts given to ReadyToTrip.
+		peerView   PeerView
+		peerWeight float64
+		// CountsStore aggregates the closed-state counts with the other
+		// instances, ReadyToTrip decides on the aggregate when it's available.
+		countsStore CountsStore
+		// Election restricts the half-open probing to the elected instance,
+		// the others stay open for up to LeaderFallback.
+		election       Election
+		leaderFallback time.Duration
+		// Quorum holds the opening until enough peers see failures too.
+		quorum            Quorum
+		quorumSize        int
+		quorumFailureRate float64
+		// OnEvent is called for every event of the CircuitBreaker.
+		onEvent EventListener
+		// TimerTransitions moves the CircuitBreaker to half-open as soon as
+		// the timeout expires instead of on the next request.
+		timerTransitions bool
+		// Clock tells the time, the system clock by default.
+		clock Clock
+		// lockFree lets the closed state requests and successes skip the
+		// lock, the shared counts store needs every outcome under it
+		lockFree bool
 
 		mutex      sync.Mutex
 		state      State
 		generation uint64
-		counts     Counts
+		counts     counts
 		expiry     time.Time
+		openedAt   time.Time
+		// windowStart is the start of the closed-state interval
+		windowStart time.Time
+		// lastErr is the last failure, reported with the state changes,
+		// and lastTag the tag of its request
+		lastErr error
+		lastTag string
+		// forced is the state the breaker is held in, if not zero
+		forced State
+
+		// remote is set while applying a state learnt from a peer
+		remote bool
+		// stuckGeneration is the last open generation reported as stuck
+		stuckGeneration uint64
+		// latencies are the latencies of the attempts sent by the transport
+		latencies *latencies
+		// stop terminates the background goroutines
+		stop     chan struct{}
+		stopOnce sync.Once
 	}
 )
 
 const (
 	defaultTimeout = time.Duration(60) * time.Second
-	defaultInterval = time.Duration(30) * time.Second
 	defaultMaxRequests = 1
 
 	Close State = iota
@@ -79,7 +185,6 @@ func NewBreaker(opts ...Option) *Breaker {
 	// defaults
 	config := &Config{
 		timeout: defaultTimeout,
-		interval:  defaultInterval,
 		maxRequests: defaultMaxRequests,
 		readyToTrip: defaultReadyToTrip,
 		onStateChange:  defaultOnStateChange,
@@ -91,16 +196,46 @@ func NewBreaker(opts ...Option) *Breaker {
 	}
 
 	cb := &Breaker{
+		name: config.name,
 		timeout: config.timeout,
 		maxRequests: config.maxRequests,
+		interval: config.interval,
+		alignInterval: config.alignInterval,
 
 		readyToTrip: config.readyToTrip,
 		onStateChange: config.onStateChange,
+		panicAsError: config.panicAsError,
+		ignoredErrors: append([]error{context.Canceled, context.DeadlineExceeded}, config.ignoredErrors...),
+		ignorable: config.isIgnorable,
+		classifier: config.errorClassifier,
+		prober: config.halfOpenProber,
+		onEvent: config.onEvent,
+		peerView: config.peerView,
+		peerWeight: config.peerWeight,
+		countsStore: config.countsStore,
+		election: config.election,
+		leaderFallback: config.leaderFallback,
+		quorum: config.quorum,
+		quorumSize: config.quorumSize,
+		quorumFailureRate: config.quorumFailureRate,
+		timerTransitions: config.timerTransitions,
+		clock: breakerClockOf(config),
+		lockFree: config.countsStore == nil,
+		counts: counts{striped: newStripedCounts(config)},
 
 		state: Close,
+		stop: make(chan struct{}),
+		latencies: &latencies{},
+	}
+
+	if cb.maxRequests == 0 {
+		cb.maxRequests = 1
 	}
+	cb.toNewGeneration(cb.clock.Now())
 
-	cb.toNewGeneration(time.Now())
+	if config.watchdogInterval > 0 {
+		go cb.watchdog(config.watchdogInterval, config.watchdogStuckAfter)
+	}
 	return cb
 }
 
@@ -113,6 +248,15 @@ func defaultOnStateChange(name string, from State, to State) {
 	// noop
 }
 
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrPanicked, e.Value)
+}
+
+// Unwrap makes errors.Is(err, ErrPanicked) match any *PanicError.
+func (e *PanicError) Unwrap() error {
+	return ErrPanicked
+}
+
 func (s State) String() string {
 	switch s {
 	case Open:
@@ -125,28 +269,92 @@ func (s State) String() string {
 	return ""
 }
 
-func (c *Counts) onRequest() {
-	c.Requests++
+// MarshalText encodes the state by name
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state encoded by name
+func (s *State) UnmarshalText(text []byte) error {
+	for _, state := range []State{Close, HalfOpen, Open} {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown state %q", text)
+}
+
+// load returns a copy of the counts
+func (c *counts) load() Counts {
+	counts := Counts{
+		Requests:             atomic.LoadUint32(&c.requests),
+		TotalSuccesses:       atomic.LoadUint32(&c.totalSuccesses),
+		TotalFailures:        atomic.LoadUint32(&c.totalFailures),
+		ConsecutiveSuccesses: atomic.LoadUint32(&c.consecutiveSuccesses),
+		ConsecutiveFailures:  atomic.LoadUint32(&c.consecutiveFailures),
+		TotalAbandoned:       atomic.LoadUint32(&c.totalAbandoned),
+	}
+	if c.striped != nil {
+		c.striped.sum(&counts)
+	}
+	return counts
+}
+
+func (c *counts) onRequest() {
+	if c.striped != nil {
+		c.striped.onRequest()
+		return
+	}
+	atomic.AddUint32(&c.requests, 1)
+}
+
+func (c *counts) onSuccess() {
+	if c.striped != nil {
+		c.striped.onSuccess()
+	} else {
+		atomic.AddUint32(&c.totalSuccesses, 1)
+		atomic.AddUint32(&c.consecutiveSuccesses, 1)
+	}
+	// most successes don't break a failure streak, they spare the write
+	// to the shared counts
+	if atomic.LoadUint32(&c.consecutiveFailures) != 0 {
+		atomic.StoreUint32(&c.consecutiveFailures, 0)
+	}
+}
+
+func (c *counts) onFailure() {
+	atomic.AddUint32(&c.totalFailures, 1)
+	atomic.AddUint32(&c.consecutiveFailures, 1)
+	atomic.StoreUint32(&c.consecutiveSuccesses, 0)
+	if c.striped != nil {
+		c.striped.breakStreak()
+	}
 }
 
-func (c *Counts) onSuccess() {
-	c.TotalSuccesses++
-	c.ConsecutiveSuccesses++
-	c.ConsecutiveFailures = 0
+func (c *counts) onIgnore() {
+	if c.striped != nil {
+		c.striped.onIgnore()
+		return
+	}
+	atomic.AddUint32(&c.requests, ^uint32(0))
 }
 
-func (c *Counts) onFailure() {
-	c.TotalFailures++
-	c.ConsecutiveFailures++
-	c.ConsecutiveSuccesses = 0
+func (c *counts) onAbandon() {
+	c.onIgnore()
+	atomic.AddUint32(&c.totalAbandoned, 1)
 }
 
-func (c *Counts) clear() {
-	c.Requests = 0
-	c.TotalSuccesses = 0
-	c.TotalFailures = 0
-	c.ConsecutiveSuccesses = 0
-	c.ConsecutiveFailures = 0
+func (c *counts) clear() {
+	atomic.StoreUint32(&c.requests, 0)
+	atomic.StoreUint32(&c.totalSuccesses, 0)
+	atomic.StoreUint32(&c.totalFailures, 0)
+	atomic.StoreUint32(&c.consecutiveSuccesses, 0)
+	atomic.StoreUint32(&c.consecutiveFailures, 0)
+	atomic.StoreUint32(&c.totalAbandoned, 0)
+	if c.striped != nil {
+		c.striped.clear()
+	}
 }
 
 
@@ -154,9 +362,28 @@ func (c *Counts) clear() {
 // Execute returns an error instantly if the CircuitBreaker rejects the request.
 // Otherwise, Execute returns the result of the request.
 // If a panic occurs in the request, the CircuitBreaker handles it as an error
-// and causes the same panic again.
+// and causes the same panic again, unless panics are contained in which case
+// the panic is returned as a *PanicError.
 func (cb *Breaker) Execute(req func() (*http.Response, error)) (*http.Response, error) {
-	generation, err := cb.beforeRequest()
+	return cb.execute(req, hasFailed)
+}
+
+// hasFailed tells the failures of Execute, the requests ending in an error
+func hasFailed(resp *http.Response, err error) bool {
+	return err != nil
+}
+
+// execute is like Execute, with failed telling the failures apart
+func (cb *Breaker) execute(req func() (*http.Response, error), failed func(*http.Response, error) bool) (*http.Response, error) {
+	return cb.executeFor(nil, "", req, failed)
+}
+
+// executeFor is like execute for the request r, which the prober of the
+// breaker may turn away while half-open, nil when unknown. tag is the tag of
+// the request, see ContextWithTag, the state change caused by its failure
+// carries it.
+func (cb *Breaker) executeFor(r *http.Request, tag string, req func() (*http.Response, error), failed func(*http.Response, error) bool) (result *http.Response, err error) {
+	generation, err := cb.beforeRequest(r)
 	if err != nil {
 		return nil, err
 	}
@@ -164,25 +391,178 @@ func (cb *Breaker) Execute(req func() (*http.Response, error)) (*http.Response,
 	defer func() {
 		e := recover()
 		if e != nil {
-			cb.afterRequest(generation, false)
-			panic(e)
+			panicErr := &PanicError{Value: e, Stack: debug.Stack()}
+			cb.afterTaggedRequest(generation, panicErr, tag)
+			if !cb.panicAsError {
+				panic(e)
+			}
+			result, err = nil, panicErr
 		}
 	}()
 
-	result, err := req()
-	cb.afterRequest(generation, err == nil)
+	result, err = req()
+	// the caller gave up, the upstream didn't fail
+	if abandoned(r, err) {
+		cb.abandonRequest(generation)
+		return result, err
+	}
+	if class, ok := classify(cb.classifier, result, err); ok {
+		switch {
+		case class == ClassIgnore || class == ClassThrottle:
+			cb.ignoreRequest(generation)
+		case class.failed():
+			cb.afterTaggedRequest(generation, failureError(result, err), tag)
+		default:
+			cb.afterTaggedRequest(generation, nil, tag)
+		}
+		return result, err
+	}
+	if err != nil && cb.isIgnorable(err) {
+		cb.ignoreRequest(generation)
+		return result, err
+	}
+	var failure error
+	if failed(result, err) {
+		failure = failureError(result, err)
+	}
+	cb.afterTaggedRequest(generation, failure, tag)
 	return result, err
 }
 
-func (cb *Breaker) beforeRequest() (uint64, error) {
+// failureError describes a failed request
+func failureError(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		return fmt.Errorf("%w: status code %d", errRequestFailed, resp.StatusCode)
+	}
+	return errRequestFailed
+}
+
+// isIgnorable reports whether the error is excluded from the accounting, the
+// proxy failures are left to the breakers of the proxies
+func (cb *Breaker) isIgnorable(err error) bool {
+	var proxyErr *ProxyError
+	if errors.As(err, &proxyErr) {
+		return true
+	}
+	var timeoutErr *upstreamTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return false
+	}
+	for _, ignored := range cb.ignoredErrors {
+		if errors.Is(err, ignored) {
+			return true
+		}
+	}
+	return cb.ignorable != nil && cb.ignorable(err)
+}
+
+// ignoreRequest takes the request back out of the counts, so it doesn't
+// hold a half-open slot either
+func (cb *Breaker) ignoreRequest(before uint64) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	_, generation := cb.currentState(cb.clock.Now())
+	if generation != before {
+		return
+	}
+	cb.counts.onIgnore()
+}
+
+// abandonRequest leaves a request the caller cancelled out of the accounting
+// of the generation it started in, and counts it as abandoned
+func (cb *Breaker) abandonRequest(before uint64) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	_, generation := cb.currentState(cb.clock.Now())
+	if generation != before {
+		return
+	}
+	cb.counts.onAbandon()
+}
+
+// Name returns the name of the Breaker.
+func (cb *Breaker) Name() string {
+	return cb.name
+}
+
+// Counts returns a copy of the internal counts of the current generation.
+func (cb *Breaker) Counts() Counts {
+	return cb.counts.load()
+}
+
+// State returns the current state of the Breaker.
+func (cb *Breaker) State() State {
+	if state, ok := cb.publishedState(); ok {
+		return state
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	state, _ := cb.currentState(cb.clock.Now())
+	return state
+}
+
+// openFor opens the breaker for exactly d, instead of the configured timeout
+func (cb *Breaker) openFor(d time.Duration, now time.Time) {
+	cb.openUntil(now.Add(d), now, false)
+}
+
+// openUntil opens the breaker until the given time, remote tells the
+// opening was learnt from a peer
+func (cb *Breaker) openUntil(until time.Time, now time.Time, remote bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if !until.After(now) {
+		return
+	}
+
+	cb.remote = remote
+	cb.setState(Open, now)
+	cb.remote = false
+
+	cb.expiry = until
+	cb.publish()
+	if cb.timerTransitions {
+		cb.scheduleTransition()
+	}
+}
+
+// snapshot returns the current state and counts
+func (cb *Breaker) snapshot() (State, Counts) {
+	return cb.State(), cb.counts.load()
+}
+
+// stateExpiry returns the current state and when it expires
+func (cb *Breaker) stateExpiry() (State, time.Time) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	state, generation := cb.currentState(time.Now())
+	state, _ := cb.currentState(cb.clock.Now())
+	return state, cb.expiry
+}
+
+func (cb *Breaker) beforeRequest(r *http.Request) (uint64, error) {
+	if generation, ok := cb.closedGeneration(); ok {
+		cb.counts.onRequest()
+		return generation, nil
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := cb.clock.Now()
+	state, generation := cb.currentState(now)
 
 	if state == Open {
-		return generation, ErrOpenState
-	} else if state == HalfOpen && cb.counts.Requests >= cb.maxRequests {
+		return generation, cb.newBreakerOpenError(now)
+	} else if state == HalfOpen && (cb.counts.load().Requests >= cb.maxRequests || !cb.mayProbe(r)) {
 		return generation, ErrTooManyRequests
 	}
 
@@ -190,23 +570,79 @@ func (cb *Breaker) beforeRequest() (uint64, error) {
 	return generation, nil
 }
 
-func (cb *Breaker) afterRequest(before uint64, success bool) {
+// afterRequest records the outcome of the request, a nil failure is a success
+func (cb *Breaker) afterRequest(before uint64, failure error) {
+	cb.afterTaggedRequest(before, failure, "")
+}
+
+// afterTaggedRequest is afterRequest for a tagged request
+func (cb *Breaker) afterTaggedRequest(before uint64, failure error, tag string) {
+	if failure == nil {
+		if generation, ok := cb.closedGeneration(); ok && generation == before {
+			cb.counts.onSuccess()
+			return
+		}
+	}
+
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	now := time.Now()
+	now := cb.clock.Now()
 	state, generation := cb.currentState(now)
 	if generation != before {
 		return
 	}
 
-	if success {
+	if failure != nil {
+		cb.lastErr, cb.lastTag = failure, tag
+	}
+	if failure == nil {
 		cb.onSuccess(state, now)
 	} else {
 		cb.onFailure(state, now)
 	}
 }
 
+// closedGeneration returns the generation without locking when the breaker
+// is closed and its counts aren't due to be cleared, the rest goes through
+// the lock. A request racing with a transition may be counted in the next
+// generation.
+func (cb *Breaker) closedGeneration() (uint64, bool) {
+	if !cb.lockFree {
+		return 0, false
+	}
+	published := atomic.LoadUint64(&cb.published)
+	if State(published&0xff) != Close {
+		return 0, false
+	}
+	if until := atomic.LoadInt64(&cb.expiresAt); until != 0 && cb.clock.Now().UnixNano() > until {
+		return 0, false
+	}
+	return published >> 8, true
+}
+
+// publishedState returns the state without locking, false when the open
+// state expired and the breaker has to be looked at under the lock. The
+// other states don't change with time.
+func (cb *Breaker) publishedState() (State, bool) {
+	state := State(atomic.LoadUint64(&cb.published) & 0xff)
+	if state != Open {
+		return state, true
+	}
+	return state, cb.clock.Now().UnixNano() <= atomic.LoadInt64(&cb.expiresAt)
+}
+
+// publish makes the generation, the state and its expiry visible to the
+// reads without the lock, the breaker must be locked
+func (cb *Breaker) publish() {
+	var until int64
+	if !cb.expiry.IsZero() {
+		until = cb.expiry.UnixNano()
+	}
+	atomic.StoreInt64(&cb.expiresAt, until)
+	atomic.StoreUint64(&cb.published, cb.generation<<8|uint64(uint8(cb.state)))
+}
+
 func (cb *Breaker) toNewGeneration(now time.Time) {
 	cb.generation++
 	cb.counts.clear()
@@ -214,26 +650,42 @@ func (cb *Breaker) toNewGeneration(now time.Time) {
 	var zero time.Time
 	switch cb.state {
 	case Close:
+		cb.windowStart = now
 		if cb.interval == 0 {
 			cb.expiry = zero
 		} else {
-			cb.expiry = now.Add(cb.interval)
+			if cb.alignInterval {
+				cb.windowStart = now.Truncate(cb.interval)
+			}
+			cb.expiry = cb.windowStart.Add(cb.interval)
 		}
 	case Open:
 		cb.expiry = now.Add(cb.timeout)
 	default: // StateHalfOpen
 		cb.expiry = zero
 	}
+	cb.publish()
 }
 
 func (cb *Breaker) currentState(now time.Time) (State, uint64) {
 	switch cb.state {
 	case Close:
 		if !cb.expiry.IsZero() && cb.expiry.Before(now) {
+			if cb.alignInterval {
+				cb.emit(Event{Type: EventRollover, From: Close, To: Close, Counts: cb.counts.load(), Duration: cb.interval, Window: cb.windowStart}, now)
+			}
 			cb.toNewGeneration(now)
 		}
 	case Open:
 		if cb.expiry.Before(now) {
+			if cb.leaderHolds(now) {
+				cb.expiry = now.Add(cb.timeout)
+				cb.publish()
+				if cb.timerTransitions {
+					cb.scheduleTransition()
+				}
+				break
+			}
 			cb.setState(HalfOpen, now)
 		}
 	}
@@ -241,27 +693,46 @@ func (cb *Breaker) currentState(now time.Time) (State, uint64) {
 }
 
 func (cb *Breaker) setState(state State, now time.Time) {
-	if cb.state == state {
+	if cb.state == state || (cb.forced != 0 && cb.forced != state) {
 		return
 	}
 
 	prev := cb.state
 	cb.state = state
 
+	counts := cb.counts.load()
 	cb.toNewGeneration(now)
+	if state == Close && cb.countsStore != nil {
+		cb.countsStore.Reset(cb.name)
+	}
+
+	since := cb.openedAt
+	if state == Open {
+		cb.openedAt = now
+		if cb.timerTransitions {
+			cb.scheduleTransition()
+		}
+	}
 
 	if cb.onStateChange != nil {
 		cb.onStateChange(cb.name, prev, state)
 	}
+
+	event := Event{Type: EventStateChange, From: prev, To: state, Counts: counts, Err: cb.lastErr, Tag: cb.lastTag}
+	if prev == Open {
+		event.Duration = now.Sub(since)
+	}
+	cb.emit(event, now)
 }
 
 func (cb *Breaker) onSuccess(state State, now time.Time) {
 	switch state {
 	case Close:
 		cb.counts.onSuccess()
+		cb.record(true)
 	case HalfOpen:
 		cb.counts.onSuccess()
-		if cb.counts.ConsecutiveSuccesses >= cb.maxRequests {
+		if cb.counts.load().ConsecutiveSuccesses >= cb.maxRequests {
 			cb.setState(Close, now)
 		}
 	}
@@ -271,7 +742,8 @@ func (cb *Breaker) onFailure(state State, now time.Time) {
 	switch state {
 	case Close:
 		cb.counts.onFailure()
-		if cb.readyToTrip(cb.counts) {
+		cb.record(false)
+		if cb.readyToTrip(cb.tripCounts()) && cb.quorumAgrees() {
 			cb.setState(Open, now)
 		}
 	case HalfOpen:
@@ -0,0 +1,114 @@
+package gcb
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	defaultPublishTimeout = 5 * time.Second
+)
+
+type (
+	// StateMessage tells the peers that a breaker opened, or closed after
+	// the probing of the leader
+	StateMessage struct {
+		// Origin identifies the instance whose breaker changed
+		Origin string `json:"origin"`
+		// Name is the name of the breaker, the key with per-key breakers
+		Name  string    `json:"name"`
+		State State     `json:"state"`
+		Until time.Time `json:"until"`
+	}
+
+	// PubSub carries the state messages between instances. Adapters for
+	// NATS and Redis live in the pubsub subpackages.
+	PubSub interface {
+		// Publish sends the message to every subscribed instance
+		Publish(ctx context.Context, data []byte) error
+		// Subscribe calls handler for every message received, until ctx is
+		// done. It returns once the subscription is established.
+		Subscribe(ctx context.Context, handler func(data []byte)) error
+	}
+
+	// broadcaster opens the breakers of the peers when a local breaker opens,
+	// and the local breakers when a peer's opens. With a probe leader, the
+	// closings are shared as well.
+	broadcaster struct {
+		pubsub PubSub
+		origin string
+		logger *logger
+		health *health
+	}
+)
+
+// WithPubSub shares the opening of the breakers with the peers, so they can
+// open theirs before they learn about the outage the hard way. origin must
+// uniquely identify this instance.
+func WithPubSub(pubsub PubSub, origin string) Option {
+	return func(config *Config) {
+		config.pubsub = pubsub
+		config.pubsubOrigin = origin
+	}
+}
+
+// publish sends the state of the breaker to the peers, it must be called
+// after the breaker lock is released
+func (b *broadcaster) publish(cb *Breaker) {
+	state, until := cb.stateExpiry()
+	if state == HalfOpen {
+		return
+	}
+
+	data, err := json.Marshal(StateMessage{
+		Origin: b.origin,
+		Name:   cb.Name(),
+		State:  state,
+		Until:  until,
+	})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+	if err := b.pubsub.Publish(ctx, data); err != nil {
+		atomic.AddUint64(&b.health.publishErrors, 1)
+		if b.logger.enabled(LevelError) {
+			b.logger.Printf("[ERR] error publishing breaker state: %v", err)
+		}
+	}
+}
+
+// subscribe opens the local breakers the peers tell about, and closes them
+// when following a probe leader
+func (b *broadcaster) subscribe(ctx context.Context, c *circuit) {
+	err := b.pubsub.Subscribe(ctx, func(data []byte) {
+		var msg StateMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Origin == b.origin {
+			return
+		}
+		if msg.State != Open && (msg.State != Close || c.breaker.election == nil) {
+			return
+		}
+
+		cb, ok := c.breakerNamed(msg.Name)
+		if !ok && c.breakers != nil && msg.State == Open {
+			// a key with no request here yet is opened ahead of its first
+			cb, ok = c.breakers.get(msg.Name), true
+		}
+		if !ok {
+			return
+		}
+		if msg.State == Close {
+			cb.closeFrom(cb.clock.Now())
+			return
+		}
+		cb.openUntil(msg.Until, cb.clock.Now(), true)
+	})
+	if err != nil && b.logger.enabled(LevelError) {
+		b.logger.Printf("[ERR] error subscribing to breaker states: %v", err)
+	}
+}
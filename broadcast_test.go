@@ -0,0 +1,93 @@
+package gcb
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memPubSub is an in-process PubSub
+type memPubSub struct {
+	mu       sync.Mutex
+	handlers []func([]byte)
+}
+
+func (ps *memPubSub) Publish(ctx context.Context, data []byte) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, handler := range ps.handlers {
+		handler(data)
+	}
+	return nil
+}
+
+func (ps *memPubSub) Subscribe(ctx context.Context, handler func([]byte)) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.handlers = append(ps.handlers, handler)
+	return nil
+}
+
+func TestBroadcast_OpensPeerBreakers(t *testing.T) {
+	ps := &memPubSub{}
+	opts := []Option{WithPerKeyBreakers(), WithReadyToTrip(func(counts Counts) bool { return true })}
+	local := newCircuitBreaker(append(opts, WithPubSub(ps, "local"))...)
+	peer := newCircuitBreaker(append(opts, WithPubSub(ps, "peer"))...)
+
+	trip(local.breakers.get("api.example.com"))
+
+	deadline := time.Now().Add(time.Second)
+	for peer.breakers.get("api.example.com").State() != Open {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the peer breaker to open")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if state := peer.breakers.get("other.example.com").State(); state != Close {
+		t.Errorf("Expected other keys to stay closed, got %s", state)
+	}
+}
+
+// electionFunc is an Election deciding with a function
+type electionFunc func(name string) bool
+
+func (f electionFunc) IsLeader(name string) bool {
+	return f(name)
+}
+
+func TestBroadcast_ProbeLeader(t *testing.T) {
+	ps := &memPubSub{}
+	opts := []Option{WithTimeout(10 * time.Millisecond), WithReadyToTrip(func(counts Counts) bool { return true })}
+	leader := newCircuitBreaker(append(opts,
+		WithPubSub(ps, "leader"),
+		WithProbeLeader(electionFunc(func(string) bool { return true }), 0))...)
+	follower := newCircuitBreaker(append(opts,
+		WithPubSub(ps, "follower"),
+		WithProbeLeader(electionFunc(func(string) bool { return false }), 0))...)
+
+	trip(leader.breaker)
+	trip(follower.breaker)
+	time.Sleep(20 * time.Millisecond)
+
+	if state := leader.breaker.State(); state != HalfOpen {
+		t.Errorf("Expected the leader to probe, got %s", state)
+	}
+	if state := follower.breaker.State(); state != Open {
+		t.Errorf("Expected the follower to stay open, got %s", state)
+	}
+
+	_, _ = leader.breaker.Execute(func() (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for follower.breaker.State() != Close {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the follower to close after the leader")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,77 @@
+package gcb
+
+import (
+	"path"
+)
+
+type (
+	// BreakerRef names a breaker of a registered transport
+	BreakerRef struct {
+		Transport string `json:"transport"`
+		Breaker   string `json:"breaker"`
+	}
+)
+
+// ResetAll releases and clears every breaker of every transport, and
+// returns them
+func (r *Registry) ResetAll() []BreakerRef {
+	var refs []BreakerRef
+	r.each(func(name string, transport AdminTarget) {
+		for _, summary := range transport.Summaries() {
+			transport.ResetBreaker(summary.Name)
+			refs = append(refs, BreakerRef{Transport: name, Breaker: summary.Name})
+		}
+	})
+	return refs
+}
+
+// ForceOpen holds open every breaker whose name matches the pattern, in
+// every transport, and returns them. The pattern follows path.Match, e.g.
+// "*.vendor.example" for the per-key breakers of a vendor. The per-key
+// breakers created afterwards aren't forced. They're released with
+// ForceState and the zero State, or ResetAll.
+func (r *Registry) ForceOpen(pattern string) ([]BreakerRef, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var refs []BreakerRef
+	r.each(func(name string, transport AdminTarget) {
+		for _, summary := range transport.Summaries() {
+			if matched, _ := path.Match(pattern, summary.Name); matched {
+				transport.ForceState(summary.Name, Open)
+				refs = append(refs, BreakerRef{Transport: name, Breaker: summary.Name})
+			}
+		}
+	})
+	return refs, nil
+}
+
+// Patch reloads the options into every transport whose name matches the
+// pattern, as Reload does, and returns their names. The pattern follows
+// path.Match, e.g. Patch("vendor-*", WithMaxRetries(0)) stops retrying
+// against a vendor.
+func (r *Registry) Patch(pattern string, opts ...Option) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	r.each(func(name string, transport AdminTarget) {
+		if matched, _ := path.Match(pattern, name); matched {
+			transport.Reload(opts...)
+			names = append(names, name)
+		}
+	})
+	return names, nil
+}
+
+// each calls fn with every transport, in the order of their names, without
+// holding the lock
+func (r *Registry) each(fn func(name string, transport AdminTarget)) {
+	for _, name := range r.names() {
+		if transport, ok := r.lookup(name); ok {
+			fn(name, transport)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package gcb
+
+import (
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Bulk(t *testing.T) {
+	registry := NewRegistry()
+	vendor := NewRoundTripper(WithPerKeyBreakers())
+	search := NewRoundTripper(WithPerKeyBreakers())
+	registry.Register("vendor-x", vendor)
+	registry.Register("search", search)
+	for _, key := range []string{"eu.vendor.example", "us.vendor.example", "other.example"} {
+		vendor.RoundTripper.(*circuit).breakers.get(key)
+	}
+	search.RoundTripper.(*circuit).breakers.get("us.vendor.example")
+
+	refs, err := registry.ForceOpen("*.vendor.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BreakerRef{
+		{"search", "us.vendor.example"},
+		{"vendor-x", "eu.vendor.example"},
+		{"vendor-x", "us.vendor.example"},
+	}
+	if !reflect.DeepEqual(sortedRefs(refs), want) {
+		t.Errorf("Expected %v, got %v", want, refs)
+	}
+	for _, summary := range vendor.Summaries() {
+		if open := summary.State == Open; open != (summary.Name != "other.example") {
+			t.Errorf("%s: Expected open %v, got %v", summary.Name, !open, summary.State)
+		}
+	}
+
+	if refs := registry.ResetAll(); len(refs) != 4 {
+		t.Errorf("Expected %d, got %d", 4, len(refs))
+	}
+	for _, transport := range []*tripper{vendor, search} {
+		for _, summary := range transport.Summaries() {
+			if summary.State != Close {
+				t.Errorf("%s: Expected %s, got %s", summary.Name, Close, summary.State)
+			}
+		}
+	}
+
+	names, err := registry.Patch("vendor-*", WithMaxRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"vendor-x"}) {
+		t.Errorf("Expected %v, got %v", []string{"vendor-x"}, names)
+	}
+	if retryMax, _ := vendor.RoundTripper.(*circuit).retrier.policy(time.Now()); retryMax != 0 {
+		t.Errorf("Expected %d, got %d", 0, retryMax)
+	}
+	if retryMax, _ := search.RoundTripper.(*circuit).retrier.policy(time.Now()); retryMax != defaultRetryMax {
+		t.Errorf("Expected %d, got %d", defaultRetryMax, retryMax)
+	}
+
+	if _, err := registry.ForceOpen("["); err != path.ErrBadPattern {
+		t.Errorf("Expected %v, got %v", path.ErrBadPattern, err)
+	}
+	if _, err := registry.Patch("["); err != path.ErrBadPattern {
+		t.Errorf("Expected %v, got %v", path.ErrBadPattern, err)
+	}
+}
+
+// sortedRefs sorts the refs by transport then breaker, the per-key
+// breakers are listed in no particular order
+func sortedRefs(refs []BreakerRef) []BreakerRef {
+	sorted := append([]BreakerRef{}, refs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Transport != sorted[j].Transport {
+			return sorted[i].Transport < sorted[j].Transport
+		}
+		return sorted[i].Breaker < sorted[j].Breaker
+	})
+	return sorted
+}
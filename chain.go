@@ -0,0 +1,144 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+var (
+	// makes sure the chain implements the round tripper interface
+	_ http.RoundTripper = (*Chain)(nil)
+
+	// ErrChainExhausted is returned when no link of the chain could serve the request
+	ErrChainExhausted = errors.New("all links of the chain failed")
+)
+
+type (
+	// Link is one hop of a Chain. Each link owns an independent circuit
+	// configured by its options.
+	Link struct {
+		// Name identifies the link, it's used as the breaker name
+		Name string
+		// Target is the base URL requests are rebased onto. If Target is
+		// nil the request URL is used as is.
+		Target *url.URL
+		// Options configure the retrier and breaker of the link
+		Options []Option
+	}
+
+	// LinkStats holds the stats of a single link
+	LinkStats struct {
+		Name   string
+		State  State
+		Counts Counts
+		// Served is the number of requests answered by this link
+		Served uint64
+		// Skipped is the number of requests this link couldn't serve
+		Skipped uint64
+	}
+
+	// ChainStats holds the stats of every link and their merged counts,
+	// consecutive counts are only meaningful per link and aren't merged
+	ChainStats struct {
+		Links  []LinkStats
+		Counts Counts
+	}
+
+	// Chain is a transport that degrades through an ordered list of links,
+	// e.g. CDN -> origin. The next link is tried only when the breaker of
+	// the previous link rejects the request or its attempt fails without
+	// a response.
+	Chain struct {
+		links []*chainLink
+	}
+
+	chainLink struct {
+		// accessed atomically, kept first for alignment
+		served  uint64
+		skipped uint64
+
+		Link
+		circuit *circuit
+	}
+)
+
+// NewChain creates a transport trying the links in the given order.
+func NewChain(links ...Link) *Chain {
+	chain := &Chain{}
+	for _, link := range links {
+		opts := append([]Option{WithName(link.Name)}, link.Options...)
+		chain.links = append(chain.links, &chainLink{
+			Link:    link,
+			circuit: newCircuitBreaker(opts...),
+		})
+	}
+	return chain
+}
+
+// RoundTrip sends the request through the first link able to serve it.
+// Requests with a body are only passed on to the next link when the body
+// can be replayed.
+func (c *Chain) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := ErrChainExhausted
+	consumed := false
+	for i, link := range c.links {
+		linkReq := link.newRequest(req)
+
+		// the last link, or any link when the body can't be replayed,
+		// consumes the original body
+		last := i == len(c.links)-1
+		if last || copyBody(linkReq, req) != nil {
+			linkReq.Body = req.Body
+			consumed, last = true, true
+		}
+
+		var resp *http.Response
+		resp, err = link.circuit.RoundTrip(linkReq)
+		if err == nil {
+			atomic.AddUint64(&link.served, 1)
+		} else {
+			atomic.AddUint64(&link.skipped, 1)
+		}
+
+		if err == nil || last {
+			if !consumed && req.Body != nil {
+				_ = req.Body.Close()
+			}
+			return resp, err
+		}
+	}
+	return nil, err
+}
+
+// newRequest clones the request and rebases it onto the link target
+func (l *chainLink) newRequest(req *http.Request) *http.Request {
+	linkReq := req.Clone(req.Context())
+	if l.Target != nil {
+		u := rebaseURL(req.URL, l.Target)
+		linkReq.URL = &u
+		linkReq.Host = ""
+	}
+	return linkReq
+}
+
+// Stats returns the stats of every link, with their counts merged
+func (c *Chain) Stats() ChainStats {
+	var stats ChainStats
+	for _, link := range c.links {
+		counts := link.circuit.breaker.Counts()
+		stats.Links = append(stats.Links, LinkStats{
+			Name:    link.Name,
+			State:   link.circuit.breaker.State(),
+			Counts:  counts,
+			Served:  atomic.LoadUint64(&link.served),
+			Skipped: atomic.LoadUint64(&link.skipped),
+		})
+
+		stats.Counts.Requests += counts.Requests
+		stats.Counts.TotalSuccesses += counts.TotalSuccesses
+		stats.Counts.TotalFailures += counts.TotalFailures
+	}
+	return stats
+}
@@ -0,0 +1,51 @@
+package gcb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestChain_FallsThroughOnHardFailure(t *testing.T) {
+	// the first link points at a server that's gone
+	deadURL, _, deadTeardown := testutil.ServerMock()
+	deadTeardown()
+
+	baseURL, mux, teardown := testutil.ServerMock()
+	defer teardown()
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Write(body)
+	}))
+
+	dead, _ := url.Parse(deadURL)
+	origin, _ := url.Parse(baseURL)
+	chain := NewChain(
+		Link{Name: "cdn", Target: dead, Options: []Option{WithMaxRetries(0)}},
+		Link{Name: "origin", Target: origin, Options: []Option{WithMaxRetries(0)}},
+	)
+	client := http.Client{Transport: chain}
+
+	resp, err := client.Post("http://example.invalid/", "text/plain", strings.NewReader("Hello Server!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "Hello Server!" {
+		t.Errorf("Expected the body to be replayed, got %q", body)
+	}
+
+	stats := chain.Stats()
+	if stats.Links[0].Skipped != 1 || stats.Links[1].Served != 1 {
+		t.Errorf("Unexpected chain stats %+v", stats)
+	}
+	if stats.Counts.Requests != 2 || stats.Counts.TotalFailures != 1 {
+		t.Errorf("Unexpected merged counts %+v", stats.Counts)
+	}
+}
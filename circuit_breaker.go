@@ -2,12 +2,15 @@ package gcb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,18 +21,24 @@ var (
 	// limit the size we consume to respReadLimit.
 	respReadLimit = int64(4096)
 
-	rateLimitExceeded = errors.New("exceeded rate limit")
+	// ErrNoResponse is returned when the underlying transport returned
+	// neither a response nor an error
+	ErrNoResponse = errors.New("transport returned no response")
+
+	errBodyNotReplayable = errors.New("request body cannot be replayed")
 )
 
 type (
-	// TODO: can be removed?
 	// ErrorHandler is called if shouldRetry are expired, containing the last status
-	// from the http library. If not specified, default behavior for the library is
-	// to close the body and return an error indicating how many tries were
-	// attempted. If overriding this, be sure to close the body if needed.
+	// from the http library.
+	//
+	// Deprecated: the transport never called it, the last response or error
+	// is returned as is. Use WithIsIgnorable or WithReadyToTrip to decide
+	// what the breaker counts.
 	ErrorHandler func(resp *http.Response, err error, numTries int) (*http.Response, error)
 
-	// ReaderFunc is the type of function that can be given natively to newRequest
+	// ReaderFunc returns a fresh reader over a request body, it is how the
+	// bodies are replayed between the retries
 	ReaderFunc func() (io.ReadCloser, error)
 
 	// LenReader is an interface implemented by many in-memory io.Reader's. Used
@@ -39,6 +48,9 @@ type (
 	}
 
 	// Request wraps the metadata needed to create HTTP requests.
+	//
+	// Deprecated: the transport takes plain *http.Request values and replays
+	// their bodies through GetBody, nothing accepts a Request.
 	Request struct {
 		// body is a seekable reader over the request body payload. This is
 		// used to rewind the request data in between shouldRetry.
@@ -52,87 +64,335 @@ type (
 	circuit struct {
 		retrier *Retrier
 		breaker *Breaker
+		// breakers holds the per-key breakers, if enabled
+		breakers *breakerMap
 
 		RoundTripper http.RoundTripper
 
-		// ErrorHandler specifies the custom error handler to use, if any
-		ErrorHandler ErrorHandler
+		// queue holds deferrable requests for background delivery, if enabled
+		queue *offlineQueue
+		// shadow mirrors part of the traffic to a secondary backend, if enabled
+		shadow *shadow
+		// throttle drops requests ahead of the breaker, if enabled
+		throttle *throttle
+		// metrics batches the request counters for the listener, if enabled
+		metrics *metrics
+
+		// keyFunc maps requests to their upstream key
+		keyFunc     KeyFunc
+		maintenance *maintenance
+
+		// maxResponseBytes limits the response body size, if positive
+		maxResponseBytes int64
+		// drainThreshold is the Content-Length above which the retried
+		// responses are closed without draining, if positive
+		drainThreshold int64
+		// openOnRetryAfter opens the breaker on 503 with Retry-After
+		openOnRetryAfter bool
+		// openStateResponse answers 503 instead of ErrOpenState
+		openStateResponse bool
+		// maxRedirects are the redirects followed by the transport, if any
+		maxRedirects int
+		// idler closes the idle connections of the transport, after the
+		// connection failures and when a breaker opens if enabled
+		idler         closeIdler
+		redialOnRetry bool
+		flushOnOpen   bool
+		// throttlingCodes turn the 4xx responses carrying them into 429
+		throttlingCodes [][]byte
+		// noAttemptContext sends the requests without the attempt context
+		noAttemptContext bool
+		// noBreaker and noRetries skip the breakers and the retry loop
+		noBreaker bool
+		noRetries bool
+		logger    *logger
+		// proxy returns the proxy of a request and proxyBreakers hold the
+		// breakers of the proxies, if enabled
+		proxy         func(*http.Request) (*url.URL, error)
+		proxyBreakers *breakerMap
+		// warmUp sends warm-up requests after an outage, if enabled
+		warmUp *warmUp
+		// idleProbe probes the idle upstreams, if enabled
+		idleProbe *idleProbe
+		// halfOpenProbe builds the synthetic probes of the half-open
+		// breakers, if enabled, and probing holds the breakers with a
+		// probe in flight
+		halfOpenProbe ProbeFunc
+		probing       sync.Map
+		// hedging hedges the slow attempts, if enabled
+		hedging *hedging
+		// cookies carries the cookies of the attempts to the retries, if
+		// enabled
+		cookies *cookieJar
+		// drain tracks the requests in flight for Shutdown, stopOnce stops
+		// the background work once
+		drain    *drainer
+		stopOnce sync.Once
+		// connTrace traces the connections of the attempts
+		connTrace bool
+		// broadcaster shares the breaker openings with the peers, if enabled
+		broadcaster *broadcaster
+
+		// audit records the manual interventions
+		audit *auditLog
+		// health counts the failures of the layer itself, eventQueue is the
+		// queue of the events whose drops it reports, if set
+		health     *health
+		eventQueue *EventQueue
+		// tags counts the tagged requests
+		tags *tagStats
+
+		// reloaded are the options reloaded at runtime, for the breakers
+		// created afterwards
+		reloadMu sync.Mutex
+		reloaded []Option
+
+		// ctx is cancelled to stop the background work
+		ctx    context.Context
+		cancel context.CancelFunc
 	}
 )
 
 func newCircuitBreaker(opts ...Option) *circuit {
+	config := &Config{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
 	retrier := NewRetrier(opts...)
-	breaker := NewBreaker(opts...)
-	return &circuit{
+	c := &circuit{
 		retrier:      retrier,
-		breaker:      breaker,
-		RoundTripper: http.DefaultTransport,
+		RoundTripper: baseTransport(config),
+		keyFunc:      defaultKeyFunc,
+		maintenance:  newMaintenance(config.maintenanceKeys),
+
+		maxResponseBytes:  config.maxResponseBytes,
+		drainThreshold:    config.drainThreshold,
+		openOnRetryAfter:  config.openOnRetryAfter,
+		openStateResponse: config.openStateResponse,
+		maxRedirects:      config.maxRedirects,
+		connTrace:         config.connTrace,
+		noAttemptContext:  config.noAttemptContext,
+		noBreaker:         config.noBreaker,
+		noRetries:         config.noRetries,
+		logger:            newLogger(config),
+		audit:             newAuditLog(config.auditSize),
+		health:            &health{},
+		eventQueue:        config.eventQueue,
+		tags:              newTagStats(config.errorClassifier),
+		drain:             newDrainer(),
+		halfOpenProbe:     config.halfOpenProbe,
+	}
+	if config.keyFunc != nil {
+		c.keyFunc = config.keyFunc
+	}
+	for _, code := range config.throttlingCodes {
+		c.throttlingCodes = append(c.throttlingCodes, []byte(code))
+	}
+
+	if config.queueStore != nil {
+		c.queue = newOfflineQueue(config.queueStore, config.onDelivery, config.queueInterval)
+		c.queue.limit(config.queueMaxAttempts, config.queueMaxAge)
+	}
+	if config.warmUpCount > 0 {
+		c.warmUp = newWarmUp(config.warmUpCount, config.warmUpProbe)
+	}
+	if config.idleProbeInterval > 0 {
+		c.idleProbe = newIdleProbe(config.idleProbeInterval, config.idleProbe)
+	}
+	if config.hedgeDelay > 0 {
+		c.hedging = newHedging(config.hedgeDelay, config.hedgeBudget)
+	}
+	if config.cookieJar != nil {
+		c.cookies = &cookieJar{jar: config.cookieJar, frozen: config.frozenCookies}
 	}
+
+	c.breaker = c.newBreaker(opts...)
+	if config.perKeyBreakers {
+		c.breakers = newBreakerMap(func(key string) *Breaker {
+			keyOpts := append(append(append([]Option{}, opts...), c.reloadedOptions()...), WithName(key))
+			return c.newBreaker(keyOpts...)
+		})
+		c.breakers.idleTTL = config.breakerIdleTTL
+		c.breakers.maxEntries = config.maxBreakers
+		c.breakers.onEvict = func(key string, cb *Breaker) {
+			c.forget(cb)
+			if config.onEvict != nil {
+				config.onEvict(key, cb)
+			}
+		}
+	}
+	if t, ok := c.RoundTripper.(*http.Transport); ok && config.proxyBreakers && t.Proxy != nil {
+		c.proxy = t.Proxy
+		c.proxyBreakers = newBreakerMap(func(host string) *Breaker {
+			hostOpts := append(append(append([]Option{}, opts...), c.reloadedOptions()...), WithName(host))
+			return c.newBreaker(hostOpts...)
+		})
+	}
+
+	if idler, ok := c.RoundTripper.(closeIdler); ok {
+		c.idler = idler
+		c.redialOnRetry = config.redialOnRetry
+		c.flushOnOpen = config.flushOnOpen
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	if c.queue != nil {
+		go c.queue.run(c)
+	}
+
+	if c.idleProbe != nil {
+		go c.idleProbe.run(c.ctx, c)
+	}
+
+	if config.pubsub != nil {
+		c.broadcaster = &broadcaster{pubsub: config.pubsub, origin: config.pubsubOrigin, logger: c.logger, health: c.health}
+		c.broadcaster.subscribe(c.ctx, c)
+	}
+
+	if config.metricsListener != nil {
+		c.metrics = newMetrics(config.metricsListener, config.metricsInterval)
+		c.metrics.classifier = config.errorClassifier
+		c.metrics.health = c.healthStats
+		c.metrics.tags = c.tags.list
+		go c.metrics.run(c.ctx)
+	}
+
+	if config.shadowTarget != nil {
+		c.shadow = newShadow(config.shadowTarget, config.shadowPercent, c.RoundTripper)
+	}
+
+	if config.throttleMaxTokens > 0 {
+		c.throttle = newThrottle(config.throttleMaxTokens, config.throttleTokenRatio)
+	}
+
+	if config.faults != nil {
+		c.RoundTripper = newFaultTransport(*config.faults, c.RoundTripper, config.randSource)
+	}
+
+	if len(config.endpoints) > 0 {
+		c.RoundTripper = newEndpointPool(config.endpoints, config.outlierDetection, c.RoundTripper)
+	}
+	return c
 }
 
-// RoundTrip intercepts the request and takes action from here:
-// The return
+// newBreaker creates a breaker whose state changes are also seen by the circuit
+func (c *circuit) newBreaker(opts ...Option) *Breaker {
+	breaker := NewBreaker(opts...)
+	onStateChange := breaker.onStateChange
+	breaker.onStateChange = func(name string, from State, to State) {
+		if onStateChange != nil {
+			onStateChange(name, from, to)
+		}
+		c.stateChanged(breaker, from, to)
+	}
+	return breaker
+}
 
-// - retry
-// - rate limiting
-// - circuit breaking
+// stateChanged reacts to the state changes of the breakers, it's called
+// while the breaker is locked
+func (c *circuit) stateChanged(cb *Breaker, from State, to State) {
+	if to == Open && c.flushOnOpen {
+		c.idler.CloseIdleConnections()
+	}
+	if c.broadcaster != nil && !cb.remote {
+		// the closings only matter to the followers of a probe leader
+		if to == Open || (to == Close && cb.election != nil) {
+			go c.broadcaster.publish(cb)
+		}
+	}
+	if to != Close {
+		return
+	}
+	if c.queue != nil {
+		c.queue.notify()
+	}
+	if c.warmUp != nil && from != Close {
+		go c.warmUp.run(cb, c.RoundTripper)
+	}
+}
+
+// RoundTrip sends the request through the maintenance check, the client
+// throttling, the breaker and the retry loop. It returns either a response
+// or an error, never both nor neither. The response is the last one received,
+// even when the retries gave up on its status. Otherwise the error tells why
+// there's none:
+//
+//   - ErrMaintenance, ErrThrottled, ErrTooManyRequests and ErrOpenState, a
+//     *BreakerOpenError, reject the request before it's sent. The open
+//     breaker answers 503 instead with WithOpenStateResponse.
+//   - *RateLimitedError means the rate limit refused to retry the failed
+//     attempt, whose error it wraps.
+//   - *RetryExhaustedError means the last allowed attempt failed too.
+//   - ErrQueued means the deferrable request was handed to the offline queue.
+//   - ErrShuttingDown means Shutdown was called before the request was
+//     sent, or while it waited to be retried.
+//   - ErrResponseTooLarge, ErrNoResponse, the context errors and those of the
+//     underlying transport are returned as is. A request the caller cancels,
+//     even while it waits to be retried, returns context.Canceled at once
+//     and counts as abandoned rather than failed, see Counts.TotalAbandoned.
+//
+// The request body is always closed, as http.RoundTripper requires. So are
+// the bodies of the responses not returned: those retried, the one of a
+// queued request and the one over WithMaxResponseBytes. The caller closes
+// the body of the response returned.
 func (c *circuit) RoundTrip(req *http.Request) (*http.Response, error) {
-	// wraps the original request
-	//request, err := newRequest(req)
-	//if err != nil {
-	//	return nil, err
-	//}
-
-	// the circuit breaker
-	res, err := c.breaker.Execute(func() (*http.Response, error) {
-		var code int            // HTTP response code
-		var resp *http.Response // HTTP response
-		var err error
-
-		// run X times
-		var i uint32
-		for i = 0; ; i++ {
-			resp, err = c.RoundTripper.RoundTrip(req)
-
-			// Check if we should continue with shouldRetry.
-			shouldRetry, checkErr := c.retrier.retryPolicy(req.Context(), resp, err)
-
-			// Now decide if we should continue.
-			if !shouldRetry {
-				if checkErr != nil {
-					err = checkErr
-				}
-				// Depending on the policy, if the request is valid
-				// we'll return here
-				return resp, err
-			}
+	if !c.drain.enter() {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, ErrShuttingDown
+	}
+	defer c.drain.leave()
 
-			// We do this before drainBody because there's no need for the I/O if
-			// we're breaking out
-			remain := c.retrier.RetryMax - i
-			if remain <= 0 {
-				err = fmt.Errorf("%s: %s %s giving up after %d attempts", errMaxRetriesReached,
-					req.Method, req.URL, c.retrier.RetryMax+1)
-				break
-			}
+	var primary chan<- shadowOutcome
+	var start time.Time
+	if c.shadow != nil {
+		primary = c.shadow.mirror(req)
+		start = time.Now()
+	}
 
-			// We're going to retry, consume any response to reuse the connection.
-			if err == nil && resp != nil {
-				c.drainBody(resp.Body)
-			}
+	var res *http.Response
+	var err error
+	if c.maxRedirects > 0 {
+		res, err = c.executeRedirects(req)
+	} else {
+		res, err = c.execute(req)
+	}
+	if c.metrics != nil {
+		c.metrics.record(res, err, abandoned(req, err))
+	}
 
-			wait := c.retrier.Backoff(c.retrier.RetryWaitMin, c.retrier.RetryWaitMax, i, resp)
-			c.logRetry(req, code, wait, remain)
+	if primary != nil {
+		out := shadowOutcome{latency: time.Since(start), failed: err != nil}
+		if res != nil {
+			out.status = res.StatusCode
+			out.failed = res.StatusCode >= 500
+		}
+		primary <- out
+	}
 
-			select {
-			case <-req.Context().Done():
-				return nil, req.Context().Err()
-			case <-time.After(wait):
+	// fire-and-forget requests that couldn't make it are handed to the
+	// offline queue instead of failing the caller
+	if err != nil && c.queue != nil && isDeferrable(req) {
+		if qErr := c.queue.enqueue(req); qErr == nil {
+			if res != nil {
+				if isStreaming(res) {
+					_ = res.Body.Close()
+				} else {
+					c.drainBody(res)
+				}
 			}
+			res, err = nil, ErrQueued
 		}
+	}
 
-		return resp, err
-	})
+	if err != nil && c.openStateResponse {
+		if unavailable, ok := openStateResponse(req, err); ok {
+			res, err = unavailable, nil
+		}
+	}
 
 	if req.Body != nil {
 		_ = req.Body.Close()
@@ -142,38 +402,342 @@ func (c *circuit) RoundTrip(req *http.Request) (*http.Response, error) {
 	// errors, otherwise we return an error.
 	// Returning a response and an error would be ignored by the client middleware anyway and just return the error.
 	if res != nil {
+		if c.maxResponseBytes > 0 {
+			return limitResponse(res, c.maxResponseBytes)
+		}
 		return res, nil
 	}
+	if err == nil {
+		err = ErrNoResponse
+	}
 	return nil, err
 }
 
+// execute runs the request through the maintenance check, the client
+// throttling, the circuit breaker and the retry loop
+func (c *circuit) execute(req *http.Request) (*http.Response, error) {
+	key := c.keyFunc(req)
+	// planned downtime is neither sent nor recorded
+	if c.maintenance.has(key) {
+		return nil, ErrMaintenance
+	}
+
+	if c.logger.debugging(key) {
+		start := time.Now()
+		c.logger.dumpRequest(req)
+		resp, err := c.throttledExecute(req)
+		c.logger.dumpResponse(req, resp, err, time.Since(start))
+		return resp, err
+	}
+	return c.throttledExecute(req)
+}
+
+// throttledExecute runs the request through the client throttling, the
+// circuit breaker and the retry loop
+func (c *circuit) throttledExecute(req *http.Request) (*http.Response, error) {
+	if c.throttle == nil {
+		return c.breakerExecute(req)
+	}
+
+	if !c.throttle.allow() {
+		return nil, ErrThrottled
+	}
+	resp, err := c.breakerExecute(req)
+	switch {
+	case err != nil && (rejected(err) || abandoned(req, err) || c.breaker.isIgnorable(err)):
+		// the upstream wasn't asked, or isn't to blame
+	case err != nil || (c.noRetries && isServerFailure(resp, nil)):
+		c.throttle.onFailure()
+	default:
+		c.throttle.onSuccess()
+	}
+	return resp, err
+}
+
+func (c *circuit) breakerExecute(req *http.Request) (*http.Response, error) {
+	// the disabled stages are skipped altogether, the proxy breakers are
+	// kept when enabled
+	if c.noBreaker && c.proxy == nil {
+		if c.noRetries {
+			return c.once(req, nil)
+		}
+		return c.retry(req, nil)
+	}
+
+	cb := c.breakerFor(req)
+	if c.warmUp != nil {
+		c.warmUp.track(cb, req)
+	}
+	if c.idleProbe != nil {
+		c.idleProbe.track(cb, req, time.Now())
+	}
+	tag, tagged := TagFromContext(req.Context())
+	resp, err := c.guardedExecute(req, cb, tag)
+	if c.halfOpenProbe != nil && err == ErrTooManyRequests {
+		c.probeHalfOpen(cb, req)
+	}
+	if tagged {
+		c.tags.record(cb.name, tag, resp, err)
+	}
+	return resp, err
+}
+
+// guardedExecute runs the request under its breaker, tag is the tag of the
+// request if any
+func (c *circuit) guardedExecute(req *http.Request, cb *Breaker, tag string) (*http.Response, error) {
+	if proxyURL := c.proxyFor(req); proxyURL != nil {
+		return c.proxyExecute(req, cb, proxyURL)
+	}
+	if c.noRetries {
+		// the server errors come back as responses, not exhaustion errors
+		return cb.executeFor(req, tag, func() (*http.Response, error) {
+			return c.once(req, cb)
+		}, isServerFailure)
+	}
+	return cb.executeFor(req, tag, func() (*http.Response, error) {
+		return c.retry(req, cb)
+	}, hasFailed)
+}
+
+// once sends the request a single time, outside of the retry loop. cb is
+// the breaker guarding the request if any.
+func (c *circuit) once(req *http.Request, cb *Breaker) (*http.Response, error) {
+	attempt := req
+	if !c.noAttemptContext {
+		var state State
+		if cb != nil {
+			state = cb.State()
+		}
+		attempt = req.WithContext(withAttempt(req.Context(), 0, 0, state))
+	}
+	if c.cookies != nil {
+		attempt = withCookies(req, attempt, c.cookies.header(req, attempt), true)
+	}
+	start := time.Now()
+	resp, err := c.roundTrip(attempt)
+	if cb != nil {
+		cb.latencies.record(start, time.Now())
+	}
+	if err != nil {
+		return nil, classifyTimeout(req, err)
+	}
+	if resp == nil {
+		return nil, ErrNoResponse
+	}
+	if c.cookies != nil {
+		c.cookies.store(attempt, resp)
+	}
+
+	if isStreaming(resp) {
+		if cb != nil {
+			watchStream(req, resp, cb)
+		}
+		return resp, nil
+	}
+	if len(c.throttlingCodes) > 0 {
+		detectThrottling(resp, c.throttlingCodes)
+	}
+	if c.openOnRetryAfter && cb != nil && resp.StatusCode == http.StatusServiceUnavailable {
+		if wait, ok := parseRetryAfter(resp, cb.clock.Now()); ok {
+			cb.openFor(wait, cb.clock.Now())
+		}
+	}
+	return resp, nil
+}
+
+// retryAttempts runs the attempts of the retry loop, counting them in stats
+func (c *circuit) retryAttempts(req *http.Request, cb *Breaker, stats *AttemptStats) (*http.Response, error) {
+	var code int            // HTTP response code
+	var resp *http.Response // HTTP response
+	var err error
+
+	stormGuard.onRequest()
+	retryMax, _ := c.retrier.policy(c.retrier.now())
+
+	// the attempts get their own copy of the body
+	var body *replayBody
+	if retryMax > 0 {
+		if body, err = newReplayBody(req); err != nil {
+			return nil, err
+		}
+		defer body.release()
+	}
+	proxyURL := c.proxyFor(req)
+	failures := c.retrier.failures()
+	var state State
+	if cb != nil {
+		state = cb.State()
+	}
+
+	// the clone of the last retry, once its response is consumed
+	var reuse *http.Request
+	// the Cookie header of the attempts, with a cookie jar
+	var cookie string
+
+	// run X times
+	var i uint32
+	for i = 0; ; i++ {
+		stats.Attempts = i + 1
+		ctx := req.Context()
+		if !c.noAttemptContext {
+			ctx = withAttempt(ctx, i, retryMax, state)
+		}
+		// the first attempt is the request itself, the retries are clones
+		attempt := req
+		if i > 0 {
+			attempt, reuse = cloneRetry(ctx, req, reuse), nil
+		} else if ctx != req.Context() {
+			attempt = req.WithContext(ctx)
+		}
+		attempt, rewindErr := body.rewind(req, attempt, i == 0)
+		if rewindErr != nil {
+			return nil, rewindErr
+		}
+		if c.cookies != nil {
+			if i == 0 || !c.cookies.frozen {
+				cookie = c.cookies.header(req, attempt)
+			}
+			attempt = withCookies(req, attempt, cookie, i == 0)
+		}
+		var tracer *connTracer
+		if c.connTrace {
+			tracer = &connTracer{}
+			attempt = attempt.WithContext(tracer.withTrace(attempt.Context()))
+		}
+		start := time.Now()
+		if proxyURL == nil {
+			resp, err = c.roundTrip(attempt)
+			err = classifyTimeout(req, err)
+		} else {
+			traced, pt := traceProxy(attempt)
+			resp, err = c.RoundTripper.RoundTrip(traced)
+			if err != nil && pt.proxyFailure(req, proxyURL, err) {
+				err = &ProxyError{Proxy: proxyURL, Err: err}
+			} else {
+				err = classifyTimeout(req, err)
+			}
+		}
+		if cb != nil {
+			cb.latencies.record(start, time.Now())
+		}
+		if err == nil && resp == nil {
+			err = ErrNoResponse
+		}
+		if err == nil && c.cookies != nil {
+			c.cookies.store(attempt, resp)
+		}
+		var conn ConnTrace
+		if tracer != nil {
+			conn = tracer.result()
+			stats.Conns = append(stats.Conns, conn)
+		}
+
+		// Streams go to the caller as soon as they start, retrying them
+		// would replay what the caller already read
+		if err == nil && isStreaming(resp) {
+			if cb != nil {
+				watchStream(req, resp, cb)
+			}
+			return resp, nil
+		}
+
+		if err == nil && len(c.throttlingCodes) > 0 {
+			detectThrottling(resp, c.throttlingCodes)
+		}
+
+		// The upstream told us how long it's going to be unavailable,
+		// no need to learn it from more failed requests
+		if c.openOnRetryAfter && cb != nil && err == nil && resp.StatusCode == http.StatusServiceUnavailable {
+			if wait, ok := parseRetryAfter(resp, cb.clock.Now()); ok {
+				cb.openFor(wait, cb.clock.Now())
+				return resp, nil
+			}
+		}
+
+		// Check if we should continue with shouldRetry.
+		shouldRetry, checkErr := c.retrier.retryPolicy(req.Context(), resp, err)
+
+		// Now decide if we should continue.
+		if !shouldRetry {
+			if checkErr != nil {
+				err = checkErr
+			}
+			// Depending on the policy, if the request is valid
+			// we'll return here
+			return resp, err
+		}
+
+		// We do this before drainBody because there's no need for the I/O if
+		// we're breaking out
+		remain := retryMax - i
+		failure := newAttemptError(i, resp, err)
+		if remain <= 0 {
+			err = newRetryExhaustedError(retryMax+1, failure, failures)
+			break
+		}
+		if failures != nil {
+			failures = append(failures, failure)
+		}
+
+		// The process is in a retry storm, stick to the first attempt
+		if !stormGuard.allowRetry() {
+			return resp, err
+		}
+
+		// The body was too large to keep, it can't be sent again
+		if !body.replayable() {
+			return resp, err
+		}
+
+		// The transport is shutting down, the requests in flight aren't
+		// retried anymore
+		if c.drain.closed() {
+			return resp, err
+		}
+
+		// We're going to retry, consume any response to reuse the connection.
+		// The transport is then done with the clone of a retry.
+		if err == nil && resp != nil {
+			c.drainBody(resp)
+			if i > 0 {
+				reuse = attempt
+			}
+		}
+
+		if c.metrics != nil {
+			c.metrics.retry()
+		}
+
+		wait, backoff, hinted := c.retrier.wait(i, resp)
+		stats.Waited += wait
+		if c.retrier.OnRetry != nil {
+			info := newRetryInfo(i, resp, err, wait, backoff, hinted, c.retrier.BackoffName)
+			info.Conn = conn
+			c.retrier.OnRetry(req, info)
+		}
+		if c.logger.enabled(LevelDebug) || c.debugging(req) {
+			c.logRetry(req, code, wait, remain)
+		}
+
+		if err := c.retrier.sleep(req.Context(), wait, c.drain.stopped()); err != nil {
+			return nil, err
+		}
+		c.redial(err)
+	}
+
+	return resp, err
+}
+
 
 func (c *circuit) logRetry(req *http.Request, code int, wait time.Duration, remain uint32) {
 	desc := fmt.Sprintf("%s %s", req.Method, req.URL)
 	if code > 0 {
 		desc = fmt.Sprintf("%s (status: %d)", desc, code)
 	}
-	log.Printf("[DEBUG] %s: retrying in %s (%d left)\n", desc, wait, remain)
+	c.logger.Printf("[DEBUG] %s: retrying in %s (%d left)\n", desc, wait, remain)
 }
 
 
-// newRequest creates a new wrapped request.
-//func newRequest(method, url string, rawBody io.ReadCloser) (*Request, error) {
-//	bodyReader, contentLength, err := getBodyReaderAndContentLength(rawBody)
-//	if err != nil {
-//		return nil, err
-//	}
-//
-//	httpReq, err := http.NewRequest(method, url, rawBody)
-//	if err != nil {
-//		return nil, err
-//	}
-//	httpReq.ContentLength = contentLength
-//	httpReq.GetBody = bodyReader
-//
-//	return &Request{bodyReader, httpReq}, nil
-//}
-
 func getBodyReaderAndContentLength(rawBody interface{}) (ReaderFunc, int64, error) {
 	var bodyReader ReaderFunc
 	var contentLength int64
@@ -271,15 +835,51 @@ func getBodyReaderAndContentLength(rawBody interface{}) (ReaderFunc, int64, erro
 	return bodyReader, contentLength, nil
 }
 
-// Try to read the response body so we can reuse this connection.
-func (c *circuit) drainBody(body io.ReadCloser) {
+// rebaseURL moves u onto the scheme and host of base, prefixing the
+// base path
+func rebaseURL(u, base *url.URL) url.URL {
+	rebased := *u
+	rebased.Scheme = base.Scheme
+	rebased.Host = base.Host
+	rebased.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+	rebased.RawPath = ""
+	return rebased
+}
+
+// copyBody gives dst a fresh copy of the body of src. It fails when the body
+// of src can't be replayed.
+func copyBody(dst, src *http.Request) error {
+	if src.Body == nil || src.Body == http.NoBody {
+		return nil
+	}
+	if src.GetBody == nil {
+		return errBodyNotReplayable
+	}
+	body, err := src.GetBody()
+	if err != nil {
+		return err
+	}
+	dst.Body = body
+	dst.GetBody = src.GetBody
+	dst.ContentLength = src.ContentLength
+	return nil
+}
+
+// drainBody consumes the start of the response body so the connection can
+// be reused. The responses advertising more than the drain threshold are
+// closed right away.
+func (c *circuit) drainBody(resp *http.Response) {
+	body := resp.Body
 	defer body.Close()
+	if c.drainThreshold > 0 && resp.ContentLength > c.drainThreshold {
+		return
+	}
 	_, err := io.Copy(ioutil.Discard, io.LimitReader(body, respReadLimit))
-	if err != nil {
-		log.Printf("[ERR] error reading response body: %v", err)
+	if err != nil && c.logger.enabled(LevelError) {
+		c.logger.Printf("[ERR] error reading response body: %v", err)
 	}
 }
 
 func (c *circuit) GetState() State {
-	return c.breaker.state
+	return c.breaker.State()
 }
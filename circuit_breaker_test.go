@@ -2,11 +2,16 @@ package gcb
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,13 +19,14 @@ import (
 )
 
 func TestCircuit_FailedAllAttempts(t *testing.T) {
-	client, _, _, teardown := newRoundTripper(WithMaxRetries(2))
+	clock := testutil.NewFakeClock(time.Now())
+	client, _, _, teardown := newRoundTripper(WithMaxRetries(2), WithClock(clock))
 	defer teardown()
 
 	var i int
 	for i < 2 {
 		request, _ := http.NewRequest(http.MethodPost, "http://localhost", strings.NewReader("Hello Server!"))
-		resp, err := client.Do(request)
+		resp, err := doAdvancing(client, request, clock, 2)
 		if err == nil {
 			t.Fatal(err)
 		}
@@ -39,12 +45,14 @@ func TestCircuit_DefaultRetryAttempts(t *testing.T) {
 	tt := []struct {
 		shouldRetry int
 		statusCode  int
+		waits       int
 	}{
-		{4, 200},
-		{7, 500},
+		{4, 200, 4},
+		{7, 500, 4},
 	}
 
-	client, baseURL, mux, teardown := newRoundTripper()
+	clock := testutil.NewFakeClock(time.Now())
+	client, baseURL, mux, teardown := newRoundTripper(WithClock(clock))
 	defer teardown()
 
 	// setup mock handler
@@ -65,7 +73,7 @@ func TestCircuit_DefaultRetryAttempts(t *testing.T) {
 		maxRetries = ts.shouldRetry
 
 		request, _ := http.NewRequest(http.MethodPost, baseURL, strings.NewReader("Hi Server!"))
-		resp, err := client.Do(request)
+		resp, err := doAdvancing(client, request, clock, ts.waits)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -94,7 +102,8 @@ func TestCircuit_WithConfiguredRetryAttempts(t *testing.T) {
 		{4, 500},
 	}
 
-	client, baseURL, mux, teardown := newRoundTripper(WithMaxRetries(2))
+	clock := testutil.NewFakeClock(time.Now())
+	client, baseURL, mux, teardown := newRoundTripper(WithMaxRetries(2), WithClock(clock))
 	defer teardown()
 
 	// setup mock handler
@@ -114,7 +123,7 @@ func TestCircuit_WithConfiguredRetryAttempts(t *testing.T) {
 		maxRetries = ts.shouldRetry
 
 		request, _ := http.NewRequest("GET", baseURL, nil)
-		resp, err := client.Do(request)
+		resp, err := doAdvancing(client, request, clock, 2)
 		if err != nil {
 			t.Error(err)
 		}
@@ -133,6 +142,376 @@ func TestCircuit_WithConfiguredRetryAttempts(t *testing.T) {
 	}
 }
 
+func TestCircuit_PanicAsError(t *testing.T) {
+	c := newCircuitBreaker(WithPanicAsError())
+	c.RoundTripper = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		panic("boom")
+	})
+
+	request, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	_, err := c.RoundTrip(request)
+	if !errors.Is(err, ErrPanicked) {
+		t.Fatalf("Expected %v, got %v", ErrPanicked, err)
+	}
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Errorf("Expected a *PanicError with the stack, got %#v", err)
+	}
+	if counts := c.breaker.Counts(); counts.TotalFailures != 1 {
+		t.Errorf("Expected the panic to count as a failure, got %+v", counts)
+	}
+}
+
+func TestCircuit_Maintenance(t *testing.T) {
+	transport := NewRoundTripper(WithMaxRetries(0))
+	client := http.Client{Transport: transport}
+
+	baseURL, mux, teardown := testutil.ServerMock()
+	defer teardown()
+
+	var reqNum int
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqNum++
+	}))
+
+	request, _ := http.NewRequest(http.MethodGet, baseURL, nil)
+	transport.SetMaintenance(request.URL.Host, true)
+
+	_, err := client.Do(request)
+	if !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("Expected %v, got %v", ErrMaintenance, err)
+	}
+	if counts := transport.RoundTripper.(*circuit).breaker.Counts(); reqNum != 0 || counts.Requests != 0 {
+		t.Errorf("Expected nothing to be sent nor recorded, got %d requests and %+v", reqNum, counts)
+	}
+
+	transport.SetMaintenance(request.URL.Host, false)
+	resp, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if reqNum != 1 {
+		t.Errorf("Expected 1 request, got %d", reqNum)
+	}
+}
+
+func TestCircuit_OpenOnRetryAfterPerKey(t *testing.T) {
+	client, downURL, downMux, teardown := newRoundTripper(WithPerKeyBreakers(), WithOpenOnRetryAfter())
+	defer teardown()
+	downMux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(503)
+	}))
+
+	upURL, upMux, upTeardown := testutil.ServerMock()
+	defer upTeardown()
+	upMux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	resp, err := client.Get(downURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Fatalf("Expected %d, got %d", 503, resp.StatusCode)
+	}
+
+	// the server told us to come back later, no need to ask again
+	_, err = client.Get(downURL)
+	if !errors.Is(err, ErrOpenState) {
+		t.Fatalf("Expected %v, got %v", ErrOpenState, err)
+	}
+
+	// other hosts have their own breaker
+	resp, err = client.Get(upURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestCircuit_WarmUpAfterOutage(t *testing.T) {
+	client, baseURL, mux, teardown := newRoundTripper(
+		WithMaxRetries(0),
+		WithTimeout(10*time.Millisecond),
+		WithReadyToTrip(func(counts Counts) bool { return true }),
+		WithWarmUp(3, nil),
+	)
+	defer teardown()
+
+	var mu sync.Mutex
+	var heads int
+	down := true
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Method == http.MethodHead {
+			heads++
+		}
+		if down {
+			w.WriteHeader(500)
+		}
+	}))
+
+	get := func() {
+		resp, err := client.Get(baseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	get()
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	get()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := heads
+		mu.Unlock()
+		if n == 3 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("Expected 3 warm-up requests, got %d", heads)
+}
+
+func TestBreaker_IgnoredErrors(t *testing.T) {
+	errInvalid := errors.New("invalid request")
+	cb := NewBreaker(WithIgnoredErrors(errInvalid))
+
+	for _, err := range []error{context.Canceled, fmt.Errorf("wrapped: %w", errInvalid)} {
+		_, _ = cb.Execute(func() (*http.Response, error) {
+			return nil, err
+		})
+	}
+	if counts := cb.Counts(); counts != (Counts{}) {
+		t.Errorf("Expected ignored errors to be left out, got %+v", counts)
+	}
+
+	trip(cb)
+	if counts := cb.Counts(); counts.Requests != 1 || counts.TotalFailures != 1 {
+		t.Errorf("Expected other errors to count, got %+v", counts)
+	}
+}
+
+func TestBreaker_ConcurrentCounts(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"atomic", nil},
+		{"striped", []Option{WithStripedCounts(4)}},
+	}
+
+	for _, tt := range tests {
+		clock := testutil.NewFakeClock(time.Now())
+		cb := NewBreaker(append(tt.opts, WithClock(clock), WithInterval(time.Minute))...)
+		ok := func() (*http.Response, error) { return nil, nil }
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					_, _ = cb.Execute(ok)
+				}
+			}()
+		}
+		wg.Wait()
+		if counts := cb.Counts(); counts.Requests != 1600 || counts.TotalSuccesses != 1600 {
+			t.Errorf("%s: Expected %d requests and successes, got %+v", tt.name, 1600, counts)
+		}
+
+		// the counts are still cleared at the end of the interval
+		clock.Advance(2 * time.Minute)
+		_, _ = cb.Execute(ok)
+		if counts := cb.Counts(); counts.Requests != 1 || counts.TotalSuccesses != 1 {
+			t.Errorf("%s: Expected the counts to be cleared, got %+v", tt.name, counts)
+		}
+
+		trip(cb)
+		if counts := cb.Counts(); counts.ConsecutiveSuccesses != 0 || counts.ConsecutiveFailures != 1 {
+			t.Errorf("%s: Expected the failure to reset the successes, got %+v", tt.name, counts)
+		}
+	}
+}
+
+func TestWithStripedCounts(t *testing.T) {
+	clock := testutil.NewFakeClock(time.Now())
+	cb := NewBreaker(WithStripedCounts(0), WithClock(clock), WithTimeout(time.Minute), WithMaxRequests(3))
+	if cb.counts.striped == nil || len(cb.counts.striped.stripes) != runtime.GOMAXPROCS(0) {
+		t.Fatalf("Expected a stripe per processor")
+	}
+
+	// the half-open successes are summed up to close the breaker
+	ok := func() (*http.Response, error) { return nil, nil }
+	cb.openFor(time.Minute, clock.Now())
+	clock.Advance(2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		_, _ = cb.Execute(ok)
+	}
+	if state := cb.State(); state != Close {
+		t.Errorf("Expected %v, got %v", Close, state)
+	}
+
+	// the shared store records under the lock, there is nothing to stripe
+	stored := NewBreaker(WithStripedCounts(4), WithCountsStore(&fleetStore{}))
+	if stored.counts.striped != nil {
+		t.Errorf("Expected no stripes along a counts store")
+	}
+}
+
+func TestBreaker_LockFreeReads(t *testing.T) {
+	clock := testutil.NewFakeClock(time.Now())
+	cb := NewBreaker(WithClock(clock), WithTimeout(time.Minute), WithReadyToTrip(func(counts Counts) bool { return true }))
+	trip(cb)
+
+	// the reads don't wait on the lock
+	cb.mutex.Lock()
+	done := make(chan State)
+	go func() {
+		state, _ := cb.snapshot()
+		_ = cb.Counts()
+		done <- state
+	}()
+	select {
+	case state := <-done:
+		if state != Open {
+			t.Errorf("Expected %s, got %s", Open, state)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the reads not to block")
+	}
+	cb.mutex.Unlock()
+
+	// the expired open state still moves to half-open
+	clock.Advance(2 * time.Minute)
+	if state := cb.State(); state != HalfOpen {
+		t.Errorf("Expected %s, got %s", HalfOpen, state)
+	}
+}
+
+// fleetStore is a CountsStore that sees the failures of other instances
+type fleetStore struct {
+	available bool
+	failures  uint32
+	resets    int
+}
+
+func (s *fleetStore) Record(name string, success bool) {
+	if !success {
+		s.failures++
+	}
+}
+
+func (s *fleetStore) Counts(name string) (Counts, bool) {
+	return Counts{TotalFailures: s.failures, ConsecutiveFailures: s.failures}, s.available
+}
+
+func (s *fleetStore) Reset(name string) {
+	s.failures = 0
+	s.resets++
+}
+
+func TestBreaker_CountsStore(t *testing.T) {
+	tests := []struct {
+		available bool
+		expected  State
+	}{
+		// the fleet already saw failures, one more trips the breaker
+		{true, Open},
+		// the store is down, the local count is under the threshold
+		{false, Close},
+	}
+
+	for _, tt := range tests {
+		store := &fleetStore{available: tt.available, failures: 10}
+		cb := NewBreaker(WithCountsStore(store), WithTimeout(time.Millisecond))
+
+		trip(cb)
+		if state := cb.State(); state != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, state)
+		}
+	}
+
+	store := &fleetStore{available: true, failures: 10}
+	cb := NewBreaker(WithCountsStore(store), WithTimeout(time.Millisecond))
+	trip(cb)
+	time.Sleep(5 * time.Millisecond)
+	_, _ = cb.Execute(func() (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	if cb.State() != Close || store.resets != 1 {
+		t.Errorf("Expected the store to be reset on close, got %s and %d resets", cb.State(), store.resets)
+	}
+}
+
+// quorumFunc is a Quorum reporting fixed rates
+type quorumFunc func(name string) []float64
+
+func (f quorumFunc) PeerFailureRates(name string) []float64 {
+	return f(name)
+}
+
+func TestBreaker_OpenQuorum(t *testing.T) {
+	tests := []struct {
+		rates    []float64
+		expected State
+	}{
+		// two peers out of three see the failures
+		{[]float64{0.9, 0.6, 0}, Open},
+		// a single peer does, the blip is local
+		{[]float64{0.9, 0.1, 0}, Close},
+		// too few peers to form a quorum
+		{[]float64{0.1}, Open},
+	}
+
+	for _, tt := range tests {
+		rates := tt.rates
+		cb := NewBreaker(
+			WithReadyToTrip(func(counts Counts) bool { return true }),
+			WithOpenQuorum(quorumFunc(func(string) []float64 { return rates }), 2, 0.5),
+		)
+
+		trip(cb)
+		if state := cb.State(); state != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, state)
+		}
+	}
+}
+
+// doAdvancing sends the request, advancing the clock through the given
+// number of waits between the attempts
+func doAdvancing(client http.Client, req *http.Request, clock *testutil.FakeClock, waits int) (*http.Response, error) {
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := client.Do(req)
+		done <- result{resp, err}
+	}()
+
+	for i := 0; i < waits; i++ {
+		clock.BlockUntilTimers(1)
+		clock.Advance(time.Minute)
+	}
+	r := <-done
+	return r.resp, r.err
+}
+
 func newRoundTripper(opts ...Option) (http.Client, string, *http.ServeMux, func()) {
 	// setup http client with our round tripper
 	// the default number of shouldRetry is 4.
@@ -145,3 +524,320 @@ func newRoundTripper(opts ...Option) (http.Client, string, *http.ServeMux, func(
 	baseURL, mux, teardown := testutil.ServerMock()
 	return client, baseURL, mux, teardown
 }
+
+func TestWithRetryWait(t *testing.T) {
+	retrier := NewRetrier(WithRetryWait(time.Millisecond, time.Second))
+	if retrier.RetryWaitMin != time.Millisecond || retrier.RetryWaitMax != time.Second {
+		t.Errorf("Expected %s and %s, got %s and %s", time.Millisecond, time.Second, retrier.RetryWaitMin, retrier.RetryWaitMax)
+	}
+}
+
+func TestRetrier_Wait(t *testing.T) {
+	retrier := NewRetrier()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 20; i++ {
+		// the timer and the context may both be ready, the timer is
+		// drained before going back to the pool either way
+		_ = retrier.Wait(cancelled, 0)
+
+		start := time.Now()
+		if err := retrier.Wait(context.Background(), 10*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+			t.Fatalf("Expected to wait %s, got %s", 10*time.Millisecond, elapsed)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := retrier.Wait(ctx, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestCircuit_DisabledStages(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		attempts int
+		status   int
+		requests uint32
+	}{
+		{"retries", []Option{WithoutRetries()}, 1, http.StatusServiceUnavailable, 1},
+		{"breaker", []Option{WithoutBreaker()}, 3, http.StatusOK, 0},
+		{"both", []Option{WithoutBreaker(), WithoutRetries()}, 1, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tt := range tests {
+		unavailable := testutil.Step{Status: http.StatusServiceUnavailable}
+		fault := testutil.NewFaultTransport(unavailable, unavailable)
+		transport := NewRoundTripper(append(tt.opts,
+			WithTransport(fault),
+			WithMaxRetries(2),
+			WithRetryWait(time.Millisecond, time.Millisecond),
+			WithoutRateLimit(),
+		)...)
+		cb := transport.RoundTripper.(*circuit).breaker
+
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.status, resp.StatusCode)
+		}
+		if n := len(fault.Requests()); n != tt.attempts {
+			t.Errorf("%s: Expected %v attempts, got %v", tt.name, tt.attempts, n)
+		}
+		// the server errors are still failures without the retries
+		counts := cb.Counts()
+		if counts.Requests != tt.requests || counts.TotalFailures != tt.requests {
+			t.Errorf("%s: Expected %v failed requests, got %+v", tt.name, tt.requests, counts)
+		}
+	}
+}
+
+func TestWithoutRateLimit(t *testing.T) {
+	transport := NewRoundTripper(WithoutRateLimit())
+	if limiter := transport.RoundTripper.(*circuit).retrier.Limiter; limiter != nil {
+		t.Errorf("Expected no limiter, got %v", limiter)
+	}
+}
+
+// countingBody counts the bytes read from it
+type countingBody struct {
+	io.Reader
+	read   int64
+	closed bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestCircuit_DrainThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int64
+		length    int64
+		read      int64
+	}{
+		{"drained", 0, 64 << 10, respReadLimit},
+		{"closed", 1 << 10, 64 << 10, 0},
+		{"small", 1 << 10, 512, 512},
+		// without a Content-Length the response is drained
+		{"unknown", 1 << 10, -1, respReadLimit},
+	}
+
+	for _, tt := range tests {
+		c := NewRoundTripper(WithDrainThreshold(tt.threshold)).RoundTripper.(*circuit)
+		size := tt.length
+		if size < 0 {
+			size = 64 << 10
+		}
+		body := &countingBody{Reader: strings.NewReader(strings.Repeat("x", int(size)))}
+
+		c.drainBody(&http.Response{StatusCode: http.StatusServiceUnavailable, ContentLength: tt.length, Body: body})
+		if body.read != tt.read || !body.closed {
+			t.Errorf("%s: Expected %d bytes read and the body closed, got %d", tt.name, tt.read, body.read)
+		}
+	}
+}
+
+func TestCircuit_SuccessAllocs(t *testing.T) {
+	tests := []struct {
+		opts   []Option
+		allocs float64
+	}{
+		// the request is sent as is
+		{[]Option{WithoutAttemptContext()}, 0},
+		// the attempt context and the request carrying it, which can't be
+		// pooled, see WithoutAttemptContext
+		{nil, 2},
+		// straight to the transport
+		{[]Option{WithoutAttemptContext(), WithoutBreaker(), WithoutRetries()}, 0},
+	}
+
+	resp := &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+	for _, tt := range tests {
+		transport := NewRoundTripper(append(tt.opts, WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return resp, nil
+		})))...)
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != tt.allocs {
+			t.Errorf("Expected %v allocations, got %v", tt.allocs, allocs)
+		}
+	}
+}
+
+func TestCircuit_RoundTripContract(t *testing.T) {
+	errConn := errors.New("connection refused")
+	refuse := func(req *http.Request) (*http.Response, error) { return nil, errConn }
+	status := func(code int) func(req *http.Request) (*http.Response, error) {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: code, Body: http.NoBody}, nil
+		}
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		limiter   Limiter
+		upstream  func(req *http.Request) (*http.Response, error)
+		forceOpen bool
+		status    int
+		err       error
+		attempts  int
+		failures  uint32
+	}{
+		{"response", nil, nil, status(http.StatusOK), false, http.StatusOK, nil, 1, 0},
+		{"response under the rate limit", nil, testutil.DenyAll(), status(http.StatusOK), false, http.StatusOK, nil, 1, 0},
+		{"exhausted on status", nil, nil, status(http.StatusBadGateway), false, http.StatusBadGateway, nil, 2, 1},
+		{"exhausted on error", nil, nil, refuse, false, 0, &RetryExhaustedError{}, 2, 1},
+		{"rate limited", nil, testutil.DenyAll(), refuse, false, 0, &RateLimitedError{}, 1, 1},
+		{"open", nil, nil, refuse, true, 0, ErrOpenState, 0, 0},
+		{"no response", nil, nil, func(req *http.Request) (*http.Response, error) { return nil, nil }, false, 0, ErrNoResponse, 2, 1},
+		{"no response in one go", []Option{WithoutRetries()}, nil, func(req *http.Request) (*http.Response, error) { return nil, nil }, false, 0, ErrNoResponse, 1, 1},
+	}
+
+	for _, tt := range tests {
+		attempts := 0
+		upstream := tt.upstream
+		transport := NewRoundTripper(append([]Option{
+			WithName("api"),
+			WithMaxRetries(1),
+			WithRetryWait(0, 0),
+			WithLogLevel(LevelOff),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return upstream(req)
+			})),
+		}, tt.opts...)...)
+		c := transport.RoundTripper.(*circuit)
+		c.retrier.Limiter = testutil.AllowAll()
+		if tt.limiter != nil {
+			c.retrier.Limiter = tt.limiter
+		}
+		if tt.forceOpen {
+			transport.ForceState("api", Open)
+		}
+
+		body := &countingBody{Reader: strings.NewReader("payload")}
+		req, _ := http.NewRequest(http.MethodPost, "http://api.example", body)
+		resp, err := transport.RoundTrip(req)
+
+		if (resp == nil) == (err == nil) {
+			t.Errorf("%s: Expected either a response or an error, got %v and %v", tt.name, resp, err)
+		}
+		if tt.err == nil && err != nil {
+			t.Errorf("%s: Expected no error, got %v", tt.name, err)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.err, err)
+		}
+		// the breaker rejections and the rate limit rejections are told apart
+		if rateLimited := errors.Is(err, &RateLimitedError{}); rateLimited && errors.Is(err, ErrOpenState) {
+			t.Errorf("%s: Expected one kind of rejection, got %v", tt.name, err)
+		}
+		if tt.status != 0 && (resp == nil || resp.StatusCode != tt.status) {
+			t.Errorf("%s: Expected %d, got %v", tt.name, tt.status, resp)
+		}
+		if errors.Is(tt.err, &RateLimitedError{}) && !errors.Is(err, errConn) {
+			t.Errorf("%s: Expected the refused attempt in %v", tt.name, err)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%s: Expected %d attempts, got %d", tt.name, tt.attempts, attempts)
+		}
+		if failures := c.breaker.Counts().TotalFailures; failures != tt.failures {
+			t.Errorf("%s: Expected %d failures, got %d", tt.name, tt.failures, failures)
+		}
+		if !body.closed {
+			t.Errorf("%s: Expected the request body closed", tt.name)
+		}
+	}
+}
+
+func TestRetrier_LimiterOnRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		limiter  *testutil.StubLimiter
+		calls    int
+		attempts int
+	}{
+		// the first attempts and the outcomes kept don't spend the limit
+		{"success", http.StatusOK, testutil.DenyAll(), 0, 1},
+		{"client error", http.StatusBadRequest, testutil.DenyAll(), 0, 1},
+		{"refused", http.StatusServiceUnavailable, testutil.DenyAll(), 1, 1},
+		// asked about the last attempt too, which CheckRetry retries
+		{"retried", http.StatusServiceUnavailable, testutil.AllowAll(), 2, 2},
+	}
+
+	for _, tt := range tests {
+		attempts := 0
+		transport := NewRoundTripper(
+			WithMaxRetries(1),
+			WithRetryWait(time.Millisecond, time.Millisecond),
+			WithLogLevel(LevelOff),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return &http.Response{StatusCode: tt.status, Body: http.NoBody}, nil
+			})),
+		)
+		transport.RoundTripper.(*circuit).retrier.Limiter = tt.limiter
+
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		if calls := tt.limiter.Calls(); calls != tt.calls {
+			t.Errorf("%s: Expected %d calls to the limiter, got %d", tt.name, tt.calls, calls)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%s: Expected %d attempts, got %d", tt.name, tt.attempts, attempts)
+		}
+	}
+}
+
+func TestBreaker_DefaultInterval(t *testing.T) {
+	clock := testutil.NewFakeClock(time.Now())
+	tests := []struct {
+		name string
+		cb   *Breaker
+	}{
+		{"breaker", NewBreaker(WithClock(clock))},
+		{"transport", NewRoundTripper(WithClock(clock)).RoundTripper.(*circuit).breaker},
+	}
+
+	for _, tt := range tests {
+		if tt.cb.interval != 0 {
+			t.Errorf("%s: Expected %v, got %v", tt.name, time.Duration(0), tt.cb.interval)
+		}
+
+		// the counts are never cleared by default
+		trip(tt.cb)
+		clock.Advance(24 * time.Hour)
+		trip(tt.cb)
+		if counts := tt.cb.Counts(); counts.TotalFailures != 2 {
+			t.Errorf("%s: Expected %d failures, got %+v", tt.name, 2, counts)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+// Classes of the outcomes of the requests
+const (
+	// ClassSuccess isn't retried and counts as a success
+	ClassSuccess Class = iota + 1
+	// ClassFailure is retried and counts as a failure
+	ClassFailure
+	// ClassIgnore isn't retried nor counted by the breakers
+	ClassIgnore
+	// ClassThrottle is retried, after the backoff, but isn't counted as a
+	// failure by the breakers, the upstream is up and asks to slow down
+	ClassThrottle
+	// ClassPermanent isn't retried, retrying can't help, and counts as a
+	// failure
+	ClassPermanent
+)
+
+type (
+	// Class is the class of the outcome of a request, see ErrorClassifier
+	Class int8
+
+	// ClassRule gives its class to the outcomes matching all of the
+	// conditions set, a rule without any matches every outcome
+	ClassRule struct {
+		// Statuses are the status codes of the response matched
+		Statuses []int
+		// Err is matched with errors.Is
+		Err error
+		// ErrType is a value of the type of error matched with errors.As,
+		// e.g. (*net.OpError)(nil)
+		ErrType error
+		// Header is the name of a header of the response matched, with a
+		// value matching HeaderPattern if set
+		Header        string
+		HeaderPattern *regexp.Regexp
+		// Class is the class of the outcomes matched
+		Class Class
+	}
+
+	// ErrorClassifier is a registry of the rules classifying the outcomes
+	// of the requests, it's shared by the retry policy, the accounting of the
+	// breakers and the metrics so that they agree on what failed. The rules
+	// are tried in the order they were registered, the first one matching
+	// classifies the outcome.
+	ErrorClassifier struct {
+		mu    sync.RWMutex
+		rules []ClassRule
+	}
+)
+
+var classNames = map[Class]string{
+	ClassSuccess:   "success",
+	ClassFailure:   "failure",
+	ClassIgnore:    "ignore",
+	ClassThrottle:  "throttle",
+	ClassPermanent: "permanent",
+}
+
+func (c Class) String() string {
+	if name, ok := classNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// retried reports whether the outcomes of the class are retried
+func (c Class) retried() bool {
+	return c == ClassFailure || c == ClassThrottle
+}
+
+// failed reports whether the outcomes of the class count as failures
+func (c Class) failed() bool {
+	return c == ClassFailure || c == ClassPermanent
+}
+
+// WithErrorClassifier classifies the outcomes of the requests with the rules
+// of the classifier. An outcome matched by a rule is retried, counted by the
+// breakers and in the metrics according to its class, in place of
+// CheckRetry, the ignored errors and the default accounting. The outcomes no
+// rule matches are left to them. The classifier can be shared by several
+// transports and rules registered with it later on.
+func WithErrorClassifier(classifier *ErrorClassifier) Option {
+	return func(config *Config) {
+		config.errorClassifier = classifier
+	}
+}
+
+// StatusRange returns the status codes from first to last, both included,
+// e.g. StatusRange(500, 599) for the server errors
+func StatusRange(first, last int) []int {
+	statuses := make([]int, 0, last-first+1)
+	for code := first; code <= last; code++ {
+		statuses = append(statuses, code)
+	}
+	return statuses
+}
+
+// NewErrorClassifier returns a classifier with the rules
+func NewErrorClassifier(rules ...ClassRule) *ErrorClassifier {
+	return &ErrorClassifier{rules: append([]ClassRule(nil), rules...)}
+}
+
+// Register adds the rules after those registered before
+func (c *ErrorClassifier) Register(rules ...ClassRule) {
+	c.mu.Lock()
+	c.rules = append(c.rules, rules...)
+	c.mu.Unlock()
+}
+
+// Classify returns the class of the outcome of a request, false when no rule
+// matches it
+func (c *ErrorClassifier) Classify(resp *http.Response, err error) (Class, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for i := range c.rules {
+		if c.rules[i].matches(resp, err) {
+			return c.rules[i].Class, true
+		}
+	}
+	return 0, false
+}
+
+// classify classifies the outcome with the classifier, if any
+func classify(c *ErrorClassifier, resp *http.Response, err error) (Class, bool) {
+	if c == nil {
+		return 0, false
+	}
+	return c.Classify(resp, err)
+}
+
+// matches reports whether the outcome meets all the conditions of the rule
+func (r *ClassRule) matches(resp *http.Response, err error) bool {
+	if len(r.Statuses) > 0 {
+		if resp == nil {
+			return false
+		}
+		found := false
+		for _, code := range r.Statuses {
+			if code == resp.StatusCode {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Err != nil && !errors.Is(err, r.Err) {
+		return false
+	}
+	if r.ErrType != nil {
+		if err == nil || !errors.As(err, reflect.New(reflect.TypeOf(r.ErrType)).Interface()) {
+			return false
+		}
+	}
+	if r.Header != "" {
+		if resp == nil {
+			return false
+		}
+		values, ok := resp.Header[http.CanonicalHeaderKey(r.Header)]
+		if !ok {
+			return false
+		}
+		if r.HeaderPattern != nil {
+			found := false
+			for _, value := range values {
+				if r.HeaderPattern.MatchString(value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
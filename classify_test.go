@@ -0,0 +1,111 @@
+package gcb
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestErrorClassifier_Classify(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	classifier := NewErrorClassifier(
+		ClassRule{Statuses: []int{http.StatusTooManyRequests}, Class: ClassThrottle},
+		ClassRule{Statuses: []int{http.StatusServiceUnavailable}, Header: "X-Overloaded", HeaderPattern: regexp.MustCompile(`^true$`), Class: ClassThrottle},
+		ClassRule{Statuses: StatusRange(500, 599), Class: ClassFailure},
+		ClassRule{Err: ErrNoResponse, Class: ClassPermanent},
+		ClassRule{ErrType: (*net.OpError)(nil), Class: ClassFailure},
+	)
+	classifier.Register(ClassRule{Statuses: StatusRange(400, 499), Class: ClassSuccess})
+
+	overloaded := http.Header{"X-Overloaded": {"true"}}
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		err        error
+		class      Class
+		classified bool
+	}{
+		{"status", http.StatusTooManyRequests, nil, nil, ClassThrottle, true},
+		{"header", http.StatusServiceUnavailable, overloaded, nil, ClassThrottle, true},
+		{"header not matching", http.StatusServiceUnavailable, http.Header{"X-Overloaded": {"false"}}, nil, ClassFailure, true},
+		{"range", http.StatusBadGateway, nil, nil, ClassFailure, true},
+		{"registered", http.StatusNotFound, nil, nil, ClassSuccess, true},
+		{"error", 0, nil, fmt.Errorf("wrapped: %w", ErrNoResponse), ClassPermanent, true},
+		{"error type", 0, nil, fmt.Errorf("wrapped: %w", refused), ClassFailure, true},
+		{"unmatched", http.StatusOK, nil, nil, 0, false},
+		{"unmatched error", 0, nil, errors.New("boom"), 0, false},
+	}
+
+	for _, tt := range tests {
+		var resp *http.Response
+		if tt.status != 0 {
+			resp = &http.Response{StatusCode: tt.status, Header: tt.header}
+		}
+		class, ok := classifier.Classify(resp, tt.err)
+		if class != tt.class || ok != tt.classified {
+			t.Errorf("%s: Expected %v %v, got %v %v", tt.name, tt.class, tt.classified, class, ok)
+		}
+	}
+}
+
+func TestWithErrorClassifier(t *testing.T) {
+	classifier := NewErrorClassifier(
+		ClassRule{Statuses: []int{http.StatusTooManyRequests}, Class: ClassThrottle},
+		ClassRule{Statuses: []int{http.StatusNotImplemented}, Class: ClassPermanent},
+		ClassRule{Statuses: []int{http.StatusConflict}, Class: ClassFailure},
+		ClassRule{Statuses: []int{http.StatusServiceUnavailable}, Class: ClassIgnore},
+	)
+
+	tests := []struct {
+		name      string
+		status    int
+		attempts  int
+		requests  uint32
+		failures  uint32
+		errors    uint64
+		throttled uint64
+	}{
+		{"throttle", http.StatusTooManyRequests, 3, 0, 0, 0, 1},
+		{"permanent", http.StatusNotImplemented, 1, 1, 1, 1, 0},
+		{"failure", http.StatusConflict, 3, 1, 1, 1, 0},
+		{"ignore", http.StatusServiceUnavailable, 1, 0, 0, 0, 0},
+		{"unclassified", http.StatusBadGateway, 3, 1, 1, 1, 0},
+	}
+
+	for _, tt := range tests {
+		var flushed Metrics
+		attempts := 0
+		transport := NewRoundTripper(
+			WithErrorClassifier(classifier),
+			WithMaxRetries(2),
+			WithRetryWait(time.Millisecond, time.Millisecond),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+			WithMetricsListener(func(metrics Metrics) { flushed = metrics }, time.Hour),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return &http.Response{StatusCode: tt.status, Body: http.NoBody}, nil
+			})),
+		)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		_, _ = transport.RoundTrip(req)
+		transport.RoundTripper.(*circuit).metrics.flush(time.Second)
+
+		if attempts != tt.attempts {
+			t.Errorf("%s: Expected %d attempts, got %d", tt.name, tt.attempts, attempts)
+		}
+		counts := transport.Summaries()[0].Counts
+		if counts.Requests != tt.requests || counts.TotalFailures != tt.failures {
+			t.Errorf("%s: Expected %d requests and %d failures, got %+v", tt.name, tt.requests, tt.failures, counts)
+		}
+		if flushed.Errors != tt.errors || flushed.Throttled != tt.throttled {
+			t.Errorf("%s: Expected %d errors and %d throttled, got %+v", tt.name, tt.errors, tt.throttled, flushed)
+		}
+	}
+}
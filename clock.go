@@ -0,0 +1,109 @@
+package gcb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Clock tells the time and waits, for the breakers and the retries.
+	// testutil.FakeClock implements it for the tests.
+	Clock interface {
+		Now() time.Time
+		After(d time.Duration) <-chan time.Time
+	}
+
+	// systemClock is the real time
+	systemClock struct{}
+
+	// coarseClock is the real time read every resolution by a single
+	// goroutine, telling it is an atomic load
+	coarseClock struct {
+		// elapsed is the time since base at the last tick, in nanoseconds
+		elapsed int64
+		// base keeps the monotonic reading, the clock isn't moved by the
+		// wall clock adjustments
+		base time.Time
+	}
+)
+
+var (
+	coarseMu sync.Mutex
+	// coarseClocks are shared by resolution, their goroutines run for the
+	// life of the process
+	coarseClocks = map[time.Duration]*coarseClock{}
+)
+
+// WithClock replaces the system clock of the breakers and the retries, e.g.
+// with a fake one in the tests. The watchdog keeps the system clock.
+func WithClock(clock Clock) Option {
+	return func(config *Config) {
+		config.clock = clock
+	}
+}
+
+// WithCoarseClock makes the breakers read the time from a clock refreshed
+// every resolution, instead of the system clock on every request. Their
+// expiries and intervals may then be late by up to resolution, a few
+// milliseconds is plenty for the intervals of seconds. The latencies and
+// the retry waits keep the system clock. It's ignored along WithClock.
+func WithCoarseClock(resolution time.Duration) Option {
+	return func(config *Config) {
+		config.coarseResolution = resolution
+	}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// clockOf returns the configured clock, the system one by default
+func clockOf(config *Config) Clock {
+	if config.clock == nil {
+		return systemClock{}
+	}
+	return config.clock
+}
+
+// breakerClockOf returns the clock of the breakers, the coarse one if asked
+func breakerClockOf(config *Config) Clock {
+	if config.clock == nil && config.coarseResolution > 0 {
+		return coarseClockOf(config.coarseResolution)
+	}
+	return clockOf(config)
+}
+
+// coarseClockOf returns the coarse clock of the resolution, starting it the
+// first time
+func coarseClockOf(resolution time.Duration) *coarseClock {
+	coarseMu.Lock()
+	defer coarseMu.Unlock()
+
+	if c, ok := coarseClocks[resolution]; ok {
+		return c
+	}
+	c := &coarseClock{base: time.Now()}
+	coarseClocks[resolution] = c
+	go c.run(resolution)
+	return c
+}
+
+func (c *coarseClock) run(resolution time.Duration) {
+	ticker := time.NewTicker(resolution)
+	for range ticker.C {
+		atomic.StoreInt64(&c.elapsed, int64(time.Since(c.base)))
+	}
+}
+
+func (c *coarseClock) Now() time.Time {
+	return c.base.Add(time.Duration(atomic.LoadInt64(&c.elapsed)))
+}
+
+func (c *coarseClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,112 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestCoarseClock(t *testing.T) {
+	clock := coarseClockOf(time.Millisecond)
+	if coarseClockOf(time.Millisecond) != clock {
+		t.Errorf("Expected the clocks of a resolution to be shared")
+	}
+
+	before := clock.Now()
+	time.Sleep(20 * time.Millisecond)
+	if elapsed := clock.Now().Sub(before); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected the clock to move on, got %v", elapsed)
+	}
+	if lag := time.Since(clock.Now()); lag < 0 || lag > time.Second {
+		t.Errorf("Expected the clock to follow the system one, got %v behind", lag)
+	}
+}
+
+func TestWithCoarseClock(t *testing.T) {
+	fake := testutil.NewFakeClock(time.Now())
+	tests := []struct {
+		name   string
+		opts   []Option
+		coarse bool
+	}{
+		{"system", nil, false},
+		{"coarse", []Option{WithCoarseClock(time.Millisecond)}, true},
+		{"clock", []Option{WithCoarseClock(time.Millisecond), WithClock(fake)}, false},
+	}
+
+	for _, tt := range tests {
+		transport := NewRoundTripper(tt.opts...)
+		c := transport.RoundTripper.(*circuit)
+		if _, coarse := c.breaker.clock.(*coarseClock); coarse != tt.coarse {
+			t.Errorf("%s: Expected a coarse breaker clock %v, got %v", tt.name, tt.coarse, coarse)
+		}
+		if _, coarse := c.retrier.clock.(*coarseClock); coarse {
+			t.Errorf("%s: Expected the retrier to keep its clock", tt.name)
+		}
+	}
+}
+
+func TestBreaker_CoarseClockInterval(t *testing.T) {
+	cb := NewBreaker(WithCoarseClock(time.Millisecond), WithInterval(20*time.Millisecond))
+	ok := func() (*http.Response, error) { return nil, nil }
+
+	_, _ = cb.Execute(ok)
+	if counts := cb.Counts(); counts.Requests != 1 {
+		t.Errorf("Expected %v, got %v", 1, counts.Requests)
+	}
+
+	// the counts are cleared once the interval is over on the coarse clock
+	time.Sleep(50 * time.Millisecond)
+	_, _ = cb.Execute(ok)
+	if counts := cb.Counts(); counts.Requests != 1 {
+		t.Errorf("Expected %v, got %v", 1, counts.Requests)
+	}
+}
+
+func TestBreaker_AlignedInterval(t *testing.T) {
+	recorder := &eventRecorder{}
+	clock := testutil.NewFakeClock(time.Date(2026, 1, 1, 10, 0, 30, 0, time.UTC))
+	cb := NewBreaker(
+		WithName("api"),
+		WithClock(clock),
+		WithInterval(time.Minute),
+		WithAlignedInterval(),
+		WithEventListener(recorder.record),
+	)
+	ok := func() (*http.Response, error) { return nil, nil }
+	failed := func() (*http.Response, error) { return nil, errors.New("failed") }
+
+	_, _ = cb.Execute(ok)
+	_, _ = cb.Execute(failed)
+	// the first interval ends on the minute, not a minute after it started
+	clock.Advance(40 * time.Second)
+	_, _ = cb.Execute(ok)
+	clock.Advance(2 * time.Minute)
+	_, _ = cb.Execute(ok)
+
+	expected := []Event{
+		{
+			Type: EventRollover, Name: "api", From: Close, To: Close,
+			Counts:   Counts{Requests: 2, TotalSuccesses: 1, TotalFailures: 1, ConsecutiveFailures: 1},
+			Duration: time.Minute,
+			Window:   time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC),
+			Time:     time.Date(2026, 1, 1, 10, 1, 10, 0, time.UTC),
+		},
+		{
+			Type: EventRollover, Name: "api", From: Close, To: Close,
+			Counts:   Counts{Requests: 1, TotalSuccesses: 1, ConsecutiveSuccesses: 1},
+			Duration: time.Minute,
+			Window:   time.Date(2026, 1, 1, 10, 1, 0, 0, time.UTC),
+			Time:     time.Date(2026, 1, 1, 10, 3, 10, 0, time.UTC),
+		},
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, recorder.events)
+	}
+}
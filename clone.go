@@ -0,0 +1,60 @@
+package gcb
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// cloneRetry returns the request of a retry, a clone of the request with
+// ctx so the headers set by the transport, e.g. a signature, don't carry
+// over to the next attempt nor race with it. reuse is the clone of the
+// previous retry once the transport is done with it, its URL and header
+// map are refilled instead of allocated again.
+func cloneRetry(ctx context.Context, req, reuse *http.Request) *http.Request {
+	if reuse == nil || req.Form != nil || req.PostForm != nil || req.MultipartForm != nil {
+		return req.Clone(ctx)
+	}
+
+	clone := req.WithContext(ctx)
+	clone.URL = copyURL(reuse.URL, req.URL)
+	clone.Header = copyHeader(reuse.Header, req.Header)
+	if req.Trailer != nil {
+		clone.Trailer = req.Trailer.Clone()
+	}
+	if req.TransferEncoding != nil {
+		clone.TransferEncoding = append([]string(nil), req.TransferEncoding...)
+	}
+	return clone
+}
+
+// copyURL copies src into dst, the user info is immutable and shared
+func copyURL(dst, src *url.URL) *url.URL {
+	if src == nil {
+		return nil
+	}
+	if dst == nil {
+		dst = new(url.URL)
+	}
+	*dst = *src
+	return dst
+}
+
+// copyHeader makes dst a copy of src, reusing its map and value slices
+func copyHeader(dst, src http.Header) http.Header {
+	if src == nil {
+		return nil
+	}
+	if dst == nil {
+		return src.Clone()
+	}
+	for key := range dst {
+		if _, ok := src[key]; !ok {
+			delete(dst, key)
+		}
+	}
+	for key, values := range src {
+		dst[key] = append(dst[key][:0], values...)
+	}
+	return dst
+}
@@ -0,0 +1,123 @@
+package gcb
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type (
+	// ConnTrace describes the connection an attempt went on and the time
+	// spent getting it, to tell a slow upstream from the redials
+	ConnTrace struct {
+		// Reused tells the connection was kept alive from an earlier
+		// request, WasIdle and IdleTime whether and how long it was idle
+		Reused   bool
+		WasIdle  bool
+		IdleTime time.Duration
+		// DNS, Connect and TLS are the time of the lookup, the dial and
+		// the handshake, zero when the attempt didn't go through them
+		DNS     time.Duration
+		Connect time.Duration
+		TLS     time.Duration
+		// ServerTime is the time from the request written to the first
+		// byte of the response, the time the upstream took
+		ServerTime time.Duration
+	}
+
+	// TraceAttribute is a key and a value to set on a span, a bool or a
+	// float64. gcb takes no dependency on a tracing library, with
+	// OpenTelemetry they map to attribute.Bool and attribute.Float64.
+	TraceAttribute struct {
+		Key   string
+		Value interface{}
+	}
+
+	// connTracer collects the ConnTrace of an attempt, a hedged attempt
+	// reports the hooks of both its copies
+	connTracer struct {
+		mu    sync.Mutex
+		trace ConnTrace
+
+		dnsStart     time.Time
+		connectStart time.Time
+		tlsStart     time.Time
+		wrote        time.Time
+	}
+)
+
+// WithConnTrace traces the connection of every attempt with httptrace: the
+// reuse of a kept-alive connection, and the time spent in the lookup, the
+// dial, the TLS handshake and the upstream. The traces are handed to
+// WithOnRetry for the attempts retried, in RetryInfo.Conn, and to
+// WithOnSuccess and WithOnFailure for all of them, in AttemptStats.Conns,
+// where they can be recorded on the spans of a tracer with Attributes.
+func WithConnTrace() Option {
+	return func(config *Config) {
+		config.connTrace = true
+	}
+}
+
+// Attributes returns the trace as span attributes, the durations in
+// fractional milliseconds under the gcb.conn prefix
+func (c ConnTrace) Attributes() []TraceAttribute {
+	return []TraceAttribute{
+		{"gcb.conn.reused", c.Reused},
+		{"gcb.conn.was_idle", c.WasIdle},
+		{"gcb.conn.idle_ms", milliseconds(c.IdleTime)},
+		{"gcb.conn.dns_ms", milliseconds(c.DNS)},
+		{"gcb.conn.connect_ms", milliseconds(c.Connect)},
+		{"gcb.conn.tls_ms", milliseconds(c.TLS)},
+		{"gcb.conn.server_ms", milliseconds(c.ServerTime)},
+	}
+}
+
+// withTrace returns the context tracing the connection of an attempt into t
+func (t *connTracer) withTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.since(&t.dnsStart, &t.trace.DNS) },
+		ConnectStart: func(network, addr string) {
+			t.mark(&t.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.since(&t.connectStart, &t.trace.Connect)
+		},
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.since(&t.tlsStart, &t.trace.TLS)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.trace.Reused, t.trace.WasIdle, t.trace.IdleTime = info.Reused, info.WasIdle, info.IdleTime
+			t.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wrote) },
+		GotFirstResponseByte: func() { t.since(&t.wrote, &t.trace.ServerTime) },
+	})
+}
+
+func (t *connTracer) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+// since sets d to the time since start, if it was marked
+func (t *connTracer) since(start *time.Time, d *time.Duration) {
+	now := time.Now()
+	t.mu.Lock()
+	if !start.IsZero() {
+		*d = now.Sub(*start)
+	}
+	t.mu.Unlock()
+}
+
+// result returns the trace of the attempt
+func (t *connTracer) result() ConnTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.trace
+}
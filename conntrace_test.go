@@ -0,0 +1,95 @@
+package gcb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithConnTrace(t *testing.T) {
+	tests := []struct {
+		name   string
+		close  bool
+		reused []bool
+	}{
+		{"kept alive", false, []bool{false, true, true}},
+		{"redialed", true, []bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if tt.close {
+				w.Header().Set("Connection", "close")
+			}
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+
+		var retried []ConnTrace
+		var stats AttemptStats
+		transport := NewRoundTripper(
+			WithConnTrace(),
+			WithTransport(&http.Transport{}),
+			WithMaxRetries(2),
+			WithRetryWait(time.Millisecond, time.Millisecond),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+			WithOnRetry(func(req *http.Request, info RetryInfo) {
+				retried = append(retried, info.Conn)
+			}),
+			WithOnSuccess(func(req *http.Request, resp *http.Response, err error, s AttemptStats) {
+				stats = s
+			}),
+		)
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+		server.Close()
+
+		if len(stats.Conns) != len(tt.reused) {
+			t.Fatalf("%s: Expected %d traces, got %+v", tt.name, len(tt.reused), stats.Conns)
+		}
+		for i, conn := range stats.Conns {
+			if conn.Reused != tt.reused[i] {
+				t.Errorf("%s: Expected attempt %d reused %v, got %+v", tt.name, i+1, tt.reused[i], conn)
+			}
+			if dialed := conn.Connect > 0; dialed == conn.Reused {
+				t.Errorf("%s: Expected attempt %d dialed %v, got %+v", tt.name, i+1, !conn.Reused, conn)
+			}
+			if conn.ServerTime <= 0 {
+				t.Errorf("%s: Expected the server time of attempt %d, got %+v", tt.name, i+1, conn)
+			}
+		}
+		for i, conn := range retried {
+			if conn != stats.Conns[i] {
+				t.Errorf("%s: Expected %+v, got %+v", tt.name, stats.Conns[i], conn)
+			}
+		}
+	}
+}
+
+func TestConnTrace_Attributes(t *testing.T) {
+	conn := ConnTrace{Reused: true, IdleTime: time.Second, DNS: 1500 * time.Microsecond, ServerTime: 20 * time.Millisecond}
+	want := []TraceAttribute{
+		{"gcb.conn.reused", true},
+		{"gcb.conn.was_idle", false},
+		{"gcb.conn.idle_ms", float64(1000)},
+		{"gcb.conn.dns_ms", 1.5},
+		{"gcb.conn.connect_ms", float64(0)},
+		{"gcb.conn.tls_ms", float64(0)},
+		{"gcb.conn.server_ms", float64(20)},
+	}
+
+	if got := conn.Attributes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,79 @@
+package gcb
+
+import (
+	"context"
+)
+
+type (
+	// Attempt tells which attempt a request is sent on
+	Attempt struct {
+		// Number of the attempt, starting at 1
+		Number uint32
+		// Max is the number of attempts allowed, the first one included
+		Max uint32
+	}
+
+	attemptKey      struct{}
+	breakerStateKey struct{}
+
+	// attemptContext carries the attempt and the breaker state in a single
+	// value
+	attemptContext struct {
+		context.Context
+		attempt Attempt
+		state   State
+	}
+)
+
+// WithoutAttemptContext sends the requests to the transport without the
+// attempt context, AttemptFromContext and BreakerStateFromContext are false
+// there. The requests succeeding on the first attempt then don't allocate.
+// With the attempt context they allocate twice, the context and the copy of
+// the request carrying it, which http.Request.WithContext can't avoid.
+// Neither can be pooled: the transport may hold on to the request after the
+// round trip, e.g. as resp.Request.
+func WithoutAttemptContext() Option {
+	return func(config *Config) {
+		config.noAttemptContext = true
+	}
+}
+
+// AttemptFromContext returns the attempt the transport or the runner is on,
+// from the context of the request, e.g. in a lower round tripper signing or
+// logging the requests. It's false outside of an attempt.
+func AttemptFromContext(ctx context.Context) (Attempt, bool) {
+	attempt, ok := ctx.Value(attemptKey{}).(Attempt)
+	return attempt, ok
+}
+
+// BreakerStateFromContext returns the state of the breaker the request went
+// through, HalfOpen for the probes. It's false when no breaker guards the
+// request.
+func BreakerStateFromContext(ctx context.Context) (State, bool) {
+	state, ok := ctx.Value(breakerStateKey{}).(State)
+	return state, ok
+}
+
+// withAttempt returns the context of an attempt, numbered from 0, under a
+// breaker in the state if it's not zero
+func withAttempt(ctx context.Context, attempt, retryMax uint32, state State) context.Context {
+	return &attemptContext{
+		Context: ctx,
+		attempt: Attempt{Number: attempt + 1, Max: retryMax + 1},
+		state:   state,
+	}
+}
+
+// Value returns the attempt and the breaker state, the values of the parent
+// otherwise
+func (c *attemptContext) Value(key interface{}) interface{} {
+	switch key.(type) {
+	case attemptKey:
+		return c.attempt
+	case breakerStateKey:
+		if c.state != 0 {
+			return c.state
+		}
+	}
+	return c.Context.Value(key)
+}
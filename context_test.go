@@ -0,0 +1,98 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestAttemptFromContext(t *testing.T) {
+	var attempts []Attempt
+	var states []State
+	clock := testutil.NewFakeClock(time.Now())
+	transport := NewRoundTripper(
+		WithMaxRetries(4),
+		WithTimeout(time.Minute),
+		WithClock(clock),
+		WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 }),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempt, _ := AttemptFromContext(req.Context())
+			state, _ := BreakerStateFromContext(req.Context())
+			attempts = append(attempts, attempt)
+			states = append(states, state)
+			if len(attempts) < 3 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+	client := http.Client{Transport: transport}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+	if _, err := doAdvancing(client, req, clock, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := []Attempt{{1, 5}, {2, 5}, {3, 5}}
+	if !reflect.DeepEqual(attempts, want) {
+		t.Errorf("Expected %v, got %v", want, attempts)
+	}
+	if !reflect.DeepEqual(states, []State{Close, Close, Close}) {
+		t.Errorf("Expected the closed state, got %v", states)
+	}
+
+	// the request after the timeout is a half-open probe
+	trip(transport.RoundTripper.(*circuit).breaker)
+	clock.Advance(time.Minute + time.Second)
+	req, _ = http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if state := states[len(states)-1]; state != HalfOpen {
+		t.Errorf("Expected %s, got %s", HalfOpen, state)
+	}
+
+	if _, ok := AttemptFromContext(context.Background()); ok {
+		t.Errorf("Expected no attempt outside of the transport")
+	}
+}
+
+func TestAttemptFromContext_Runner(t *testing.T) {
+	runner := NewRunner(WithMaxRetries(1))
+	runner.retrier.Backoff = func(min, max time.Duration, attempt uint32, resp *http.Response) time.Duration {
+		return time.Millisecond
+	}
+
+	var attempts []Attempt
+	_ = runner.Run(context.Background(), func(ctx context.Context) error {
+		attempt, _ := AttemptFromContext(ctx)
+		attempts = append(attempts, attempt)
+		return errors.New("unavailable")
+	})
+	if want := []Attempt{{1, 2}, {2, 2}}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("Expected %v, got %v", want, attempts)
+	}
+}
+
+func TestWithoutAttemptContext(t *testing.T) {
+	var ok bool
+	transport := NewRoundTripper(
+		WithoutAttemptContext(),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			_, ok = AttemptFromContext(req.Context())
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("Expected no attempt in the transport")
+	}
+}
@@ -0,0 +1,269 @@
+// Package controlplane lets a central team tune the resilience settings of
+// a fleet. The client periodically fetches a policy document from an HTTP
+// endpoint and applies it to a gcb transport through its reload path.
+//
+//	transport := gcb.NewRoundTripper(gcb.WithPerKeyBreakers())
+//	client := controlplane.New(transport, controlplane.Config{URL: policyURL})
+//	client.Start()
+//	defer client.Close()
+//
+// A policy document looks like:
+//
+//	{
+//		"max_retries": 2,
+//		"timeout": "30s",
+//		"failure_threshold": 10,
+//		"maintenance": ["billing.internal"],
+//		"forced_states": {"search.internal": "Open"}
+//	}
+//
+// Every field is optional. The maintenance keys and forced states that
+// disappear from the document are released. A forced state only applies to
+// a breaker that exists, so the per-key breaker of a key is forced from the
+// first poll after its first request, even when the document didn't change.
+package controlplane
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+var (
+	defaultInterval = 30 * time.Second
+	defaultTimeout  = 10 * time.Second
+)
+
+type (
+	// Target is what the policies are applied to, a gcb transport
+	Target interface {
+		Reload(opts ...gcb.Option)
+		SetMaintenance(key string, enabled bool)
+		ForceState(name string, state gcb.State) bool
+	}
+
+	// FailureReporter is a Target counting the failed polls, the gcb
+	// transports are one and report them in their health
+	FailureReporter interface {
+		ReportReloadFailure(err error)
+	}
+
+	// Config configures the client, zero values are replaced by the defaults
+	Config struct {
+		// URL of the policy document
+		URL string
+		// Header is sent with every fetch, e.g. for authentication
+		Header http.Header
+		// Interval between two fetches, 30 seconds by default
+		Interval time.Duration
+		// Timeout of a fetch, 10 seconds by default
+		Timeout time.Duration
+	}
+
+	// Document is the policy document served by the control plane
+	Document struct {
+		// MaxRetries is the maximum number of retries
+		MaxRetries *uint32 `json:"max_retries,omitempty"`
+		// Timeout is the period of the open state, e.g. "30s"
+		Timeout string `json:"timeout,omitempty"`
+		// FailureThreshold trips the breakers after as many consecutive
+		// failures
+		FailureThreshold *uint32 `json:"failure_threshold,omitempty"`
+		// Maintenance are the keys in maintenance
+		Maintenance []string `json:"maintenance,omitempty"`
+		// ForcedStates holds breakers open or closed, by name
+		ForcedStates map[string]gcb.State `json:"forced_states,omitempty"`
+	}
+
+	// Client polls the control plane
+	Client struct {
+		target Target
+		config Config
+		client *http.Client
+
+		mu          sync.Mutex
+		last        []byte
+		maintenance map[string]struct{}
+		forced      map[string]struct{}
+		// pending holds the forced states of the breakers that didn't
+		// exist yet, tried again on every poll
+		pending map[string]gcb.State
+
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+)
+
+// New returns a client applying the policies to the target
+func New(target Target, config Config) *Client {
+	if config.Interval == 0 {
+		config.Interval = defaultInterval
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	return &Client{
+		target: target,
+		config: config,
+		client: &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   config.Timeout,
+		},
+		maintenance: make(map[string]struct{}),
+		forced:      make(map[string]struct{}),
+		pending:     make(map[string]gcb.State),
+	}
+}
+
+// Start polls the control plane in the background, starting right away
+func (c *Client) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := c.Poll(ctx); err != nil && ctx.Err() == nil {
+				c.reportFailure(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// reportFailure hands a failed poll to the target, or logs it
+func (c *Client) reportFailure(err error) {
+	err = fmt.Errorf("error polling the control plane: %w", err)
+	if reporter, ok := c.target.(FailureReporter); ok {
+		reporter.ReportReloadFailure(err)
+		return
+	}
+	log.Printf("[ERR] %v", err)
+}
+
+// Close stops the polling
+func (c *Client) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+		<-c.done
+	}
+	return nil
+}
+
+// Poll fetches the policy document and applies it if it changed
+func (c *Client) Poll(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, c.config.URL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range c.config.Header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if bytes.Equal(data, c.last) {
+		for name, state := range c.pending {
+			if c.target.ForceState(name, state) {
+				delete(c.pending, name)
+			}
+		}
+		return nil
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if err := c.apply(doc); err != nil {
+		return err
+	}
+	c.last = data
+	return nil
+}
+
+// apply applies the document to the target, the client must be locked
+func (c *Client) apply(doc Document) error {
+	var opts []gcb.Option
+	if doc.MaxRetries != nil {
+		opts = append(opts, gcb.WithMaxRetries(*doc.MaxRetries))
+	}
+	if doc.Timeout != "" {
+		timeout, err := time.ParseDuration(doc.Timeout)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, gcb.WithTimeout(timeout))
+	}
+	if doc.FailureThreshold != nil {
+		threshold := *doc.FailureThreshold
+		opts = append(opts, gcb.WithReadyToTrip(func(counts gcb.Counts) bool {
+			return counts.ConsecutiveFailures >= threshold
+		}))
+	}
+	if len(opts) > 0 {
+		c.target.Reload(opts...)
+	}
+
+	maintenance := make(map[string]struct{}, len(doc.Maintenance))
+	for _, key := range doc.Maintenance {
+		maintenance[key] = struct{}{}
+		c.target.SetMaintenance(key, true)
+	}
+	for key := range c.maintenance {
+		if _, ok := maintenance[key]; !ok {
+			c.target.SetMaintenance(key, false)
+		}
+	}
+	c.maintenance = maintenance
+
+	forced := make(map[string]struct{}, len(doc.ForcedStates))
+	pending := make(map[string]gcb.State)
+	for name, state := range doc.ForcedStates {
+		forced[name] = struct{}{}
+		if !c.target.ForceState(name, state) {
+			pending[name] = state
+		}
+	}
+	for name := range c.forced {
+		if _, ok := forced[name]; !ok {
+			c.target.ForceState(name, 0)
+		}
+	}
+	c.forced = forced
+	c.pending = pending
+	return nil
+}
@@ -0,0 +1,103 @@
+package controlplane
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestClient_Poll(t *testing.T) {
+	var mu sync.Mutex
+	doc := `{"maintenance": ["billing"], "forced_states": {"search": "Open"}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write([]byte(doc))
+	}))
+	defer server.Close()
+
+	transport := gcb.NewRoundTripper(gcb.WithPerKeyBreakers(), gcb.WithTransport(gcb.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})))
+	client := New(transport, Config{URL: server.URL})
+
+	// the key has no breaker to force until its first request
+	if err := client.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if state := stateOf(transport, "search"); state != 0 {
+		t.Errorf("Expected no breaker, got %s", state)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://search", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !transport.InMaintenance("billing") {
+		t.Errorf("Expected billing to be in maintenance")
+	}
+	if state := stateOf(transport, "search"); state != gcb.Open {
+		t.Errorf("Expected %s, got %s", gcb.Open, state)
+	}
+
+	// the keys gone from the document are released
+	mu.Lock()
+	doc = `{"timeout": "5s"}`
+	mu.Unlock()
+
+	if err := client.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if transport.InMaintenance("billing") {
+		t.Errorf("Expected billing to be out of maintenance")
+	}
+	if err := client.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	doc = `{"timeout": "soon"}`
+	mu.Unlock()
+
+	if err := client.Poll(context.Background()); err == nil {
+		t.Errorf("Expected an invalid document to fail")
+	}
+}
+
+func stateOf(transport interface{ Summaries() []gcb.BreakerSummary }, name string) gcb.State {
+	for _, s := range transport.Summaries() {
+		if s.Name == name {
+			return s.State
+		}
+	}
+	return 0
+}
+
+func TestClient_ReportsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"timeout": "soon"}`))
+	}))
+	defer server.Close()
+
+	transport := gcb.NewRoundTripper(gcb.WithLogLevel(gcb.LevelOff))
+	client := New(transport, Config{URL: server.URL, Interval: time.Millisecond})
+	client.Start()
+	defer client.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for transport.Health().ReloadFailures == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the failed polls to be reported")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
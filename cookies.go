@@ -0,0 +1,94 @@
+package gcb
+
+import (
+	"net/http"
+	"strings"
+)
+
+type (
+	// cookieJar carries the cookies of the attempts over to the retries
+	cookieJar struct {
+		jar http.CookieJar
+		// frozen sends the cookies of the first attempt to the retries
+		frozen bool
+	}
+)
+
+// WithCookieJar has the retries carry the cookies set by the failed
+// attempts. The http.Client only stores the cookies of the response it gets,
+// those of the attempts the transport retried are otherwise lost and the
+// retries send the cookies of the request as is. With a jar, usually the jar
+// of the client, the cookies of every attempt are stored in it and every
+// attempt sends the cookies of the request along with those of the jar,
+// which win by name.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(config *Config) {
+		config.cookieJar = jar
+	}
+}
+
+// WithFrozenCookies has the retries of a request send the cookies of its
+// first attempt, so that a retry replays exactly what was sent whatever the
+// jar got meanwhile, from the failed attempts or from the other requests.
+// The cookies of the attempts are still stored in the jar of WithCookieJar,
+// for the requests to come.
+func WithFrozenCookies() Option {
+	return func(config *Config) {
+		config.frozenCookies = true
+	}
+}
+
+// store stores the cookies set by the response of an attempt
+func (j *cookieJar) store(attempt *http.Request, resp *http.Response) {
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		j.jar.SetCookies(attempt.URL, cookies)
+	}
+}
+
+// header returns the Cookie header of an attempt, the cookies of the request
+// and those of the jar for the URL of the attempt
+func (j *cookieJar) header(req *http.Request, attempt *http.Request) string {
+	stored := j.jar.Cookies(attempt.URL)
+	if len(stored) == 0 {
+		return req.Header.Get("Cookie")
+	}
+	names := make(map[string]bool, len(stored))
+	for _, cookie := range stored {
+		names[cookie.Name] = true
+	}
+
+	var pairs []string
+	for _, cookie := range req.Cookies() {
+		if !names[cookie.Name] {
+			pairs = append(pairs, cookie.Name+"="+cookie.Value)
+		}
+	}
+	for _, cookie := range stored {
+		pairs = append(pairs, cookie.Name+"="+cookie.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// withCookies returns the attempt with the Cookie header. The first attempt
+// shares the header of the request, which is left alone, the retries have
+// their own.
+func withCookies(req, attempt *http.Request, cookie string, first bool) *http.Request {
+	if attempt.Header.Get("Cookie") == cookie {
+		return attempt
+	}
+	if first {
+		if attempt == req {
+			attempt = req.WithContext(req.Context())
+		}
+		attempt.Header = attempt.Header.Clone()
+		if attempt.Header == nil {
+			attempt.Header = make(http.Header)
+		}
+	}
+	if cookie == "" {
+		attempt.Header.Del("Cookie")
+	} else {
+		attempt.Header.Set("Cookie", cookie)
+	}
+	return attempt
+}
@@ -0,0 +1,72 @@
+package gcb
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithCookieJar(t *testing.T) {
+	tests := []struct {
+		name     string
+		jar      bool
+		frozen   bool
+		cookie   string
+		sent     []string
+		expected string
+	}{
+		{"without jar", false, false, "user=1", []string{"user=1", "user=1"}, ""},
+		{"jar", true, false, "user=1", []string{"user=1", "user=1; session=new"}, "session=new"},
+		{"jar wins", true, false, "session=old; user=1", []string{"session=old; user=1", "user=1; session=new"}, "session=new"},
+		{"frozen", true, true, "user=1", []string{"user=1", "user=1"}, "session=new"},
+	}
+
+	for _, tt := range tests {
+		var sent []string
+		jar, _ := cookiejar.New(nil)
+		opts := []Option{
+			WithMaxRetries(1),
+			WithRetryWait(time.Millisecond, time.Millisecond),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = append(sent, req.Header.Get("Cookie"))
+				if len(sent) == 1 {
+					header := http.Header{"Set-Cookie": {"session=new"}}
+					return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header, Body: http.NoBody}, nil
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})),
+		}
+		if tt.jar {
+			opts = append(opts, WithCookieJar(jar))
+		}
+		if tt.frozen {
+			opts = append(opts, WithFrozenCookies())
+		}
+		transport := NewRoundTripper(opts...)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example/", nil)
+		req.Header.Set("Cookie", tt.cookie)
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if !reflect.DeepEqual(sent, tt.sent) {
+			t.Errorf("%s: Expected %q, got %q", tt.name, tt.sent, sent)
+		}
+		if got := req.Header.Get("Cookie"); got != tt.cookie {
+			t.Errorf("%s: Expected the request to keep %q, got %q", tt.name, tt.cookie, got)
+		}
+		var stored string
+		for _, cookie := range jar.Cookies(&url.URL{Scheme: "http", Host: "api.example"}) {
+			stored = cookie.String()
+		}
+		if stored != tt.expected {
+			t.Errorf("%s: Expected %q in the jar, got %q", tt.name, tt.expected, stored)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package gcb
+
+type (
+	// CountsStore aggregates the closed-state counts of the breakers, e.g.
+	// across the instances of a service. It's called while the breaker is
+	// locked, so it must not block: a store backed by a remote service
+	// records locally and synchronises in the background.
+	CountsStore interface {
+		// Record records the outcome of a request of the breaker
+		Record(name string, success bool)
+		// Counts returns the aggregated counts of the breaker, false when
+		// they are unavailable, e.g. the shared store can't be reached
+		Counts(name string) (Counts, bool)
+		// Reset clears the counts of the breaker, it's called when the
+		// breaker closes again
+		Reset(name string)
+	}
+)
+
+// WithCountsStore makes ReadyToTrip decide on the counts aggregated by the
+// store. When the store has no counts available the breaker falls back to
+// its local counts, so the breaker never depends on the store being up.
+func WithCountsStore(store CountsStore) Option {
+	return func(config *Config) {
+		config.countsStore = store
+	}
+}
+
+// record forwards the outcome of a closed-state request to the store, the
+// breaker must be locked
+func (cb *Breaker) record(success bool) {
+	if cb.countsStore != nil {
+		cb.countsStore.Record(cb.name, success)
+	}
+}
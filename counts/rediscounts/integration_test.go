@@ -0,0 +1,75 @@
+//go:build gcb_integration
+
+package rediscounts
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// These tests run against the Redis at REDIS_ADDR:
+//
+//	REDIS_ADDR=localhost:6379 go test -tags gcb_integration ./counts/rediscounts
+
+func newTestClient(t *testing.T) *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR isn't set")
+	}
+	return redis.NewClient(&redis.Options{Addr: addr})
+}
+
+func TestStore_SharedWindow(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+
+	prefix := "gcb-test:" + time.Now().Format(time.RFC3339Nano) + ":"
+	config := Config{Prefix: prefix, Interval: time.Hour, Window: 200 * time.Millisecond, TTL: time.Second}
+	first, second := New(client, config), New(client, config)
+	defer first.Close()
+	defer second.Close()
+
+	// start at the beginning of a window
+	time.Sleep(time.Until(time.Now().Truncate(config.Window).Add(config.Window)))
+	first.Record("api", false)
+	second.Record("api", false)
+	if err := first.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if counts, _ := second.Counts("api"); counts.TotalFailures != 2 {
+		t.Errorf("Expected %d failures, got %+v", 2, counts)
+	}
+
+	// the next window starts over
+	time.Sleep(config.Window)
+	if counts, _ := second.Counts("api"); counts.TotalFailures != 0 {
+		t.Errorf("Expected %d failures, got %+v", 0, counts)
+	}
+	first.Record("api", true)
+	if err := first.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if counts, _ := second.Counts("api"); counts.Requests != 1 || counts.TotalFailures != 0 {
+		t.Errorf("Expected only the request of the window, got %+v", counts)
+	}
+
+	// the past windows expire, even though the stores keep reading them
+	time.Sleep(config.TTL + config.Window)
+	_ = first.Flush()
+	keys, err := client.Keys(prefix + "*").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected the counts to expire, got %v", keys)
+	}
+}
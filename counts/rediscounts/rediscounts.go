@@ -0,0 +1,477 @@
+// Package rediscounts aggregates the breaker counts of every instance in
+// Redis, with a local fallback.
+//
+// Outcomes are recorded locally and pushed to Redis in the background, so
+// the requests never wait on Redis. While Redis answers, the breakers decide
+// on the counts of the whole fleet; when it can't be reached for a while the
+// store reports the shared counts as unavailable and the breakers go back to
+// their local counts until it's reachable again.
+//
+//	store := rediscounts.New(client, rediscounts.Config{Prefix: "gcb:"})
+//	defer store.Close()
+//	transport := gcb.NewRoundTripper(gcb.WithCountsStore(store))
+//
+// The breakers clear their counts every interval, the shared counts follow
+// with a Window set to the same interval and gcb.WithAlignedInterval, so
+// every instance rolls over at the same time:
+//
+//	store := rediscounts.New(client, rediscounts.Config{Prefix: "gcb:", Window: time.Minute})
+//	transport := gcb.NewRoundTripper(gcb.WithCountsStore(store), gcb.WithInterval(time.Minute), gcb.WithAlignedInterval())
+package rediscounts
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"github.com/go-redis/redis/v7"
+)
+
+var (
+	// makes sure the store implements the gcb counts store and quorum
+	// interfaces
+	_ gcb.CountsStore = (*Store)(nil)
+	_ gcb.Quorum      = (*Store)(nil)
+
+	defaultInterval = 500 * time.Millisecond
+
+	// merge applies the delta of an instance to the shared counts and
+	// returns them. The consecutive counts are set rather than incremented
+	// when the delta broke the streak. An empty delta only reads them, so
+	// the counts nobody records for expire.
+	merge = redis.NewScript(`
+if ARGV[1] == '0' and ARGV[6] == '0' and ARGV[7] == '0' then
+	return redis.call('HMGET', KEYS[1], 'requests', 'successes', 'failures', 'consecutive_successes', 'consecutive_failures')
+end
+redis.call('HINCRBY', KEYS[1], 'requests', ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'successes', ARGV[2])
+redis.call('HINCRBY', KEYS[1], 'failures', ARGV[3])
+if ARGV[6] == '1' then
+	redis.call('HSET', KEYS[1], 'consecutive_successes', ARGV[4])
+else
+	redis.call('HINCRBY', KEYS[1], 'consecutive_successes', ARGV[4])
+end
+if ARGV[7] == '1' then
+	redis.call('HSET', KEYS[1], 'consecutive_failures', ARGV[5])
+else
+	redis.call('HINCRBY', KEYS[1], 'consecutive_failures', ARGV[5])
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[8])
+return redis.call('HMGET', KEYS[1], 'requests', 'successes', 'failures', 'consecutive_successes', 'consecutive_failures')
+`)
+)
+
+type (
+	// Config configures the store
+	Config struct {
+		// Prefix is prepended to the breaker names to build the Redis keys
+		Prefix string
+		// Interval between two synchronisations, 500 milliseconds by default
+		Interval time.Duration
+		// TTL expires the shared counts of a breaker nobody records for,
+		// it defaults to a minute
+		TTL time.Duration
+		// Window starts the shared counts over every window, aligned on
+		// the multiples of the window since the zero time as
+		// gcb.WithAlignedInterval does. Set it to the interval of the
+		// breakers, zero keeps the counts until the breaker closes again
+		// or nobody records for TTL.
+		Window time.Duration
+		// StaleAfter is the time without a successful synchronisation after
+		// which the shared counts are unavailable, it defaults to three
+		// intervals
+		StaleAfter time.Duration
+		// Instance identifies this instance, it enables the publication of
+		// the per-instance failure rates
+		Instance string
+		// RateExpiry is the age after which the failure rate of an instance
+		// is ignored, it defaults to ten intervals
+		RateExpiry time.Duration
+	}
+
+	// delta is what an instance recorded since the last synchronisation
+	delta struct {
+		// window is the start of the window recorded in
+		window time.Time
+
+		requests, successes, failures             uint32
+		consecutiveSuccesses, consecutiveFailures uint32
+		brokeSuccessStreak, brokeFailureStreak    bool
+	}
+
+	// Store is a gcb.CountsStore shared through Redis
+	Store struct {
+		client *redis.Client
+		config Config
+
+		mu      sync.Mutex
+		pending map[string]*delta
+		shared  map[string]gcb.Counts
+		resets  map[string]struct{}
+		rates   map[string][]float64
+		synced  time.Time
+		// window is the start of the window the shared counts are of
+		window time.Time
+
+		stop chan struct{}
+		done chan struct{}
+	}
+)
+
+// New returns a store over the Redis client and starts its synchronisation
+func New(client *redis.Client, config Config) *Store {
+	if config.Interval == 0 {
+		config.Interval = defaultInterval
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Minute
+	}
+	if config.TTL < config.Window {
+		config.TTL = config.Window
+	}
+	if config.StaleAfter == 0 {
+		config.StaleAfter = 3 * config.Interval
+	}
+	if config.RateExpiry == 0 {
+		config.RateExpiry = 10 * config.Interval
+	}
+
+	s := &Store{
+		client:  client,
+		config:  config,
+		pending: make(map[string]*delta),
+		shared:  make(map[string]gcb.Counts),
+		resets:  make(map[string]struct{}),
+		rates:   make(map[string][]float64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Close stops the synchronisation
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.done
+	return nil
+}
+
+// Record records the outcome locally, it's pushed on the next synchronisation
+func (s *Store) Record(name string, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	window := s.windowOf(time.Now())
+	d, ok := s.pending[name]
+	if !ok || !d.window.Equal(window) {
+		// the last window is over, what it recorded is left out
+		d = &delta{window: window}
+		s.pending[name] = d
+	}
+	d.record(success)
+}
+
+// Counts returns the shared counts plus what's not pushed yet, false when
+// Redis couldn't be reached lately
+func (s *Store) Counts(name string) (gcb.Counts, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.synced.IsZero() || time.Since(s.synced) > s.config.StaleAfter {
+		return gcb.Counts{}, false
+	}
+	// the counts of a past window are over, as the local ones are
+	window := s.windowOf(time.Now())
+	var counts gcb.Counts
+	if s.window.Equal(window) {
+		counts = s.shared[name]
+	}
+	if d, ok := s.pending[name]; ok && d.window.Equal(window) {
+		counts = d.apply(counts)
+	}
+	return counts, true
+}
+
+// windowOf returns the start of the window of now, the zero time without
+// windows
+func (s *Store) windowOf(now time.Time) time.Time {
+	if s.config.Window <= 0 {
+		return time.Time{}
+	}
+	return now.Truncate(s.config.Window)
+}
+
+// key returns the Redis key of the shared counts of the breaker in the
+// window
+func (s *Store) key(name string, window time.Time) string {
+	if window.IsZero() {
+		return s.config.Prefix + name
+	}
+	return s.config.Prefix + name + ":" + strconv.FormatInt(window.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// PeerFailureRates returns the failure rates the other instances published
+// lately, nil when Redis couldn't be reached lately
+func (s *Store) PeerFailureRates(name string) []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.synced.IsZero() || time.Since(s.synced) > s.config.StaleAfter {
+		return nil
+	}
+	return s.rates[name]
+}
+
+// Reset drops the local counts and clears the shared ones on the next
+// synchronisation
+func (s *Store) Reset(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, name)
+	delete(s.shared, name)
+	s.resets[name] = struct{}{}
+}
+
+func (s *Store) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			_ = s.sync()
+		}
+	}
+}
+
+// Flush pushes the pending deltas now instead of on the next
+// synchronisation, gcb flushes the store on Shutdown
+func (s *Store) Flush() error {
+	return s.sync()
+}
+
+// sync pushes the pending deltas and pulls the shared counts of every
+// breaker known to the store
+func (s *Store) sync() error {
+	s.mu.Lock()
+	pending, resets := s.pending, s.resets
+	s.pending = make(map[string]*delta)
+	s.resets = make(map[string]struct{})
+	names := make(map[string]struct{}, len(pending)+len(s.shared))
+	for name := range pending {
+		names[name] = struct{}{}
+	}
+	for name := range s.shared {
+		names[name] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	window := s.windowOf(time.Now())
+	pipe := s.client.Pipeline()
+	for name := range resets {
+		pipe.Del(s.key(name, window))
+	}
+	cmds := make(map[string]*redis.Cmd, len(names))
+	for name := range names {
+		d := pending[name]
+		if d == nil || !d.window.Equal(window) {
+			// the window of the delta is over, nobody reads its counts
+			d = &delta{window: window}
+		}
+		cmds[name] = merge.Eval(pipe, []string{s.key(name, window)}, d.args(s.config.TTL)...)
+	}
+	rateCmds := make(map[string]*redis.StringStringMapCmd)
+	if s.config.Instance != "" {
+		now := time.Now()
+		for name := range names {
+			key := s.config.Prefix + name + ":rates"
+			if d := pending[name]; d != nil && d.requests > 0 {
+				rate := float64(d.failures) / float64(d.requests)
+				pipe.HSet(key, s.config.Instance, formatRate(rate, now))
+				pipe.PExpire(key, s.config.TTL)
+			}
+			rateCmds[name] = pipe.HGetAll(key)
+		}
+	}
+	_, err := pipe.Exec()
+	if err == redis.Nil {
+		err = nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		// keep the deltas for the next attempt, ahead of what was recorded
+		// in the meantime, and the resets that didn't go through
+		for name, d := range pending {
+			if _, reset := s.resets[name]; reset {
+				continue
+			}
+			if later, ok := s.pending[name]; ok {
+				if !later.window.Equal(d.window) {
+					continue
+				}
+				d.add(later)
+			}
+			s.pending[name] = d
+		}
+		for name := range resets {
+			s.resets[name] = struct{}{}
+		}
+		return err
+	}
+
+	for name, cmd := range cmds {
+		if _, reset := s.resets[name]; reset {
+			continue
+		}
+		values, err := cmd.Result()
+		if err != nil {
+			continue
+		}
+		s.shared[name] = parseCounts(values)
+	}
+	s.window = window
+	for name, cmd := range rateCmds {
+		if values, err := cmd.Result(); err == nil {
+			s.rates[name] = s.peerRates(values, time.Now())
+		}
+	}
+	s.synced = time.Now()
+	return nil
+}
+
+// peerRates returns the fresh rates of the other instances
+func (s *Store) peerRates(values map[string]string, now time.Time) []float64 {
+	var rates []float64
+	for instance, value := range values {
+		if instance == s.config.Instance {
+			continue
+		}
+		rate, at, ok := parseRate(value)
+		if !ok || now.Sub(at) > s.config.RateExpiry {
+			continue
+		}
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+// formatRate encodes a failure rate along with the time it was measured
+func formatRate(rate float64, at time.Time) string {
+	return strconv.FormatFloat(rate, 'f', 4, 64) + "|" + strconv.FormatInt(at.UnixNano()/int64(time.Millisecond), 10)
+}
+
+func parseRate(value string) (float64, time.Time, bool) {
+	i := strings.IndexByte(value, '|')
+	if i < 0 {
+		return 0, time.Time{}, false
+	}
+	rate, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	millis, err := strconv.ParseInt(value[i+1:], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return rate, time.Unix(0, millis*int64(time.Millisecond)), true
+}
+
+func (d *delta) record(success bool) {
+	d.requests++
+	if success {
+		d.successes++
+		d.consecutiveSuccesses++
+		d.consecutiveFailures = 0
+		d.brokeFailureStreak = true
+	} else {
+		d.failures++
+		d.consecutiveFailures++
+		d.consecutiveSuccesses = 0
+		d.brokeSuccessStreak = true
+	}
+}
+
+// add appends the later delta to d
+func (d *delta) add(later *delta) {
+	d.requests += later.requests
+	d.successes += later.successes
+	d.failures += later.failures
+	if later.brokeSuccessStreak {
+		d.consecutiveSuccesses = later.consecutiveSuccesses
+	} else {
+		d.consecutiveSuccesses += later.consecutiveSuccesses
+	}
+	if later.brokeFailureStreak {
+		d.consecutiveFailures = later.consecutiveFailures
+	} else {
+		d.consecutiveFailures += later.consecutiveFailures
+	}
+	d.brokeSuccessStreak = d.brokeSuccessStreak || later.brokeSuccessStreak
+	d.brokeFailureStreak = d.brokeFailureStreak || later.brokeFailureStreak
+}
+
+// apply returns the counts with the delta applied
+func (d *delta) apply(counts gcb.Counts) gcb.Counts {
+	counts.Requests += d.requests
+	counts.TotalSuccesses += d.successes
+	counts.TotalFailures += d.failures
+	if d.brokeSuccessStreak {
+		counts.ConsecutiveSuccesses = d.consecutiveSuccesses
+	} else {
+		counts.ConsecutiveSuccesses += d.consecutiveSuccesses
+	}
+	if d.brokeFailureStreak {
+		counts.ConsecutiveFailures = d.consecutiveFailures
+	} else {
+		counts.ConsecutiveFailures += d.consecutiveFailures
+	}
+	return counts
+}
+
+// args are the arguments of the merge script
+func (d *delta) args(ttl time.Duration) []interface{} {
+	flag := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	return []interface{}{
+		d.requests, d.successes, d.failures,
+		d.consecutiveSuccesses, d.consecutiveFailures,
+		flag(d.brokeSuccessStreak), flag(d.brokeFailureStreak),
+		ttl.Milliseconds(),
+	}
+}
+
+func parseCounts(value interface{}) gcb.Counts {
+	values, _ := value.([]interface{})
+	fields := make([]uint32, 5)
+	for i := range fields {
+		if i >= len(values) {
+			break
+		}
+		if s, ok := values[i].(string); ok {
+			n, _ := strconv.ParseUint(s, 10, 32)
+			fields[i] = uint32(n)
+		}
+	}
+	return gcb.Counts{
+		Requests:             fields[0],
+		TotalSuccesses:       fields[1],
+		TotalFailures:        fields[2],
+		ConsecutiveSuccesses: fields[3],
+		ConsecutiveFailures:  fields[4],
+	}
+}
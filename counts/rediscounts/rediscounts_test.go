@@ -0,0 +1,129 @@
+package rediscounts
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"github.com/go-redis/redis/v7"
+)
+
+func TestStore_Unreachable(t *testing.T) {
+	// nothing listens on the discard port
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:9", DialTimeout: 50 * time.Millisecond, MaxRetries: -1})
+	defer client.Close()
+
+	store := New(client, Config{Interval: 10 * time.Millisecond})
+
+	store.Record("test", false)
+	time.Sleep(50 * time.Millisecond)
+
+	if _, ok := store.Counts("test"); ok {
+		t.Errorf("Expected the shared counts to be unavailable")
+	}
+
+	_ = store.Close()
+	if d := store.pending["test"]; d == nil || d.failures != 1 {
+		t.Errorf("Expected the failure to be kept for the next attempt, got %+v", d)
+	}
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		base     gcb.Counts
+		outcomes []bool
+		expected gcb.Counts
+	}{
+		{
+			gcb.Counts{Requests: 3, TotalFailures: 3, ConsecutiveFailures: 3},
+			[]bool{false, false},
+			gcb.Counts{Requests: 5, TotalFailures: 5, ConsecutiveFailures: 5},
+		},
+		{
+			gcb.Counts{Requests: 3, TotalFailures: 3, ConsecutiveFailures: 3},
+			[]bool{false, true, true},
+			gcb.Counts{Requests: 6, TotalSuccesses: 2, TotalFailures: 4, ConsecutiveSuccesses: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		// split the outcomes over two deltas to cover add as well
+		first, second := &delta{}, &delta{}
+		for i, success := range tt.outcomes {
+			if i == 0 {
+				first.record(success)
+			} else {
+				second.record(success)
+			}
+		}
+		first.add(second)
+
+		if counts := first.apply(tt.base); counts != tt.expected {
+			t.Errorf("Expected %+v, got %+v", tt.expected, counts)
+		}
+	}
+}
+
+func TestStore_PeerRates(t *testing.T) {
+	store := &Store{config: Config{Instance: "self", RateExpiry: time.Minute}}
+	now := time.Now()
+
+	rates := store.peerRates(map[string]string{
+		"self":    formatRate(1, now),
+		"fresh":   formatRate(0.5, now),
+		"stale":   formatRate(1, now.Add(-time.Hour)),
+		"invalid": "garbage",
+	}, now)
+
+	if len(rates) != 1 || rates[0] != 0.5 {
+		t.Errorf("Expected [0.5], got %v", rates)
+	}
+}
+
+func TestStore_Window(t *testing.T) {
+	store := &Store{
+		config:  Config{Prefix: "gcb:", Window: time.Hour, StaleAfter: time.Hour},
+		pending: make(map[string]*delta),
+		shared:  map[string]gcb.Counts{"test": {Requests: 3, TotalFailures: 3, ConsecutiveFailures: 3}},
+		synced:  time.Now(),
+	}
+	now := store.windowOf(time.Now())
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		shared   time.Time
+		pending  time.Time
+		expected gcb.Counts
+	}{
+		{"current", now, now, gcb.Counts{Requests: 4, TotalFailures: 4, ConsecutiveFailures: 4}},
+		{"synced before the rollover", past, now, gcb.Counts{Requests: 1, TotalFailures: 1, ConsecutiveFailures: 1}},
+		{"recorded before the rollover", now, past, gcb.Counts{Requests: 3, TotalFailures: 3, ConsecutiveFailures: 3}},
+		{"all before the rollover", past, past, gcb.Counts{}},
+	}
+
+	for _, tt := range tests {
+		store.window = tt.shared
+		store.pending["test"] = &delta{window: tt.pending}
+		store.pending["test"].record(false)
+
+		if counts, ok := store.Counts("test"); !ok || counts != tt.expected {
+			t.Errorf("%s: Expected %+v, got %+v", tt.name, tt.expected, counts)
+		}
+	}
+
+	// the outcomes of the past window are left out of the next one
+	store.pending["test"] = &delta{window: past, requests: 5}
+	store.Record("test", true)
+	if d := store.pending["test"]; !d.window.Equal(now) || d.requests != 1 {
+		t.Errorf("Expected a delta of the current window, got %+v", d)
+	}
+
+	if key := store.key("test", now); key != "gcb:test:"+strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10) {
+		t.Errorf("Expected a key of the window, got %s", key)
+	}
+	if key := store.key("test", time.Time{}); key != "gcb:test" {
+		t.Errorf("Expected %s, got %s", "gcb:test", key)
+	}
+}
@@ -0,0 +1,193 @@
+package gcb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type (
+	// StateDumper writes a human-readable snapshot of its state, as the
+	// transports returned by NewRoundTripper do
+	StateDumper interface {
+		DumpState(w io.Writer) error
+	}
+
+	// breakerDump is the configuration and the live state of a breaker
+	breakerDump struct {
+		name        string
+		state       State
+		forced      State
+		counts      Counts
+		expiry      time.Time
+		now         time.Time
+		maxRequests uint32
+		interval    time.Duration
+		timeout     time.Duration
+		latency     latencySnapshot
+	}
+)
+
+// DumpState writes a human-readable snapshot of the transport: the retry
+// policy, the rate limits, the throttling, the keys in maintenance and the
+// configuration and counts of every breaker. It's meant to be attached to
+// incident tickets, its format isn't stable.
+func (t *tripper) DumpState(w io.Writer) error {
+	c := t.RoundTripper.(*circuit)
+	now := time.Now()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "gcb state at %s\n\n", now.Format(time.RFC3339))
+
+	c.retrier.dump(tw)
+	if c.throttle != nil {
+		c.throttle.dump(tw)
+	}
+	c.maintenance.dump(tw)
+	c.audit.dump(tw)
+	dumpHealth(tw, c.healthStats())
+
+	breakers := c.allBreakers()
+	fmt.Fprintf(tw, "breakers (%d)\n", len(breakers))
+	fmt.Fprintln(tw, "  NAME\tSTATE\tFORCED\tREQUESTS\tSUCCESSES\tFAILURES\tCONSEC-S\tCONSEC-F\tEXPIRES\tMAX-REQ\tINTERVAL\tTIMEOUT")
+	for _, cb := range breakers {
+		d := cb.dump()
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\t%d\t%s\t%s\n",
+			dumpName(d.name), d.state, dumpForced(d.forced),
+			d.counts.Requests, d.counts.TotalSuccesses, d.counts.TotalFailures,
+			d.counts.ConsecutiveSuccesses, d.counts.ConsecutiveFailures,
+			dumpExpiry(d.expiry, d.now), d.maxRequests, d.interval, d.timeout)
+	}
+	return tw.Flush()
+}
+
+// dump returns the configuration and the live state of the breaker
+func (cb *Breaker) dump() breakerDump {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := cb.clock.Now()
+	state, _ := cb.currentState(now)
+	return breakerDump{
+		name:        cb.name,
+		state:       state,
+		forced:      cb.forced,
+		counts:      cb.counts.load(),
+		expiry:      cb.expiry,
+		now:         now,
+		maxRequests: cb.maxRequests,
+		interval:    cb.interval,
+		timeout:     cb.timeout,
+		// the latencies are timed on the system clock
+		latency: cb.latencies.snapshot(time.Now()),
+	}
+}
+
+func (r *Retrier) dump(w io.Writer) {
+	r.mu.RLock()
+	retryMax, limiter := r.RetryMax, r.Limiter
+	r.mu.RUnlock()
+
+	fmt.Fprintln(w, "retrier")
+	fmt.Fprintf(w, "  max retries\t%d\n", retryMax)
+	fmt.Fprintf(w, "  wait\t%s - %s\n", r.RetryWaitMin, r.RetryWaitMax)
+	fmt.Fprintf(w, "  rate limit\t%s\n", dumpLimiter(limiter))
+
+	active := r.activeWindow(r.now())
+	for i, win := range r.windows {
+		status := ""
+		if win == active {
+			status = ", active"
+		}
+		fmt.Fprintf(w, "  window %d\tmax retries %d, rate limit %s%s\n", i, win.MaxRetries, dumpLimiter(win.limiter), status)
+	}
+	fmt.Fprintln(w)
+}
+
+func (t *throttle) dump(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprintln(w, "throttle")
+	fmt.Fprintf(w, "  tokens\t%.2f of %.2f, ratio %.2f\n\n", t.tokens, t.maxTokens, t.tokenRatio)
+}
+
+func (m *maintenance) dump(w io.Writer) {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.keys))
+	for key := range m.keys {
+		keys = append(keys, key)
+	}
+	m.mu.RUnlock()
+
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "maintenance (%d)\n", len(keys))
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s\n", dumpName(key))
+	}
+	fmt.Fprintln(w)
+}
+
+func (a *auditLog) dump(w io.Writer) {
+	entries := a.list()
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "audit (%d)\n", len(entries))
+	for _, entry := range entries {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", entry.Time.Format(time.RFC3339), entry.Principal, entry.Action, entry.Target, entry.Detail)
+	}
+	fmt.Fprintln(w)
+}
+
+func dumpHealth(w io.Writer, health HealthStats) {
+	fmt.Fprintln(w, "health")
+	fmt.Fprintf(w, "  event drops\t%d\n", health.EventDrops)
+	fmt.Fprintf(w, "  evictions\t%d\n", health.Evictions)
+	fmt.Fprintf(w, "  queue errors\t%d\n", health.QueueErrors)
+	fmt.Fprintf(w, "  publish errors\t%d\n", health.PublishErrors)
+	fmt.Fprintf(w, "  reload failures\t%d\n\n", health.ReloadFailures)
+}
+
+// dumpLimiter describes a limiter, the limit and burst only for a
+// *rate.Limiter
+func dumpLimiter(limiter Limiter) string {
+	switch l := limiter.(type) {
+	case nil:
+		return "none"
+	case *rate.Limiter:
+		if l.Limit() == rate.Inf {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%g/s, burst %d", float64(l.Limit()), l.Burst())
+	}
+	return fmt.Sprintf("%T", limiter)
+}
+
+func dumpName(name string) string {
+	if name == "" {
+		return `""`
+	}
+	return name
+}
+
+func dumpForced(forced State) string {
+	if forced == 0 {
+		return "-"
+	}
+	return forced.String()
+}
+
+func dumpExpiry(expiry, now time.Time) string {
+	if expiry.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("in %s", expiry.Sub(now).Round(time.Millisecond))
+}
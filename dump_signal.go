@@ -0,0 +1,37 @@
+//go:build !windows
+
+package gcb
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// DumpOnSignal writes the state of the transports to w every time the
+// process receives SIGUSR1, e.g. os.Stderr, until the returned function is
+// called. Windows has no SIGUSR1, DumpState can be called directly there.
+func DumpOnSignal(w io.Writer, transports ...StateDumper) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				for _, t := range transports {
+					_ = t.DumpState(w)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
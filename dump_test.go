@@ -0,0 +1,64 @@
+package gcb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTripper_DumpState(t *testing.T) {
+	transport := NewRoundTripper(
+		WithName("payments"),
+		WithTimeout(time.Minute),
+		WithMaxRetries(2),
+		WithThrottle(10, 0.1),
+		WithMaintenance("b.example", "a.example"),
+		WithReadyToTrip(func(counts Counts) bool { return true }),
+	)
+	trip(transport.RoundTripper.(*circuit).breaker)
+
+	var buf bytes.Buffer
+	if err := transport.DumpState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"retries", "max retries  2\n"},
+		{"rate limit", "rate limit   200/s, burst 200\n"},
+		{"throttle", "tokens  10.00 of 10.00, ratio 0.10\n"},
+		{"maintenance", "maintenance (2)\n  a.example\n  b.example\n"},
+		{"breaker", "  payments  Open   -       0         0          0         0         0         in 1m0s  1        0s        1m0s\n"},
+	}
+
+	for _, tt := range tests {
+		if !strings.Contains(dump, tt.want) {
+			t.Errorf("%s: Expected %q in\n%s", tt.name, tt.want, dump)
+		}
+	}
+}
+
+func TestTripper_DumpStateForced(t *testing.T) {
+	transport := NewRoundTripper(WithPerKeyBreakers(), WithoutRateLimit())
+	transport.RoundTripper.(*circuit).breakers.get("api.example")
+	transport.ForceState("api.example", Close)
+
+	var buf bytes.Buffer
+	if err := transport.DumpState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+
+	for _, want := range []string{"rate limit   none\n", "breakers (1)\n", "api.example  Close  Close"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Expected %q in\n%s", want, dump)
+		}
+	}
+	if strings.Contains(dump, "throttle") || strings.Contains(dump, "maintenance") {
+		t.Errorf("Expected no throttle nor maintenance in\n%s", dump)
+	}
+}
@@ -0,0 +1,219 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// RetryExhaustedError is returned when the last allowed attempt failed
+	// too. LastStatus is the status code of the last response, zero when the
+	// last attempt failed with LastErr. Errors holds the failure of every
+	// attempt, first to last, unless WithLastErrorOnly is set.
+	RetryExhaustedError struct {
+		Attempts   uint32
+		LastStatus int
+		LastErr    error
+		Errors     []AttemptError
+	}
+
+	// AttemptError is the failure of one attempt, either an error or a
+	// status code
+	AttemptError struct {
+		// Attempt is the number of the attempt, starting at 1
+		Attempt uint32
+		Time    time.Time
+		Status  int
+		Err     error
+	}
+
+	// BreakerOpenError is returned when the breaker is open. RetryAfter is
+	// the time left until the breaker lets a probe through.
+	BreakerOpenError struct {
+		Name       string
+		OpenedAt   time.Time
+		RetryAfter time.Duration
+	}
+
+	// RateLimitedError is returned when a rate limit refused a request, see
+	// RateLimitPolicy, or a retry. Err is then the failure of the attempt
+	// which would have been retried.
+	RateLimitedError struct {
+		Err error
+	}
+
+	// upstreamTimeoutError marks a deadline error the caller didn't cause,
+	// e.g. a transport timeout, which matches context.DeadlineExceeded but
+	// is a failure of the upstream
+	upstreamTimeoutError struct {
+		err error
+	}
+)
+
+// WithLastErrorOnly leaves the failures of the attempts before the last one
+// out of the RetryExhaustedError
+func WithLastErrorOnly() Option {
+	return func(config *Config) {
+		config.lastErrorOnly = true
+	}
+}
+
+func (e *RetryExhaustedError) Error() string {
+	msg := fmt.Sprintf("%v: giving up after %d attempts", errMaxRetriesReached, e.Attempts)
+	if len(e.Errors) > 1 {
+		failures := make([]string, len(e.Errors))
+		for i, failure := range e.Errors {
+			failures[i] = failure.Error()
+		}
+		return msg + ": " + strings.Join(failures, "; ")
+	}
+	if e.LastErr != nil {
+		return msg + ": " + e.LastErr.Error()
+	}
+	if e.LastStatus != 0 {
+		return fmt.Sprintf("%s: status code %d", msg, e.LastStatus)
+	}
+	return msg
+}
+
+// Unwrap returns the error of the last attempt
+func (e *RetryExhaustedError) Unwrap() error {
+	return e.LastErr
+}
+
+// Is matches any RetryExhaustedError and the error of any attempt
+func (e *RetryExhaustedError) Is(target error) bool {
+	if target == errMaxRetriesReached {
+		return true
+	}
+	if _, ok := target.(*RetryExhaustedError); ok {
+		return true
+	}
+	for _, failure := range e.Errors {
+		if failure.Err != nil && errors.Is(failure.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the target in the error of any attempt
+func (e *RetryExhaustedError) As(target interface{}) bool {
+	for _, failure := range e.Errors {
+		if failure.Err != nil && errors.As(failure.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e AttemptError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("attempt %d: %v", e.Attempt, e.Err)
+	}
+	return fmt.Sprintf("attempt %d: status code %d", e.Attempt, e.Status)
+}
+
+// Unwrap returns the error of the attempt
+func (e AttemptError) Unwrap() error {
+	return e.Err
+}
+
+// newAttemptError describes the failed attempt, numbered from 0
+func newAttemptError(attempt uint32, resp *http.Response, err error) AttemptError {
+	failure := AttemptError{Attempt: attempt + 1, Time: time.Now(), Err: err}
+	if err == nil && resp != nil {
+		failure.Status = resp.StatusCode
+	}
+	return failure
+}
+
+// newRetryExhaustedError describes the last failed attempt, along with the
+// previous failures if any
+func newRetryExhaustedError(attempts uint32, last AttemptError, failures []AttemptError) *RetryExhaustedError {
+	e := &RetryExhaustedError{
+		Attempts:   attempts,
+		LastStatus: last.Status,
+		LastErr:    last.Err,
+	}
+	if failures != nil {
+		e.Errors = append(failures, last)
+	}
+	return e
+}
+
+func (e *BreakerOpenError) Error() string {
+	if e.Name == "" {
+		return ErrOpenState.Error()
+	}
+	return fmt.Sprintf("%v: %s", ErrOpenState, e.Name)
+}
+
+// Is matches ErrOpenState and any BreakerOpenError
+func (e *BreakerOpenError) Is(target error) bool {
+	if target == ErrOpenState {
+		return true
+	}
+	_, ok := target.(*BreakerOpenError)
+	return ok
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.Err == nil {
+		return "exceeded rate limit"
+	}
+	return fmt.Sprintf("exceeded rate limit: %v", e.Err)
+}
+
+func (e *RateLimitedError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any RateLimitedError
+func (e *RateLimitedError) Is(target error) bool {
+	_, ok := target.(*RateLimitedError)
+	return ok
+}
+
+// newBreakerOpenError describes the open breaker, it must be locked
+func (cb *Breaker) newBreakerOpenError(now time.Time) *BreakerOpenError {
+	retryAfter := cb.expiry.Sub(now)
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return &BreakerOpenError{
+		Name:       cb.name,
+		OpenedAt:   cb.openedAt,
+		RetryAfter: retryAfter,
+	}
+}
+
+func (e *upstreamTimeoutError) Error() string {
+	return e.err.Error()
+}
+
+func (e *upstreamTimeoutError) Unwrap() error {
+	return e.err
+}
+
+// classifyTimeout marks the deadline errors of an attempt the caller didn't
+// give up on as upstream timeouts
+func classifyTimeout(req *http.Request, err error) error {
+	if err == nil || req.Context().Err() != nil {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return &upstreamTimeoutError{err: err}
+	}
+	return err
+}
+
+// abandoned reports whether err is the caller cancelling req, during an
+// attempt or the backoff between two
+func abandoned(req *http.Request, err error) bool {
+	return req != nil && errors.Is(err, context.Canceled) && req.Context().Err() == context.Canceled
+}
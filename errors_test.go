@@ -0,0 +1,221 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	errConn := errors.New("connection refused")
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"exhausted is exhausted", &RetryExhaustedError{Attempts: 3, LastErr: errConn}, &RetryExhaustedError{}, true},
+		{"exhausted wraps the last error", &RetryExhaustedError{Attempts: 3, LastErr: errConn}, errConn, true},
+		{"exhausted on status", &RetryExhaustedError{Attempts: 3, LastStatus: 503}, errConn, false},
+		{"open is ErrOpenState", &BreakerOpenError{Name: "api"}, ErrOpenState, true},
+		{"open is open", &BreakerOpenError{Name: "api"}, &BreakerOpenError{}, true},
+		{"open isn't too many requests", &BreakerOpenError{Name: "api"}, ErrTooManyRequests, false},
+		{"rate limited", &RateLimitedError{}, &RateLimitedError{}, true},
+		{"rate limited isn't open", &RateLimitedError{}, ErrOpenState, false},
+		{"rate limited wraps the refused attempt", &RateLimitedError{Err: errConn}, errConn, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestErrors_FromTransport(t *testing.T) {
+	// nothing listens anymore
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	transport := NewRoundTripper(
+		WithName("api"),
+		WithMaxRetries(1),
+		WithTimeout(time.Minute),
+		WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 }),
+	)
+	c := transport.RoundTripper.(*circuit)
+	c.retrier.RetryWaitMin = time.Millisecond
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := transport.RoundTrip(req)
+	var exhausted *RetryExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("Expected a RetryExhaustedError, got %v", err)
+	}
+	if exhausted.Attempts != 2 || exhausted.LastErr == nil {
+		t.Errorf("Expected 2 attempts ending on an error, got %+v", exhausted)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err = transport.RoundTrip(req)
+	var open *BreakerOpenError
+	if !errors.As(err, &open) {
+		t.Fatalf("Expected a BreakerOpenError, got %v", err)
+	}
+	if open.Name != "api" || open.OpenedAt.IsZero() || open.RetryAfter <= 0 || open.RetryAfter > time.Minute {
+		t.Errorf("Unexpected %+v", open)
+	}
+}
+
+func TestRetryExhaustedError_Attempts(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	errReset := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		failures int
+	}{
+		{"every attempt", nil, 3},
+		{"last error only", []Option{WithLastErrorOnly()}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewRunner(append([]Option{WithMaxRetries(2)}, tt.opts...)...)
+			runner.retrier.Backoff = func(min, max time.Duration, attempt uint32, resp *http.Response) time.Duration {
+				return time.Millisecond
+			}
+
+			calls := 0
+			err := runner.Run(context.Background(), func(ctx context.Context) error {
+				calls++
+				if calls == 1 {
+					return errTimeout
+				}
+				return errReset
+			})
+
+			var exhausted *RetryExhaustedError
+			if !errors.As(err, &exhausted) {
+				t.Fatalf("Expected a RetryExhaustedError, got %v", err)
+			}
+			if len(exhausted.Errors) != tt.failures {
+				t.Errorf("Expected %d, got %d", tt.failures, len(exhausted.Errors))
+			}
+			if exhausted.LastErr != errReset {
+				t.Errorf("Expected %v, got %v", errReset, exhausted.LastErr)
+			}
+			if got := errors.Is(err, errTimeout); got != (tt.failures > 0) {
+				t.Errorf("Expected the first error to be found: %v, got %v", tt.failures > 0, got)
+			}
+			for i, failure := range exhausted.Errors {
+				if failure.Attempt != uint32(i+1) || failure.Time.IsZero() {
+					t.Errorf("Unexpected attempt %+v", failure)
+				}
+			}
+		})
+	}
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	// a transport timeout matching context.DeadlineExceeded, like the
+	// response header timeout of http.Transport
+	timeout := fmt.Errorf("timeout awaiting response headers: %w", context.DeadlineExceeded)
+	transport := NewRoundTripper(
+		WithMaxRetries(0),
+		WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 }),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, timeout
+		})),
+	)
+	cb := transport.RoundTripper.(*circuit).breaker
+
+	// the caller giving up is ignored
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://upstream.example", nil)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if state := cb.State(); state != Close {
+		t.Errorf("Expected %s, got %s", Close, state)
+	}
+
+	// the upstream timing out while the caller waits is a failure
+	req, _ = http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if state := cb.State(); state != Open {
+		t.Errorf("Expected %s, got %s", Open, state)
+	}
+}
+
+func TestAbandoned(t *testing.T) {
+	tests := []struct {
+		name string
+		// backoff cancels the request while it waits to be retried, or else
+		// during its second attempt
+		backoff bool
+	}{
+		{"in the backoff", true},
+		{"in an attempt", false},
+	}
+
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		var metrics []Metrics
+		attempts := 0
+		wait := time.Hour
+		if !tt.backoff {
+			wait = time.Millisecond
+		}
+		transport := NewRoundTripper(
+			WithMaxRetries(1),
+			WithRetryWait(wait, wait),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+			WithMetricsListener(func(m Metrics) { metrics = append(metrics, m) }, time.Hour),
+			WithOnRetry(func(req *http.Request, info RetryInfo) {
+				if tt.backoff {
+					cancel()
+				}
+			}),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				attempts++
+				if attempts > 1 {
+					cancel()
+					return nil, req.Context().Err()
+				}
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			})),
+		)
+		cb := transport.RoundTripper.(*circuit).breaker
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://upstream.example", nil)
+		start := time.Now()
+		if _, err := transport.RoundTrip(req); err != context.Canceled {
+			t.Errorf("%s: Expected %v, got %v", tt.name, context.Canceled, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: Expected to return at once, took %s", tt.name, elapsed)
+		}
+
+		expected := Counts{TotalAbandoned: 1}
+		if counts := cb.Counts(); counts != expected {
+			t.Errorf("%s: Expected %+v, got %+v", tt.name, expected, counts)
+		}
+		_ = transport.Shutdown(context.Background())
+		if len(metrics) != 1 || metrics[0].Abandoned != 1 || metrics[0].Errors != 0 {
+			t.Errorf("%s: Expected an abandoned request, got %+v", tt.name, metrics)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package gcb
+
+import "time"
+
+const (
+	// EventStateChange is emitted whenever the breaker changes state
+	EventStateChange EventType = iota
+	// EventStuckOpen is emitted when the breaker stays open well past its
+	// timeout, because no request came in to move it to half-open
+	EventStuckOpen
+	// EventStreamDisconnect is emitted when a streaming response drops
+	// while the caller reads it, the drop counts as a failure
+	EventStreamDisconnect
+	// EventRollover is emitted when a closed-state interval aligned with
+	// WithAlignedInterval rolls over, with the counts of the interval. It's
+	// emitted by the first request after the interval, the intervals
+	// without requests aren't reported.
+	EventRollover
+)
+
+type (
+	// EventType identifies the kind of an Event
+	EventType int8
+
+	// Event describes something that happened to a breaker
+	Event struct {
+		Type EventType
+		// Name is the name of the breaker
+		Name string
+		// From and To are the states of a state change, for any other
+		// event both are the current state
+		From State
+		To   State
+		// Counts is a copy of the breaker counts when the event happened
+		Counts Counts
+		// Duration is how long the breaker has been open, for a stuck
+		// breaker or a state change out of open, or the interval of a
+		// rollover
+		Duration time.Duration
+		// Err is the last failure the breaker saw, for a state change, or
+		// the error that dropped the stream
+		Err error
+		// Tag is the tag of the request that failed with Err, if any, see
+		// ContextWithTag
+		Tag string
+		// Window is the start of the interval of a rollover, which lasted
+		// Duration
+		Window time.Time
+		Time   time.Time
+	}
+
+	// EventListener is called for every event of the breaker. It's called
+	// while the breaker is locked, so it must not block nor call back into
+	// the breaker, an EventQueue runs the listeners that may.
+	EventListener func(event Event)
+)
+
+// WithEventListener sets the listener of the breaker events
+func WithEventListener(fn EventListener) Option {
+	return func(config *Config) {
+		config.onEvent = fn
+	}
+}
+
+func (t EventType) String() string {
+	switch t {
+	case EventStateChange:
+		return "StateChange"
+	case EventStuckOpen:
+		return "StuckOpen"
+	case EventStreamDisconnect:
+		return "StreamDisconnect"
+	case EventRollover:
+		return "Rollover"
+	}
+	return ""
+}
+
+// emit sends the event to the listener, the breaker must be locked
+func (cb *Breaker) emit(event Event, now time.Time) {
+	if cb.onEvent == nil {
+		return
+	}
+	event.Name = cb.name
+	event.Time = now
+	cb.onEvent(event)
+}
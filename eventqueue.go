@@ -0,0 +1,174 @@
+package gcb
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultEventQueueSize is the number of events a queue holds by default
+const defaultEventQueueSize = 256
+
+type (
+	// EventQueue hands the events of the breakers over to a listener running
+	// on a goroutine of its own, so the listener may take its time. Its
+	// Listen method is the event listener of the breakers:
+	//
+	//	queue := gcb.NewEventQueue(n.Notify, 1024)
+	//	defer queue.Close()
+	//	transport := gcb.NewRoundTripper(gcb.WithEventListener(queue.Listen))
+	//
+	// Listen never blocks nor locks: the queue is a ring buffer and when the
+	// listener falls behind the oldest events are dropped for the new ones.
+	EventQueue struct {
+		// head and tail are the positions of the next event to take and to
+		// put, dropped the count of events dropped. They come first to be
+		// aligned for the atomics.
+		head    uint64
+		tail    uint64
+		dropped uint64
+		// sleeping is set while the goroutine waits for events
+		sleeping int32
+
+		slots    []eventSlot
+		mask     uint64
+		listener EventListener
+
+		wake      chan struct{}
+		stop      chan struct{}
+		done      chan struct{}
+		closeOnce sync.Once
+	}
+
+	// eventSlot holds an event of the ring, seq tells whether it's to be
+	// put or taken at a position
+	eventSlot struct {
+		seq   uint64
+		event Event
+	}
+)
+
+// NewEventQueue returns a queue of size events, rounded up to a power of
+// two of at least 2 and 256 when 0, delivering them to the listener in order
+func NewEventQueue(listener EventListener, size int) *EventQueue {
+	if size <= 0 {
+		size = defaultEventQueueSize
+	}
+	// a single slot can't tell a full queue from an empty one
+	n := 2
+	for n < size {
+		n <<= 1
+	}
+
+	q := &EventQueue{
+		slots:    make([]eventSlot, n),
+		mask:     uint64(n - 1),
+		listener: listener,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i := range q.slots {
+		q.slots[i].seq = uint64(i)
+	}
+	go q.run()
+	return q
+}
+
+// Listen queues the event, dropping the oldest one if the queue is full
+func (q *EventQueue) Listen(event Event) {
+	for !q.put(event) {
+		if _, ok := q.take(); ok {
+			atomic.AddUint64(&q.dropped, 1)
+		} else {
+			// the slot is being taken, let the taker finish
+			runtime.Gosched()
+		}
+	}
+	if atomic.LoadInt32(&q.sleeping) == 1 && atomic.CompareAndSwapInt32(&q.sleeping, 1, 0) {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Dropped returns the number of events dropped so far
+func (q *EventQueue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// Close delivers the events left and stops the queue
+func (q *EventQueue) Close() error {
+	q.closeOnce.Do(func() { close(q.stop) })
+	<-q.done
+	return nil
+}
+
+// put adds the event at the tail, false when the queue is full
+func (q *EventQueue) put(event Event) bool {
+	pos := atomic.LoadUint64(&q.tail)
+	for {
+		slot := &q.slots[pos&q.mask]
+		switch diff := int64(atomic.LoadUint64(&slot.seq) - pos); {
+		case diff == 0:
+			if atomic.CompareAndSwapUint64(&q.tail, pos, pos+1) {
+				slot.event = event
+				atomic.StoreUint64(&slot.seq, pos+1)
+				return true
+			}
+		case diff < 0:
+			return false
+		}
+		pos = atomic.LoadUint64(&q.tail)
+	}
+}
+
+// take removes the event at the head, false when the queue is empty. The
+// goroutine takes the events, Listen the ones it drops.
+func (q *EventQueue) take() (Event, bool) {
+	pos := atomic.LoadUint64(&q.head)
+	for {
+		slot := &q.slots[pos&q.mask]
+		switch diff := int64(atomic.LoadUint64(&slot.seq) - (pos + 1)); {
+		case diff == 0:
+			if atomic.CompareAndSwapUint64(&q.head, pos, pos+1) {
+				event := slot.event
+				slot.event = Event{}
+				atomic.StoreUint64(&slot.seq, pos+q.mask+1)
+				return event, true
+			}
+		case diff < 0:
+			return Event{}, false
+		}
+		pos = atomic.LoadUint64(&q.head)
+	}
+}
+
+func (q *EventQueue) run() {
+	defer close(q.done)
+
+	for {
+		if event, ok := q.take(); ok {
+			q.listener(event)
+			continue
+		}
+
+		atomic.StoreInt32(&q.sleeping, 1)
+		// an event may have come in before the flag was seen
+		if event, ok := q.take(); ok {
+			atomic.StoreInt32(&q.sleeping, 0)
+			q.listener(event)
+			continue
+		}
+
+		select {
+		case <-q.wake:
+		case <-q.stop:
+			for event, ok := q.take(); ok; event, ok = q.take() {
+				q.listener(event)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gcb
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventQueue_Order(t *testing.T) {
+	var got []EventType
+	queue := NewEventQueue(func(event Event) { got = append(got, event.Type) }, 4)
+
+	expected := []EventType{EventStateChange, EventStuckOpen, EventStreamDisconnect}
+	for _, typ := range expected {
+		queue.Listen(Event{Type: typ})
+	}
+	_ = queue.Close()
+
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestEventQueue_SingleEvent(t *testing.T) {
+	var got []string
+	queue := NewEventQueue(func(event Event) { got = append(got, event.Name) }, 1)
+
+	queue.Listen(Event{Name: "a"})
+	queue.Listen(Event{Name: "b"})
+	_ = queue.Close()
+
+	if len(got) == 0 || got[len(got)-1] != "b" {
+		t.Errorf("Expected the last event delivered, got %v", got)
+	}
+}
+
+func TestEventQueue_DropOldest(t *testing.T) {
+	var got []string
+	taken, release := make(chan struct{}), make(chan struct{})
+	queue := NewEventQueue(func(event Event) {
+		if event.Name == "first" {
+			close(taken)
+			<-release
+		}
+		got = append(got, event.Name)
+	}, 2)
+
+	// the listener stalls on the first event, the queue fills up behind it
+	queue.Listen(Event{Name: "first"})
+	<-taken
+	for _, name := range []string{"a", "b", "c", "d"} {
+		queue.Listen(Event{Name: name})
+	}
+	if dropped := queue.Dropped(); dropped != 2 {
+		t.Errorf("Expected %v, got %v", 2, dropped)
+	}
+
+	close(release)
+	_ = queue.Close()
+	expected := []string{"first", "c", "d"}
+	if len(got) != len(expected) || got[1] != "c" || got[2] != "d" {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestEventQueue_Concurrent(t *testing.T) {
+	var mu sync.Mutex
+	delivered := 0
+	queue := NewEventQueue(func(event Event) {
+		time.Sleep(time.Microsecond)
+		mu.Lock()
+		delivered++
+		mu.Unlock()
+	}, 16)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				queue.Listen(Event{Type: EventStateChange})
+			}
+		}()
+	}
+	wg.Wait()
+	_ = queue.Close()
+
+	// every event is either delivered or dropped
+	if total := uint64(delivered) + queue.Dropped(); total != 4000 {
+		t.Errorf("Expected %v, got %v", 4000, total)
+	}
+}
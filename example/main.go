@@ -1,41 +1,247 @@
+// Command example drives load through a gcb transport and prints what the
+// retries and the breaker made of it:
+//
+//	go run ./example -concurrency 16 -duration 10s -fail 0.3 -policy aggressive
+//
+// Without -target the requests go to a server started in process. The
+// failures are injected in front of the target, -fail is the share of the
+// attempts answered with 503.
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
+	"math/rand"
 	"net/http"
-	"strings"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/calvernaz/gcb"
 )
 
+// presets are the policies to pick from
+var presets = map[string][]gcb.Option{
+	"default": nil,
+	"aggressive": {
+		gcb.WithMaxRetries(6),
+		gcb.WithRetryWait(50*time.Millisecond, time.Second),
+		gcb.WithTimeout(5 * time.Second),
+		gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return counts.ConsecutiveFailures >= 20 }),
+	},
+	"conservative": {
+		gcb.WithMaxRetries(1),
+		gcb.WithRetryWait(200*time.Millisecond, time.Second),
+		gcb.WithTimeout(30 * time.Second),
+		gcb.WithReadyToTrip(func(counts gcb.Counts) bool {
+			return counts.Requests >= 20 && float64(counts.TotalFailures)/float64(counts.Requests) >= 0.2
+		}),
+	},
+}
+
+type (
+	// config is set by the flags
+	config struct {
+		target      string
+		concurrency int
+		duration    time.Duration
+		fail        float64
+		policy      string
+	}
+
+	// summary adds up a run
+	summary struct {
+		Requests   int64
+		Succeeded  int64
+		Failed     int64
+		Shed       int64
+		Unfinished int64
+		Attempts   int64
+		Retries    int64
+		// Transitions are the state changes of the breaker, in order
+		Transitions []string
+		Latencies   []time.Duration
+	}
+
+	// injector fails a share of the attempts and counts them
+	injector struct {
+		transport http.RoundTripper
+		fail      float64
+		attempts  int64
+
+		mu  sync.Mutex
+		rnd *rand.Rand
+	}
+)
+
 func main() {
+	var cfg config
+	flag.StringVar(&cfg.target, "target", "", "URL to send the requests to, a server started in process by default")
+	flag.IntVar(&cfg.concurrency, "concurrency", 8, "number of concurrent clients")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long to send requests for")
+	flag.Float64Var(&cfg.fail, "fail", 0, "share of the attempts failed with 503, from 0 to 1")
+	flag.StringVar(&cfg.policy, "policy", "default", "policy preset: default, aggressive or conservative")
+	verbose := flag.Bool("v", false, "log every retry")
+	flag.Parse()
 
-	transport := gcb.NewRoundTripper()
-	client := http.Client{
-		Transport: transport,
-		Timeout:   30 * time.Second,
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
 	}
 
-	i := 0
+	s, err := run(context.Background(), cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	s.print(os.Stdout, cfg.duration)
+}
+
+// run sends requests for the duration of the configuration
+func run(ctx context.Context, cfg config) (*summary, error) {
+	opts, ok := presets[cfg.policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown policy %q", cfg.policy)
+	}
+	if cfg.concurrency < 1 {
+		return nil, errors.New("the concurrency must be positive")
+	}
+
+	target := cfg.target
+	if target == "" {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+		target = server.URL
+	}
+
+	s := &summary{}
+	var mu sync.Mutex
 	start := time.Now()
-	for {
-		request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/", strings.NewReader("Hello Server!"))
-		response, err := client.Do(request)
-		if err != nil {
-			break
-			//log.Fatal(err)
-		}
-		i++
-		bytes, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			break
-			//log.Fatal(err)
-		}
-		fmt.Println(string(bytes))
-		fmt.Println(i)
-	}
-	t := time.Now()
-	fmt.Println(t.Sub(start))
+	inject := &injector{
+		transport: http.DefaultTransport,
+		fail:      cfg.fail,
+		rnd:       rand.New(rand.NewSource(start.UnixNano())),
+	}
+	opts = append(append([]gcb.Option{}, opts...),
+		gcb.WithTransport(inject),
+		gcb.WithEventListener(func(event gcb.Event) {
+			if event.Type != gcb.EventStateChange {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			s.Transitions = append(s.Transitions, fmt.Sprintf("%s %s -> %s", event.Time.Sub(start).Round(time.Millisecond), event.From, event.To))
+		}),
+	)
+	client := &http.Client{Transport: gcb.NewRoundTripper(opts...)}
+
+	// the requests still retrying at the end are cut short
+	ctx, cancel := context.WithTimeout(ctx, cfg.duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+				sent := time.Now()
+				resp, err := client.Do(req)
+				latency := time.Since(sent)
+				if err == nil {
+					_, _ = io.Copy(ioutil.Discard, resp.Body)
+					_ = resp.Body.Close()
+				}
+
+				mu.Lock()
+				s.Requests++
+				switch {
+				case errors.Is(err, gcb.ErrOpenState) || errors.Is(err, gcb.ErrTooManyRequests):
+					s.Shed++
+				case ctx.Err() != nil:
+					s.Unfinished++
+				case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+					s.Failed++
+					s.Latencies = append(s.Latencies, latency)
+				default:
+					s.Succeeded++
+					s.Latencies = append(s.Latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Attempts = atomic.LoadInt64(&inject.attempts)
+	s.Retries = s.Attempts - (s.Requests - s.Shed)
+	if s.Retries < 0 {
+		s.Retries = 0
+	}
+	return s, nil
+}
+
+func (i *injector) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&i.attempts, 1)
+
+	i.mu.Lock()
+	fail := i.rnd.Float64() < i.fail
+	i.mu.Unlock()
+	if fail {
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+	return i.transport.RoundTrip(req)
+}
+
+// print writes the summary
+func (s *summary) print(w io.Writer, duration time.Duration) {
+	fmt.Fprintf(w, "requests     %d (%.1f/s)\n", s.Requests, float64(s.Requests)/duration.Seconds())
+	fmt.Fprintf(w, "  succeeded  %d\n", s.Succeeded)
+	fmt.Fprintf(w, "  failed     %d\n", s.Failed)
+	fmt.Fprintf(w, "  shed       %d\n", s.Shed)
+	fmt.Fprintf(w, "  unfinished %d\n", s.Unfinished)
+	fmt.Fprintf(w, "attempts     %d\n", s.Attempts)
+	fmt.Fprintf(w, "retries      %d\n", s.Retries)
+
+	fmt.Fprintf(w, "transitions  %d\n", len(s.Transitions))
+	for _, transition := range s.Transitions {
+		fmt.Fprintf(w, "  %s\n", transition)
+	}
+
+	if len(s.Latencies) > 0 {
+		fmt.Fprintf(w, "latency      p50 %s  p90 %s  p99 %s  max %s\n",
+			s.percentile(0.5), s.percentile(0.9), s.percentile(0.99), s.percentile(1))
+	}
+}
+
+// percentile returns the latency under which the share p of the requests
+// completed, not counting the shed ones
+func (s *summary) percentile(p float64) time.Duration {
+	if !sort.SliceIsSorted(s.Latencies, func(i, j int) bool { return s.Latencies[i] < s.Latencies[j] }) {
+		sort.Slice(s.Latencies, func(i, j int) bool { return s.Latencies[i] < s.Latencies[j] })
+	}
+	n := int(p*float64(len(s.Latencies))+0.5) - 1
+	if n < 0 {
+		n = 0
+	}
+	if n >= len(s.Latencies) {
+		n = len(s.Latencies) - 1
+	}
+	return s.Latencies[n].Round(time.Microsecond)
 }
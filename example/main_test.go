@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(out)
+
+	tests := []struct {
+		name string
+		cfg  config
+	}{
+		{"healthy", config{concurrency: 4, duration: 200 * time.Millisecond, policy: "default"}},
+		{"failing", config{concurrency: 4, duration: 500 * time.Millisecond, fail: 0.5, policy: "aggressive"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := run(context.Background(), tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Requests == 0 {
+				t.Fatalf("Expected requests, got none")
+			}
+			if sum := s.Succeeded + s.Failed + s.Shed + s.Unfinished; sum != s.Requests {
+				t.Errorf("Expected %d, got %d", s.Requests, sum)
+			}
+			if tt.cfg.fail == 0 && (s.Retries != 0 || s.Failed != 0) {
+				t.Errorf("Expected no retries nor failures, got %+v", s)
+			}
+			if tt.cfg.fail > 0 && s.Retries == 0 {
+				t.Errorf("Expected retries, got none")
+			}
+
+			var b bytes.Buffer
+			s.print(&b, tt.cfg.duration)
+			if !strings.Contains(b.String(), "latency      p50") {
+				t.Errorf("Expected the latency percentiles, got %s", b.String())
+			}
+		})
+	}
+
+	if _, err := run(context.Background(), config{concurrency: 1, policy: "reckless"}); err == nil {
+		t.Errorf("Expected an unknown policy to fail")
+	}
+}
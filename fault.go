@@ -0,0 +1,108 @@
+package gcb
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInjectedFault is the default error of the fault injection
+	ErrInjectedFault = errors.New("injected fault")
+)
+
+type (
+	// FaultConfig configures the faults injected into the transport. Each
+	// percentage (0-100) is the share of attempts the fault applies to.
+	FaultConfig struct {
+		// Delay is added to DelayPercent of the attempts
+		Delay        time.Duration
+		DelayPercent float64
+
+		// ErrorPercent of the attempts fail with Error, which defaults to
+		// ErrInjectedFault
+		Error        error
+		ErrorPercent float64
+
+		// StatusPercent of the attempts get an empty response with StatusCode
+		StatusCode    int
+		StatusPercent float64
+	}
+
+	// faultTransport injects faults in front of the transport
+	faultTransport struct {
+		transport http.RoundTripper
+		config    FaultConfig
+
+		mu  sync.Mutex
+		rnd *rand.Rand
+	}
+)
+
+// WithFaultInjection injects faults into every attempt, for chaos testing the
+// timeout, retry and breaker settings. Faults are only injected when this
+// option is used. They're drawn at random, seeded from WithRandSource when
+// set.
+func WithFaultInjection(config FaultConfig) Option {
+	return func(c *Config) {
+		c.faults = &config
+	}
+}
+
+// newFaultTransport returns the faults rolled from a source of their own,
+// seeded from src if set so that the faults replay along with the backoffs
+func newFaultTransport(config FaultConfig, transport http.RoundTripper, src rand.Source) *faultTransport {
+	if config.Error == nil {
+		config.Error = ErrInjectedFault
+	}
+	seed := time.Now().UnixNano()
+	if src != nil {
+		seed = src.Int63()
+	}
+	return &faultTransport{
+		transport: transport,
+		config:    config,
+		rnd:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (f *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.roll(f.config.DelayPercent) {
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(f.config.Delay):
+		}
+	}
+
+	if f.roll(f.config.ErrorPercent) {
+		return nil, f.config.Error
+	}
+
+	if f.roll(f.config.StatusPercent) {
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", f.config.StatusCode, http.StatusText(f.config.StatusCode)),
+			StatusCode: f.config.StatusCode,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	return f.transport.RoundTrip(req)
+}
+
+func (f *faultTransport) roll(percent float64) bool {
+	if percent <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rnd.Float64()*100 < percent
+}
@@ -0,0 +1,98 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFaultTransport(t *testing.T) {
+	refused := errors.New("connection refused")
+	tests := []struct {
+		name    string
+		config  FaultConfig
+		delayed bool
+		status  int
+		err     error
+	}{
+		{"none", FaultConfig{Delay: time.Hour, StatusCode: http.StatusServiceUnavailable}, false, http.StatusOK, nil},
+		{"delay", FaultConfig{Delay: 20 * time.Millisecond, DelayPercent: 100}, true, http.StatusOK, nil},
+		{"error", FaultConfig{ErrorPercent: 100}, false, 0, ErrInjectedFault},
+		{"own error", FaultConfig{Error: refused, ErrorPercent: 100}, false, 0, refused},
+		{"status", FaultConfig{StatusCode: http.StatusServiceUnavailable, StatusPercent: 100}, false, http.StatusServiceUnavailable, nil},
+		{"delayed error", FaultConfig{Delay: 20 * time.Millisecond, DelayPercent: 100, ErrorPercent: 100}, true, 0, ErrInjectedFault},
+	}
+
+	for _, tt := range tests {
+		transport := newFaultTransport(tt.config, RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}), nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		start := time.Now()
+		resp, err := transport.RoundTrip(req)
+		if delayed := time.Since(start) >= 20*time.Millisecond; delayed != tt.delayed {
+			t.Errorf("%s: Expected a delay %v, got %v", tt.name, tt.delayed, delayed)
+		}
+		if err != tt.err {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.err, err)
+		}
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		if status != tt.status {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.status, status)
+		}
+	}
+}
+
+func TestFaultTransport_CancelDelay(t *testing.T) {
+	transport := NewRoundTripper(
+		WithoutRetries(),
+		WithFaultInjection(FaultConfig{Delay: time.Hour, DelayPercent: 100}),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+	if _, err := transport.RoundTrip(req.WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestFaultTransport_RandSource(t *testing.T) {
+	outcomes := func(seed int64) []bool {
+		transport := NewRoundTripper(
+			WithoutRetries(),
+			WithoutBreaker(),
+			WithRandSource(rand.NewSource(seed)),
+			WithFaultInjection(FaultConfig{ErrorPercent: 50}),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})),
+		)
+		var failed []bool
+		for i := 0; i < 32; i++ {
+			req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+			_, err := transport.RoundTrip(req)
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first, second := outcomes(42), outcomes(42)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same faults for the same seed, got %v and %v", first, second)
+	}
+	if reflect.DeepEqual(first, outcomes(7)) {
+		t.Errorf("Expected other faults for another seed, got %v", first)
+	}
+}
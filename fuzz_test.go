@@ -0,0 +1,99 @@
+package gcb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzParseRetryAfter(f *testing.F) {
+	for _, seed := range []string{"", "0", "120", "-1", "1e3", "Wed, 21 Oct 2015 07:28:00 GMT", "Mon, 02 Jan 2006 15:04:05 MST"} {
+		f.Add(seed)
+	}
+
+	now := time.Date(2015, 10, 21, 7, 0, 0, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, header string) {
+		resp := &http.Response{Header: http.Header{"Retry-After": {header}}}
+		wait, ok := parseRetryAfter(resp, now)
+		if wait < 0 {
+			t.Errorf("Expected a positive wait for %q, got %s", header, wait)
+		}
+		if !ok && wait != 0 {
+			t.Errorf("Expected no wait for %q, got %s", header, wait)
+		}
+	})
+}
+
+func FuzzDetectThrottling(f *testing.F) {
+	f.Add(400, []byte(`{"__type":"ThrottlingException"}`))
+	f.Add(403, []byte(`<Error><Code>SlowDown</Code></Error>`))
+	f.Add(400, []byte(`{"error":"ThrottlingExceptions"}`))
+	f.Add(404, bytes.Repeat([]byte("x"), int(respReadLimit)+10))
+	f.Add(500, []byte(`{"__type":"ThrottlingException"}`))
+
+	var codes [][]byte
+	for _, code := range defaultThrottlingCodes {
+		codes = append(codes, []byte(code))
+	}
+	f.Fuzz(func(t *testing.T, status int, body []byte) {
+		resp := &http.Response{StatusCode: status, Body: ioutil.NopCloser(bytes.NewReader(body))}
+		detectThrottling(resp, codes)
+
+		// the caller reads the whole body, whatever was sniffed
+		got, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, body) {
+			t.Errorf("Expected the body to be intact, got %d bytes out of %d", len(got), len(body))
+		}
+		if resp.StatusCode != status && (status < 400 || status >= 500 || resp.StatusCode != http.StatusTooManyRequests) {
+			t.Errorf("Unexpected %d turned into %d", status, resp.StatusCode)
+		}
+	})
+}
+
+func FuzzGetBodyReaderAndContentLength(f *testing.F) {
+	f.Add([]byte(""), uint8(0))
+	f.Add([]byte(`{"id":1}`), uint8(1))
+	f.Add(bytes.Repeat([]byte("body"), 1024), uint8(3))
+
+	f.Fuzz(func(t *testing.T, body []byte, kind uint8) {
+		var raw interface{}
+		switch kind % 5 {
+		case 0:
+			raw = body
+		case 1:
+			raw = bytes.NewBuffer(append([]byte{}, body...))
+		case 2:
+			raw = bytes.NewReader(body)
+		case 3:
+			raw = strings.NewReader(string(body))
+		default:
+			raw = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		reader, length, err := getBodyReaderAndContentLength(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length != int64(len(body)) {
+			t.Errorf("Expected %d, got %d", len(body), length)
+		}
+
+		// the body reads the same every time
+		for i := 0; i < 2; i++ {
+			rc, err := reader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := ioutil.ReadAll(rc)
+			if !bytes.Equal(got, body) {
+				t.Errorf("Expected %q, got %q", body, got)
+			}
+		}
+	})
+}
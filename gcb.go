@@ -1,30 +1,154 @@
 package gcb
 
 import (
+	"math/rand"
 	"net/http"
+	"net/url"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
 type (
 	// tripper
 	tripper struct {
 		http.RoundTripper
+		// principal is who the manual interventions are recorded under
+		principal string
 	}
 
 	// Option represents an option for retry.
 	Option func(*Config)
 
 	Config struct {
+		name string
+
 		maxRetries    uint32
 		maxRequests   uint32
 
 		interval time.Duration
+		alignInterval bool
 		timeout time.Duration
 		maxWait time.Duration
 		minWait time.Duration
 
 		readyToTrip   ReadyToTrip
 		onStateChange OnStateChange
+
+		queueStore       QueueStore
+		onDelivery       DeliveryCallback
+		queueInterval    time.Duration
+		queueMaxAttempts int
+		queueMaxAge      time.Duration
+
+		shadowTarget  *url.URL
+		shadowPercent float64
+
+		endpoints        []*url.URL
+		outlierDetection *OutlierDetection
+
+		panicAsError bool
+
+		throttleMaxTokens  float64
+		throttleTokenRatio float64
+
+		metricsListener MetricsListener
+		metricsInterval time.Duration
+
+		onEvent            EventListener
+		eventQueue         *EventQueue
+		watchdogInterval   time.Duration
+		watchdogStuckAfter time.Duration
+		timerTransitions   bool
+
+		keyFunc         KeyFunc
+		maintenanceKeys []string
+
+		faults *FaultConfig
+
+		maxResponseBytes int64
+		drainThreshold   int64
+
+		perKeyBreakers    bool
+		breakerIdleTTL    time.Duration
+		maxBreakers       int
+		onEvict           OnEvict
+		openOnRetryAfter  bool
+		openStateResponse bool
+		maxRedirects      int
+
+		warmUpCount int
+		warmUpProbe ProbeFunc
+
+		halfOpenProber HalfOpenProber
+		halfOpenProbe  ProbeFunc
+
+		idleProbeInterval time.Duration
+		idleProbe         ProbeFunc
+
+		hedgeDelay  time.Duration
+		hedgeBudget rate.Limit
+
+		cookieJar     http.CookieJar
+		frozenCookies bool
+
+		connTrace bool
+
+		windows []Window
+
+		ignoredErrors []error
+		isIgnorable   IsIgnorable
+
+		pubsub       PubSub
+		pubsubOrigin string
+
+		peerView   PeerView
+		peerWeight float64
+
+		countsStore   CountsStore
+		stripedCounts bool
+		countsStripes int
+
+		election       Election
+		leaderFallback time.Duration
+
+		quorum            Quorum
+		quorumSize        int
+		quorumFailureRate float64
+
+		maxConcurrency int
+
+		transport       http.RoundTripper
+		dialContext     DialContextFunc
+		addressRotation bool
+		redialOnRetry   bool
+		flushOnOpen     bool
+
+		throttlingCodes []string
+		proxyBreakers   bool
+		lastErrorOnly   bool
+		onRetrySuccess  RetryHook
+		onRetryFailure  RetryHook
+		onRetry         RetryListener
+		retryAfterHints bool
+		bodyClassifier  BodyClassifier
+		errorClassifier *ErrorClassifier
+
+		noAttemptContext bool
+		noBreaker        bool
+		noRetries        bool
+		noRateLimit      bool
+
+		logger   Logger
+		logLevel LogLevel
+
+		auditSize int
+
+		clock            Clock
+		coarseResolution time.Duration
+
+		randSource    rand.Source
+		jitterBackoff JitterBackoff
 	}
 )
 
@@ -49,6 +173,118 @@ func WithMaxRetries(maxRetries uint32) Option {
 	}
 }
 
+// WithRetryWait sets the bounds of the backoff between the retries
+func WithRetryWait(min, max time.Duration) Option {
+	return func(config *Config) {
+		config.minWait = min
+		config.maxWait = max
+	}
+}
+
+// WithDrainThreshold closes the responses of the retried attempts which
+// advertise a Content-Length above n, instead of reading up to 4KB of them
+// before the retry. The transport then gives up their connection, or
+// drains them in the background in the recent versions of net/http. 0
+// drains every response.
+func WithDrainThreshold(n int64) Option {
+	return func(config *Config) {
+		config.drainThreshold = n
+	}
+}
+
+// WithoutRetries sends every request a single time, skipping the retry
+// loop, its rate limit and the retry storm guard. The responses in the 500
+// range still count as breaker failures.
+func WithoutRetries() Option {
+	return func(config *Config) {
+		config.noRetries = true
+	}
+}
+
+// WithoutRateLimit lifts the default rate limit of the retries, the limits
+// of the schedule windows still apply
+func WithoutRateLimit() Option {
+	return func(config *Config) {
+		config.noRateLimit = true
+	}
+}
+
+// WithoutBreaker sends the requests without going through a breaker, the
+// proxy breakers still guard the proxies when enabled
+func WithoutBreaker() Option {
+	return func(config *Config) {
+		config.noBreaker = true
+	}
+}
+
+// WithTimeout sets the period of the open state, after which
+// the circuit breaker becomes half-open
+func WithTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.timeout = timeout
+	}
+}
+
+// WithMaxRequests sets the number of requests let through while the
+// circuit breaker is half-open, 0 lets only one through
+func WithMaxRequests(maxRequests uint32) Option {
+	return func(config *Config) {
+		config.maxRequests = maxRequests
+	}
+}
+
+// WithInterval sets the cyclic period of the closed state after which the
+// circuit breaker clears its counts. 0, the default of the breakers and the
+// transports alike, never clears them.
+func WithInterval(interval time.Duration) Option {
+	return func(config *Config) {
+		config.interval = interval
+	}
+}
+
+// WithAlignedInterval aligns the closed-state intervals to the wall clock,
+// to the multiples of the interval since the zero time, e.g. every minute on
+// the minute, so that the counts compare with the per-minute dashboards of
+// the servers. Every interval rolling over emits an EventRollover with its
+// counts.
+func WithAlignedInterval() Option {
+	return func(config *Config) {
+		config.alignInterval = true
+	}
+}
+
+// WithName sets the name of the circuit breaker, it's passed along
+// to the state change callbacks
+func WithName(name string) Option {
+	return func(config *Config) {
+		config.name = name
+	}
+}
+
+// WithPanicAsError contains panics happening in the transport stack, they
+// are returned from RoundTrip as a *PanicError and still count as failures.
+func WithPanicAsError() Option {
+	return func(config *Config) {
+		config.panicAsError = true
+	}
+}
+
+// WithIgnoredErrors excludes the errors, as matched by errors.Is, from the
+// breaker accounting, on top of context.Canceled and context.DeadlineExceeded
+func WithIgnoredErrors(errs ...error) Option {
+	return func(config *Config) {
+		config.ignoredErrors = append(config.ignoredErrors, errs...)
+	}
+}
+
+// WithIsIgnorable sets a classifier excluding errors from the breaker
+// accounting, e.g. request validation errors
+func WithIsIgnorable(fn IsIgnorable) Option {
+	return func(config *Config) {
+		config.isIgnorable = fn
+	}
+}
+
 func WithReadyToTrip(fn ReadyToTrip) Option {
 	return func(config *Config) {
 		config.readyToTrip = fn
@@ -0,0 +1,49 @@
+// Package gcbchi exposes gcb with the func(next) next signature of the chi
+// middlewares, which net/http middleware chains follow too.
+//
+// On the server side, every route pattern gets its own breaker:
+//
+//	r := chi.NewRouter()
+//	r.With(gcbchi.Breaker(gcb.WithMaxConcurrency(100))).Get("/users/{id}", getUser)
+//
+// The route pattern is only known once chi has routed the request, so the
+// middleware must be set on the routes, with With or inside Route and Group,
+// rather than with Use on the root router where it falls back on the path.
+//
+// On the client side, Transport decorates a round tripper:
+//
+//	client := &http.Client{Transport: gcbchi.Transport(gcb.WithMaxRetries(3))(http.DefaultTransport)}
+package gcbchi
+
+import (
+	"net/http"
+
+	"github.com/calvernaz/gcb"
+	"github.com/go-chi/chi/v5"
+)
+
+// Breaker returns a middleware protecting the handlers with gcb.Middleware,
+// keyed by the chi route pattern unless gcb.WithKeyFunc says otherwise
+func Breaker(opts ...gcb.Option) func(next http.Handler) http.Handler {
+	opts = append([]gcb.Option{gcb.WithKeyFunc(routePattern)}, opts...)
+	return func(next http.Handler) http.Handler {
+		return gcb.Middleware(next, opts...)
+	}
+}
+
+// Transport returns a decorator layering gcb on top of a round tripper
+func Transport(opts ...gcb.Option) func(next http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return gcb.NewRoundTripper(append(append([]gcb.Option{}, opts...), gcb.WithTransport(next))...)
+	}
+}
+
+// routePattern keys the requests by route pattern, e.g. /users/{id}
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return r.URL.Path
+}
@@ -0,0 +1,60 @@
+package gcbchi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestBreaker(t *testing.T) {
+	r := chi.NewRouter()
+	breaker := Breaker(
+		gcb.WithTimeout(time.Minute),
+		gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return counts.ConsecutiveFailures >= 1 }),
+	)
+	r.With(breaker).Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r.With(breaker).Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/users/1", http.StatusInternalServerError},
+		// same route, same open breaker
+		{"/users/2", http.StatusServiceUnavailable},
+		{"/health", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: Expected %d, got %d", tt.path, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport(gcb.WithMaxRetries(0))(http.DefaultTransport)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+}
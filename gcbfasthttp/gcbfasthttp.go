@@ -0,0 +1,123 @@
+// Package gcbfasthttp guards a fasthttp client with a gcb breaker and
+// retrier, for the services that can't use net/http.
+//
+//	cb := gcb.NewBreaker(gcb.WithName("catalog"))
+//	r := gcb.NewRetrier(gcb.WithMaxRetries(3))
+//	client := gcbfasthttp.New(&fasthttp.Client{}, cb, r)
+//	err := client.DoTimeout(req, resp, time.Second)
+//
+// The retries follow the retrier policy: its rate limit, CheckRetry and
+// Backoff see a net/http response carrying the status code and headers of
+// the fasthttp one. Requests are replayed as is, their body included.
+package gcbfasthttp
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// makes sure the client can stand in for the fasthttp clients
+	_ Doer = (*Client)(nil)
+	_ Doer = (*fasthttp.Client)(nil)
+	_ Doer = (*fasthttp.HostClient)(nil)
+)
+
+type (
+	// Doer is the fasthttp client interface, implemented by fasthttp.Client
+	// and fasthttp.HostClient
+	Doer interface {
+		DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+	}
+
+	// Client sends the requests through the breaker and retries them
+	Client struct {
+		doer    Doer
+		breaker *gcb.Breaker
+		retrier *gcb.Retrier
+	}
+)
+
+// New returns a client guarding doer, a nil retrier disables the retries
+func New(doer Doer, cb *gcb.Breaker, r *gcb.Retrier) *Client {
+	return &Client{doer: doer, breaker: cb, retrier: r}
+}
+
+// Do sends the request without deadline
+func (c *Client) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return c.DoDeadline(req, resp, time.Time{})
+}
+
+// DoTimeout sends the request, retries included, within the timeout
+func (c *Client) DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	return c.DoDeadline(req, resp, time.Now().Add(timeout))
+}
+
+// DoDeadline sends the request, retries included, before the deadline. A
+// zero deadline means no deadline.
+func (c *Client) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	_, err := c.breaker.Execute(func() (*http.Response, error) {
+		return nil, c.retry(req, resp, deadline)
+	})
+	return err
+}
+
+func (c *Client) retry(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	ctx := context.Background()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	for attempt := uint32(0); ; attempt++ {
+		err := c.doer.DoDeadline(req, resp, deadline)
+		if c.retrier == nil {
+			return err
+		}
+
+		var status *http.Response
+		if err == nil {
+			status = httpResponse(resp)
+		}
+		shouldRetry, checkErr := c.retrier.ShouldRetry(ctx, status, err)
+		if !shouldRetry {
+			if checkErr != nil {
+				err = checkErr
+			}
+			return err
+		}
+
+		retryMax := c.retrier.MaxRetries()
+		if attempt >= retryMax {
+			exhausted := &gcb.RetryExhaustedError{Attempts: retryMax + 1, LastErr: err}
+			if err == nil {
+				exhausted.LastStatus = resp.StatusCode()
+			}
+			return exhausted
+		}
+
+		wait := c.retrier.Backoff(c.retrier.RetryWaitMin, c.retrier.RetryWaitMax, attempt, status)
+		if err := c.retrier.Wait(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// httpResponse exposes the status and headers of the response to the
+// retrier
+func httpResponse(resp *fasthttp.Response) *http.Response {
+	header := make(http.Header)
+	resp.Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+	return &http.Response{
+		StatusCode: resp.StatusCode(),
+		Status:     http.StatusText(resp.StatusCode()),
+		Header:     header,
+	}
+}
@@ -0,0 +1,72 @@
+package gcbfasthttp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"github.com/valyala/fasthttp"
+)
+
+// doerFunc is a Doer answering with the given status codes in turn
+type doerFunc func(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+
+func (f doerFunc) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	return f(req, resp, deadline)
+}
+
+func TestClient_DoTimeout(t *testing.T) {
+	tests := []struct {
+		statuses []int
+		calls    int
+		failed   bool
+	}{
+		{[]int{503, 503, 200}, 3, false},
+		{[]int{404}, 1, false},
+		{[]int{503, 503, 503, 503, 503}, 3, true},
+	}
+
+	for _, tt := range tests {
+		r := gcb.NewRetrier(gcb.WithMaxRetries(2))
+		r.Backoff = func(min, max time.Duration, attempt uint32, resp *http.Response) time.Duration {
+			return time.Millisecond
+		}
+		cb := gcb.NewBreaker(gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return true }))
+
+		calls := 0
+		client := New(doerFunc(func(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+			resp.SetStatusCode(tt.statuses[calls])
+			calls++
+			return nil
+		}), cb, r)
+
+		req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		req.SetRequestURI("http://catalog/items")
+		err := client.DoTimeout(req, resp, time.Second)
+
+		if calls != tt.calls {
+			t.Errorf("Expected %d, got %d", tt.calls, calls)
+		}
+		if (err != nil) != tt.failed {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if tt.failed && cb.State() != gcb.Open {
+			t.Errorf("Expected %s, got %s", gcb.Open, cb.State())
+		}
+	}
+}
+
+func TestClient_Open(t *testing.T) {
+	cb := gcb.NewBreaker(gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return true }))
+	client := New(doerFunc(func(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+		return errors.New("connection refused")
+	}), cb, nil)
+
+	req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	_ = client.Do(req, resp)
+	if err := client.Do(req, resp); !errors.Is(err, gcb.ErrOpenState) {
+		t.Errorf("Expected %v, got %v", gcb.ErrOpenState, err)
+	}
+}
@@ -0,0 +1,98 @@
+// Package gcbgrpc guards gRPC client calls with a gcb breaker and retrier.
+//
+//	cb := gcb.NewBreaker(gcb.WithName("inventory"))
+//	r := gcb.NewRetrier(gcb.WithMaxRetries(3))
+//	conn, err := grpc.Dial(target,
+//		grpc.WithUnaryInterceptor(gcbgrpc.UnaryClientInterceptor(cb, r)),
+//		grpc.WithStreamInterceptor(gcbgrpc.StreamClientInterceptor(cb, r)),
+//	)
+//
+// The calls rejected by the breaker fail with gcb.ErrOpenState or
+// gcb.ErrTooManyRequests, and aren't retried.
+package gcbgrpc
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/calvernaz/gcb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor runs the unary calls through the breaker and retries
+// the calls that failed with Unavailable. A nil retrier disables the retries.
+func UnaryClientInterceptor(cb *gcb.Breaker, r *gcb.Retrier) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return retry(ctx, r, func() error {
+			return execute(cb, func() error {
+				return invoker(ctx, method, req, reply, cc, opts...)
+			})
+		})
+	}
+}
+
+// StreamClientInterceptor runs the establishment of the streams through the
+// breaker and retries it when it failed with Unavailable. Once established,
+// a stream is handed over as is: its messages are never replayed, a stream
+// failing midway must be handled by the caller. A nil retrier disables the
+// retries.
+func StreamClientInterceptor(cb *gcb.Breaker, r *gcb.Retrier) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		var stream grpc.ClientStream
+		err := retry(ctx, r, func() error {
+			return execute(cb, func() error {
+				var err error
+				stream, err = streamer(ctx, desc, cc, method, opts...)
+				return err
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
+}
+
+// execute runs the call through the breaker, only the errors pointing at
+// the server count as failures
+func execute(cb *gcb.Breaker, call func() error) error {
+	var callErr error
+	_, err := cb.Execute(func() (*http.Response, error) {
+		callErr = call()
+		if isFailure(callErr) {
+			return nil, callErr
+		}
+		return nil, nil
+	})
+	if callErr != nil {
+		return callErr
+	}
+	return err
+}
+
+// retry calls fn until it succeeds, fails with another code than
+// Unavailable, or the retries run out
+func retry(ctx context.Context, r *gcb.Retrier, fn func() error) error {
+	for attempt := uint32(0); ; attempt++ {
+		err := fn()
+		if r == nil || attempt >= r.RetryMax || status.Code(err) != codes.Unavailable {
+			return err
+		}
+
+		if r.Wait(ctx, r.Backoff(r.RetryWaitMin, r.RetryWaitMax, attempt, nil)) != nil {
+			return err
+		}
+	}
+}
+
+// isFailure reports whether the error says the server is in trouble, as
+// opposed to a rejected request
+func isFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package gcbgrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStream is an established client stream
+type fakeStream struct {
+	grpc.ClientStream
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	r := gcb.NewRetrier(gcb.WithMaxRetries(3))
+	r.Backoff = func(min, max time.Duration, attempt uint32, _ *http.Response) time.Duration {
+		return time.Millisecond
+	}
+
+	tests := []struct {
+		failures    int
+		code        codes.Code
+		expected    int
+		established bool
+	}{
+		// connection failures are retried until the stream is established
+		{2, codes.Unavailable, 3, true},
+		// the other errors aren't
+		{1, codes.PermissionDenied, 1, false},
+		// until the retries run out
+		{10, codes.Unavailable, 4, false},
+	}
+
+	for _, tt := range tests {
+		cb := gcb.NewBreaker(gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return false }))
+		interceptor := StreamClientInterceptor(cb, r)
+
+		calls := 0
+		streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			calls++
+			if calls <= tt.failures {
+				return nil, status.Error(tt.code, "failed")
+			}
+			return fakeStream{}, nil
+		}
+
+		stream, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/svc/Watch", streamer)
+		if calls != tt.expected {
+			t.Errorf("Expected %d, got %d", tt.expected, calls)
+		}
+		if (stream != nil) != tt.established || (err == nil) != tt.established {
+			t.Errorf("Unexpected stream %v and error %v", stream, err)
+		}
+	}
+}
+
+func TestStreamClientInterceptor_Open(t *testing.T) {
+	cb := gcb.NewBreaker(gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return true }))
+	interceptor := StreamClientInterceptor(cb, nil)
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, status.Error(codes.Unavailable, "failed")
+	}
+	_, _ = interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/svc/Watch", streamer)
+
+	_, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/svc/Watch", streamer)
+	if !errors.Is(err, gcb.ErrOpenState) {
+		t.Errorf("Expected %v, got %v", gcb.ErrOpenState, err)
+	}
+}
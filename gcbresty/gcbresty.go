@@ -0,0 +1,30 @@
+// Package gcbresty sends the requests of a resty client through gcb.
+//
+//	client := gcbresty.New(gcb.WithMaxRetries(3), gcb.WithPerKeyBreakers())
+//	resp, err := client.R().Get("https://catalog.internal/items")
+//
+// gcb becomes the transport of the resty client, so the requests are
+// retried and broken below resty: leave the resty retries off, they would
+// multiply the gcb ones. The transport settings of resty, e.g.
+// SetTLSClientConfig or SetProxy, need the *http.Transport and must be done
+// before Wrap.
+package gcbresty
+
+import (
+	"github.com/calvernaz/gcb"
+	"github.com/go-resty/resty/v2"
+)
+
+// New returns a resty client whose requests go through gcb
+func New(opts ...gcb.Option) *resty.Client {
+	return Wrap(resty.New(), opts...)
+}
+
+// Wrap layers gcb on top of the transport of the resty client
+func Wrap(client *resty.Client, opts ...gcb.Option) *resty.Client {
+	transport := client.GetClient().Transport
+	if transport != nil {
+		opts = append(append([]gcb.Option{}, opts...), gcb.WithTransport(transport))
+	}
+	return client.SetTransport(gcb.NewRoundTripper(opts...))
+}
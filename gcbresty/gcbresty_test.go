@@ -0,0 +1,45 @@
+package gcbresty
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestWrap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Team") != "catalog" {
+			t.Errorf("Expected the resty headers to be sent")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// nothing listens there anymore
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	client := New(
+		gcb.WithMaxRetries(0),
+		gcb.WithPerKeyBreakers(),
+		gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return counts.ConsecutiveFailures >= 1 }),
+	).SetHeader("X-Team", "catalog")
+
+	resp, err := client.R().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, resp.StatusCode())
+	}
+
+	if _, err := client.R().Get(closed.URL); err == nil {
+		t.Fatalf("Expected the request to fail")
+	}
+	if _, err := client.R().Get(closed.URL); !errors.Is(err, gcb.ErrOpenState) {
+		t.Errorf("Expected %v, got %v", gcb.ErrOpenState, err)
+	}
+}
@@ -0,0 +1,170 @@
+// Package gcbws guards the establishment of WebSocket connections with a
+// gcb breaker and retrier.
+//
+//	cb := gcb.NewBreaker(gcb.WithName("feed"))
+//	r := gcb.NewRetrier(gcb.WithMaxRetries(3))
+//	dialer := gcbws.NewDialer(websocket.DefaultDialer, cb, r)
+//	conn, resp, err := dialer.DialContext(ctx, "wss://feed.example.com", nil)
+//
+// Only the handshake is retried. Once established, the connection is left
+// alone, frames are never replayed, but a connection dropping without a
+// normal close is reported to the breaker as a failure.
+package gcbws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/calvernaz/gcb"
+	"github.com/gorilla/websocket"
+)
+
+type (
+	// Dialer dials WebSocket connections through the breaker
+	Dialer struct {
+		dialer  *websocket.Dialer
+		breaker *gcb.Breaker
+		retrier *gcb.Retrier
+	}
+
+	// Conn is a WebSocket connection reporting its drops to the breaker
+	Conn struct {
+		*websocket.Conn
+		breaker *gcb.Breaker
+
+		mu       sync.Mutex
+		closed   bool
+		reported bool
+	}
+)
+
+// NewDialer returns a dialer guarding dialer, a nil retrier disables the
+// retries
+func NewDialer(dialer *websocket.Dialer, cb *gcb.Breaker, r *gcb.Retrier) *Dialer {
+	return &Dialer{dialer: dialer, breaker: cb, retrier: r}
+}
+
+// DialContext establishes the connection, retrying the failed handshakes
+// the retry policy allows. Handshakes answered with a 5xx or failing to
+// connect count as failures.
+func (d *Dialer) DialContext(ctx context.Context, urlStr string, requestHeader http.Header) (*Conn, *http.Response, error) {
+	var conn *websocket.Conn
+	var resp *http.Response
+	var dialErr error
+
+	_, err := d.breaker.Execute(func() (*http.Response, error) {
+		conn, resp, dialErr = d.dial(ctx, urlStr, requestHeader)
+		if dialErr != nil && resp != nil && resp.StatusCode < 500 {
+			// the server is up, it refused the upgrade
+			return nil, nil
+		}
+		return nil, dialErr
+	})
+	if err == nil {
+		err = dialErr
+	}
+	if err != nil {
+		return nil, resp, err
+	}
+	return &Conn{Conn: conn, breaker: d.breaker}, resp, nil
+}
+
+func (d *Dialer) dial(ctx context.Context, urlStr string, requestHeader http.Header) (*websocket.Conn, *http.Response, error) {
+	for attempt := uint32(0); ; attempt++ {
+		conn, resp, err := d.dialer.DialContext(ctx, urlStr, requestHeader)
+		if err == nil || d.retrier == nil {
+			return conn, resp, err
+		}
+
+		// a handshake answered is judged on its status
+		var shouldRetry bool
+		var checkErr error
+		if resp != nil {
+			shouldRetry, checkErr = d.retrier.ShouldRetry(ctx, resp, nil)
+		} else {
+			shouldRetry, checkErr = d.retrier.ShouldRetry(ctx, nil, err)
+		}
+		if !shouldRetry {
+			if checkErr != nil {
+				err = checkErr
+			}
+			return nil, resp, err
+		}
+
+		retryMax := d.retrier.MaxRetries()
+		if attempt >= retryMax {
+			exhausted := &gcb.RetryExhaustedError{Attempts: retryMax + 1, LastErr: err}
+			if resp != nil {
+				exhausted.LastStatus = resp.StatusCode
+			}
+			return nil, resp, exhausted
+		}
+
+		if err := d.retrier.Wait(ctx, d.retrier.Backoff(d.retrier.RetryWaitMin, d.retrier.RetryWaitMax, attempt, resp)); err != nil {
+			return nil, resp, err
+		}
+	}
+}
+
+// NextReader reads the next message, reporting a drop to the breaker
+func (c *Conn) NextReader() (int, io.Reader, error) {
+	messageType, r, err := c.Conn.NextReader()
+	c.report(err)
+	return messageType, r, err
+}
+
+// ReadMessage reads the next message, reporting a drop to the breaker
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType, p, err := c.Conn.ReadMessage()
+	c.report(err)
+	return messageType, p, err
+}
+
+// ReadJSON reads the next JSON message, reporting a drop to the breaker
+func (c *Conn) ReadJSON(v interface{}) error {
+	err := c.Conn.ReadJSON(v)
+	c.report(err)
+	return err
+}
+
+// Close closes the connection, the errors that follow aren't drops
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// report records the first unexpected read error as a breaker failure
+func (c *Conn) report(err error) {
+	if err == nil || !isDrop(err) {
+		return
+	}
+
+	c.mu.Lock()
+	if c.closed || c.reported {
+		c.mu.Unlock()
+		return
+	}
+	c.reported = true
+	c.mu.Unlock()
+
+	_, _ = c.breaker.Execute(func() (*http.Response, error) {
+		return nil, err
+	})
+}
+
+// isDrop reports whether the read error means the connection dropped, as
+// opposed to a normal close or a malformed message
+func isDrop(err error) bool {
+	if _, ok := err.(*websocket.CloseError); ok {
+		return websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway)
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr)
+}
@@ -0,0 +1,59 @@
+package gcbws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"github.com/gorilla/websocket"
+)
+
+func TestDialer_RetriesHandshake(t *testing.T) {
+	var calls int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		// drop the connection without a close frame
+		_ = conn.UnderlyingConn().Close()
+	}))
+	defer server.Close()
+
+	r := gcb.NewRetrier(gcb.WithMaxRetries(3))
+	r.Backoff = func(min, max time.Duration, attempt uint32, resp *http.Response) time.Duration {
+		return time.Millisecond
+	}
+	cb := gcb.NewBreaker()
+	dialer := NewDialer(websocket.DefaultDialer, cb, r)
+
+	conn, _, err := dialer.DialContext(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if calls != 3 {
+		t.Errorf("Expected %d, got %d", 3, calls)
+	}
+	if counts := cb.Counts(); counts.TotalSuccesses != 1 {
+		t.Errorf("Expected the handshake to succeed, got %+v", counts)
+	}
+
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("Expected the connection to drop")
+	}
+	if counts := cb.Counts(); counts.TotalFailures != 1 {
+		t.Errorf("Expected the drop to be a failure, got %+v", counts)
+	}
+}
@@ -1,5 +1,29 @@
 module github.com/calvernaz/gcb
 
-go 1.13
+go 1.18
 
-require golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+require (
+	github.com/go-chi/chi/v5 v5.0.7
+	github.com/go-redis/redis/v7 v7.4.1
+	github.com/go-resty/resty/v2 v2.7.0
+	github.com/gorilla/websocket v1.4.2
+	github.com/nats-io/nats.go v1.9.1
+	github.com/valyala/fasthttp v1.9.0
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	google.golang.org/grpc v1.27.1
+)
+
+require (
+	github.com/golang/protobuf v1.3.2 // indirect
+	github.com/klauspost/compress v1.8.2 // indirect
+	github.com/klauspost/cpuid v1.2.1 // indirect
+	github.com/nats-io/jwt v0.3.0 // indirect
+	github.com/nats-io/nkeys v0.1.0 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
+	golang.org/x/net v0.0.0-20211029224645-99673261e6eb // indirect
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
+	golang.org/x/text v0.3.6 // indirect
+	google.golang.org/genproto v0.0.0-20190819201941-24fa4b261c55 // indirect
+)
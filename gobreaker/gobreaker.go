@@ -0,0 +1,180 @@
+// Package gobreaker exposes the API of sony/gobreaker over a gcb.Breaker,
+// so the code written against gobreaker can switch by changing the import
+// path:
+//
+//	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{Name: "payments"})
+//	body, err := cb.Execute(func() (interface{}, error) {
+//		return charge(order)
+//	})
+//
+// The underlying breaker is available from Breaker. Unlike gobreaker, and
+// like every gcb breaker, it leaves context.Canceled and
+// context.DeadlineExceeded out of the counts.
+package gobreaker
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+var (
+	// ErrTooManyRequests is returned when the CB state is half open and the
+	// requests count is over the cb maxRequests
+	ErrTooManyRequests = gcb.ErrTooManyRequests
+	// ErrOpenState is returned when the CB state is open
+	ErrOpenState = gcb.ErrOpenState
+)
+
+// These constants are states of CircuitBreaker.
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+type (
+	// State is a type that represents a state of CircuitBreaker.
+	State int
+
+	// Counts holds the numbers of requests and their successes/failures.
+	Counts = gcb.Counts
+
+	// Settings configures CircuitBreaker, see sony/gobreaker for the
+	// meaning of every field
+	Settings struct {
+		Name          string
+		MaxRequests   uint32
+		Interval      time.Duration
+		Timeout       time.Duration
+		ReadyToTrip   func(counts Counts) bool
+		OnStateChange func(name string, from State, to State)
+		IsSuccessful  func(err error) bool
+	}
+
+	// CircuitBreaker is a state machine to prevent sending requests that
+	// are likely to fail.
+	CircuitBreaker struct {
+		breaker      *gcb.Breaker
+		isSuccessful func(err error) bool
+	}
+)
+
+// String implements stringer interface.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown state"
+}
+
+// NewCircuitBreaker returns a new CircuitBreaker configured with the given
+// Settings. The zero values have the gobreaker defaults: a timeout of 60
+// seconds, no interval and tripping after more than 5 consecutive failures.
+func NewCircuitBreaker(st Settings) *CircuitBreaker {
+	opts := []gcb.Option{
+		gcb.WithName(st.Name),
+		gcb.WithMaxRequests(st.MaxRequests),
+		gcb.WithInterval(st.Interval),
+	}
+	if st.Timeout > 0 {
+		opts = append(opts, gcb.WithTimeout(st.Timeout))
+	}
+
+	readyToTrip := st.ReadyToTrip
+	if readyToTrip == nil {
+		readyToTrip = defaultReadyToTrip
+	}
+	opts = append(opts, gcb.WithReadyToTrip(readyToTrip))
+
+	if st.OnStateChange != nil {
+		onStateChange := st.OnStateChange
+		opts = append(opts, gcb.WithEventListener(func(event gcb.Event) {
+			if event.Type == gcb.EventStateChange {
+				onStateChange(event.Name, state(event.From), state(event.To))
+			}
+		}))
+	}
+
+	isSuccessful := st.IsSuccessful
+	if isSuccessful == nil {
+		isSuccessful = defaultIsSuccessful
+	}
+
+	return &CircuitBreaker{
+		breaker:      gcb.NewBreaker(opts...),
+		isSuccessful: isSuccessful,
+	}
+}
+
+// Breaker returns the underlying gcb breaker
+func (cb *CircuitBreaker) Breaker() *gcb.Breaker {
+	return cb.breaker
+}
+
+// Name returns the name of the CircuitBreaker.
+func (cb *CircuitBreaker) Name() string {
+	return cb.breaker.Name()
+}
+
+// State returns the current state of the CircuitBreaker.
+func (cb *CircuitBreaker) State() State {
+	return state(cb.breaker.State())
+}
+
+// Counts returns internal counters
+func (cb *CircuitBreaker) Counts() Counts {
+	return cb.breaker.Counts()
+}
+
+// Execute runs the given request if the CircuitBreaker accepts it.
+// Execute returns an error instantly if the CircuitBreaker rejects the
+// request. Otherwise, Execute returns the result of the request. If a
+// panic occurs in the request, the CircuitBreaker handles it as an error
+// and causes the same panic again.
+func (cb *CircuitBreaker) Execute(req func() (interface{}, error)) (interface{}, error) {
+	var result interface{}
+	var reqErr error
+	_, err := cb.breaker.Execute(func() (*http.Response, error) {
+		result, reqErr = req()
+		if reqErr != nil && !cb.isSuccessful(reqErr) {
+			return nil, reqErr
+		}
+		return nil, nil
+	})
+	if err != nil && reqErr == nil {
+		// the breaker rejected the request, with the sentinel errors the
+		// gobreaker users compare to
+		if errors.Is(err, gcb.ErrOpenState) {
+			return nil, ErrOpenState
+		}
+		return nil, err
+	}
+	return result, reqErr
+}
+
+// state maps the gcb states
+func state(s gcb.State) State {
+	switch s {
+	case gcb.HalfOpen:
+		return StateHalfOpen
+	case gcb.Open:
+		return StateOpen
+	}
+	return StateClosed
+}
+
+func defaultReadyToTrip(counts Counts) bool {
+	return counts.ConsecutiveFailures > 5
+}
+
+func defaultIsSuccessful(err error) bool {
+	return err == nil
+}
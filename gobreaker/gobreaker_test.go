@@ -0,0 +1,57 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	errNotFound := errors.New("not found")
+	var transitions []string
+
+	cb := NewCircuitBreaker(Settings{
+		Name:    "payments",
+		Timeout: 10 * time.Millisecond,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+		OnStateChange: func(name string, from State, to State) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+		IsSuccessful: func(err error) bool {
+			return err == nil || errors.Is(err, errNotFound)
+		},
+	})
+
+	fail := func() (interface{}, error) { return nil, errors.New("failed") }
+
+	// a successful error is returned but doesn't count as a failure
+	if _, err := cb.Execute(func() (interface{}, error) { return nil, errNotFound }); err != errNotFound {
+		t.Errorf("Expected %v, got %v", errNotFound, err)
+	}
+	_, _ = cb.Execute(fail)
+	_, _ = cb.Execute(fail)
+	if cb.State() != StateOpen {
+		t.Errorf("Expected %s, got %s", StateOpen, cb.State())
+	}
+	if _, err := cb.Execute(fail); err != ErrOpenState {
+		t.Errorf("Expected %v, got %v", ErrOpenState, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	result, err := cb.Execute(func() (interface{}, error) { return 42, nil })
+	if err != nil || result != 42 {
+		t.Errorf("Expected %d, got %v, %v", 42, result, err)
+	}
+
+	expected := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], transitions[i])
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Package gossip lets instances exchange their breaker summaries without
+// shared infrastructure. Every node periodically sends its summaries, along
+// with the peers it knows about, to a few random peers over UDP, so both the
+// observations and the membership spread through the cluster.
+//
+// A node is a gcb.PeerView, to be used with gcb.WithPeerView:
+//
+//	node, err := gossip.New(gossip.Config{BindAddr: ":7946", Peers: seeds})
+//	transport := gcb.NewRoundTripper(gcb.WithPeerView(node, 0.5))
+//	node.Start(transport.Summaries)
+//
+// It's also a gcb.Election for gcb.WithProbeLeader, the live node with the
+// lowest ID leads, and a gcb.Quorum for gcb.WithOpenQuorum.
+package gossip
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+var (
+	// makes sure the node implements the peer view and election interfaces
+	_ gcb.PeerView = (*Node)(nil)
+	_ gcb.Election = (*Node)(nil)
+	_ gcb.Quorum   = (*Node)(nil)
+
+	defaultInterval = time.Second
+	defaultFanout   = 3
+
+	// keep the datagrams under the usual safe UDP payload
+	maxMessageSize = 65000
+	// minReadBackoff is the first wait after a failed read, doubled up to
+	// the interval while the reads keep failing
+	minReadBackoff = 10 * time.Millisecond
+)
+
+type (
+	// Config configures a gossip node
+	Config struct {
+		// NodeID identifies the node, it defaults to the bind address
+		NodeID string
+		// BindAddr is the UDP address the node listens on
+		BindAddr string
+		// Peers are the seed addresses, the rest of the cluster is learnt
+		// from them
+		Peers []string
+		// Interval between two gossip rounds, 1 second by default
+		Interval time.Duration
+		// Fanout is the number of peers gossiped to every round, 3 by default
+		Fanout int
+		// Expiry is the time after which a silent peer is forgotten, along
+		// with its address unless it's a seed. It defaults to ten intervals.
+		Expiry time.Duration
+	}
+
+	// message is the gossip datagram
+	message struct {
+		Node      string               `json:"node"`
+		Peers     []string             `json:"peers"`
+		Summaries []gcb.BreakerSummary `json:"summaries"`
+	}
+
+	// peer is what the node knows about another node
+	peer struct {
+		summaries map[string]gcb.Counts
+		seen      time.Time
+	}
+
+	// address is the address of a node, learnt when another node first
+	// told about it and heard when it last sent a message itself
+	address struct {
+		seed          bool
+		learnt, heard time.Time
+	}
+
+	// Node is a member of the gossip cluster
+	Node struct {
+		config Config
+		conn   *net.UDPConn
+
+		mu    sync.RWMutex
+		addrs map[string]*address
+		peers map[string]*peer
+		rnd   *rand.Rand
+
+		stop chan struct{}
+		done sync.WaitGroup
+	}
+)
+
+// New creates a node listening on the bind address
+func New(config Config) (*Node, error) {
+	if config.Interval == 0 {
+		config.Interval = defaultInterval
+	}
+	if config.Fanout == 0 {
+		config.Fanout = defaultFanout
+	}
+	if config.Expiry == 0 {
+		config.Expiry = 10 * config.Interval
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", config.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.NodeID == "" {
+		config.NodeID = conn.LocalAddr().String()
+	}
+
+	n := &Node{
+		config: config,
+		conn:   conn,
+		addrs:  make(map[string]*address),
+		peers:  make(map[string]*peer),
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		stop:   make(chan struct{}),
+	}
+	for _, p := range config.Peers {
+		n.addrs[p] = &address{seed: true}
+	}
+	return n, nil
+}
+
+// Addr returns the address the node listens on
+func (n *Node) Addr() string {
+	return n.conn.LocalAddr().String()
+}
+
+// Start gossips the summaries returned by source, e.g. the Summaries method
+// of a gcb transport, and listens to the peers.
+func (n *Node) Start(source func() []gcb.BreakerSummary) {
+	n.done.Add(2)
+	go n.listen()
+	go n.gossip(source)
+}
+
+// Close stops the node
+func (n *Node) Close() error {
+	close(n.stop)
+	err := n.conn.Close()
+	n.done.Wait()
+	return err
+}
+
+// PeerCounts returns the average counts the live peers have for the breaker
+func (n *Node) PeerCounts(name string) (gcb.Counts, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var sum [5]uint64
+	var found uint64
+	now := time.Now()
+	for _, p := range n.peers {
+		counts, ok := p.summaries[name]
+		if !ok || now.Sub(p.seen) > n.config.Expiry {
+			continue
+		}
+		found++
+		sum[0] += uint64(counts.Requests)
+		sum[1] += uint64(counts.TotalSuccesses)
+		sum[2] += uint64(counts.TotalFailures)
+		sum[3] += uint64(counts.ConsecutiveSuccesses)
+		sum[4] += uint64(counts.ConsecutiveFailures)
+	}
+	if found == 0 {
+		return gcb.Counts{}, false
+	}
+
+	return gcb.Counts{
+		Requests:             uint32(sum[0] / found),
+		TotalSuccesses:       uint32(sum[1] / found),
+		TotalFailures:        uint32(sum[2] / found),
+		ConsecutiveSuccesses: uint32(sum[3] / found),
+		ConsecutiveFailures:  uint32(sum[4] / found),
+	}, true
+}
+
+// PeerFailureRates returns the failure rate of the breaker for every live
+// peer that reported it
+func (n *Node) PeerFailureRates(name string) []float64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var rates []float64
+	now := time.Now()
+	for _, p := range n.peers {
+		counts, ok := p.summaries[name]
+		if !ok || now.Sub(p.seen) > n.config.Expiry {
+			continue
+		}
+		var rate float64
+		if counts.Requests > 0 {
+			rate = float64(counts.TotalFailures) / float64(counts.Requests)
+		}
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+// IsLeader reports whether the node has the lowest ID among the live nodes,
+// the same node leads every breaker
+func (n *Node) IsLeader(name string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	now := time.Now()
+	for id, p := range n.peers {
+		if id < n.config.NodeID && now.Sub(p.seen) <= n.config.Expiry {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Node) gossip(source func() []gcb.BreakerSummary) {
+	defer n.done.Done()
+
+	ticker := time.NewTicker(n.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+			n.round(source())
+		}
+	}
+}
+
+// round sends the summaries to a few random peers, along with the addresses
+// of the nodes heard from lately. Passing on the addresses only learnt would
+// keep a dead node known forever, each node telling the others about it.
+func (n *Node) round(summaries []gcb.BreakerSummary) {
+	now := time.Now()
+	n.mu.Lock()
+	n.expire(now)
+	addrs := make([]string, 0, len(n.addrs))
+	var live []string
+	for addr, a := range n.addrs {
+		addrs = append(addrs, addr)
+		if now.Sub(a.heard) <= n.config.Expiry {
+			live = append(live, addr)
+		}
+	}
+	n.rnd.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	n.mu.Unlock()
+
+	data, err := json.Marshal(message{
+		Node:      n.config.NodeID,
+		Peers:     live,
+		Summaries: summaries,
+	})
+	if err != nil || len(data) > maxMessageSize {
+		return
+	}
+
+	if len(addrs) > n.config.Fanout {
+		addrs = addrs[:n.config.Fanout]
+	}
+	for _, addr := range addrs {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			continue
+		}
+		_, _ = n.conn.WriteToUDP(data, udpAddr)
+	}
+}
+
+func (n *Node) listen() {
+	defer n.done.Done()
+
+	buf := make([]byte, maxMessageSize)
+	backoff := minReadBackoff
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// the error may well repeat, don't spin on it
+			select {
+			case <-n.stop:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > n.config.Interval {
+				backoff = n.config.Interval
+			}
+			continue
+		}
+		backoff = minReadBackoff
+
+		var msg message
+		if err := json.Unmarshal(buf[:size], &msg); err != nil || msg.Node == n.config.NodeID {
+			continue
+		}
+		n.merge(msg, from.String())
+	}
+}
+
+// merge records the summaries of the peer and the peers it knows about, the
+// sender is reachable at the address the message came from
+func (n *Node) merge(msg message, from string) {
+	summaries := make(map[string]gcb.Counts, len(msg.Summaries))
+	for _, s := range msg.Summaries {
+		summaries[s.Name] = s.Counts
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	n.peers[msg.Node] = &peer{summaries: summaries, seen: now}
+	if a, ok := n.addrs[from]; ok {
+		a.heard = now
+	} else {
+		n.addrs[from] = &address{learnt: now, heard: now}
+	}
+	for _, addr := range msg.Peers {
+		if _, ok := n.addrs[addr]; !ok && addr != n.Addr() {
+			n.addrs[addr] = &address{learnt: now}
+		}
+	}
+	n.expire(now)
+}
+
+// expire forgets the peers gone silent, and the addresses not heard from
+// since they were learnt but the seeds. The node must be locked.
+func (n *Node) expire(now time.Time) {
+	for id, p := range n.peers {
+		if now.Sub(p.seen) > n.config.Expiry {
+			delete(n.peers, id)
+		}
+	}
+	for addr, a := range n.addrs {
+		if !a.seed && now.Sub(a.learnt) > n.config.Expiry && now.Sub(a.heard) > n.config.Expiry {
+			delete(n.addrs, addr)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package gossip
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestNode_ExchangesSummaries(t *testing.T) {
+	a, err := New(Config{BindAddr: "127.0.0.1:0", Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// b only knows about a, a learns about b from its messages
+	b, err := New(Config{BindAddr: "127.0.0.1:0", Peers: []string{a.Addr()}, Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	a.Start(func() []gcb.BreakerSummary {
+		return []gcb.BreakerSummary{{Name: "api", State: gcb.Close, Counts: gcb.Counts{ConsecutiveFailures: 4}}}
+	})
+	b.Start(func() []gcb.BreakerSummary {
+		return []gcb.BreakerSummary{{Name: "api", State: gcb.Close, Counts: gcb.Counts{ConsecutiveFailures: 2}}}
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		fromA, okA := b.PeerCounts("api")
+		fromB, okB := a.PeerCounts("api")
+		if okA && okB {
+			if fromA.ConsecutiveFailures != 4 || fromB.ConsecutiveFailures != 2 {
+				t.Errorf("Unexpected peer counts %+v %+v", fromA, fromB)
+			}
+			if a.IsLeader("api") == b.IsLeader("api") {
+				t.Errorf("Expected exactly one leader")
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Expected the nodes to exchange their summaries")
+}
+
+func TestNode_ExpiresAddresses(t *testing.T) {
+	n, err := New(Config{BindAddr: "127.0.0.1:0", Peers: []string{"127.0.0.1:7946"}, Expiry: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	// a peer tells about a node it heard from, and about one it didn't
+	n.merge(message{Node: "b", Peers: []string{"127.0.0.1:7948"}}, "127.0.0.1:7947")
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		addrs []string
+	}{
+		{"learnt", 0, []string{"127.0.0.1:7946", "127.0.0.1:7947", "127.0.0.1:7948"}},
+		{"silent", 2 * time.Minute, []string{"127.0.0.1:7946"}},
+	}
+
+	for _, tt := range tests {
+		n.mu.Lock()
+		n.expire(time.Now().Add(tt.after))
+		var addrs []string
+		for addr := range n.addrs {
+			addrs = append(addrs, addr)
+		}
+		n.mu.Unlock()
+
+		sort.Strings(addrs)
+		if !reflect.DeepEqual(addrs, tt.addrs) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.addrs, addrs)
+		}
+	}
+}
+
+func TestNode_ListenClosed(t *testing.T) {
+	n, err := New(Config{BindAddr: "127.0.0.1:0", Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.done.Add(1)
+	go n.listen()
+
+	// a closed connection stops the listening rather than spinning on it
+	_ = n.conn.Close()
+	stopped := make(chan struct{})
+	go func() {
+		n.done.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the listening to stop")
+	}
+}
@@ -0,0 +1,77 @@
+package gcb
+
+import (
+	"sync/atomic"
+)
+
+type (
+	// HealthStats count the failures of gcb itself since the transport was
+	// created, which would otherwise go unnoticed
+	HealthStats struct {
+		// EventDrops are the events dropped by the queue of WithEventQueue
+		EventDrops uint64 `json:"eventDrops"`
+		// Evictions are the per-key and proxy breakers evicted
+		Evictions uint64 `json:"evictions"`
+		// QueueErrors are the requests the offline queue failed to store,
+		// or to store back after a failed delivery
+		QueueErrors uint64 `json:"queueErrors"`
+		// PublishErrors are the breaker states that couldn't be shared with
+		// the peers
+		PublishErrors uint64 `json:"publishErrors"`
+		// ReloadFailures are the failed reloads reported by the control
+		// plane, or any other caller of ReportReloadFailure
+		ReloadFailures uint64 `json:"reloadFailures"`
+	}
+
+	// health counts the failures not counted by the components themselves
+	health struct {
+		publishErrors  uint64
+		reloadFailures uint64
+	}
+)
+
+// WithEventQueue delivers the breaker events to the queue, as
+// WithEventListener(queue.Listen) does, and reports its drops in the
+// health of the transport
+func WithEventQueue(queue *EventQueue) Option {
+	return func(config *Config) {
+		config.onEvent = queue.Listen
+		config.eventQueue = queue
+	}
+}
+
+// Health returns the health counters of the transport
+func (t *tripper) Health() HealthStats {
+	return t.RoundTripper.(*circuit).healthStats()
+}
+
+// ReportReloadFailure counts a reload of the options which failed before
+// reaching the transport, e.g. a policy the control plane couldn't parse.
+// The error is logged.
+func (t *tripper) ReportReloadFailure(err error) {
+	c := t.RoundTripper.(*circuit)
+	atomic.AddUint64(&c.health.reloadFailures, 1)
+	if c.logger.enabled(LevelError) {
+		c.logger.Printf("[ERR] error reloading the options: %v", err)
+	}
+}
+
+func (c *circuit) healthStats() HealthStats {
+	stats := HealthStats{
+		PublishErrors:  atomic.LoadUint64(&c.health.publishErrors),
+		ReloadFailures: atomic.LoadUint64(&c.health.reloadFailures),
+	}
+	if c.eventQueue != nil {
+		stats.EventDrops = c.eventQueue.Dropped()
+	}
+	if c.breakers != nil {
+		stats.Evictions += atomic.LoadUint64(&c.breakers.evicted)
+	}
+	if c.proxyBreakers != nil {
+		stats.Evictions += atomic.LoadUint64(&c.proxyBreakers.evicted)
+	}
+	if c.queue != nil {
+		stats.QueueErrors = atomic.LoadUint64(&c.queue.failed)
+	}
+	return stats
+}
@@ -0,0 +1,84 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// failingPubSub fails every publication
+type failingPubSub struct{}
+
+func (failingPubSub) Publish(ctx context.Context, data []byte) error {
+	return errors.New("unreachable")
+}
+
+func (failingPubSub) Subscribe(ctx context.Context, handler func([]byte)) error {
+	return nil
+}
+
+func TestTripper_Health(t *testing.T) {
+	block := make(chan struct{})
+	queue := NewEventQueue(func(event Event) { <-block }, 1)
+	defer queue.Close()
+	defer close(block)
+
+	var metrics []Metrics
+	transport := NewRoundTripper(
+		WithName("api"),
+		WithPerKeyBreakers(),
+		WithBreakerEviction(0, 1, nil),
+		WithEventQueue(queue),
+		WithPubSub(failingPubSub{}, "local"),
+		WithOfflineQueue(NewMemoryQueue(0), nil),
+		WithMaxRetries(0),
+		WithLogLevel(LevelOff),
+		WithMetricsListener(func(m Metrics) { metrics = append(metrics, m) }, time.Hour),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		})),
+	)
+	c := transport.RoundTripper.(*circuit)
+
+	// the state changes overflow the event queue and can't be published
+	c.breakers.get("a.example")
+	for _, state := range []State{Open, Close, Open, Close, Open} {
+		transport.ForceState("a.example", state)
+	}
+	// a.example is evicted for b.example
+	c.breakers.get("b.example")
+	// the offline queue can't take the request
+	req, _ := http.NewRequest(http.MethodGet, "http://b.example", nil)
+	if _, err := transport.RoundTrip(Deferrable(req)); errors.Is(err, ErrQueued) {
+		t.Errorf("Expected the request not to be queued")
+	}
+	transport.ReportReloadFailure(errors.New("invalid policy"))
+
+	// the publications run in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for transport.Health().PublishErrors < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	health := transport.Health()
+	if health.EventDrops == 0 {
+		t.Errorf("Expected event drops, got none")
+	}
+	if health.PublishErrors < 2 {
+		t.Errorf("Expected at least %d, got %d", 2, health.PublishErrors)
+	}
+	want := HealthStats{EventDrops: health.EventDrops, Evictions: 1, QueueErrors: 1, PublishErrors: health.PublishErrors, ReloadFailures: 1}
+	if health != want {
+		t.Errorf("Expected %+v, got %+v", want, health)
+	}
+
+	if stats := transport.Stats(); stats.Health != health {
+		t.Errorf("Expected %+v, got %+v", health, stats.Health)
+	}
+	c.metrics.flush(time.Second)
+	if len(metrics) != 1 || metrics[0].Health.ReloadFailures != 1 {
+		t.Errorf("Expected the health in the metrics, got %+v", metrics)
+	}
+}
@@ -0,0 +1,152 @@
+package gcb
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type (
+	// hedging sends a second copy of the attempts slower than delay, the
+	// first response wins and the other attempt is cancelled
+	hedging struct {
+		delay time.Duration
+		// budget bounds the extra attempts, nil for no bound
+		budget *rate.Limiter
+	}
+
+	// hedgeResult is the outcome of one of the copies of an attempt
+	hedgeResult struct {
+		resp  *http.Response
+		err   error
+		index int
+	}
+
+	// cancelBody cancels the context of the winning attempt once its body
+	// is closed, the context can't be cancelled while the body is read
+	cancelBody struct {
+		io.ReadCloser
+		once   sync.Once
+		cancel context.CancelFunc
+	}
+)
+
+// WithHedging sends a second copy of the attempts which haven't got a
+// response after delay, the first response wins. The other copy is cancelled
+// through its context, which closes its connection if it's still waiting,
+// and its response is closed if it came too. budget bounds the extra copies
+// per second over the transport, 0 doesn't bound them. Only the GET, HEAD and
+// OPTIONS requests without a body are hedged, the others could have effects
+// twice.
+func WithHedging(delay time.Duration, budget rate.Limit) Option {
+	return func(config *Config) {
+		config.hedgeDelay = delay
+		config.hedgeBudget = budget
+	}
+}
+
+func newHedging(delay time.Duration, budget rate.Limit) *hedging {
+	h := &hedging{delay: delay}
+	if budget > 0 {
+		h.budget = rate.NewLimiter(budget, int(math.Max(1, math.Ceil(float64(budget)))))
+	}
+	return h
+}
+
+// hedgeable reports whether the request may be sent twice
+func hedgeable(req *http.Request) bool {
+	return SafeMethods(req) && (req.Body == nil || req.Body == http.NoBody)
+}
+
+// roundTrip sends the attempt, hedged if enabled
+func (c *circuit) roundTrip(attempt *http.Request) (*http.Response, error) {
+	if c.hedging == nil || !hedgeable(attempt) {
+		return c.RoundTripper.RoundTrip(attempt)
+	}
+	return c.hedging.roundTrip(c.RoundTripper, attempt)
+}
+
+// roundTrip sends the request, and a copy of it once the delay is over if
+// the budget allows it
+func (h *hedging) roundTrip(transport http.RoundTripper, req *http.Request) (*http.Response, error) {
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func(attempt *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := transport.RoundTrip(attempt.WithContext(ctx))
+			results <- hedgeResult{resp, err, index}
+		}()
+	}
+	// discard cancels the attempts other than the winner, if any, and
+	// closes the responses of the n attempts still out
+	discard := func(winner, n int) {
+		for i, cancel := range cancels {
+			if i != winner {
+				cancel()
+			}
+		}
+		go discardHedges(results, n)
+	}
+
+	send(req)
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+
+	var last hedgeResult
+	for received := 0; received < len(cancels); {
+		select {
+		case <-timer.C:
+			if h.budget == nil || h.budget.Allow() {
+				send(req.Clone(req.Context()))
+			}
+		case result := <-results:
+			received++
+			if result.err == nil && result.resp == nil {
+				result.err = ErrNoResponse
+			}
+			if result.err != nil {
+				cancels[result.index]()
+				last = result
+				continue
+			}
+			discard(result.index, len(cancels)-received)
+			// the context of the winner lives until its body is closed
+			cancel := cancels[result.index]
+			if result.resp.Body == nil {
+				cancel()
+				return result.resp, nil
+			}
+			result.resp.Body = &cancelBody{ReadCloser: result.resp.Body, cancel: cancel}
+			return result.resp, nil
+		case <-req.Context().Done():
+			discard(-1, len(cancels)-received)
+			return nil, req.Context().Err()
+		}
+	}
+	return last.resp, last.err
+}
+
+// discardHedges closes the responses of the n attempts left, which were
+// cancelled
+func discardHedges(results chan hedgeResult, n int) {
+	for i := 0; i < n; i++ {
+		result := <-results
+		if result.resp != nil && result.resp.Body != nil {
+			_ = result.resp.Body.Close()
+		}
+	}
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.cancel)
+	return err
+}
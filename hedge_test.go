@@ -0,0 +1,154 @@
+package gcb
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestWithHedging(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	var hits int32
+	cancelled := make(chan struct{}, 1)
+	var mu sync.Mutex
+	active := map[net.Conn]bool{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			// the first attempt hangs until the hedge wins
+			select {
+			case <-r.Context().Done():
+				cancelled <- struct{}{}
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("hedge"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		mu.Lock()
+		active[conn] = state == http.StateActive
+		mu.Unlock()
+	}
+	server.Start()
+
+	base := &http.Transport{}
+	transport := NewRoundTripper(WithHedging(10*time.Millisecond, 0), WithoutRetries(), WithTransport(base))
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "hedge" {
+		t.Errorf("Expected %s, got %s", "hedge", body)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the losing attempt to be cancelled")
+	}
+
+	// the connections are released, then nothing is left running
+	base.CloseIdleConnections()
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		busy := 0
+		for _, isActive := range active {
+			if isActive {
+				busy++
+			}
+		}
+		mu.Unlock()
+		if busy == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no active connection, got %d", busy)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	server.Close()
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		buf := make([]byte, 1<<16)
+		t.Errorf("Expected at most %d goroutines, got %d\n%s", goroutines, n, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestWithHedging_Budget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget rate.Limit
+		method string
+		hits   int32
+	}{
+		{"unbounded", 0, http.MethodGet, 6},
+		{"budget", 1, http.MethodGet, 4},
+		{"not idempotent", 0, http.MethodPost, 3},
+	}
+
+	for _, tt := range tests {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			select {
+			case <-r.Context().Done():
+			case <-time.After(50 * time.Millisecond):
+			}
+		}))
+
+		transport := NewRoundTripper(WithHedging(5*time.Millisecond, tt.budget), WithoutRetries(), WithTransport(&http.Transport{}))
+		for i := 0; i < 3; i++ {
+			req, _ := http.NewRequest(tt.method, server.URL, strings.NewReader(""))
+			if tt.method == http.MethodGet {
+				req, _ = http.NewRequest(tt.method, server.URL, nil)
+			}
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			_ = resp.Body.Close()
+		}
+		server.Close()
+
+		if got := atomic.LoadInt32(&hits); got != tt.hits {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.hits, got)
+		}
+	}
+}
+
+func TestWithHedging_NoResponse(t *testing.T) {
+	var attempts int32
+	transport := NewRoundTripper(WithHedging(time.Millisecond, 0), WithoutRetries(), WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			// the first attempt is still running when the hedge is sent
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil, nil
+	})))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+	resp, err := transport.RoundTrip(req)
+	if resp != nil || !errors.Is(err, ErrNoResponse) {
+		t.Errorf("Expected %v, got %v, %v", ErrNoResponse, resp, err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("Expected %d, got %d", 2, got)
+	}
+}
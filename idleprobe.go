@@ -0,0 +1,114 @@
+package gcb
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// idleProbe probes the upstreams of the breakers left without traffic,
+	// so a dead backend is found by a probe rather than by the first request
+	// after a quiet period
+	idleProbe struct {
+		interval time.Duration
+		probe    ProbeFunc
+
+		// targets holds the idleTarget of each breaker
+		targets sync.Map
+	}
+
+	// idleTarget is the last URL seen by a breaker, and its last use in unix
+	// nanoseconds, a request or a probe
+	idleTarget struct {
+		lastUsed int64
+		url      atomic.Value
+	}
+)
+
+// WithMaxIdleProbeInterval probes the upstream of every breaker that had no
+// traffic for interval, about once per interval for as long as it stays
+// idle, so the first request after a quiet period doesn't have to find out
+// the backend died. It's meant for per-key breakers, where each host has its
+// own. The probes are built by probe against the URL of the last request
+// seen by the breaker, a nil probe sends HEAD requests to that URL. They are
+// sent through the breaker, a single attempt each, and count as requests:
+// a failing probe opens the breaker of a dead host as a request would. The
+// open breakers aren't probed, and neither are the evicted ones. Shutdown
+// stops the probing.
+func WithMaxIdleProbeInterval(interval time.Duration, probe ProbeFunc) Option {
+	return func(config *Config) {
+		config.idleProbeInterval = interval
+		config.idleProbe = probe
+	}
+}
+
+func newIdleProbe(interval time.Duration, probe ProbeFunc) *idleProbe {
+	if probe == nil {
+		probe = headProbe
+	}
+	return &idleProbe{interval: interval, probe: probe}
+}
+
+// track remembers the request URL as the probe target of the breaker, and
+// the breaker as used
+func (p *idleProbe) track(cb *Breaker, req *http.Request, now time.Time) {
+	t, ok := p.targets.Load(cb)
+	if !ok {
+		t, _ = p.targets.LoadOrStore(cb, &idleTarget{})
+	}
+	target := t.(*idleTarget)
+	target.url.Store(req.URL)
+	atomic.StoreInt64(&target.lastUsed, now.UnixNano())
+}
+
+// run probes the idle breakers every interval until ctx is done
+func (p *idleProbe) run(ctx context.Context, c *circuit) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.probeIdle(c, now)
+		}
+	}
+}
+
+// probeIdle sends a probe to the breakers idle for interval, one at a time
+// per breaker
+func (p *idleProbe) probeIdle(c *circuit, now time.Time) {
+	p.targets.Range(func(key, value interface{}) bool {
+		cb, target := key.(*Breaker), value.(*idleTarget)
+		select {
+		case <-cb.stop:
+			// evicted
+			p.targets.Delete(cb)
+			return true
+		default:
+		}
+		if now.UnixNano()-atomic.LoadInt64(&target.lastUsed) < int64(p.interval) || cb.State() == Open {
+			return true
+		}
+		if _, inFlight := c.probing.LoadOrStore(cb, struct{}{}); inFlight {
+			return true
+		}
+		probe, err := p.probe(target.url.Load().(*url.URL))
+		if err != nil {
+			c.probing.Delete(cb)
+			return true
+		}
+		atomic.StoreInt64(&target.lastUsed, now.UnixNano())
+
+		go func() {
+			defer c.probing.Delete(cb)
+			c.sendProbe(cb, probe)
+		}()
+		return true
+	})
+}
@@ -0,0 +1,100 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithMaxIdleProbeInterval(t *testing.T) {
+	var mu sync.Mutex
+	var probed []string
+	dead := map[string]bool{}
+	transport := NewRoundTripper(
+		WithPerKeyBreakers(),
+		WithoutRetries(),
+		WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 }),
+		WithMaxIdleProbeInterval(time.Hour, nil),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if req.Method == http.MethodHead {
+				probed = append(probed, req.URL.Host+req.URL.Path)
+			}
+			if dead[req.URL.Host] {
+				return nil, errors.New("connection refused")
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+	c := transport.RoundTripper.(*circuit)
+
+	start := time.Now()
+	for _, target := range []string{"http://a.example/users", "http://b.example/orders"} {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	dead["a.example"] = true
+	mu.Unlock()
+
+	tests := []struct {
+		name   string
+		after  time.Duration
+		probed []string
+		states []State
+	}{
+		{"busy", 30 * time.Minute, nil, []State{Close, Close}},
+		{"idle", 2 * time.Hour, []string{"a.example/users", "b.example/orders"}, []State{Open, Close}},
+		{"just probed", 2*time.Hour + time.Minute, nil, []State{Open, Close}},
+		{"open", 4 * time.Hour, []string{"b.example/orders"}, []State{Open, Close}},
+	}
+
+	for _, tt := range tests {
+		mu.Lock()
+		probed = nil
+		mu.Unlock()
+
+		c.idleProbe.probeIdle(c, start.Add(tt.after))
+		waitProbes(t, c)
+
+		mu.Lock()
+		sort.Strings(probed)
+		if !reflect.DeepEqual(probed, tt.probed) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.probed, probed)
+		}
+		mu.Unlock()
+		var states []State
+		for _, cb := range c.allBreakers() {
+			states = append(states, cb.State())
+		}
+		if !reflect.DeepEqual(states, tt.states) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.states, states)
+		}
+	}
+}
+
+// waitProbes waits for the probes in flight
+func waitProbes(t *testing.T, c *circuit) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		inFlight := false
+		c.probing.Range(func(key, value interface{}) bool {
+			inFlight = true
+			return false
+		})
+		if !inFlight {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the probes to finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
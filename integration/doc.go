@@ -0,0 +1,7 @@
+// Package integration holds the integration tests of gcb, which run the
+// transport through a TCP proxy inducing network faults httptest can't
+// simulate: latency, connection resets, bandwidth limits and outages. They
+// are behind the gcb_integration build tag:
+//
+//	go test -tags gcb_integration ./integration
+package integration
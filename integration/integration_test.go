@@ -0,0 +1,159 @@
+//go:build gcb_integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+const payload = 64 << 10
+
+// setup starts an upstream behind a proxy and returns a client going
+// through the proxy with a gcb transport
+func setup(t *testing.T, opts ...gcb.Option) (*proxy, *http.Client, string) {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("x"), payload))
+	}))
+	t.Cleanup(upstream.Close)
+	p := newProxy(t, upstream.Listener.Addr().String())
+
+	// every request opens a connection, so it goes through the current toxics
+	opts = append([]gcb.Option{
+		gcb.WithTransport(&http.Transport{DisableKeepAlives: true}),
+		gcb.WithRetryWait(10*time.Millisecond, 50*time.Millisecond),
+		gcb.WithTimeout(200 * time.Millisecond),
+		gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return counts.ConsecutiveFailures >= 2 }),
+	}, opts...)
+	return p, &http.Client{Transport: gcb.NewRoundTripper(opts...)}, "http://" + p.Addr()
+}
+
+// get sends a request with a timeout and reads the whole body
+func get(client *http.Client, url string, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	return len(body), err
+}
+
+func TestConnectionResets(t *testing.T) {
+	p, client, url := setup(t, gcb.WithMaxRetries(3))
+
+	// the resets are retried until the upstream answers
+	p.Set(toxics{Reset: 2})
+	n, err := get(client, url, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != payload || p.Conns() != 3 {
+		t.Errorf("Expected %d bytes after %d connections, got %d after %d", payload, 3, n, p.Conns())
+	}
+
+	// more resets than retries fail the request with the last reset
+	p.Set(toxics{Reset: 10})
+	_, err = get(client, url, 5*time.Second)
+	var exhausted *gcb.RetryExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 4 {
+		t.Errorf("Expected the retries to be exhausted after %d attempts, got %v", 4, err)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	p, client, url := setup(t,
+		gcb.WithMaxRetries(0),
+		gcb.WithTransport(&http.Transport{DisableKeepAlives: true, ResponseHeaderTimeout: 100 * time.Millisecond}),
+	)
+
+	// latency under the timeouts is not a failure
+	p.Set(toxics{Latency: 20 * time.Millisecond})
+	if _, err := get(client, url, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// the caller giving up is not the upstream failing
+	p.Set(toxics{Latency: 500 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		if _, err := get(client, url, 50*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	}
+
+	// the upstream not answering in time trips the breaker
+	for i := 0; i < 2; i++ {
+		if _, err := get(client, url, 5*time.Second); err == nil || errors.Is(err, gcb.ErrOpenState) {
+			t.Fatalf("Expected the request to time out, got %v", err)
+		}
+	}
+	if _, err := get(client, url, 5*time.Second); !errors.Is(err, gcb.ErrOpenState) {
+		t.Errorf("Expected %v, got %v", gcb.ErrOpenState, err)
+	}
+
+	// the breaker closes once the latency is gone
+	p.Set(toxics{})
+	time.Sleep(250 * time.Millisecond)
+	if _, err := get(client, url, 5*time.Second); err != nil {
+		t.Errorf("Expected the breaker to recover, got %v", err)
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	p, client, url := setup(t)
+	p.Set(toxics{Bandwidth: 256 << 10})
+
+	// a slow body still arrives whole
+	start := time.Now()
+	n, err := get(client, url, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); n != payload || elapsed < 200*time.Millisecond {
+		t.Errorf("Expected %d bytes in more than %s, got %d in %s", payload, 200*time.Millisecond, n, elapsed)
+	}
+
+	// unless the caller gives up on it, which fails the read, not the request
+	if _, err := get(client, url, 50*time.Millisecond); err == nil {
+		t.Errorf("Expected the body to be cut short")
+	}
+}
+
+func TestOutage(t *testing.T) {
+	p, client, url := setup(t, gcb.WithMaxRetries(1))
+
+	p.Set(toxics{Down: true})
+	for i := 0; i < 2; i++ {
+		if _, err := get(client, url, 5*time.Second); err == nil {
+			t.Fatalf("Expected the request to fail during the outage")
+		}
+	}
+	conns := p.Conns()
+	if _, err := get(client, url, 5*time.Second); !errors.Is(err, gcb.ErrOpenState) {
+		t.Errorf("Expected %v, got %v", gcb.ErrOpenState, err)
+	}
+	if p.Conns() != conns {
+		t.Errorf("Expected the open breaker not to connect")
+	}
+
+	p.Set(toxics{})
+	time.Sleep(250 * time.Millisecond)
+	if _, err := get(client, url, 5*time.Second); err != nil {
+		t.Errorf("Expected the breaker to recover, got %v", err)
+	}
+}
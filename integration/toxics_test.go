@@ -0,0 +1,135 @@
+//go:build gcb_integration
+
+package integration
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type (
+	// toxics are the faults a proxy induces, toxiproxy style
+	toxics struct {
+		// Latency delays every chunk sent back to the client
+		Latency time.Duration
+		// Reset resets the next connections once the client sent its request
+		Reset int
+		// Bandwidth limits the bytes per second sent back to the client
+		Bandwidth int
+		// Down refuses the connections
+		Down bool
+	}
+
+	// proxy forwards TCP connections to an upstream through the toxics
+	proxy struct {
+		upstream string
+		listener net.Listener
+		conns    int64
+
+		mu     sync.Mutex
+		toxics toxics
+	}
+)
+
+// newProxy starts a proxy in front of upstream, closed with the test
+func newProxy(t *testing.T, upstream string) *proxy {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &proxy{upstream: upstream, listener: listener}
+	go p.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+	return p
+}
+
+// Addr returns the address of the proxy
+func (p *proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Set replaces the toxics
+func (p *proxy) Set(t toxics) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.toxics = t
+}
+
+// Conns returns the number of connections accepted so far
+func (p *proxy) Conns() int {
+	return int(atomic.LoadInt64(&p.conns))
+}
+
+func (p *proxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt64(&p.conns, 1)
+		go p.handle(conn.(*net.TCPConn))
+	}
+}
+
+func (p *proxy) handle(conn *net.TCPConn) {
+	defer conn.Close()
+
+	p.mu.Lock()
+	t := p.toxics
+	reset := t.Reset > 0
+	if reset {
+		p.toxics.Reset--
+	}
+	p.mu.Unlock()
+
+	if t.Down {
+		_ = conn.SetLinger(0)
+		return
+	}
+	if reset {
+		// wait for the request so the client sees a reset, not a refusal
+		_, _ = conn.Read(make([]byte, 1))
+		_ = conn.SetLinger(0)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", p.upstream)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		_ = upstream.(*net.TCPConn).CloseWrite()
+	}()
+
+	buf := make([]byte, 4096)
+	if t.Bandwidth > 0 && t.Bandwidth < len(buf) {
+		buf = buf[:t.Bandwidth]
+	}
+	for {
+		n, err := upstream.Read(buf)
+		if n > 0 {
+			if t.Latency > 0 {
+				time.Sleep(t.Latency)
+			}
+			if t.Bandwidth > 0 {
+				time.Sleep(time.Duration(n) * time.Second / time.Duration(t.Bandwidth))
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package gcb
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyWindow is how long a window of the latency histograms lasts, the
+// percentiles cover the current window and the last one
+const latencyWindow = 30 * time.Second
+
+// latencyBounds are the upper bounds of the buckets of the latency
+// histograms, the attempts slower than the last one go to an extra bucket
+var latencyBounds = [...]time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+type (
+	// latencies is the histogram of the attempt latencies of a breaker. The
+	// attempts are counted in the current window, which takes the place of
+	// the last one once over, so the percentiles cover between one and two
+	// windows. The counts are updated without the lock, it only guards the
+	// rotations.
+	latencies struct {
+		// windows come first, the 64-bit atomics must be aligned on 32-bit
+		// platforms
+		windows [2]latencyHistogram
+		// end is the end of the current window in unix nanoseconds, and
+		// current its index in windows
+		end     int64
+		current uint32
+		mu      sync.Mutex
+	}
+
+	// latencyHistogram counts the attempts by bucket of latencyBounds, with
+	// the sum and the max of their latencies in nanoseconds
+	latencyHistogram struct {
+		buckets [len(latencyBounds) + 1]uint64
+		sum     int64
+		max     int64
+	}
+
+	// latencySnapshot is a copy of the histograms of the windows covered
+	latencySnapshot latencyHistogram
+)
+
+// record counts an attempt sent at start and answered at end
+func (l *latencies) record(start, end time.Time) {
+	if l == nil {
+		return
+	}
+	if end.UnixNano() >= atomic.LoadInt64(&l.end) {
+		l.rotate(end)
+	}
+	latency := int64(end.Sub(start))
+	h := &l.windows[atomic.LoadUint32(&l.current)]
+	atomic.AddUint64(&h.buckets[latencyBucket(time.Duration(latency))], 1)
+	atomic.AddInt64(&h.sum, latency)
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if latency <= max || atomic.CompareAndSwapInt64(&h.max, max, latency) {
+			return
+		}
+	}
+}
+
+// rotate starts a new window at now, clearing the one it replaces
+func (l *latencies) rotate(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	end := atomic.LoadInt64(&l.end)
+	if now.UnixNano() < end {
+		// rotated by another attempt
+		return
+	}
+	next := 1 - atomic.LoadUint32(&l.current)
+	l.windows[next].clear()
+	if now.UnixNano() >= end+int64(latencyWindow) {
+		// no attempt for a whole window, the current one is too old to be
+		// kept as the last
+		l.windows[1-next].clear()
+	}
+	atomic.StoreUint32(&l.current, next)
+	atomic.StoreInt64(&l.end, now.Add(latencyWindow).UnixNano())
+}
+
+// snapshot returns the histogram of the windows still covered at now
+func (l *latencies) snapshot(now time.Time) latencySnapshot {
+	var s latencySnapshot
+	if l == nil {
+		return s
+	}
+	end := atomic.LoadInt64(&l.end)
+	current := atomic.LoadUint32(&l.current)
+	if now.UnixNano() < end+int64(latencyWindow) {
+		s.add(&l.windows[current])
+	}
+	if now.UnixNano() < end {
+		s.add(&l.windows[1-current])
+	}
+	return s
+}
+
+func (h *latencyHistogram) clear() {
+	for i := range h.buckets {
+		atomic.StoreUint64(&h.buckets[i], 0)
+	}
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.max, 0)
+}
+
+func (s *latencySnapshot) add(h *latencyHistogram) {
+	for i := range h.buckets {
+		s.buckets[i] += atomic.LoadUint64(&h.buckets[i])
+	}
+	s.sum += atomic.LoadInt64(&h.sum)
+	if max := atomic.LoadInt64(&h.max); max > s.max {
+		s.max = max
+	}
+}
+
+// count returns the number of attempts
+func (s latencySnapshot) count() uint64 {
+	var count uint64
+	for _, n := range s.buckets {
+		count += n
+	}
+	return count
+}
+
+// mean returns the mean latency, zero without attempts
+func (s latencySnapshot) mean() time.Duration {
+	count := s.count()
+	if count == 0 {
+		return 0
+	}
+	return time.Duration(s.sum / int64(count))
+}
+
+// percentile returns the latency under which p percent of the attempts
+// are: the upper bound of the bucket of the attempt ranking p, capped at the
+// max. It's zero without attempts.
+func (s latencySnapshot) percentile(p float64) time.Duration {
+	count := s.count()
+	if count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range s.buckets {
+		if seen += n; seen < rank {
+			continue
+		}
+		if i < len(latencyBounds) && int64(latencyBounds[i]) < s.max {
+			return latencyBounds[i]
+		}
+		break
+	}
+	return time.Duration(s.max)
+}
+
+// latencyBucket returns the index of the bucket of the latency
+func latencyBucket(latency time.Duration) int {
+	for i, bound := range latencyBounds {
+		if latency <= bound {
+			return i
+		}
+	}
+	return len(latencyBounds)
+}
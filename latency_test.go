@@ -0,0 +1,112 @@
+package gcb
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLatencies(t *testing.T) {
+	start := time.Now()
+	l := &latencies{}
+	// 90 attempts of 3ms, 9 of 40ms and one of 7s
+	for i := 0; i < 100; i++ {
+		latency := 3 * time.Millisecond
+		switch {
+		case i == 99:
+			latency = 7 * time.Second
+		case i >= 90:
+			latency = 40 * time.Millisecond
+		}
+		l.record(start, start.Add(latency))
+	}
+
+	tests := []struct {
+		name       string
+		at         time.Duration
+		count      uint64
+		percentile float64
+		latency    time.Duration
+	}{
+		{"min", 0, 100, 0, 5 * time.Millisecond},
+		{"median", 0, 100, 50, 5 * time.Millisecond},
+		{"p90", 0, 100, 90, 5 * time.Millisecond},
+		{"p95", 0, 100, 95, 50 * time.Millisecond},
+		{"p99", 0, 100, 99, 50 * time.Millisecond},
+		{"slowest", 0, 100, 100, 7 * time.Second},
+		{"last window", latencyWindow + time.Second, 100, 50, 5 * time.Millisecond},
+		{"expired", 2*latencyWindow + time.Second, 0, 50, 0},
+	}
+
+	for _, tt := range tests {
+		s := l.snapshot(start.Add(tt.at))
+		if count := s.count(); count != tt.count {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.count, count)
+		}
+		if latency := s.percentile(tt.percentile); latency != tt.latency {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.latency, latency)
+		}
+	}
+}
+
+func TestLatencies_Rotate(t *testing.T) {
+	start := time.Now()
+	l := &latencies{}
+	l.record(start, start.Add(time.Second))
+
+	// the second window keeps the first one as the last
+	next := start.Add(latencyWindow + time.Second)
+	l.record(next, next.Add(time.Millisecond))
+	s := l.snapshot(next)
+	if count, max := s.count(), time.Duration(s.max); count != 2 || max != time.Second {
+		t.Errorf("Expected %d attempts up to %v, got %d up to %v", 2, time.Second, count, max)
+	}
+
+	// the third replaces the first
+	next = next.Add(latencyWindow)
+	l.record(next, next.Add(time.Millisecond))
+	s = l.snapshot(next)
+	if count, max := s.count(), time.Duration(s.max); count != 2 || max != time.Millisecond {
+		t.Errorf("Expected %d attempts up to %v, got %d up to %v", 2, time.Millisecond, count, max)
+	}
+
+	// after a quiet window, neither is kept
+	next = next.Add(3 * latencyWindow)
+	l.record(next, next.Add(2*time.Millisecond))
+	s = l.snapshot(next)
+	if count, mean := s.count(), s.mean(); count != 1 || mean != 2*time.Millisecond {
+		t.Errorf("Expected %d attempt of %v, got %d of %v", 1, 2*time.Millisecond, count, mean)
+	}
+}
+
+func TestCircuit_Latency(t *testing.T) {
+	calls := 0
+	transport := NewRoundTripper(
+		WithMaxRetries(1),
+		WithRetryWait(time.Millisecond, time.Millisecond),
+		WithoutRateLimit(),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			time.Sleep(30 * time.Millisecond)
+			if calls == 1 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// every attempt is timed, the retry too
+	stats := transport.RoundTripper.(*circuit).breaker.dump().stats().Latency
+	if stats.Count != 2 {
+		t.Errorf("Expected %d attempts, got %d", 2, stats.Count)
+	}
+	// both are in the 50ms bucket, its bound is capped at the slowest
+	if stats.MaxMs < 30 || stats.P50Ms != stats.MaxMs || stats.MeanMs < 30 || stats.MeanMs > stats.MaxMs {
+		t.Errorf("Expected the percentiles at the max of at least 30ms, got %+v", stats)
+	}
+}
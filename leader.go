@@ -0,0 +1,60 @@
+package gcb
+
+import (
+	"time"
+)
+
+var (
+	// followers probe themselves after this many timeouts without word
+	// from the leader
+	defaultLeaderFallback = 3
+)
+
+type (
+	// Election tells whether this instance is the one probing a breaker. The
+	// gossip node implements it. It's called while the breaker is locked, so
+	// it must not block.
+	Election interface {
+		IsLeader(name string) bool
+	}
+)
+
+// WithProbeLeader lets only the elected instance probe an open breaker. The
+// followers stay open past the timeout until the leader closes its breaker
+// and tells them through the pub/sub, see WithPubSub. If the leader doesn't
+// report within fallback, e.g. it went away, the followers probe by
+// themselves. A zero fallback is three timeouts.
+func WithProbeLeader(election Election, fallback time.Duration) Option {
+	return func(config *Config) {
+		config.election = election
+		config.leaderFallback = fallback
+	}
+}
+
+// leaderHolds reports whether the breaker must stay open for the leader to
+// probe, the breaker must be locked
+func (cb *Breaker) leaderHolds(now time.Time) bool {
+	if cb.election == nil || cb.election.IsLeader(cb.name) {
+		return false
+	}
+
+	fallback := cb.leaderFallback
+	if fallback == 0 {
+		fallback = time.Duration(defaultLeaderFallback) * cb.timeout
+	}
+	return now.Sub(cb.openedAt) < fallback
+}
+
+// closeFrom closes the breaker on behalf of a peer, unless it's closed
+// already
+func (cb *Breaker) closeFrom(now time.Time) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == Close {
+		return
+	}
+	cb.remote = true
+	cb.setState(Close, now)
+	cb.remote = false
+}
@@ -0,0 +1,63 @@
+package gcb
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+var (
+	// ErrResponseTooLarge is returned when the response body is over the
+	// configured limit. The upstream answered, so it doesn't count as a
+	// failure of the breaker.
+	ErrResponseTooLarge = errors.New("response body too large")
+)
+
+type (
+	// limitedBody fails the read once more than the limit has been read
+	limitedBody struct {
+		body      io.ReadCloser
+		remaining int64
+	}
+)
+
+// WithMaxResponseBytes limits the size of the response bodies to n bytes.
+// Responses advertising a larger Content-Length are rejected right away,
+// others fail with ErrResponseTooLarge when the limit is crossed while reading.
+func WithMaxResponseBytes(n int64) Option {
+	return func(config *Config) {
+		config.maxResponseBytes = n
+	}
+}
+
+// limitResponse applies the size limit to the response
+func limitResponse(resp *http.Response, limit int64) (*http.Response, error) {
+	if resp.ContentLength > limit {
+		_ = resp.Body.Close()
+		return nil, ErrResponseTooLarge
+	}
+	resp.Body = &limitedBody{body: resp.Body, remaining: limit}
+	return resp, nil
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+
+	// read one byte past the limit to tell a body of exactly the limit
+	// from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n - 1, ErrResponseTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
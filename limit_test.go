@@ -0,0 +1,42 @@
+package gcb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLimitResponse(t *testing.T) {
+	tt := []struct {
+		body          string
+		contentLength int64
+		err           error
+	}{
+		{"12345", -1, nil},
+		{"123456", -1, ErrResponseTooLarge},
+		{"123456", 6, ErrResponseTooLarge},
+	}
+
+	for _, ts := range tt {
+		resp := &http.Response{
+			Body:          ioutil.NopCloser(strings.NewReader(ts.body)),
+			ContentLength: ts.contentLength,
+		}
+
+		resp, err := limitResponse(resp, 5)
+		if err == nil {
+			var body []byte
+			body, err = ioutil.ReadAll(resp.Body)
+			if err == nil && string(body) != ts.body {
+				t.Errorf("Expected %q, got %q", ts.body, body)
+			}
+			if err != nil && len(body) != 5 {
+				t.Errorf("Expected the read to stop at the limit, got %q", body)
+			}
+		}
+		if err != ts.err {
+			t.Errorf("Expected %v, got %v", ts.err, err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package gcb
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Logger receives the logs of the transport, *log.Logger is one
+	Logger interface {
+		Printf(format string, v ...interface{})
+	}
+
+	// LevelLogger is a Logger telling which levels it keeps, the messages
+	// of the other levels are not even formatted
+	LevelLogger interface {
+		Logger
+		Enabled(level LogLevel) bool
+	}
+
+	// LogLevel is the level of a log message
+	LogLevel int8
+
+	// logger drops the messages under its level, which can change at
+	// runtime, and dumps the requests to the debugged hosts
+	logger struct {
+		Logger
+		level int32
+
+		// debugged is the number of debugged hosts, the requests skip the
+		// lock while there's none
+		debugged int32
+		debugMu  sync.Mutex
+		// debugUntil holds the debugged hosts and until when
+		debugUntil map[string]time.Time
+	}
+
+	// stdLogger logs to the standard logger, it's disabled when the
+	// standard logger writes to io.Discard
+	stdLogger struct{}
+)
+
+const (
+	// LevelDebug is the level of the retries
+	LevelDebug LogLevel = iota
+	// LevelError is the level of the errors nothing else reports
+	LevelError
+	// LevelOff disables the logs
+	LevelOff
+)
+
+// WithLogger sends the logs to the logger, the standard logger by default
+func WithLogger(l Logger) Option {
+	return func(config *Config) {
+		config.logger = l
+	}
+}
+
+// WithLogLevel drops the logs under the level, LevelDebug by default
+func WithLogLevel(level LogLevel) Option {
+	return func(config *Config) {
+		config.logLevel = level
+	}
+}
+
+var (
+	// defaultLogger logs everything to the standard logger
+	defaultLogger = &logger{Logger: stdLogger{}}
+
+	// redactedHeaders are left out of the request dumps
+	redactedHeaders = map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+	}
+)
+
+// SetLogLevel changes the level of the logs of the transport at runtime
+func (t *tripper) SetLogLevel(level LogLevel) {
+	t.RoundTripper.(*circuit).logger.setLevel(level)
+	t.audit("loglevel", "", level.String())
+}
+
+// LogLevel returns the level of the logs of the transport
+func (t *tripper) LogLevel() LogLevel {
+	return t.RoundTripper.(*circuit).logger.getLevel()
+}
+
+// DebugHost dumps the requests to the host, the key of KeyFunc, and their
+// responses for d, whatever the log level, along with the retries. The
+// dumps leave out the bodies and the credentials. 0 stops right away.
+func (t *tripper) DebugHost(host string, d time.Duration) {
+	t.RoundTripper.(*circuit).logger.debugHost(host, time.Now().Add(d))
+	detail := "stop"
+	if d > 0 {
+		detail = d.String()
+	}
+	t.audit("debug", host, detail)
+}
+
+// DebugHosts returns the debugged hosts and until when
+func (t *tripper) DebugHosts() map[string]time.Time {
+	return t.RoundTripper.(*circuit).logger.debugHosts(time.Now())
+}
+
+// newLogger returns the logger of the configuration
+func newLogger(config *Config) *logger {
+	l := &logger{Logger: config.logger, level: int32(config.logLevel)}
+	if l.Logger == nil {
+		l.Logger = stdLogger{}
+	}
+	return l
+}
+
+func (l *logger) setLevel(level LogLevel) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *logger) getLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32(&l.level))
+}
+
+// enabled reports whether the messages of the level are logged, the callers
+// check it before formatting anything
+func (l *logger) enabled(level LogLevel) bool {
+	if level < l.getLevel() {
+		return false
+	}
+	if leveled, ok := l.Logger.(LevelLogger); ok {
+		return leveled.Enabled(level)
+	}
+	return true
+}
+
+// debugHost debugs the host until the given time, a past time stops
+func (l *logger) debugHost(host string, until time.Time) {
+	l.debugMu.Lock()
+	defer l.debugMu.Unlock()
+
+	if l.debugUntil == nil {
+		l.debugUntil = make(map[string]time.Time)
+	}
+	if until.After(time.Now()) {
+		l.debugUntil[host] = until
+	} else {
+		delete(l.debugUntil, host)
+	}
+	atomic.StoreInt32(&l.debugged, int32(len(l.debugUntil)))
+}
+
+// debugHosts returns the debugged hosts, dropping those expired
+func (l *logger) debugHosts(now time.Time) map[string]time.Time {
+	l.debugMu.Lock()
+	defer l.debugMu.Unlock()
+
+	hosts := make(map[string]time.Time)
+	for host, until := range l.debugUntil {
+		if now.Before(until) {
+			hosts[host] = until
+		} else {
+			delete(l.debugUntil, host)
+		}
+	}
+	atomic.StoreInt32(&l.debugged, int32(len(l.debugUntil)))
+	return hosts
+}
+
+// debugging reports whether the requests to the host are dumped
+func (l *logger) debugging(host string) bool {
+	if atomic.LoadInt32(&l.debugged) == 0 {
+		return false
+	}
+
+	l.debugMu.Lock()
+	defer l.debugMu.Unlock()
+
+	until, ok := l.debugUntil[host]
+	if ok && !time.Now().Before(until) {
+		delete(l.debugUntil, host)
+		atomic.StoreInt32(&l.debugged, int32(len(l.debugUntil)))
+		return false
+	}
+	return ok
+}
+
+// debugging reports whether the requests to the host of req are dumped,
+// without calling KeyFunc while no host is
+func (c *circuit) debugging(req *http.Request) bool {
+	if atomic.LoadInt32(&c.logger.debugged) == 0 {
+		return false
+	}
+	return c.logger.debugging(c.keyFunc(req))
+}
+
+// dumpRequest logs the request line and headers
+func (l *logger) dumpRequest(req *http.Request) {
+	l.Printf("[DEBUG] > %s %s %s%s", req.Method, req.URL, req.Proto, dumpHeader(req.Header))
+}
+
+// dumpResponse logs the status and headers of the response, or the error
+func (l *logger) dumpResponse(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	if resp == nil {
+		l.Printf("[DEBUG] < %s %s: %v (%s)", req.Method, req.URL, err, elapsed)
+		return
+	}
+	l.Printf("[DEBUG] < %s %s: %s (%s)%s", req.Method, req.URL, resp.Status, elapsed, dumpHeader(resp.Header))
+}
+
+// dumpHeader formats the header one field per line, sorted, with the
+// credentials redacted
+func dumpHeader(header http.Header) string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		value := strings.Join(header[key], ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(key)] {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(&b, "\n    %s: %s", key, value)
+	}
+	return b.String()
+}
+
+// String returns the name of the level
+func (level LogLevel) String() string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelError:
+		return "error"
+	case LevelOff:
+		return "off"
+	}
+	return ""
+}
+
+// MarshalText encodes the level by name
+func (level LogLevel) MarshalText() ([]byte, error) {
+	return []byte(level.String()), nil
+}
+
+// UnmarshalText decodes a level encoded by name
+func (level *LogLevel) UnmarshalText(text []byte) error {
+	for _, l := range []LogLevel{LevelDebug, LevelError, LevelOff} {
+		if l.String() == string(text) {
+			*level = l
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q", text)
+}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+func (stdLogger) Enabled(level LogLevel) bool {
+	return log.Writer() != io.Discard
+}
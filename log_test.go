@@ -0,0 +1,198 @@
+package gcb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingLogger keeps the messages, Enabled is only called when it's
+// leveled
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+// leveledLogger keeps the messages of its level and above
+type leveledLogger struct {
+	recordingLogger
+	level LogLevel
+}
+
+func (l *leveledLogger) Enabled(level LogLevel) bool {
+	return level >= l.level
+}
+
+func TestLogger_Levels(t *testing.T) {
+	recording := &recordingLogger{}
+	leveled := &leveledLogger{level: LevelError}
+	tests := []struct {
+		name     string
+		opts     []Option
+		messages *[]string
+		expected int
+	}{
+		{"debug", []Option{WithLogger(recording)}, &recording.messages, 2},
+		{"error", []Option{WithLogger(recording), WithLogLevel(LevelError)}, &recording.messages, 0},
+		{"leveled", []Option{WithLogger(leveled)}, &leveled.messages, 0},
+	}
+
+	for _, tt := range tests {
+		*tt.messages = nil
+		transport := NewRoundTripper(append(tt.opts,
+			WithMaxRetries(2),
+			WithRetryWait(time.Millisecond, time.Millisecond),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			})),
+		)...)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+		_, _ = transport.RoundTrip(req)
+		if n := len(*tt.messages); n != tt.expected {
+			t.Errorf("%s: Expected %d messages, got %d", tt.name, tt.expected, n)
+		}
+		for _, message := range *tt.messages {
+			if !strings.HasPrefix(message, "[DEBUG] GET http://upstream.example: retrying in") {
+				t.Errorf("%s: Unexpected message %q", tt.name, message)
+			}
+		}
+	}
+}
+
+func TestStdLogger_Discard(t *testing.T) {
+	out := log.Writer()
+	defer log.SetOutput(out)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	if !defaultLogger.enabled(LevelDebug) {
+		t.Errorf("Expected the standard logger to be enabled")
+	}
+
+	// nothing is formatted for a discarded output
+	log.SetOutput(ioutil.Discard)
+	if defaultLogger.enabled(LevelError) {
+		t.Errorf("Expected the discarded standard logger to be disabled")
+	}
+}
+
+func TestTripper_SetLogLevel(t *testing.T) {
+	recording := &recordingLogger{}
+	transport := NewRoundTripper(
+		WithLogger(recording),
+		WithLogLevel(LevelError),
+		WithMaxRetries(1),
+		WithRetryWait(time.Millisecond, time.Millisecond),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		})),
+	)
+
+	tests := []struct {
+		name     string
+		level    LogLevel
+		expected int
+	}{
+		{"error", LevelError, 0},
+		{"debug", LevelDebug, 1},
+		{"off", LevelOff, 0},
+	}
+
+	for _, tt := range tests {
+		recording.messages = nil
+		transport.SetLogLevel(tt.level)
+		if level := transport.LogLevel(); level != tt.level {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.level, level)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+		_, _ = transport.RoundTrip(req)
+		if n := len(recording.messages); n != tt.expected {
+			t.Errorf("%s: Expected %d messages, got %d", tt.name, tt.expected, n)
+		}
+	}
+}
+
+func TestTripper_DebugHost(t *testing.T) {
+	recording := &recordingLogger{}
+	transport := NewRoundTripper(
+		WithLogger(recording),
+		WithLogLevel(LevelOff),
+		WithMaxRetries(1),
+		WithRetryWait(time.Millisecond, time.Millisecond),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{"Set-Cookie": {"session=secret"}, "Retry-After": {"0"}}
+			return &http.Response{Status: "503 Service Unavailable", StatusCode: http.StatusServiceUnavailable, Header: header, Body: http.NoBody}, nil
+		})),
+	)
+	transport.DebugHost("api.example", time.Minute)
+
+	send := func(url string) {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Accept", "application/json")
+		_, _ = transport.RoundTrip(req)
+	}
+
+	// only the debugged host is dumped, the level is off
+	send("http://other.example")
+	if len(recording.messages) != 0 {
+		t.Errorf("Expected no messages, got %q", recording.messages)
+	}
+
+	send("http://api.example/items")
+	if n := len(recording.messages); n != 3 {
+		t.Fatalf("Expected the request, the retry and the response, got %q", recording.messages)
+	}
+	dump := strings.Join(recording.messages, "\n")
+	for _, want := range []string{
+		"[DEBUG] > GET http://api.example/items HTTP/1.1\n    Accept: application/json\n    Authorization: [redacted]",
+		"[DEBUG] GET http://api.example/items: retrying in",
+		"[DEBUG] < GET http://api.example/items: 503 Service Unavailable (",
+		"    Retry-After: 0\n    Set-Cookie: [redacted]",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Expected %q in %q", want, dump)
+		}
+	}
+	if strings.Contains(dump, "secret") {
+		t.Errorf("Expected the credentials to be redacted, got %q", dump)
+	}
+
+	if hosts := transport.DebugHosts(); len(hosts) != 1 || hosts["api.example"].IsZero() {
+		t.Errorf("Expected api.example, got %v", hosts)
+	}
+	transport.DebugHost("api.example", 0)
+	if hosts := transport.DebugHosts(); len(hosts) != 0 {
+		t.Errorf("Expected no hosts, got %v", hosts)
+	}
+
+	recording.messages = nil
+	send("http://api.example/items")
+	if len(recording.messages) != 0 {
+		t.Errorf("Expected no messages, got %q", recording.messages)
+	}
+}
+
+func TestLogLevel_Text(t *testing.T) {
+	for _, level := range []LogLevel{LevelDebug, LevelError, LevelOff} {
+		text, _ := level.MarshalText()
+		var got LogLevel
+		if err := got.UnmarshalText(text); err != nil || got != level {
+			t.Errorf("Expected %v, got %v (%v)", level, got, err)
+		}
+	}
+	var level LogLevel
+	if err := level.UnmarshalText([]byte("verbose")); err == nil {
+		t.Errorf("Expected an error, got none")
+	}
+}
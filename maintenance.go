@@ -0,0 +1,87 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+var (
+	// ErrMaintenance is returned for requests to a key in maintenance
+	ErrMaintenance = errors.New("upstream in maintenance")
+)
+
+type (
+	// KeyFunc maps a request to the key identifying its upstream, e.g. the host
+	KeyFunc func(req *http.Request) string
+
+	// maintenance holds the keys in maintenance
+	maintenance struct {
+		mu   sync.RWMutex
+		keys map[string]struct{}
+	}
+)
+
+// WithKeyFunc sets how requests are mapped to their upstream key. The default
+// key is the request host.
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(config *Config) {
+		config.keyFunc = fn
+	}
+}
+
+// WithMaintenance puts the given keys in maintenance from the start
+func WithMaintenance(keys ...string) Option {
+	return func(config *Config) {
+		config.maintenanceKeys = append(config.maintenanceKeys, keys...)
+	}
+}
+
+// SetMaintenance puts the key in maintenance, or takes it out. Requests to a
+// key in maintenance fail right away with ErrMaintenance and aren't recorded
+// by the breaker, so planned downtime doesn't pollute its counts.
+func (t *tripper) SetMaintenance(key string, enabled bool) {
+	t.RoundTripper.(*circuit).maintenance.set(key, enabled)
+	detail := "off"
+	if enabled {
+		detail = "on"
+	}
+	t.audit("maintenance", key, detail)
+}
+
+// InMaintenance reports whether the key is in maintenance
+func (t *tripper) InMaintenance(key string) bool {
+	return t.RoundTripper.(*circuit).maintenance.has(key)
+}
+
+// defaultKeyFunc keys requests by host
+func defaultKeyFunc(req *http.Request) string {
+	return req.URL.Host
+}
+
+func newMaintenance(keys []string) *maintenance {
+	m := &maintenance{keys: make(map[string]struct{})}
+	for _, key := range keys {
+		m.keys[key] = struct{}{}
+	}
+	return m
+}
+
+func (m *maintenance) set(key string, enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if enabled {
+		m.keys[key] = struct{}{}
+	} else {
+		delete(m.keys, key)
+	}
+}
+
+func (m *maintenance) has(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.keys[key]
+	return ok
+}
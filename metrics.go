@@ -0,0 +1,173 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMetricsInterval is how often the metrics are flushed by default
+var defaultMetricsInterval = time.Second
+
+type (
+	// Metrics counts the requests of a round tripper over an interval
+	Metrics struct {
+		// Requests are the requests sent through the round tripper
+		Requests uint64
+		// Retries are the attempts made after the first ones
+		Retries uint64
+		// Rejected are the requests turned away by the breakers or the
+		// throttling, they were never sent
+		Rejected uint64
+		// Errors are the other requests ending in an error, or classified
+		// as a failure by WithErrorClassifier
+		Errors uint64
+		// Throttled are the requests classified as throttled by
+		// WithErrorClassifier
+		Throttled uint64
+		// Abandoned are the requests the caller cancelled, during an
+		// attempt or the backoff between two, they aren't errors
+		Abandoned uint64
+		// Interval is the time the counters cover
+		Interval time.Duration
+		// Health are the health counters of the transport, they are
+		// cumulative unlike the others
+		Health HealthStats
+		// Tags count the tagged requests, cumulative too, see
+		// ContextWithTag
+		Tags []TagStats
+	}
+
+	// MetricsListener receives the metrics of every interval, it's called
+	// from a single goroutine and never on the path of the requests
+	MetricsListener func(metrics Metrics)
+
+	// metrics batches the counters in shards, a request adds to the shard
+	// of its processor and the shards are summed up on every flush
+	metrics struct {
+		shards   []metricsShard
+		next     uint32
+		pool     sync.Pool
+		listener MetricsListener
+		interval time.Duration
+		// health returns the health counters and tags the tag counts, if set
+		health func() HealthStats
+		tags   func() []TagStats
+		// classifier classifies the outcomes, if set
+		classifier *ErrorClassifier
+		// done is closed once run has flushed a last time
+		done chan struct{}
+	}
+
+	// metricsShard is padded to a cache line of its own
+	metricsShard struct {
+		requests  uint64
+		retries   uint64
+		rejected  uint64
+		errors    uint64
+		throttled uint64
+		abandoned uint64
+		_         [16]byte
+	}
+)
+
+// WithMetricsListener hands the request counters to the listener every
+// interval, a second by default. The requests only add to counters kept per
+// processor, so the instrumentation doesn't contend with them.
+func WithMetricsListener(fn MetricsListener, interval time.Duration) Option {
+	return func(config *Config) {
+		config.metricsListener = fn
+		config.metricsInterval = interval
+	}
+}
+
+func newMetrics(listener MetricsListener, interval time.Duration) *metrics {
+	if interval <= 0 {
+		interval = defaultMetricsInterval
+	}
+	m := &metrics{
+		shards:   make([]metricsShard, runtime.GOMAXPROCS(0)),
+		listener: listener,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	// the pool keeps a shard per processor, the shards handed out again
+	// after a collection are taken in turn
+	m.pool.New = func() interface{} {
+		return &m.shards[int(atomic.AddUint32(&m.next, 1))%len(m.shards)]
+	}
+	return m
+}
+
+// record counts a request once it's done
+func (m *metrics) record(resp *http.Response, err error, abandoned bool) {
+	shard := m.pool.Get().(*metricsShard)
+	atomic.AddUint64(&shard.requests, 1)
+	class, classified := classify(m.classifier, resp, err)
+	switch {
+	case abandoned:
+		atomic.AddUint64(&shard.abandoned, 1)
+	case errors.Is(err, ErrOpenState), errors.Is(err, ErrTooManyRequests), errors.Is(err, ErrThrottled):
+		atomic.AddUint64(&shard.rejected, 1)
+	case classified && class == ClassThrottle:
+		atomic.AddUint64(&shard.throttled, 1)
+	case classified:
+		if class.failed() {
+			atomic.AddUint64(&shard.errors, 1)
+		}
+	case err != nil:
+		atomic.AddUint64(&shard.errors, 1)
+	}
+	m.pool.Put(shard)
+}
+
+// retry counts a retry about to be made
+func (m *metrics) retry() {
+	shard := m.pool.Get().(*metricsShard)
+	atomic.AddUint64(&shard.retries, 1)
+	m.pool.Put(shard)
+}
+
+// run flushes the counters every interval, and a last time once ctx is done
+func (m *metrics) run(ctx context.Context) {
+	defer close(m.done)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			m.flush(time.Since(last))
+			return
+		case now := <-ticker.C:
+			m.flush(now.Sub(last))
+			last = now
+		}
+	}
+}
+
+// flush hands the counters since the last flush to the listener
+func (m *metrics) flush(interval time.Duration) {
+	metrics := Metrics{Interval: interval}
+	for i := range m.shards {
+		shard := &m.shards[i]
+		metrics.Requests += atomic.SwapUint64(&shard.requests, 0)
+		metrics.Retries += atomic.SwapUint64(&shard.retries, 0)
+		metrics.Rejected += atomic.SwapUint64(&shard.rejected, 0)
+		metrics.Errors += atomic.SwapUint64(&shard.errors, 0)
+		metrics.Throttled += atomic.SwapUint64(&shard.throttled, 0)
+		metrics.Abandoned += atomic.SwapUint64(&shard.abandoned, 0)
+	}
+	if m.health != nil {
+		metrics.Health = m.health()
+	}
+	if m.tags != nil {
+		metrics.Tags = m.tags()
+	}
+	m.listener(metrics)
+}
@@ -0,0 +1,72 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestMetrics_Flush(t *testing.T) {
+	var flushed []Metrics
+	unavailable := testutil.Step{Status: http.StatusServiceUnavailable}
+	transport := NewRoundTripper(
+		WithMetricsListener(func(metrics Metrics) { flushed = append(flushed, metrics) }, time.Hour),
+		WithTransport(testutil.NewFaultTransport(unavailable, testutil.Step{Err: errors.New("connection reset")})),
+		WithMaxRetries(1),
+		WithRetryWait(time.Millisecond, time.Millisecond),
+		WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 }),
+	)
+	c := transport.RoundTripper.(*circuit)
+	c.retrier.Limiter = testutil.AllowAll()
+
+	// a request failing after its retry, then one turned away
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+		_, _ = transport.RoundTrip(req)
+	}
+
+	c.metrics.flush(time.Second)
+	c.metrics.flush(time.Second)
+	expected := []Metrics{
+		{Requests: 2, Retries: 1, Rejected: 1, Errors: 1, Interval: time.Second},
+		{Interval: time.Second},
+	}
+	if len(flushed) != len(expected) {
+		t.Fatalf("Expected %d flushes, got %d", len(expected), len(flushed))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(flushed[i], expected[i]) {
+			t.Errorf("Expected %+v, got %+v", expected[i], flushed[i])
+		}
+	}
+}
+
+func TestMetrics_Interval(t *testing.T) {
+	flushed := make(chan Metrics, 1)
+	transport := NewRoundTripper(
+		WithMetricsListener(func(metrics Metrics) {
+			select {
+			case flushed <- metrics:
+			default:
+			}
+		}, 10*time.Millisecond),
+		WithTransport(testutil.NewFaultTransport()),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case metrics := <-flushed:
+		if metrics.Requests != 1 {
+			t.Errorf("Expected %v, got %v", 1, metrics.Requests)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the metrics to be flushed")
+	}
+}
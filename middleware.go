@@ -0,0 +1,133 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// defaultMaxRoutes bounds the breakers of the middleware unless
+	// WithBreakerEviction sets a maximum, the paths come from the clients
+	defaultMaxRoutes = 1024
+)
+
+type (
+	// middleware guards the handler with one breaker per route
+	middleware struct {
+		next     http.Handler
+		breakers *breakerMap
+		keyFunc  KeyFunc
+		slots    chan struct{}
+	}
+
+	// statusRecorder remembers the status written by the handler
+	statusRecorder struct {
+		http.ResponseWriter
+		status int
+	}
+)
+
+// WithMaxConcurrency limits the number of requests the middleware lets in at
+// the same time
+func WithMaxConcurrency(n int) Option {
+	return func(config *Config) {
+		config.maxConcurrency = n
+	}
+}
+
+// Middleware protects the handler with the breaker machinery. Every route,
+// the request path unless WithKeyFunc says otherwise, has its own breaker:
+// responses in the 500 range and panics count as failures, see
+// WithPanicAsError to answer 500 instead of panicking again. While the
+// breaker of a route is open, or when there are more than WithMaxConcurrency
+// requests in flight, requests are answered 503 with a Retry-After header
+// without reaching the handler.
+//
+// The clients choose the paths, so the breakers are bounded: past 1024
+// routes, or the maximum of WithBreakerEviction, the least recently used
+// one is evicted. A KeyFunc returning the route template, e.g. /users/{id}
+// rather than /users/42, keeps the breakers of the busy routes from being
+// evicted by the random paths of scanners.
+func Middleware(next http.Handler, opts ...Option) http.Handler {
+	config := &Config{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	m := &middleware{
+		next:    next,
+		keyFunc: routeKey,
+	}
+	if config.keyFunc != nil {
+		m.keyFunc = config.keyFunc
+	}
+	if config.maxConcurrency > 0 {
+		m.slots = make(chan struct{}, config.maxConcurrency)
+	}
+
+	m.breakers = newBreakerMap(func(key string) *Breaker {
+		return NewBreaker(append(append([]Option{}, opts...), WithName(key))...)
+	})
+	m.breakers.idleTTL = config.breakerIdleTTL
+	m.breakers.maxEntries = config.maxBreakers
+	if m.breakers.maxEntries == 0 {
+		m.breakers.maxEntries = defaultMaxRoutes
+	}
+	m.breakers.onEvict = config.onEvict
+	return m
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.slots != nil {
+		select {
+		case m.slots <- struct{}{}:
+			defer func() { <-m.slots }()
+		default:
+			unavailable(w, time.Second)
+			return
+		}
+	}
+
+	cb := m.breakers.get(m.keyFunc(r))
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	_, err := cb.execute(func() (*http.Response, error) {
+		m.next.ServeHTTP(rec, r)
+		return &http.Response{StatusCode: rec.status}, nil
+	}, isServerFailure)
+
+	var openErr *BreakerOpenError
+	switch {
+	case errors.As(err, &openErr):
+		unavailable(w, openErr.RetryAfter)
+	case err == ErrTooManyRequests:
+		unavailable(w, time.Second)
+	case errors.Is(err, ErrPanicked):
+		// contained with WithPanicAsError
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// routeKey keys the inbound requests by path
+func routeKey(r *http.Request) string {
+	return r.URL.Path
+}
+
+// unavailable answers 503, telling the client when to come back
+func unavailable(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,90 @@
+package gcb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/overloaded" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}), WithTimeout(30*time.Second), WithReadyToTrip(func(counts Counts) bool {
+		return counts.ConsecutiveFailures >= 2
+	}))
+
+	tests := []struct {
+		path       string
+		status     int
+		retryAfter string
+	}{
+		{"/overloaded", http.StatusInternalServerError, ""},
+		{"/overloaded", http.StatusInternalServerError, ""},
+		// the route breaker is open now
+		{"/overloaded", http.StatusServiceUnavailable, "30"},
+		// the other routes aren't affected
+		{"/healthy", http.StatusNoContent, ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.status {
+			t.Errorf("Expected %d, got %d", tt.status, w.Code)
+		}
+		if retryAfter := w.Header().Get("Retry-After"); retryAfter != tt.retryAfter {
+			t.Errorf("Expected Retry-After %q, got %q", tt.retryAfter, retryAfter)
+		}
+	}
+}
+
+func TestMiddleware_MaxConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), WithMaxConcurrency(1))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-started
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	close(release)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestMiddleware_BoundedRoutes(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected int64
+	}{
+		{"default", nil, int64(defaultMaxRoutes)},
+		{"eviction", []Option{WithBreakerEviction(0, 10, nil)}, 10},
+	}
+
+	for _, tt := range tests {
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tt.opts...)
+
+		// a scanner trying random paths
+		for i := 0; i < 2*defaultMaxRoutes; i++ {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d", i), nil))
+		}
+
+		if size := handler.(*middleware).breakers.size; size != tt.expected {
+			t.Errorf("%s: Expected %d breakers, got %d", tt.name, tt.expected, size)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package notifier posts the breaker state changes to webhooks, e.g. a
+// Slack incoming webhook.
+//
+// The notifier is an event listener:
+//
+//	n := notifier.New(notifier.Config{
+//		Webhooks: []notifier.Webhook{{URL: slackURL, Slack: true}},
+//	})
+//	defer n.Close()
+//	transport := gcb.NewRoundTripper(gcb.WithEventListener(n.Notify))
+//
+// The webhooks are called with a plain HTTP transport and a small retry of
+// their own: notifying about an outage must not go through the breakers
+// that report it.
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+var (
+	defaultTimeout    = 5 * time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = 500 * time.Millisecond
+	defaultQueueSize  = 64
+)
+
+type (
+	// Webhook is an URL the state changes are posted to
+	Webhook struct {
+		URL string
+		// Slack posts a Slack message instead of the JSON payload
+		Slack bool
+	}
+
+	// Config configures the notifier, zero values are replaced by the
+	// defaults
+	Config struct {
+		Webhooks []Webhook
+		// Timeout of a single post, 5 seconds by default
+		Timeout time.Duration
+		// MaxRetries is the number of retries of a failed post, 3 by default
+		MaxRetries int
+		// Backoff is the wait before the first retry, doubled on every
+		// following one, 500 milliseconds by default
+		Backoff time.Duration
+		// QueueSize is the number of notifications waiting to be posted,
+		// the state changes are dropped when it's full. 64 by default.
+		QueueSize int
+	}
+
+	// Payload is the JSON body posted to the webhooks
+	Payload struct {
+		Name   string     `json:"name"`
+		From   gcb.State  `json:"from"`
+		To     gcb.State  `json:"to"`
+		Counts gcb.Counts `json:"counts"`
+		Error  string     `json:"error,omitempty"`
+		Time   time.Time  `json:"time"`
+	}
+
+	// slackMessage is the body of a Slack incoming webhook
+	slackMessage struct {
+		Text string `json:"text"`
+	}
+
+	// Notifier posts the state changes in the background
+	Notifier struct {
+		config Config
+		client *http.Client
+
+		// mu guards the queue against Close, the state changes notified
+		// once it's closed are dropped
+		mu     sync.RWMutex
+		closed bool
+		queue  chan Payload
+		done   chan struct{}
+	}
+)
+
+// New starts a notifier
+func New(config Config) *Notifier {
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.Backoff == 0 {
+		config.Backoff = defaultBackoff
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = defaultQueueSize
+	}
+
+	n := &Notifier{
+		config: config,
+		client: &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   config.Timeout,
+		},
+		queue: make(chan Payload, config.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Notify queues the state changes, it's meant for gcb.WithEventListener
+func (n *Notifier) Notify(event gcb.Event) {
+	if event.Type != gcb.EventStateChange {
+		return
+	}
+
+	payload := Payload{
+		Name:   event.Name,
+		From:   event.From,
+		To:     event.To,
+		Counts: event.Counts,
+		Time:   event.Time,
+	}
+	if event.Err != nil {
+		payload.Error = event.Err.Error()
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.closed {
+		log.Printf("[ERR] notifier closed, dropping %s state change", event.Name)
+		return
+	}
+	select {
+	case n.queue <- payload:
+	default:
+		log.Printf("[ERR] notification queue full, dropping %s state change", event.Name)
+	}
+}
+
+// Close posts the queued notifications and stops the notifier. The state
+// changes notified afterwards are dropped, as the transports may still emit
+// some.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	<-n.done
+	return nil
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+
+	for payload := range n.queue {
+		for _, webhook := range n.config.Webhooks {
+			if err := n.post(webhook, payload); err != nil {
+				log.Printf("[ERR] error notifying %s: %v", webhook.URL, err)
+			}
+		}
+	}
+}
+
+// post sends the payload to the webhook, retrying on errors, 429 and 5xx
+func (n *Notifier) post(webhook Webhook, payload Payload) error {
+	var body interface{} = payload
+	if webhook.Slack {
+		body = slackMessage{Text: payload.text()}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	backoff := n.config.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.send(webhook.URL, data)
+		if !retry || attempt == n.config.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send posts the data once and tells whether a failure is worth a retry
+func (n *Notifier) send(url string, data []byte) (bool, error) {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return false, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// text is the human readable form of the payload
+func (p Payload) text() string {
+	text := fmt.Sprintf("Circuit breaker %s changed from %s to %s (%d failures out of %d requests)",
+		p.Name, p.From, p.To, p.Counts.TotalFailures, p.Counts.Requests)
+	if p.Error != "" {
+		text += ", last error: " + p.Error
+	}
+	return text
+}
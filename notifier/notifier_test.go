@@ -0,0 +1,98 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestNotifier_PostsStateChanges(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var payload Payload
+	var slack slackMessage
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer webhook.Close()
+
+	slackHook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewDecoder(r.Body).Decode(&slack)
+	}))
+	defer slackHook.Close()
+
+	n := New(Config{
+		Webhooks: []Webhook{{URL: webhook.URL}, {URL: slackHook.URL, Slack: true}},
+		Backoff:  time.Millisecond,
+	})
+
+	n.Notify(gcb.Event{Type: gcb.EventStuckOpen, Name: "ignored"})
+	n.Notify(gcb.Event{
+		Type:   gcb.EventStateChange,
+		Name:   "api",
+		From:   gcb.Close,
+		To:     gcb.Open,
+		Counts: gcb.Counts{Requests: 5, TotalFailures: 5},
+		Err:    errors.New("connection refused"),
+	})
+	_ = n.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+	if payload.Name != "api" || payload.To != gcb.Open || payload.Error != "connection refused" {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+	if !strings.Contains(slack.Text, "api changed from Close to Open") {
+		t.Errorf("Unexpected Slack message %q", slack.Text)
+	}
+}
+
+func TestNotifier_NotifyAfterClose(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+	}))
+	defer webhook.Close()
+
+	n := New(Config{Webhooks: []Webhook{{URL: webhook.URL}}})
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the transports may still emit state changes, they're dropped
+	n.Notify(gcb.Event{Type: gcb.EventStateChange, Name: "api", From: gcb.Close, To: gcb.Open})
+	if err := n.Close(); err != nil {
+		t.Errorf("Expected %v, got %v", nil, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 0 {
+		t.Errorf("Expected %d calls, got %d", 0, calls)
+	}
+}
@@ -0,0 +1,189 @@
+package gcb
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	// Default outlier detection configuration, mirroring Envoy
+	defaultConsecutiveGatewayFailure = uint32(5)
+	defaultBaseEjectionTime          = 30 * time.Second
+	defaultMaxEjectionTime           = 300 * time.Second
+	defaultMaxEjectionPercent        = 10
+)
+
+type (
+	// OutlierDetection configures the passive ejection of endpoints that
+	// keep failing. Zero values are replaced by the defaults.
+	OutlierDetection struct {
+		// ConsecutiveGatewayFailure is the number of consecutive gateway
+		// errors (502, 503, 504 or connection errors) that ejects an endpoint.
+		ConsecutiveGatewayFailure uint32
+		// BaseEjectionTime is the time an endpoint is ejected for the first
+		// time, it doubles on every following ejection.
+		BaseEjectionTime time.Duration
+		// MaxEjectionTime caps the ejection time.
+		MaxEjectionTime time.Duration
+		// MaxEjectionPercent is the maximum percentage of endpoints that can
+		// be ejected at the same time, at least one endpoint can always be
+		// ejected.
+		MaxEjectionPercent int
+	}
+
+	// endpoint is a single backend of the pool
+	endpoint struct {
+		url *url.URL
+
+		consecutiveFailures uint32
+		ejections           uint32
+		ejectedUntil        time.Time
+	}
+
+	// endpointPool spreads the attempts over the endpoints in round-robin,
+	// skipping the ejected ones
+	endpointPool struct {
+		transport http.RoundTripper
+		detection *OutlierDetection
+
+		mu        sync.Mutex
+		endpoints []*endpoint
+		next      int
+	}
+)
+
+// WithEndpoints spreads the requests over the given base URLs, every
+// attempt is rebased onto the next endpoint in rotation.
+func WithEndpoints(endpoints ...*url.URL) Option {
+	return func(config *Config) {
+		config.endpoints = endpoints
+	}
+}
+
+// WithOutlierDetection ejects endpoints from the rotation after consecutive
+// gateway errors. It only applies when multiple endpoints are configured.
+func WithOutlierDetection(detection OutlierDetection) Option {
+	return func(config *Config) {
+		config.outlierDetection = &detection
+	}
+}
+
+func newEndpointPool(endpoints []*url.URL, od *OutlierDetection, transport http.RoundTripper) *endpointPool {
+	var detection *OutlierDetection
+	if od != nil {
+		d := *od
+		detection = &d
+		if detection.ConsecutiveGatewayFailure == 0 {
+			detection.ConsecutiveGatewayFailure = defaultConsecutiveGatewayFailure
+		}
+		if detection.BaseEjectionTime == 0 {
+			detection.BaseEjectionTime = defaultBaseEjectionTime
+		}
+		if detection.MaxEjectionTime == 0 {
+			detection.MaxEjectionTime = defaultMaxEjectionTime
+		}
+		if detection.MaxEjectionPercent == 0 {
+			detection.MaxEjectionPercent = defaultMaxEjectionPercent
+		}
+	}
+
+	pool := &endpointPool{
+		transport: transport,
+		detection: detection,
+	}
+	for _, u := range endpoints {
+		pool.endpoints = append(pool.endpoints, &endpoint{url: u})
+	}
+	return pool
+}
+
+// RoundTrip sends the attempt to the next endpoint and records its outcome
+func (p *endpointPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	ep := p.pick(time.Now())
+
+	u := rebaseURL(req.URL, ep.url)
+	epReq := req.Clone(req.Context())
+	epReq.URL = &u
+	epReq.Host = ""
+
+	resp, err := p.transport.RoundTrip(epReq)
+	p.record(ep, isGatewayFailure(resp, err), time.Now())
+	return resp, err
+}
+
+// pick returns the next endpoint in rotation. Endpoints whose ejection
+// expired are brought back, if every endpoint is ejected the rotation
+// ignores the ejections.
+func (p *endpointPool) pick(now time.Time) *endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.endpoints {
+		ep := p.endpoints[(p.next+i)%len(p.endpoints)]
+		if !ep.ejectedUntil.IsZero() && !ep.ejectedUntil.After(now) {
+			ep.ejectedUntil = time.Time{}
+			ep.consecutiveFailures = 0
+		}
+		if ep.ejectedUntil.IsZero() {
+			p.next = (p.next + i + 1) % len(p.endpoints)
+			return ep
+		}
+	}
+
+	ep := p.endpoints[p.next]
+	p.next = (p.next + 1) % len(p.endpoints)
+	return ep
+}
+
+func (p *endpointPool) record(ep *endpoint, failed bool, now time.Time) {
+	if p.detection == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !failed {
+		ep.consecutiveFailures = 0
+		return
+	}
+
+	ep.consecutiveFailures++
+	if ep.consecutiveFailures < p.detection.ConsecutiveGatewayFailure || !ep.ejectedUntil.IsZero() {
+		return
+	}
+
+	// max ejection percentage guard, like Envoy one endpoint can always
+	// be ejected regardless of the percentage
+	ejected := 1
+	for _, other := range p.endpoints {
+		if !other.ejectedUntil.IsZero() && other.ejectedUntil.After(now) {
+			ejected++
+		}
+	}
+	if ejected > 1 && ejected*100 > p.detection.MaxEjectionPercent*len(p.endpoints) {
+		return
+	}
+
+	ejection := p.detection.BaseEjectionTime << ep.ejections
+	if ejection <= 0 || ejection > p.detection.MaxEjectionTime {
+		ejection = p.detection.MaxEjectionTime
+	}
+	ep.ejections++
+	ep.ejectedUntil = now.Add(ejection)
+}
+
+// isGatewayFailure reports whether the attempt failed in a way that points
+// at the endpoint itself
+func isGatewayFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
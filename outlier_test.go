@@ -0,0 +1,50 @@
+package gcb
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestEndpointPool_EjectsOutlier(t *testing.T) {
+	bad, _ := url.Parse("http://bad")
+	good, _ := url.Parse("http://good")
+
+	hits := map[string]int{}
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		hits[req.URL.Host]++
+		if req.URL.Host == "bad" {
+			return &http.Response{StatusCode: 503, Body: http.NoBody}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+
+	pool := newEndpointPool([]*url.URL{bad, good}, &OutlierDetection{
+		ConsecutiveGatewayFailure: 2,
+		BaseEjectionTime:          time.Minute,
+	}, transport)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://service/path", nil)
+	for i := 0; i < 10; i++ {
+		if _, err := pool.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if hits["bad"] != 2 || hits["good"] != 8 {
+		t.Errorf("Expected the bad endpoint to be ejected after 2 failures, got %v", hits)
+	}
+
+	// the ejection doubles the next time around
+	pool.pick(time.Now().Add(2 * time.Minute))
+	bad1 := pool.endpoints[0]
+	if !bad1.ejectedUntil.IsZero() {
+		t.Fatal("Expected the ejection to expire")
+	}
+	pool.record(bad1, true, time.Now())
+	pool.record(bad1, true, time.Now())
+	if d := time.Until(bad1.ejectedUntil); d < time.Minute+59*time.Second {
+		t.Errorf("Expected a 2m ejection, got %s", d)
+	}
+}
@@ -0,0 +1,73 @@
+package gcb
+
+type (
+	// BreakerSummary is the state and counts of a breaker, as exchanged
+	// with the peers
+	BreakerSummary struct {
+		Name   string `json:"name"`
+		State  State  `json:"state"`
+		Counts Counts `json:"counts"`
+	}
+
+	// PeerView provides what the peers observed for a breaker, e.g. the
+	// average of their counts. It's called while the breaker is locked, so it
+	// must not block.
+	PeerView interface {
+		PeerCounts(name string) (Counts, bool)
+	}
+)
+
+// WithPeerView factors the peer observations into the ReadyToTrip decisions:
+// ReadyToTrip gets the local counts plus the peer counts scaled by weight.
+func WithPeerView(view PeerView, weight float64) Option {
+	return func(config *Config) {
+		config.peerView = view
+		config.peerWeight = weight
+	}
+}
+
+// Summaries returns the summary of every breaker of the transport
+func (t *tripper) Summaries() []BreakerSummary {
+	breakers := t.RoundTripper.(*circuit).allBreakers()
+
+	summaries := make([]BreakerSummary, 0, len(breakers))
+	for _, cb := range breakers {
+		state, counts := cb.snapshot()
+		summaries = append(summaries, BreakerSummary{
+			Name:   cb.Name(),
+			State:  state,
+			Counts: counts,
+		})
+	}
+	return summaries
+}
+
+// tripCounts returns the counts ReadyToTrip decides on, the breaker must
+// be locked
+func (cb *Breaker) tripCounts() Counts {
+	counts := cb.counts.load()
+	if cb.countsStore != nil {
+		if shared, ok := cb.countsStore.Counts(cb.name); ok {
+			counts = shared
+		}
+	}
+
+	if cb.peerView == nil {
+		return counts
+	}
+	peer, ok := cb.peerView.PeerCounts(cb.name)
+	if !ok {
+		return counts
+	}
+
+	weighted := func(local, peer uint32) uint32 {
+		return local + uint32(float64(peer)*cb.peerWeight)
+	}
+	return Counts{
+		Requests:             weighted(counts.Requests, peer.Requests),
+		TotalSuccesses:       weighted(counts.TotalSuccesses, peer.TotalSuccesses),
+		TotalFailures:        weighted(counts.TotalFailures, peer.TotalFailures),
+		ConsecutiveSuccesses: weighted(counts.ConsecutiveSuccesses, peer.ConsecutiveSuccesses),
+		ConsecutiveFailures:  weighted(counts.ConsecutiveFailures, peer.ConsecutiveFailures),
+	}
+}
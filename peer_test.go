@@ -0,0 +1,52 @@
+package gcb
+
+import "testing"
+
+// fakePeerView reports the same counts for every breaker
+type fakePeerView struct {
+	counts Counts
+	ok     bool
+}
+
+func (v *fakePeerView) PeerCounts(name string) (Counts, bool) {
+	return v.counts, v.ok
+}
+
+func TestWithPeerView(t *testing.T) {
+	tests := []struct {
+		name     string
+		view     *fakePeerView
+		weight   float64
+		expected Counts
+	}{
+		{"no peers", &fakePeerView{counts: Counts{Requests: 8, TotalFailures: 8, ConsecutiveFailures: 8}}, 0.5,
+			Counts{Requests: 2, TotalFailures: 2, ConsecutiveFailures: 2}},
+		{"weighted", &fakePeerView{counts: Counts{Requests: 8, TotalSuccesses: 3, TotalFailures: 5, ConsecutiveFailures: 5}, ok: true}, 0.5,
+			Counts{Requests: 6, TotalSuccesses: 1, TotalFailures: 4, ConsecutiveFailures: 4}},
+		{"ignored", &fakePeerView{counts: Counts{Requests: 8, TotalFailures: 8, ConsecutiveFailures: 8}, ok: true}, 0,
+			Counts{Requests: 2, TotalFailures: 2, ConsecutiveFailures: 2}},
+		// opens on the first failure, the second is rejected
+		{"full weight", &fakePeerView{counts: Counts{Requests: 8, TotalFailures: 8, ConsecutiveFailures: 8}, ok: true}, 1,
+			Counts{Requests: 9, TotalFailures: 9, ConsecutiveFailures: 9}},
+	}
+
+	for _, tt := range tests {
+		var decided Counts
+		cb := NewBreaker(
+			WithPeerView(tt.view, tt.weight),
+			WithReadyToTrip(func(counts Counts) bool {
+				decided = counts
+				return counts.ConsecutiveFailures >= 4
+			}),
+		)
+		trip(cb)
+		trip(cb)
+
+		if decided != tt.expected {
+			t.Errorf("%s: Expected %+v, got %+v", tt.name, tt.expected, decided)
+		}
+		if open := cb.State() == Open; open != (tt.expected.ConsecutiveFailures >= 4) {
+			t.Errorf("%s: Expected open %v, got %s", tt.name, tt.expected.ConsecutiveFailures >= 4, cb.State())
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package gcb
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// breakerShards is the number of locks the per-key breakers are spread over
+const breakerShards = 32
+
+type (
+	// OnEvict is called when a per-key breaker is evicted
+	OnEvict func(key string, cb *Breaker)
+
+	// breakerMap holds one breaker per upstream key, created on first use.
+	// The keys are spread over shards, so the lookups of different hosts
+	// don't wait on each other. Breakers idle for longer than idleTTL, or
+	// the least recently used ones past maxEntries, are evicted.
+	breakerMap struct {
+		// size is the number of breakers and lastSweep the last sweep of the
+		// idle ones in unix nanoseconds, they come first to be aligned for
+		// the atomics
+		size      int64
+		lastSweep int64
+		// evicted is the number of breakers evicted
+		evicted uint64
+
+		shards     [breakerShards]breakerShard
+		newBreaker func(key string) *Breaker
+
+		idleTTL    time.Duration
+		maxEntries int
+		onEvict    OnEvict
+
+		// evictMu serialises the evictions, they go through every shard
+		evictMu sync.Mutex
+	}
+
+	// breakerShard holds the breakers of the keys hashed to it
+	breakerShard struct {
+		mu       sync.RWMutex
+		breakers map[string]*breakerEntry
+	}
+
+	// breakerEntry is a breaker of the map, lastUsed is in unix nanoseconds
+	// and only kept up to date when there is an eviction bound
+	breakerEntry struct {
+		lastUsed int64
+		key      string
+		cb       *Breaker
+	}
+)
+
+// WithPerKeyBreakers gives every upstream key its own breaker, so a failing
+// host doesn't open the circuit for the others. Keys are computed by the
+// KeyFunc, the request host by default.
+func WithPerKeyBreakers() Option {
+	return func(config *Config) {
+		config.perKeyBreakers = true
+	}
+}
+
+// WithBreakerEviction bounds the per-key breakers: breakers unused for
+// idleTTL are evicted, and so is the least recently used one when there are
+// more than maxEntries. The maximum is checked on every lookup and the idle
+// breakers are swept at most every quarter of idleTTL, zero disables either
+// bound. An evicted key gets a
+// fresh closed breaker on its next request, so idleTTL should be longer
+// than the breaker timeout. onEvict, if not nil, is called with the evicted
+// breakers.
+func WithBreakerEviction(idleTTL time.Duration, maxEntries int, onEvict OnEvict) Option {
+	return func(config *Config) {
+		config.breakerIdleTTL = idleTTL
+		config.maxBreakers = maxEntries
+		config.onEvict = onEvict
+	}
+}
+
+func newBreakerMap(newBreaker func(key string) *Breaker) *breakerMap {
+	m := &breakerMap{newBreaker: newBreaker}
+	for i := range m.shards {
+		m.shards[i].breakers = make(map[string]*breakerEntry)
+	}
+	return m
+}
+
+// shardOf returns the shard of the key, by its FNV-1a hash
+func (m *breakerMap) shardOf(key string) *breakerShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return &m.shards[hash%breakerShards]
+}
+
+// get returns the breaker of the key, creating it if needed
+func (m *breakerMap) get(key string) *Breaker {
+	bounded := m.idleTTL > 0 || m.maxEntries > 0
+	var now time.Time
+	if bounded {
+		now = time.Now()
+	}
+
+	shard := m.shardOf(key)
+	shard.mu.RLock()
+	entry, ok := shard.breakers[key]
+	shard.mu.RUnlock()
+	if !ok {
+		shard.mu.Lock()
+		if entry, ok = shard.breakers[key]; !ok {
+			entry = &breakerEntry{lastUsed: now.UnixNano(), key: key, cb: m.newBreaker(key)}
+			shard.breakers[key] = entry
+			atomic.AddInt64(&m.size, 1)
+		}
+		shard.mu.Unlock()
+	}
+	if !bounded {
+		return entry.cb
+	}
+
+	atomic.StoreInt64(&entry.lastUsed, now.UnixNano())
+	for _, e := range m.evict(now) {
+		atomic.AddUint64(&m.evicted, 1)
+		e.cb.stopBackground()
+		if m.onEvict != nil {
+			m.onEvict(e.key, e.cb)
+		}
+	}
+	return entry.cb
+}
+
+// lookup returns the breaker of the key if there's one, without creating
+// it or counting it as used
+func (m *breakerMap) lookup(key string) (*Breaker, bool) {
+	shard := m.shardOf(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	entry, ok := shard.breakers[key]
+	if !ok {
+		return nil, false
+	}
+	return entry.cb, true
+}
+
+// evict removes the idle breakers and the ones over the maximum, starting
+// from the least recently used
+func (m *breakerMap) evict(now time.Time) []*breakerEntry {
+	sweep := m.idleTTL > 0 && now.UnixNano()-atomic.LoadInt64(&m.lastSweep) >= int64(m.idleTTL/4)
+	over := m.maxEntries > 0 && atomic.LoadInt64(&m.size) > int64(m.maxEntries)
+	if !sweep && !over {
+		return nil
+	}
+
+	m.evictMu.Lock()
+	defer m.evictMu.Unlock()
+
+	var evicted []*breakerEntry
+	if sweep && now.UnixNano()-atomic.LoadInt64(&m.lastSweep) >= int64(m.idleTTL/4) {
+		atomic.StoreInt64(&m.lastSweep, now.UnixNano())
+		evicted = m.removeIdle(now)
+	}
+	for m.maxEntries > 0 && atomic.LoadInt64(&m.size) > int64(m.maxEntries) {
+		oldest := m.oldest()
+		if oldest == nil {
+			break
+		}
+		m.remove(oldest)
+		evicted = append(evicted, oldest)
+	}
+	return evicted
+}
+
+// removeIdle removes the breakers unused for idleTTL, the least recently
+// used first
+func (m *breakerMap) removeIdle(now time.Time) []*breakerEntry {
+	var idle []*breakerEntry
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.Lock()
+		for key, entry := range shard.breakers {
+			if now.UnixNano()-atomic.LoadInt64(&entry.lastUsed) > int64(m.idleTTL) {
+				delete(shard.breakers, key)
+				atomic.AddInt64(&m.size, -1)
+				idle = append(idle, entry)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	sort.Slice(idle, func(i, j int) bool {
+		return atomic.LoadInt64(&idle[i].lastUsed) < atomic.LoadInt64(&idle[j].lastUsed)
+	})
+	return idle
+}
+
+// oldest returns the least recently used breaker
+func (m *breakerMap) oldest() *breakerEntry {
+	var oldest *breakerEntry
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.RLock()
+		for _, entry := range shard.breakers {
+			if oldest == nil || atomic.LoadInt64(&entry.lastUsed) < atomic.LoadInt64(&oldest.lastUsed) {
+				oldest = entry
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return oldest
+}
+
+// remove takes the breaker out of its shard
+func (m *breakerMap) remove(entry *breakerEntry) {
+	shard := m.shardOf(entry.key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if shard.breakers[entry.key] == entry {
+		delete(shard.breakers, entry.key)
+		atomic.AddInt64(&m.size, -1)
+	}
+}
+
+// all returns every breaker of the map, by key
+func (m *breakerMap) all() []*Breaker {
+	var entries []*breakerEntry
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.RLock()
+		for _, entry := range shard.breakers {
+			entries = append(entries, entry)
+		}
+		shard.mu.RUnlock()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	breakers := make([]*Breaker, 0, len(entries))
+	for _, entry := range entries {
+		breakers = append(breakers, entry.cb)
+	}
+	return breakers
+}
+
+// forget drops the evicted breaker from the maps keyed by breaker, so they
+// don't grow with every key ever seen
+func (c *circuit) forget(cb *Breaker) {
+	if c.warmUp != nil {
+		c.warmUp.targets.Delete(cb)
+	}
+	if c.idleProbe != nil {
+		c.idleProbe.targets.Delete(cb)
+	}
+}
+
+// breakerFor returns the breaker guarding the request
+func (c *circuit) breakerFor(req *http.Request) *Breaker {
+	if c.breakers == nil {
+		return c.breaker
+	}
+	return c.breakers.get(c.keyFunc(req))
+}
@@ -0,0 +1,113 @@
+package gcb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreakerMap_Eviction(t *testing.T) {
+	var evicted []string
+	transport := NewRoundTripper(
+		WithPerKeyBreakers(),
+		WithBreakerEviction(50*time.Millisecond, 2, func(key string, cb *Breaker) {
+			evicted = append(evicted, key)
+		}),
+	)
+	breakers := transport.RoundTripper.(*circuit).breakers
+
+	// a is the least recently used when c comes in
+	breakers.get("a")
+	breakers.get("b")
+	breakers.get("c")
+	if !reflect.DeepEqual(evicted, []string{"a"}) {
+		t.Errorf("Expected [a] evicted, got %v", evicted)
+	}
+
+	// b and c go idle, only the fresh d stays
+	time.Sleep(60 * time.Millisecond)
+	breakers.get("d")
+	if !reflect.DeepEqual(evicted, []string{"a", "b", "c"}) {
+		t.Errorf("Expected [a b c] evicted, got %v", evicted)
+	}
+	if n := len(breakers.all()); n != 1 {
+		t.Errorf("Expected %d, got %d", 1, n)
+	}
+}
+
+func TestBreakerMap_Concurrent(t *testing.T) {
+	m := newBreakerMap(func(key string) *Breaker { return NewBreaker(WithName(key)) })
+	m.maxEntries = 64
+
+	// every goroutine gets the same breaker for a key
+	var wg sync.WaitGroup
+	got := make([]map[string]*Breaker, 8)
+	for i := range got {
+		got[i] = make(map[string]*Breaker)
+		wg.Add(1)
+		go func(seen map[string]*Breaker) {
+			defer wg.Done()
+			for j := 0; j < 32; j++ {
+				key := fmt.Sprintf("host-%d", j)
+				seen[key] = m.get(key)
+			}
+		}(got[i])
+	}
+	wg.Wait()
+	for _, seen := range got[1:] {
+		if !reflect.DeepEqual(seen, got[0]) {
+			t.Fatalf("Expected one breaker per key")
+		}
+	}
+
+	// the keys past the maximum evict the least recently used
+	for j := 32; j < 128; j++ {
+		m.get(fmt.Sprintf("host-%d", j))
+	}
+	if n := len(m.all()); n != 64 {
+		t.Errorf("Expected %d, got %d", 64, n)
+	}
+	if cb := m.all()[0]; cb.Name() != "host-100" {
+		t.Errorf("Expected %s, got %s", "host-100", cb.Name())
+	}
+}
+
+func TestBreakerMap_EvictionSideMaps(t *testing.T) {
+	evicted := 0
+	transport := NewRoundTripper(
+		WithPerKeyBreakers(),
+		WithWarmUp(1, nil),
+		WithMaxIdleProbeInterval(time.Hour, nil),
+		WithBreakerEviction(0, 2, func(key string, cb *Breaker) { evicted++ }),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+	defer func() { _ = transport.Shutdown(context.Background()) }()
+	c := transport.RoundTripper.(*circuit)
+
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://host-%d.example/", i), nil)
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if evicted != 8 {
+		t.Errorf("Expected %d evictions, got %d", 8, evicted)
+	}
+	for name, targets := range map[string]*sync.Map{"warm-up": &c.warmUp.targets, "idle probe": &c.idleProbe.targets} {
+		count := 0
+		targets.Range(func(key, value interface{}) bool {
+			count++
+			return true
+		})
+		if count != 2 {
+			t.Errorf("%s: Expected the targets of %d breakers, got %d", name, 2, count)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrBulkheadFull is returned when the bulkhead has no room for the request
+	ErrBulkheadFull = errors.New("bulkhead is full")
+)
+
+type (
+	// RoundTripperFunc is an adapter to use a function as a http.RoundTripper
+	RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+	// Policy is a stage of a pipeline, it wraps the next stage of the
+	// pipeline into a RoundTripper adding its own behaviour.
+	Policy func(next http.RoundTripper) http.RoundTripper
+)
+
+// RoundTrip calls fn(req)
+func (fn RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// NewPipeline composes the policies over the transport, the first policy is
+// the outermost stage. NewRoundTripper retries inside of the breaker, much like
+//
+//	NewPipeline(transport, BreakerPolicy(b), RetryPolicy(r))
+//
+// while putting RetryPolicy first retries outside of the breaker, so every
+// attempt is recorded by the breaker.
+func NewPipeline(transport http.RoundTripper, policies ...Policy) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(policies) - 1; i >= 0; i-- {
+		transport = policies[i](transport)
+	}
+	return transport
+}
+
+// RateLimitPolicy rejects the requests over the rate of the limiter
+func RateLimitPolicy(limiter Limiter) Policy {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !limiter.Allow() {
+				return nil, &RateLimitedError{}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// BulkheadPolicy limits the number of concurrent requests, requests over the
+// limit are rejected with ErrBulkheadFull.
+func BulkheadPolicy(maxConcurrent int) Policy {
+	slots := make(chan struct{}, maxConcurrent)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				return nil, ErrBulkheadFull
+			}
+			defer func() { <-slots }()
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// BreakerPolicy guards the next stages with the breaker. Errors and
+// responses in the 500 range count as failures.
+func BreakerPolicy(cb *Breaker) Policy {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return cb.execute(func() (*http.Response, error) {
+				return next.RoundTrip(req)
+			}, isServerFailure)
+		})
+	}
+}
+
+// RetryPolicy retries the next stages according to the retrier
+func RetryPolicy(r *Retrier) Policy {
+	return func(next http.RoundTripper) http.RoundTripper {
+		c := &circuit{retrier: r, RoundTripper: next, logger: defaultLogger}
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return c.retry(req, nil)
+		})
+	}
+}
+
+// isServerFailure reports whether the outcome is an error or a server error
+func isServerFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= 500
+}
@@ -0,0 +1,56 @@
+package gcb
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPipeline_RetryOutsideBreaker(t *testing.T) {
+	var attempts int
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts < 3 {
+			return &http.Response{StatusCode: 500, Body: http.NoBody}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+
+	retrier := NewRetrier()
+	retrier.RetryWaitMin = time.Millisecond
+	breaker := NewBreaker()
+
+	pipeline := NewPipeline(transport, RetryPolicy(retrier), BulkheadPolicy(1), BreakerPolicy(breaker))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	resp, err := pipeline.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected %d, got %d", 200, resp.StatusCode)
+	}
+
+	// every attempt went through the breaker
+	counts := breaker.Counts()
+	if counts.Requests != 3 || counts.TotalFailures != 2 || counts.TotalSuccesses != 1 {
+		t.Errorf("Unexpected counts %+v", counts)
+	}
+}
+
+func TestRetryPolicy_AttemptContext(t *testing.T) {
+	var attempt Attempt
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempt, _ = AttemptFromContext(req.Context())
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+
+	pipeline := NewPipeline(transport, RetryPolicy(NewRetrier(WithMaxRetries(2))))
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	if _, err := pipeline.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Attempt{Number: 1, Max: 3}); attempt != want {
+		t.Errorf("Expected %v, got %v", want, attempt)
+	}
+}
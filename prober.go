@@ -0,0 +1,92 @@
+package gcb
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+var (
+	defaultProbeTimeout = 10 * time.Second
+)
+
+type (
+	// HalfOpenProber reports whether the request may probe a half-open
+	// breaker. It's called while the breaker is locked, so it must not
+	// block.
+	HalfOpenProber func(req *http.Request) bool
+
+	probeContextKey struct{}
+)
+
+// WithHalfOpenProber lets only the requests selected by prober probe a
+// half-open breaker, e.g. the cheap GETs, the others are rejected with
+// ErrTooManyRequests until the probes close the breaker. The breaker stays
+// half-open as long as no request is selected, unless probe is set: a
+// rejected request then has a synthetic probe, built by probe against its
+// URL, sent in the background through the breaker, one at a time. A nil
+// prober selects the synthetic probes only.
+func WithHalfOpenProber(prober HalfOpenProber, probe ProbeFunc) Option {
+	return func(config *Config) {
+		if prober == nil {
+			prober = func(*http.Request) bool { return false }
+		}
+		config.halfOpenProber = prober
+		config.halfOpenProbe = probe
+	}
+}
+
+// SafeMethods is a HalfOpenProber selecting the GET, HEAD and OPTIONS
+// requests
+func SafeMethods(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "":
+		return true
+	}
+	return false
+}
+
+// mayProbe reports whether the request may probe the breaker while
+// half-open, the breaker must be locked
+func (cb *Breaker) mayProbe(r *http.Request) bool {
+	if cb.prober == nil || r == nil || r.Context().Value(probeContextKey{}) != nil {
+		return true
+	}
+	return cb.prober(r)
+}
+
+// probeHalfOpen sends a synthetic probe through the breaker, which turned
+// the request away, unless one is in flight
+func (c *circuit) probeHalfOpen(cb *Breaker, req *http.Request) {
+	if cb.State() != HalfOpen {
+		return
+	}
+	if _, inFlight := c.probing.LoadOrStore(cb, struct{}{}); inFlight {
+		return
+	}
+	probe, err := c.halfOpenProbe(req.URL)
+	if err != nil {
+		c.probing.Delete(cb)
+		return
+	}
+
+	go func() {
+		defer c.probing.Delete(cb)
+		c.sendProbe(cb, probe)
+	}()
+}
+
+// sendProbe sends a synthetic probe through the breaker, a single attempt
+// whose response is discarded
+func (c *circuit) sendProbe(cb *Breaker, probe *http.Request) {
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), probeContextKey{}, true), defaultProbeTimeout)
+	defer cancel()
+	probe = probe.WithContext(ctx)
+
+	resp, err := cb.executeFor(probe, "", func() (*http.Response, error) {
+		return c.once(probe, cb)
+	}, isServerFailure)
+	if err == nil {
+		c.drainBody(resp)
+	}
+}
@@ -0,0 +1,85 @@
+package gcb
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestWithHalfOpenProber(t *testing.T) {
+	healthProbe := func(target *url.URL) (*http.Request, error) {
+		return http.NewRequest(http.MethodHead, target.Scheme+"://"+target.Host+"/health", nil)
+	}
+
+	tests := []struct {
+		name     string
+		prober   HalfOpenProber
+		probe    ProbeFunc
+		requests []string
+		rejected []bool
+		sent     []string
+	}{
+		{"safe methods", SafeMethods, nil, []string{"POST", "GET", "POST"}, []bool{true, false, false}, []string{"GET /", "POST /"}},
+		{"synthetic probe", nil, healthProbe, []string{"POST", "GET", "POST"}, []bool{true, false, false}, []string{"HEAD /health", "GET /", "POST /"}},
+		{"any request", SafeMethods, healthProbe, []string{"GET"}, []bool{false}, []string{"GET /"}},
+	}
+
+	for _, tt := range tests {
+		var mu sync.Mutex
+		var sent []string
+		probed := make(chan struct{}, 1)
+		clock := testutil.NewFakeClock(time.Now())
+		transport := NewRoundTripper(
+			WithoutRetries(),
+			WithTimeout(time.Minute),
+			WithClock(clock),
+			WithReadyToTrip(func(counts Counts) bool { return true }),
+			WithHalfOpenProber(tt.prober, tt.probe),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				sent = append(sent, req.Method+" "+req.URL.Path)
+				mu.Unlock()
+				if req.Method == http.MethodHead {
+					probed <- struct{}{}
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})),
+		)
+		c := transport.RoundTripper.(*circuit)
+		trip(c.breaker)
+		clock.Advance(time.Minute + time.Second)
+
+		for i, method := range tt.requests {
+			req, _ := http.NewRequest(method, "http://api.example/", nil)
+			_, err := transport.RoundTrip(req)
+			if rejected := err == ErrTooManyRequests; rejected != tt.rejected[i] {
+				t.Errorf("%s: Expected %s rejected %v, got %v", tt.name, method, tt.rejected[i], err)
+			}
+			if i == 0 && tt.rejected[0] && tt.probe != nil {
+				select {
+				case <-probed:
+				case <-time.After(time.Second):
+					t.Fatalf("%s: Expected a synthetic probe", tt.name)
+				}
+				// the synthetic probe leaves once it's done
+				for _, inFlight := c.probing.Load(c.breaker); inFlight; _, inFlight = c.probing.Load(c.breaker) {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}
+
+		mu.Lock()
+		if !reflect.DeepEqual(sent, tt.sent) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.sent, sent)
+		}
+		mu.Unlock()
+		if state := c.breaker.State(); state != Close {
+			t.Errorf("%s: Expected %s, got %s", tt.name, Close, state)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package proptest checks properties of custom retry and breaker policies
+// over random inputs, the ones every policy is expected to hold:
+//
+//	func TestBackoff(t *testing.T) {
+//		proptest.BackoffBounded(t, myBackoff)
+//		proptest.BackoffMonotonic(t, myBackoff)
+//		proptest.CheckRetryHonorsContext(t, myCheckRetry)
+//		proptest.ReadyToTripMonotonic(t, myReadyToTrip)
+//	}
+//
+// Every property draws Runs inputs from a random seed, which is reported on
+// failure. Setting PROPTEST_SEED replays the inputs of a failed run.
+package proptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+// SeedEnv is the environment variable fixing the seed of the random inputs
+const SeedEnv = "PROPTEST_SEED"
+
+// Runs is the number of random inputs a property is checked against
+var Runs = 1000
+
+var errConnection = errors.New("connection reset by peer")
+
+// Check runs a property against Runs random inputs, the property returns a
+// description of the input it doesn't hold for, empty when it holds
+func Check(t testing.TB, name string, property func(rnd *rand.Rand) string) {
+	t.Helper()
+
+	seed := time.Now().UnixNano()
+	if env := os.Getenv(SeedEnv); env != "" {
+		if parsed, err := strconv.ParseInt(env, 10, 64); err == nil {
+			seed = parsed
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	for i := 0; i < Runs; i++ {
+		if failure := property(rnd); failure != "" {
+			t.Errorf("%s doesn't hold for %s (%s=%d)", name, failure, SeedEnv, seed)
+			return
+		}
+	}
+}
+
+// BackoffBounded checks the waits are between zero and the maximum wait
+func BackoffBounded(t testing.TB, backoff gcb.Backoff) {
+	t.Helper()
+
+	Check(t, "BackoffBounded", func(rnd *rand.Rand) string {
+		min, max := randomWaits(rnd)
+		attempt := uint32(rnd.Intn(64))
+		resp := randomResponse(rnd)
+		if wait := backoff(min, max, attempt, resp); wait < 0 || wait > max {
+			return fmt.Sprintf("min %s, max %s, attempt %d, %s: waits %s", min, max, attempt, describe(resp), wait)
+		}
+		return ""
+	})
+}
+
+// BackoffMonotonic checks the waits never decrease from one attempt to the
+// next, jittered backoffs don't hold it
+func BackoffMonotonic(t testing.TB, backoff gcb.Backoff) {
+	t.Helper()
+
+	Check(t, "BackoffMonotonic", func(rnd *rand.Rand) string {
+		min, max := randomWaits(rnd)
+		attempt := uint32(rnd.Intn(64))
+		wait, next := backoff(min, max, attempt, nil), backoff(min, max, attempt+1, nil)
+		if next < wait {
+			return fmt.Sprintf("min %s, max %s: attempt %d waits %s, attempt %d %s", min, max, attempt, wait, attempt+1, next)
+		}
+		return ""
+	})
+}
+
+// CheckRetryHonorsContext checks nothing is retried once the context of the
+// request is cancelled or past its deadline
+func CheckRetryHonorsContext(t testing.TB, checkRetry gcb.CheckRetry) {
+	t.Helper()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	Check(t, "CheckRetryHonorsContext", func(rnd *rand.Rand) string {
+		ctx := cancelled
+		if rnd.Intn(2) == 0 {
+			ctx = expired
+		}
+		resp, err := randomResponse(rnd), error(nil)
+		if resp == nil {
+			err = errConnection
+		}
+		if retry, _ := checkRetry(ctx, resp, err); retry {
+			return fmt.Sprintf("%v context, %s", ctx.Err(), describe(resp))
+		}
+		return ""
+	})
+}
+
+// ReadyToTripMonotonic checks that a breaker tripping on some counts trips
+// on the same counts plus one more failure, and never trips without failures
+func ReadyToTripMonotonic(t testing.TB, readyToTrip gcb.ReadyToTrip) {
+	t.Helper()
+
+	Check(t, "ReadyToTripMonotonic", func(rnd *rand.Rand) string {
+		counts := randomCounts(rnd)
+		if counts.TotalFailures == 0 && readyToTrip(counts) {
+			return fmt.Sprintf("%+v without failures", counts)
+		}
+
+		more := counts
+		more.Requests++
+		more.TotalFailures++
+		more.ConsecutiveFailures++
+		more.ConsecutiveSuccesses = 0
+		if readyToTrip(counts) && !readyToTrip(more) {
+			return fmt.Sprintf("%+v, but not %+v", counts, more)
+		}
+		return ""
+	})
+}
+
+// randomWaits draws a minimum and maximum wait
+func randomWaits(rnd *rand.Rand) (time.Duration, time.Duration) {
+	min := time.Duration(rnd.Int63n(int64(10 * time.Second)))
+	return min, min + time.Duration(rnd.Int63n(int64(time.Minute)))
+}
+
+// randomResponse draws a response the policies are likely to act on, nil
+// standing for a connection error
+func randomResponse(rnd *rand.Rand) *http.Response {
+	statuses := []int{0, http.StatusOK, http.StatusBadRequest, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusNotImplemented, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	status := statuses[rnd.Intn(len(statuses))]
+	if status == 0 {
+		return nil
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody}
+}
+
+// randomCounts draws consistent counts
+func randomCounts(rnd *rand.Rand) gcb.Counts {
+	var counts gcb.Counts
+	counts.Requests = uint32(rnd.Intn(1000))
+	counts.TotalFailures = uint32(rnd.Intn(int(counts.Requests) + 1))
+	counts.TotalSuccesses = counts.Requests - counts.TotalFailures
+	if rnd.Intn(2) == 0 {
+		counts.ConsecutiveFailures = uint32(rnd.Intn(int(counts.TotalFailures) + 1))
+	} else {
+		counts.ConsecutiveSuccesses = uint32(rnd.Intn(int(counts.TotalSuccesses) + 1))
+	}
+	return counts
+}
+
+func describe(resp *http.Response) string {
+	if resp == nil {
+		return "no response"
+	}
+	return fmt.Sprintf("status %d", resp.StatusCode)
+}
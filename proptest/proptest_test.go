@@ -0,0 +1,69 @@
+package proptest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+// recordingT records the failures of the properties
+type recordingT struct {
+	testing.TB
+	failures int
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.failures++
+}
+
+func TestDefaults(t *testing.T) {
+	BackoffBounded(t, gcb.DefaultBackoff)
+	BackoffMonotonic(t, gcb.DefaultBackoff)
+	CheckRetryHonorsContext(t, gcb.DefaultRetryPolicy)
+	ReadyToTripMonotonic(t, func(counts gcb.Counts) bool {
+		return counts.Requests >= 10 && float64(counts.TotalFailures)/float64(counts.Requests) >= 0.5
+	})
+}
+
+func TestViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(t testing.TB)
+	}{
+		{"unbounded", func(t testing.TB) {
+			BackoffBounded(t, func(min, max time.Duration, attempt uint32, resp *http.Response) time.Duration {
+				return min << attempt
+			})
+		}},
+		{"decreasing", func(t testing.TB) {
+			BackoffMonotonic(t, func(min, max time.Duration, attempt uint32, resp *http.Response) time.Duration {
+				return max - time.Duration(attempt)
+			})
+		}},
+		{"ignores the context", func(t testing.TB) {
+			CheckRetryHonorsContext(t, func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+				return err != nil || resp.StatusCode >= 500, nil
+			})
+		}},
+		{"trips on successes", func(t testing.TB) {
+			ReadyToTripMonotonic(t, func(counts gcb.Counts) bool {
+				return counts.ConsecutiveSuccesses > 5
+			})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingT{TB: t}
+			tt.check(recorder)
+			if recorder.failures != 1 {
+				t.Errorf("Expected %d, got %d", 1, recorder.failures)
+			}
+		})
+	}
+}
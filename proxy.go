@@ -0,0 +1,122 @@
+package gcb
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync/atomic"
+)
+
+type (
+	// ProxyError is a failure of the proxy rather than of the target host:
+	// the proxy couldn't be reached or refused to open the tunnel. It's the
+	// error CheckRetry sees, so the retry policy can tell it apart.
+	ProxyError struct {
+		Proxy *url.URL
+		Err   error
+	}
+
+	// proxyTrace follows how far a request went through the proxy
+	proxyTrace struct {
+		tlsStarts int32
+		gotConn   int32
+	}
+)
+
+// WithProxyBreakers gives every proxy its own breaker, named after the proxy
+// host. The failures of the proxy or of its CONNECT tunnel open the proxy
+// breaker and aren't counted by the breakers of the target hosts, so a flaky
+// proxy doesn't open the circuits of every destination behind it. It only
+// applies to the *http.Transport with a Proxy function, http.DefaultTransport
+// included.
+func WithProxyBreakers() Option {
+	return func(config *Config) {
+		config.proxyBreakers = true
+	}
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("proxy %s: %v", e.Proxy.Host, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// proxyFor returns the proxy the request goes through, if any
+func (c *circuit) proxyFor(req *http.Request) *url.URL {
+	if c.proxy == nil {
+		return nil
+	}
+	proxyURL, err := c.proxy(req)
+	if err != nil {
+		return nil
+	}
+	return proxyURL
+}
+
+// proxyExecute runs the request under the breaker of its proxy, which only
+// counts the proxy failures, and the breaker of its target, which ignores them
+func (c *circuit) proxyExecute(req *http.Request, cb *Breaker, proxyURL *url.URL) (*http.Response, error) {
+	proxyBreaker := c.proxyBreakers.get(proxyURL.Host)
+	generation, err := proxyBreaker.beforeRequest(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			proxyBreaker.afterRequest(generation, nil)
+			panic(e)
+		}
+	}()
+
+	resp, err := cb.executeFor(req, "", func() (*http.Response, error) {
+		return c.retry(req, cb)
+	}, hasFailed)
+	var proxyErr *ProxyError
+	if errors.As(err, &proxyErr) {
+		proxyBreaker.afterRequest(generation, proxyErr)
+	} else {
+		proxyBreaker.afterRequest(generation, nil)
+	}
+	return resp, err
+}
+
+// traceProxy returns the request traced for the proxy failures
+func traceProxy(req *http.Request) (*http.Request, *proxyTrace) {
+	pt := &proxyTrace{}
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { atomic.AddInt32(&pt.tlsStarts, 1) },
+		GotConn:           func(httptrace.GotConnInfo) { atomic.StoreInt32(&pt.gotConn, 1) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), pt
+}
+
+// proxyFailure tells whether the error happened before the request made it
+// through the proxy: the proxy couldn't be dialed, or the connection was
+// never handed over and the TLS handshake with the target didn't start
+func (pt *proxyTrace) proxyFailure(req *http.Request, proxyURL *url.URL, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "proxyconnect" {
+		return true
+	}
+	if atomic.LoadInt32(&pt.gotConn) == 1 {
+		return false
+	}
+	if req.URL.Scheme != "https" {
+		return true
+	}
+	// an https proxy has its own handshake ahead of the one with the target
+	targetStart := int32(1)
+	if proxyURL.Scheme == "https" {
+		targetStart = 2
+	}
+	return atomic.LoadInt32(&pt.tlsStarts) < targetStart
+}
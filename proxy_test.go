@@ -0,0 +1,93 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxyBreakers(t *testing.T) {
+	// the proxy refuses every tunnel
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			t.Errorf("Expected a CONNECT, got %s", r.Method)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	transport := NewRoundTripper(
+		WithTransport(&http.Transport{Proxy: http.ProxyURL(proxyURL)}),
+		WithProxyBreakers(),
+		WithPerKeyBreakers(),
+		WithMaxRetries(0),
+		WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures >= 2 }),
+	)
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Get("https://target.example/")
+		var proxyErr *ProxyError
+		if !errors.As(err, &proxyErr) {
+			t.Fatalf("Expected a proxy error, got %v", err)
+		}
+	}
+
+	c := transport.RoundTripper.(*circuit)
+	if state := c.proxyBreakers.get(proxyURL.Host).State(); state != Open {
+		t.Errorf("Expected %s, got %s", Open, state)
+	}
+	if state := c.breakers.get("target.example").State(); state != Close {
+		t.Errorf("Expected %s, got %s", Close, state)
+	}
+	if n := c.breakers.get("target.example").Counts().Requests; n != 0 {
+		t.Errorf("Expected %d, got %d", 0, n)
+	}
+
+	if _, err := client.Get("https://target.example/"); !errors.Is(err, ErrOpenState) {
+		t.Errorf("Expected the open proxy breaker to reject the request, got %v", err)
+	}
+}
+
+func TestProxyTrace_ProxyFailure(t *testing.T) {
+	httpProxy, _ := url.Parse("http://proxy.example:3128")
+	httpsProxy, _ := url.Parse("https://proxy.example:3129")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	errTunnel := errors.New("Bad Gateway")
+
+	tests := []struct {
+		name      string
+		target    string
+		proxy     *url.URL
+		ctx       context.Context
+		tlsStarts int32
+		gotConn   int32
+		err       error
+		want      bool
+	}{
+		{"proxy dial", "http://target.example", httpProxy, context.Background(), 0, 0, &net.OpError{Op: "proxyconnect", Err: errTunnel}, true},
+		{"tunnel refused", "https://target.example", httpProxy, context.Background(), 0, 0, errTunnel, true},
+		{"target handshake", "https://target.example", httpProxy, context.Background(), 1, 0, errTunnel, false},
+		{"tunnel refused by https proxy", "https://target.example", httpsProxy, context.Background(), 1, 0, errTunnel, true},
+		{"target handshake through https proxy", "https://target.example", httpsProxy, context.Background(), 2, 0, errTunnel, false},
+		{"after the connection", "http://target.example", httpProxy, context.Background(), 0, 1, errTunnel, false},
+		{"cancelled", "https://target.example", httpProxy, cancelled, 0, 0, context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tt.target, nil)
+			req = req.WithContext(tt.ctx)
+			pt := &proxyTrace{tlsStarts: tt.tlsStarts, gotConn: tt.gotConn}
+			if got := pt.proxyFailure(req, tt.proxy, tt.err); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+//go:build gcb_integration
+
+package natspubsub
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// These tests run against the NATS server at NATS_URL:
+//
+//	NATS_URL=nats://localhost:4222 go test -tags gcb_integration ./pubsub/natspubsub
+
+func TestPubSub(t *testing.T) {
+	url := os.Getenv("NATS_URL")
+	if url == "" {
+		t.Skip("NATS_URL isn't set")
+	}
+	conn, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	subject := "gcb-test." + time.Now().Format("150405.000000000")
+	publisher, subscriber := New(conn, subject), New(conn, subject)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan string, 1)
+	if err := subscriber.Subscribe(ctx, func(data []byte) { received <- string(data) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := publisher.Publish(context.Background(), []byte("open")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if data != "open" {
+			t.Errorf("Expected %s, got %s", "open", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the message to be received")
+	}
+
+	// the subscription ends with its context
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if err := publisher.Publish(context.Background(), []byte("close")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Flush()
+	select {
+	case data := <-received:
+		t.Errorf("Expected no message after the cancellation, got %s", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,46 @@
+// Package natspubsub shares the breaker states between instances over NATS.
+package natspubsub
+
+import (
+	"context"
+
+	"github.com/calvernaz/gcb"
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	// makes sure the adapter implements the gcb pub/sub interface
+	_ gcb.PubSub = (*PubSub)(nil)
+)
+
+// PubSub publishes and receives the breaker states on a NATS subject
+type PubSub struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// New returns a gcb.PubSub over the NATS connection
+func New(conn *nats.Conn, subject string) *PubSub {
+	return &PubSub{conn: conn, subject: subject}
+}
+
+// Publish sends the message on the subject
+func (ps *PubSub) Publish(ctx context.Context, data []byte) error {
+	return ps.conn.Publish(ps.subject, data)
+}
+
+// Subscribe calls handler for every message on the subject until ctx is done
+func (ps *PubSub) Subscribe(ctx context.Context, handler func(data []byte)) error {
+	sub, err := ps.conn.Subscribe(ps.subject, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = sub.Unsubscribe()
+	}()
+	return nil
+}
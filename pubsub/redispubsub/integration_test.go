@@ -0,0 +1,59 @@
+//go:build gcb_integration
+
+package redispubsub
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// These tests run against the Redis at REDIS_ADDR:
+//
+//	REDIS_ADDR=localhost:6379 go test -tags gcb_integration ./pubsub/redispubsub
+
+func TestPubSub(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR isn't set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+
+	channel := "gcb-test:" + time.Now().Format("150405.000000000")
+	publisher, subscriber := New(client, channel), New(client, channel)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan string, 1)
+	if err := subscriber.Subscribe(ctx, func(data []byte) { received <- string(data) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := publisher.Publish(context.Background(), []byte("open")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if data != "open" {
+			t.Errorf("Expected %s, got %s", "open", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the message to be received")
+	}
+
+	// the subscription ends with its context
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if err := publisher.Publish(context.Background(), []byte("close")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		t.Errorf("Expected no message after the cancellation, got %s", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
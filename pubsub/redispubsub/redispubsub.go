@@ -0,0 +1,60 @@
+// Package redispubsub shares the breaker states between instances over
+// Redis pub/sub.
+package redispubsub
+
+import (
+	"context"
+
+	"github.com/calvernaz/gcb"
+	"github.com/go-redis/redis/v7"
+)
+
+var (
+	// makes sure the adapter implements the gcb pub/sub interface
+	_ gcb.PubSub = (*PubSub)(nil)
+)
+
+// PubSub publishes and receives the breaker states on a Redis channel
+type PubSub struct {
+	client  *redis.Client
+	channel string
+}
+
+// New returns a gcb.PubSub over the Redis client
+func New(client *redis.Client, channel string) *PubSub {
+	return &PubSub{client: client, channel: channel}
+}
+
+// Publish sends the message on the channel
+func (ps *PubSub) Publish(ctx context.Context, data []byte) error {
+	return ps.client.WithContext(ctx).Publish(ps.channel, data).Err()
+}
+
+// Subscribe calls handler for every message on the channel until ctx is done
+func (ps *PubSub) Subscribe(ctx context.Context, handler func(data []byte)) error {
+	sub := ps.client.Subscribe(ps.channel)
+
+	// wait for the subscription to be confirmed
+	if _, err := sub.Receive(); err != nil {
+		_ = sub.Close()
+		return err
+	}
+
+	go func() {
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				handler([]byte(msg.Payload))
+			}
+		}
+	}()
+	return nil
+}
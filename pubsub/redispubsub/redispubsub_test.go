@@ -0,0 +1,23 @@
+package redispubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func TestPubSub_Unreachable(t *testing.T) {
+	// nothing listens on the discard port
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:9", DialTimeout: 50 * time.Millisecond, MaxRetries: -1})
+	defer client.Close()
+
+	ps := New(client, "gcb")
+	if err := ps.Subscribe(context.Background(), func(data []byte) {}); err == nil {
+		t.Errorf("Expected the subscription to fail")
+	}
+	if err := ps.Publish(context.Background(), []byte("open")); err == nil {
+		t.Errorf("Expected the publication to fail")
+	}
+}
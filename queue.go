@@ -0,0 +1,320 @@
+package gcb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrQueued is returned when a deferrable request could not be delivered
+	// and was handed over to the offline queue for later delivery
+	ErrQueued = errors.New("request queued for later delivery")
+	// ErrQueueFull is returned by a QueueStore when it has no room left
+	ErrQueueFull = errors.New("offline queue is full")
+	// ErrQueueExpired is reported to the DeliveryCallback for the queued
+	// requests dropped after too many attempts or too long in the queue
+	ErrQueueExpired = errors.New("queued request expired")
+
+	// defaultQueueInterval is the time between the deliveries of the queued
+	// requests whose breaker stayed closed
+	defaultQueueInterval = 30 * time.Second
+	// defaultQueueMaxAttempts and defaultQueueMaxAge bound the deliveries of
+	// a queued request, see WithQueueLimits
+	defaultQueueMaxAttempts = 10
+	defaultQueueMaxAge      = 24 * time.Hour
+)
+
+type (
+	// QueuedRequest is a snapshot of a deferrable request, detached from the
+	// caller so it can be replayed in the background.
+	QueuedRequest struct {
+		Method string
+		URL    string
+		Header http.Header
+		Body   []byte
+
+		// Attempts is the number of deliveries attempted so far
+		Attempts int
+		// EnqueuedAt is the time the request first entered the queue
+		EnqueuedAt time.Time
+	}
+
+	// QueueStore holds queued requests until they can be delivered. The
+	// store is expected to be bounded and to return ErrQueueFull when a
+	// request cannot be accepted. Implementations must be safe for
+	// concurrent use.
+	QueueStore interface {
+		Push(req *QueuedRequest) error
+		Pop() (*QueuedRequest, bool)
+		Len() int
+	}
+
+	// DeliveryCallback is called once per queued request with the outcome of
+	// the background delivery. err is nil when the request was delivered,
+	// otherwise the request has been dropped.
+	DeliveryCallback func(req *QueuedRequest, resp *http.Response, err error)
+
+	// memoryQueue is a bounded FIFO QueueStore
+	memoryQueue struct {
+		mu    sync.Mutex
+		items []*QueuedRequest
+		size  int
+	}
+
+	// offlineQueue replays queued requests through the circuit whenever a
+	// breaker closes, and every interval
+	offlineQueue struct {
+		// failed is the number of requests the store failed to take, it
+		// comes first to be aligned for the atomics
+		failed uint64
+
+		store       QueueStore
+		onDelivery  DeliveryCallback
+		interval    time.Duration
+		maxAttempts int
+		maxAge      time.Duration
+
+		wake chan struct{}
+		stop chan struct{}
+	}
+
+	deferrableKey struct{}
+)
+
+// NewMemoryQueue returns an in-memory QueueStore that holds up to size requests.
+func NewMemoryQueue(size int) QueueStore {
+	return &memoryQueue{size: size}
+}
+
+func (q *memoryQueue) Push(req *QueuedRequest) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= q.size {
+		return ErrQueueFull
+	}
+	q.items = append(q.items, req)
+	return nil
+}
+
+func (q *memoryQueue) Pop() (*QueuedRequest, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	req := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	return req, true
+}
+
+func (q *memoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// WithOfflineQueue enables the asynchronous mode: deferrable requests that
+// exhaust their retries, or are rejected by the breaker, are stored in store
+// and re-attempted in the background when a breaker closes, and every 30
+// seconds otherwise, see WithQueueInterval. They're dropped after 10
+// attempts or a day, see WithQueueLimits. onDelivery may be nil.
+func WithOfflineQueue(store QueueStore, onDelivery DeliveryCallback) Option {
+	return func(config *Config) {
+		config.queueStore = store
+		config.onDelivery = onDelivery
+	}
+}
+
+// WithQueueInterval sets the time between the deliveries of the offline
+// queue, which also run whenever a breaker closes
+func WithQueueInterval(interval time.Duration) Option {
+	return func(config *Config) {
+		config.queueInterval = interval
+	}
+}
+
+// WithQueueLimits bounds the deliveries of the offline queue: a request is
+// dropped once maxAttempts deliveries failed, counting the original request,
+// or once it's been queued for maxAge, even if its breaker stayed open all
+// along. The drop is reported to the DeliveryCallback with ErrQueueExpired.
+// The defaults are 10 attempts and 24 hours, zero keeps a default.
+func WithQueueLimits(maxAttempts int, maxAge time.Duration) Option {
+	return func(config *Config) {
+		config.queueMaxAttempts = maxAttempts
+		config.queueMaxAge = maxAge
+	}
+}
+
+// Deferrable marks the request as fire-and-forget, allowing it to be queued
+// for later delivery when an offline queue is configured.
+func Deferrable(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), deferrableKey{}, true))
+}
+
+func isDeferrable(req *http.Request) bool {
+	deferrable, _ := req.Context().Value(deferrableKey{}).(bool)
+	return deferrable
+}
+
+func newOfflineQueue(store QueueStore, onDelivery DeliveryCallback, interval time.Duration) *offlineQueue {
+	if interval <= 0 {
+		interval = defaultQueueInterval
+	}
+	return &offlineQueue{
+		store:       store,
+		onDelivery:  onDelivery,
+		interval:    interval,
+		maxAttempts: defaultQueueMaxAttempts,
+		maxAge:      defaultQueueMaxAge,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+}
+
+// limit sets the bounds of the deliveries, zero keeps a default. The
+// requests pushed without an enqueue time don't age.
+func (q *offlineQueue) limit(maxAttempts int, maxAge time.Duration) {
+	if maxAttempts > 0 {
+		q.maxAttempts = maxAttempts
+	}
+	if maxAge > 0 {
+		q.maxAge = maxAge
+	}
+}
+
+// enqueue snapshots the request into the store. It fails when the body
+// cannot be replayed or the store is full.
+func (q *offlineQueue) enqueue(req *http.Request) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return errBodyNotReplayable
+		}
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return q.push(&QueuedRequest{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Header:     req.Header.Clone(),
+		Body:       body,
+		Attempts:   1,
+		EnqueuedAt: time.Now(),
+	})
+}
+
+// push stores the request, counting the failures
+func (q *offlineQueue) push(qr *QueuedRequest) error {
+	err := q.store.Push(qr)
+	if err != nil {
+		atomic.AddUint64(&q.failed, 1)
+	}
+	return err
+}
+
+// notify wakes up the delivery loop without blocking, it's safe to call
+// while holding the breaker lock
+func (q *offlineQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *offlineQueue) run(c *circuit) {
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+			q.drain(c)
+		case <-ticker.C:
+			q.drain(c)
+		}
+	}
+}
+
+// drain goes once through the queued requests and delivers those whose
+// breaker is closed. The others are put back in the queue, and so are the
+// failed deliveries, whose breaker isn't tried again until the next drain.
+// The requests past the limits are dropped instead.
+func (q *offlineQueue) drain(c *circuit) {
+	// the breakers not to try again in this drain
+	skipped := map[*Breaker]bool{}
+	for n := q.store.Len(); n > 0; n-- {
+		qr, ok := q.store.Pop()
+		if !ok {
+			return
+		}
+		if !qr.EnqueuedAt.IsZero() && time.Since(qr.EnqueuedAt) >= q.maxAge {
+			q.deliver(qr, nil, fmt.Errorf("%w after %s in the queue", ErrQueueExpired, q.maxAge))
+			continue
+		}
+
+		req, err := http.NewRequest(qr.Method, qr.URL, bytes.NewReader(qr.Body))
+		if err != nil {
+			q.deliver(qr, nil, err)
+			continue
+		}
+		if qr.Header != nil {
+			req.Header = qr.Header.Clone()
+		}
+
+		cb := c.breakerFor(req)
+		if skipped[cb] || cb.State() != Close {
+			if pushErr := q.push(qr); pushErr != nil {
+				q.deliver(qr, nil, pushErr)
+			}
+			continue
+		}
+
+		qr.Attempts++
+		resp, err := c.execute(req)
+		if err == nil {
+			q.deliver(qr, resp, nil)
+			continue
+		}
+		if resp != nil {
+			c.drainBody(resp)
+		}
+
+		skipped[cb] = true
+		if qr.Attempts >= q.maxAttempts {
+			q.deliver(qr, nil, fmt.Errorf("%w after %d attempts: %v", ErrQueueExpired, qr.Attempts, err))
+			continue
+		}
+		if pushErr := q.push(qr); pushErr != nil {
+			q.deliver(qr, nil, err)
+		}
+	}
+}
+
+func (q *offlineQueue) deliver(qr *QueuedRequest, resp *http.Response, err error) {
+	if q.onDelivery != nil {
+		q.onDelivery(qr, resp, err)
+	}
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+}
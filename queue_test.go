@@ -0,0 +1,170 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuit_OfflineQueue(t *testing.T) {
+	store := NewMemoryQueue(1)
+	client, baseURL, mux, teardown := newRoundTripper(WithMaxRetries(0), WithOfflineQueue(store, nil))
+	defer teardown()
+
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(500)
+	}))
+
+	request, _ := http.NewRequest(http.MethodPost, baseURL, strings.NewReader("event"))
+	_, err := client.Do(Deferrable(request))
+	if !errors.Is(err, ErrQueued) {
+		t.Fatalf("Expected %v, got %v", ErrQueued, err)
+	}
+
+	if store.Len() != 1 {
+		t.Fatalf("Expected 1 queued request, got %d", store.Len())
+	}
+	qr, _ := store.Pop()
+	if string(qr.Body) != "event" {
+		t.Errorf("Expected body %q, got %q", "event", qr.Body)
+	}
+
+	// without the mark the caller gets the response back
+	request, _ = http.NewRequest(http.MethodPost, baseURL, strings.NewReader("event"))
+	resp, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 500 {
+		t.Errorf("Expected %d, got %d", 500, resp.StatusCode)
+	}
+}
+
+func TestCircuit_OfflineQueueDelivery(t *testing.T) {
+	var healthy int32
+	delivered := make(chan *QueuedRequest, 1)
+	transport := NewRoundTripper(
+		WithMaxRetries(0),
+		WithLogLevel(LevelOff),
+		WithQueueInterval(10*time.Millisecond),
+		WithOfflineQueue(NewMemoryQueue(1), func(qr *QueuedRequest, resp *http.Response, err error) {
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected the delivery to succeed, got %v", err)
+			}
+			delivered <- qr
+		}),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if atomic.LoadInt32(&healthy) == 0 {
+				return &http.Response{StatusCode: http.StatusInternalServerError, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+	defer func() { _ = transport.Shutdown(context.Background()) }()
+
+	req, _ := http.NewRequest(http.MethodPost, "http://api.example/events", strings.NewReader("event"))
+	if _, err := transport.RoundTrip(Deferrable(req)); !errors.Is(err, ErrQueued) {
+		t.Fatalf("Expected %v, got %v", ErrQueued, err)
+	}
+
+	// the breaker never opened, the request is delivered on the interval
+	atomic.StoreInt32(&healthy, 1)
+	select {
+	case qr := <-delivered:
+		if string(qr.Body) != "event" || qr.Attempts != 2 {
+			t.Errorf("Unexpected delivery %+v", qr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the queued request to be delivered")
+	}
+}
+
+func TestOfflineQueue_OpenKey(t *testing.T) {
+	var delivered []string
+	store := NewMemoryQueue(2)
+	transport := NewRoundTripper(
+		WithPerKeyBreakers(),
+		WithReadyToTrip(func(counts Counts) bool { return true }),
+		WithQueueInterval(time.Hour),
+		WithOfflineQueue(store, func(qr *QueuedRequest, resp *http.Response, err error) {
+			delivered = append(delivered, qr.URL)
+		}),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+	defer func() { _ = transport.Shutdown(context.Background()) }()
+	c := transport.RoundTripper.(*circuit)
+
+	_ = store.Push(&QueuedRequest{Method: http.MethodPost, URL: "http://down.example/events", Attempts: 1})
+	_ = store.Push(&QueuedRequest{Method: http.MethodPost, URL: "http://up.example/events", Attempts: 1})
+	trip(c.breakers.get("down.example"))
+
+	// the open key is skipped, the others are still delivered
+	c.queue.drain(c)
+	if expected := []string{"http://up.example/events"}; !reflect.DeepEqual(delivered, expected) {
+		t.Errorf("Expected %v, got %v", expected, delivered)
+	}
+	qr, ok := store.Pop()
+	if !ok || qr.URL != "http://down.example/events" || qr.Attempts != 1 {
+		t.Errorf("Expected the request of the open key to stay queued, got %+v", qr)
+	}
+}
+
+func TestOfflineQueue_Limits(t *testing.T) {
+	tests := []struct {
+		name     string
+		queued   QueuedRequest
+		open     bool
+		err      error
+		attempts int
+	}{
+		{"retried", QueuedRequest{Attempts: 1, EnqueuedAt: time.Now()}, false, nil, 2},
+		{"too many attempts", QueuedRequest{Attempts: 2, EnqueuedAt: time.Now()}, false, ErrQueueExpired, 3},
+		{"too old", QueuedRequest{Attempts: 1, EnqueuedAt: time.Now().Add(-2 * time.Hour)}, false, ErrQueueExpired, 1},
+		{"too old behind an open breaker", QueuedRequest{Attempts: 1, EnqueuedAt: time.Now().Add(-2 * time.Hour)}, true, ErrQueueExpired, 1},
+	}
+
+	for _, tt := range tests {
+		var dropped error
+		store := NewMemoryQueue(1)
+		transport := NewRoundTripper(
+			WithoutRetries(),
+			WithLogLevel(LevelOff),
+			WithQueueInterval(time.Hour),
+			WithQueueLimits(3, time.Hour),
+			WithOfflineQueue(store, func(qr *QueuedRequest, resp *http.Response, err error) {
+				dropped = err
+			}),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			})),
+		)
+		c := transport.RoundTripper.(*circuit)
+		if tt.open {
+			c.breaker.force(Open, time.Now())
+		}
+
+		qr := tt.queued
+		qr.Method, qr.URL = http.MethodPost, "http://api.example/events"
+		_ = store.Push(&qr)
+		c.queue.drain(c)
+		_ = transport.Shutdown(context.Background())
+
+		if !errors.Is(dropped, tt.err) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.err, dropped)
+		}
+		if qr.Attempts != tt.attempts {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.attempts, qr.Attempts)
+		}
+		if queued := store.Len(); (queued == 0) != (tt.err != nil) {
+			t.Errorf("%s: Expected the request to be dropped only on %v, got %d queued", tt.name, tt.err, queued)
+		}
+	}
+}
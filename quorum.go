@@ -0,0 +1,44 @@
+package gcb
+
+type (
+	// Quorum provides the recent failure rate reported by each live peer
+	// for a breaker, from 0 to 1. It's called while the breaker is locked,
+	// so it must not block.
+	Quorum interface {
+		PeerFailureRates(name string) []float64
+	}
+)
+
+// WithOpenQuorum only lets a breaker open when, on top of tripping locally,
+// at least k peers report a failure rate of failureRate or more, so a
+// network blip local to one instance doesn't open its circuits. While fewer
+// than k peers are known no quorum can be formed, and the local decision
+// stands.
+func WithOpenQuorum(quorum Quorum, k int, failureRate float64) Option {
+	return func(config *Config) {
+		config.quorum = quorum
+		config.quorumSize = k
+		config.quorumFailureRate = failureRate
+	}
+}
+
+// quorumAgrees reports whether enough peers see the failures to open the
+// breaker, the breaker must be locked
+func (cb *Breaker) quorumAgrees() bool {
+	if cb.quorum == nil {
+		return true
+	}
+
+	rates := cb.quorum.PeerFailureRates(cb.name)
+	if len(rates) < cb.quorumSize {
+		return true
+	}
+
+	elevated := 0
+	for _, rate := range rates {
+		if rate >= cb.quorumFailureRate {
+			elevated++
+		}
+	}
+	return elevated >= cb.quorumSize
+}
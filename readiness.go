@@ -0,0 +1,128 @@
+package gcb
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type (
+	// ReadinessCheck is a dependency the readiness of the instance looks
+	// at, through the states of its breakers
+	ReadinessCheck struct {
+		// Name names the dependency in the report
+		Name string
+		// Transport holds the breakers of the dependency
+		Transport BreakerSource
+		// Breakers are the names of the breakers to look at, all the
+		// breakers of the transport when empty
+		Breakers []string
+		// Critical makes the instance unready while one of the breakers is
+		// failing, the failures of the other dependencies are only reported
+		Critical bool
+		// FailingStates are the states a breaker is failing in, Open by
+		// default. HalfOpen fails a dependency until it has recovered.
+		FailingStates []State
+	}
+
+	// ReadinessReport is the body of the readiness handler responses
+	ReadinessReport struct {
+		Ready        bool               `json:"ready"`
+		Dependencies []DependencyReport `json:"dependencies"`
+	}
+
+	// DependencyReport is the readiness of a dependency, Failing lists its
+	// failing breakers
+	DependencyReport struct {
+		Name     string   `json:"name"`
+		Critical bool     `json:"critical"`
+		Ready    bool     `json:"ready"`
+		Failing  []string `json:"failing,omitempty"`
+	}
+
+	readinessHandler struct {
+		checks []ReadinessCheck
+	}
+)
+
+// ReadinessHandler answers 200 while the instance is ready and 503 while
+// one of the breakers of a critical dependency is failing, with the report
+// of every dependency. It's meant as the target of a readiness probe: an
+// instance whose critical dependency is down is taken out of the load
+// balancing until it's back. The liveness probe must not look at the
+// breakers, restarting the instance doesn't bring the dependency back.
+//
+//	http.Handle("/ready", gcb.ReadinessHandler(
+//		gcb.ReadinessCheck{Name: "payments", Transport: payments, Critical: true},
+//		gcb.ReadinessCheck{Name: "recommendations", Transport: recommendations},
+//	))
+func ReadinessHandler(checks ...ReadinessCheck) http.Handler {
+	return &readinessHandler{checks: checks}
+}
+
+func (h *readinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		adminMethodNotAllowed(w, http.MethodGet+", "+http.MethodHead)
+		return
+	}
+
+	report := h.report()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if r.Method == http.MethodGet {
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
+
+// report checks every dependency
+func (h *readinessHandler) report() ReadinessReport {
+	report := ReadinessReport{Ready: true, Dependencies: make([]DependencyReport, 0, len(h.checks))}
+	for _, check := range h.checks {
+		dependency := check.report()
+		if check.Critical && !dependency.Ready {
+			report.Ready = false
+		}
+		report.Dependencies = append(report.Dependencies, dependency)
+	}
+	return report
+}
+
+// report lists the failing breakers of the dependency
+func (check ReadinessCheck) report() DependencyReport {
+	report := DependencyReport{Name: check.Name, Critical: check.Critical, Ready: true}
+	for _, summary := range check.Transport.Summaries() {
+		if check.covers(summary.Name) && check.failing(summary.State) {
+			report.Ready = false
+			report.Failing = append(report.Failing, summary.Name)
+		}
+	}
+	return report
+}
+
+// covers reports whether the check looks at the named breaker
+func (check ReadinessCheck) covers(name string) bool {
+	if len(check.Breakers) == 0 {
+		return true
+	}
+	for _, breaker := range check.Breakers {
+		if breaker == name {
+			return true
+		}
+	}
+	return false
+}
+
+// failing reports whether a breaker in the state is failing
+func (check ReadinessCheck) failing(state State) bool {
+	if len(check.FailingStates) == 0 {
+		return state == Open
+	}
+	for _, failing := range check.FailingStates {
+		if failing == state {
+			return true
+		}
+	}
+	return false
+}
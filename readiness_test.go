@@ -0,0 +1,79 @@
+package gcb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	payments := NewRoundTripper(WithPerKeyBreakers())
+	payments.RoundTripper.(*circuit).breakers.get("api.example")
+	recommendations := NewRoundTripper(WithName("recommendations"))
+	handler := ReadinessHandler(
+		ReadinessCheck{Name: "payments", Transport: payments, Breakers: []string{"api.example"}, Critical: true},
+		ReadinessCheck{Name: "recommendations", Transport: recommendations},
+	)
+
+	tests := []struct {
+		name   string
+		force  func()
+		status int
+		report ReadinessReport
+	}{
+		{"ready", func() {}, http.StatusOK, ReadinessReport{Ready: true, Dependencies: []DependencyReport{
+			{Name: "payments", Critical: true, Ready: true},
+			{Name: "recommendations", Ready: true},
+		}}},
+		// the dependencies which aren't critical are only reported
+		{"degraded", func() { recommendations.ForceState("recommendations", Open) }, http.StatusOK, ReadinessReport{Ready: true, Dependencies: []DependencyReport{
+			{Name: "payments", Critical: true, Ready: true},
+			{Name: "recommendations", Failing: []string{"recommendations"}},
+		}}},
+		{"other breaker", func() { payments.ForceState("other.example", Open) }, http.StatusOK, ReadinessReport{Ready: true, Dependencies: []DependencyReport{
+			{Name: "payments", Critical: true, Ready: true},
+			{Name: "recommendations", Failing: []string{"recommendations"}},
+		}}},
+		{"unready", func() { payments.ForceState("api.example", Open) }, http.StatusServiceUnavailable, ReadinessReport{Dependencies: []DependencyReport{
+			{Name: "payments", Critical: true, Failing: []string{"api.example"}},
+			{Name: "recommendations", Failing: []string{"recommendations"}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		tt.force()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.status, rec.Code)
+		}
+		var report ReadinessReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(report, tt.report) {
+			t.Errorf("%s: Expected %+v, got %+v", tt.name, tt.report, report)
+		}
+	}
+}
+
+func TestReadinessCheck_FailingStates(t *testing.T) {
+	transport := NewRoundTripper(WithTimeout(time.Millisecond), WithReadyToTrip(func(counts Counts) bool { return true }))
+	cb := transport.RoundTripper.(*circuit).breaker
+	trip(cb)
+	time.Sleep(5 * time.Millisecond)
+
+	// the half-open breaker fails the dependency until it has recovered
+	check := ReadinessCheck{Transport: transport, Critical: true, FailingStates: []State{Open, HalfOpen}}
+	if report := check.report(); report.Ready {
+		t.Errorf("Expected the half-open dependency to be unready")
+	}
+	check.FailingStates = nil
+	if report := check.report(); !report.Ready {
+		t.Errorf("Expected the half-open dependency to be ready")
+	}
+}
@@ -0,0 +1,57 @@
+package gcb
+
+import (
+	"errors"
+	"net"
+)
+
+type (
+	// closeIdler is implemented by the transports pooling their
+	// connections, e.g. *http.Transport
+	closeIdler interface {
+		CloseIdleConnections()
+	}
+)
+
+// WithRedialOnRetry closes the idle connections of the transport before
+// retrying an attempt which failed at the connection level, a dial, read or
+// write error or a failed lookup, so that the retry dials a new connection
+// and looks the host up again. Failovers driven by DNS, e.g. records behind
+// health checks, then take effect within the retries instead of the retries
+// hammering the dead address. The lookups go through the resolver of the
+// dialer, gcb can't clear the cache of the system resolver if there is one.
+// Without WithTransport, the transport gcb builds gets its own connection
+// pool so the other users of http.DefaultTransport keep their connections.
+func WithRedialOnRetry() Option {
+	return func(config *Config) {
+		config.redialOnRetry = true
+	}
+}
+
+// WithFlushOnOpen closes the idle connections of the transport whenever a
+// breaker opens, so the keep-alive connections to a dead or replaced backend
+// aren't reused once the breaker lets requests through again. The
+// http.Transport can't close the connections of a single host, those of the
+// other hosts are closed too and dialed again when needed. As with
+// WithRedialOnRetry, the transport gcb builds gets its own connection pool.
+func WithFlushOnOpen() Option {
+	return func(config *Config) {
+		config.flushOnOpen = true
+	}
+}
+
+// isConnectionFailure reports whether the attempt failed to reach the
+// upstream or lost its connection
+func isConnectionFailure(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
+
+// redial has the next attempt dial a new connection after a connection
+// failure, if enabled
+func (c *circuit) redial(err error) {
+	if c.redialOnRetry && err != nil && isConnectionFailure(err) {
+		c.idler.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,102 @@
+package gcb
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// idleTransport answers the script and counts the idle connections closes
+type idleTransport struct {
+	outcomes []error
+	closes   int
+}
+
+func (t *idleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := t.outcomes[0]
+	t.outcomes = t.outcomes[1:]
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func (t *idleTransport) CloseIdleConnections() {
+	t.closes++
+}
+
+func TestWithRedialOnRetry(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	lookup := &net.DNSError{Err: "no such host", Name: "api.example"}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		outcomes []error
+		closes   int
+	}{
+		{"dial", []Option{WithRedialOnRetry()}, []error{refused, nil}, 1},
+		{"lookup", []Option{WithRedialOnRetry()}, []error{lookup, refused, nil}, 2},
+		{"other error", []Option{WithRedialOnRetry()}, []error{errors.New("bad request"), nil}, 0},
+		{"disabled", nil, []error{refused, nil}, 0},
+	}
+
+	for _, tt := range tests {
+		upstream := &idleTransport{outcomes: tt.outcomes}
+		transport := NewRoundTripper(append([]Option{
+			WithTransport(upstream),
+			WithRetryWait(0, 0),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+		}, tt.opts...)...)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Errorf("%s: Expected no error, got %v", tt.name, err)
+		}
+		if upstream.closes != tt.closes {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.closes, upstream.closes)
+		}
+	}
+
+	// the transport gcb builds has its own connections
+	if base := NewRoundTripper(WithRedialOnRetry()).RoundTripper.(*circuit).RoundTripper; base == http.DefaultTransport {
+		t.Errorf("Expected a transport of its own, got http.DefaultTransport")
+	}
+}
+
+func TestWithFlushOnOpen(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		closes int
+	}{
+		{"enabled", []Option{WithFlushOnOpen()}, 1},
+		{"per key", []Option{WithFlushOnOpen(), WithPerKeyBreakers()}, 1},
+		{"disabled", nil, 0},
+	}
+
+	for _, tt := range tests {
+		upstream := &idleTransport{outcomes: []error{refused}}
+		transport := NewRoundTripper(append([]Option{
+			WithName("api"),
+			WithTransport(upstream),
+			WithMaxRetries(0),
+			WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures > 0 }),
+			WithLogLevel(LevelOff),
+		}, tt.opts...)...)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		_, _ = transport.RoundTrip(req)
+		// the requests rejected while open don't flush again
+		if _, err := transport.RoundTrip(req); !errors.Is(err, ErrOpenState) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, ErrOpenState, err)
+		}
+		if upstream.closes != tt.closes {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.closes, upstream.closes)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrTooManyRedirects is returned when a request is redirected more
+	// times than allowed by WithRedirects
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// WithRedirects has the transport follow up to maxHops redirects itself,
+// instead of leaving them to the http.Client, so that every hop goes through
+// the maintenance check, the breaker of its own key and the retry loop. As
+// the http.Client does, 301, 302 and 303 are followed with a GET and no body,
+// 307 and 308 with the method and the body of the request, which is replayed
+// to each hop. A 307 or 308 whose body can't be replayed is returned as is.
+// The credentials and cookies aren't sent to the hosts other than the one of
+// the request.
+func WithRedirects(maxHops int) Option {
+	return func(config *Config) {
+		config.maxRedirects = maxHops
+	}
+}
+
+// executeRedirects runs the request and the redirects it gets through
+// execute
+func (c *circuit) executeRedirects(req *http.Request) (*http.Response, error) {
+	body, err := newReplayBody(req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.release()
+	hop, err := body.rewind(req, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for hops := 0; ; hops++ {
+		resp, err := c.execute(hop)
+		if err != nil || !isRedirect(resp.StatusCode) || resp.Header.Get("Location") == "" {
+			return resp, err
+		}
+		next, ok := redirectRequest(req, hop, resp, body)
+		if !ok {
+			return resp, nil
+		}
+		c.drainBody(resp)
+		if hops == c.maxRedirects {
+			return nil, ErrTooManyRedirects
+		}
+		hop = next
+	}
+}
+
+// isRedirect reports whether the status is one of the redirects followed
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectRequest returns the request following the redirect of the hop,
+// false when it can't be followed
+func redirectRequest(req, hop *http.Request, resp *http.Response, body *replayBody) (*http.Request, bool) {
+	location, err := hop.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return nil, false
+	}
+
+	next := req.Clone(req.Context())
+	next.URL = location
+	next.Host = ""
+	next.Response = resp
+	if !strings.EqualFold(location.Host, req.URL.Host) {
+		for _, header := range []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"} {
+			next.Header.Del(header)
+		}
+	}
+
+	if resp.StatusCode == http.StatusTemporaryRedirect || resp.StatusCode == http.StatusPermanentRedirect {
+		if !body.replayable() {
+			return nil, false
+		}
+		next, err = body.rewind(req, next, false)
+		return next, err == nil
+	}
+
+	// the other redirects are followed with a GET, without the body
+	if next.Method != http.MethodGet && next.Method != http.MethodHead {
+		next.Method = http.MethodGet
+	}
+	next.Body, next.GetBody, next.ContentLength = nil, nil, 0
+	next.Header.Del("Content-Type")
+	next.Header.Del("Content-Length")
+	return next, true
+}
@@ -0,0 +1,93 @@
+package gcb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithRedirects(t *testing.T) {
+	type hop struct{ method, body, auth string }
+	var hops []hop
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		hops = append(hops, hop{r.Method, string(body), r.Header.Get("Authorization")})
+		_, _ = w.Write([]byte("done"))
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		hops = append(hops, hop{r.Method, string(body), r.Header.Get("Authorization")})
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/here", http.StatusMovedPermanently)
+		case "/here":
+			_, _ = w.Write([]byte("here"))
+		default:
+			code := http.StatusTemporaryRedirect
+			if r.URL.Path == "/see-other" {
+				code = http.StatusSeeOther
+			}
+			w.Header().Set("Location", target.URL+"/done")
+			w.WriteHeader(code)
+		}
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		maxHops  int
+		status   int
+		err      error
+		expected []hop
+	}{
+		{"not followed", http.MethodPost, "/temporary", 0, http.StatusTemporaryRedirect, nil, []hop{{"POST", "payload", "secret"}}},
+		{"same host", http.MethodGet, "/moved", 1, http.StatusOK, nil, []hop{{"GET", "", "secret"}, {"GET", "", "secret"}}},
+		{"body replayed", http.MethodPost, "/temporary", 1, http.StatusOK, nil, []hop{{"POST", "payload", "secret"}, {"POST", "payload", ""}}},
+		{"see other", http.MethodPost, "/see-other", 1, http.StatusOK, nil, []hop{{"POST", "payload", "secret"}, {"GET", "", ""}}},
+		{"too many", http.MethodGet, "/loop", 2, 0, ErrTooManyRedirects, []hop{{"GET", "", "secret"}, {"GET", "", "secret"}, {"GET", "", "secret"}}},
+	}
+
+	for _, tt := range tests {
+		hops = nil
+		transport := NewRoundTripper(WithRedirects(tt.maxHops), WithPerKeyBreakers())
+		// the body can't rewind itself, it's buffered
+		req, _ := http.NewRequest(tt.method, origin.URL+tt.path, ioutil.NopCloser(strings.NewReader("payload")))
+		if tt.method == http.MethodGet {
+			req, _ = http.NewRequest(tt.method, origin.URL+tt.path, nil)
+		}
+		req.Header.Set("Authorization", "secret")
+
+		resp, err := transport.RoundTrip(req)
+		if err != tt.err {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.err, err)
+		}
+		if resp != nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("%s: Expected %d, got %d", tt.name, tt.status, resp.StatusCode)
+			}
+		}
+		if !reflect.DeepEqual(hops, tt.expected) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.expected, hops)
+		}
+
+		// every host has its own breaker
+		if tt.err == nil && len(hops) > 1 && tt.path != "/moved" {
+			requests := map[string]uint32{}
+			for _, summary := range transport.Summaries() {
+				requests[summary.Name] = summary.Counts.Requests
+			}
+			if requests[req.URL.Host] != 1 || requests[strings.TrimPrefix(target.URL, "http://")] != 1 {
+				t.Errorf("%s: Expected the breakers of both hosts, got %v", tt.name, requests)
+			}
+		}
+	}
+}
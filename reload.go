@@ -0,0 +1,153 @@
+package gcb
+
+import (
+	"time"
+)
+
+// Reload applies the options to the running transport. Only the maximum
+// number of retries, the breaker timeout, ReadyToTrip and the maintenance
+// keys can be reloaded, the other options are fixed at creation. Breakers
+// created afterwards, e.g. for a new key, get the reloaded options too.
+func (t *tripper) Reload(opts ...Option) {
+	c := t.RoundTripper.(*circuit)
+
+	c.reloadMu.Lock()
+	c.reloaded = append(c.reloaded, opts...)
+	c.reloadMu.Unlock()
+
+	c.retrier.reload(opts)
+	for _, cb := range c.allBreakers() {
+		cb.reload(opts)
+	}
+
+	config := &Config{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	for _, key := range config.maintenanceKeys {
+		c.maintenance.set(key, true)
+	}
+	t.audit("reload", "", describeReload(opts))
+}
+
+// ForceState holds the named breaker in the Open or Close state regardless
+// of its counts, until it's released with the zero State. With per-key
+// breakers the name is the key, and the breakers of the proxies are named
+// by their host. It returns false when there's no such breaker, a key that
+// had no request yet has none and isn't created.
+func (t *tripper) ForceState(name string, state State) bool {
+	c := t.RoundTripper.(*circuit)
+	cb, ok := c.breakerNamed(name)
+	if !ok {
+		return false
+	}
+	cb.force(state, cb.clock.Now())
+	detail := state.String()
+	if detail == "" {
+		detail = "release"
+	}
+	t.audit("force", name, detail)
+	return true
+}
+
+// ResetBreaker releases the named breaker if it's forced and closes it
+// with cleared counts, as named for ForceState. It returns false when
+// there's no such breaker.
+func (t *tripper) ResetBreaker(name string) bool {
+	c := t.RoundTripper.(*circuit)
+	cb, ok := c.breakerNamed(name)
+	if !ok {
+		return false
+	}
+	cb.reset(cb.clock.Now())
+	t.audit("reset", name, "")
+	return true
+}
+
+// reloadedOptions returns the options reloaded so far
+func (c *circuit) reloadedOptions() []Option {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	return append([]Option{}, c.reloaded...)
+}
+
+// allBreakers returns every breaker of the circuit
+func (c *circuit) allBreakers() []*Breaker {
+	breakers := []*Breaker{c.breaker}
+	if c.breakers != nil {
+		breakers = c.breakers.all()
+	}
+	if c.proxyBreakers != nil {
+		breakers = append(breakers, c.proxyBreakers.all()...)
+	}
+	return breakers
+}
+
+// breakerNamed returns the breaker with the name, the breaker of the key
+// with per-key breakers or the one of a proxy. It never creates one, a key
+// not seen yet has none.
+func (c *circuit) breakerNamed(name string) (*Breaker, bool) {
+	if c.breakers != nil {
+		if cb, ok := c.breakers.lookup(name); ok {
+			return cb, true
+		}
+	} else if name == c.breaker.Name() {
+		return c.breaker, true
+	}
+	if c.proxyBreakers != nil {
+		return c.proxyBreakers.lookup(name)
+	}
+	return nil, false
+}
+
+func (r *Retrier) reload(opts []Option) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config := &Config{maxRetries: r.RetryMax}
+	for _, opt := range opts {
+		opt(config)
+	}
+	r.RetryMax = config.maxRetries
+}
+
+func (cb *Breaker) reload(opts []Option) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	config := &Config{timeout: cb.timeout, readyToTrip: cb.readyToTrip}
+	for _, opt := range opts {
+		opt(config)
+	}
+	cb.timeout = config.timeout
+	cb.readyToTrip = config.readyToTrip
+}
+
+// force holds the breaker in the state, the zero State releases it
+func (cb *Breaker) force(state State, now time.Time) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch state {
+	case Open, Close:
+		cb.forced = 0
+		cb.setState(state, now)
+		cb.forced = state
+	default:
+		cb.forced = 0
+	}
+}
+
+// reset releases the breaker and starts it over closed
+func (cb *Breaker) reset(now time.Time) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.forced = 0
+	if cb.state != Close {
+		cb.setState(Close, now)
+		return
+	}
+	cb.toNewGeneration(now)
+}
@@ -0,0 +1,102 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTripper_Reload(t *testing.T) {
+	transport := NewRoundTripper(WithPerKeyBreakers())
+	c := transport.RoundTripper.(*circuit)
+	before := c.breakers.get("before")
+
+	transport.Reload(
+		WithMaxRetries(1),
+		WithTimeout(time.Minute),
+		WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 }),
+		WithMaintenance("down"),
+	)
+
+	if retryMax, _ := c.retrier.policy(time.Now()); retryMax != 1 {
+		t.Errorf("Expected %d, got %d", 1, retryMax)
+	}
+	if !transport.InMaintenance("down") {
+		t.Errorf("Expected the key to be in maintenance")
+	}
+
+	// breakers created before and after the reload trip on the first failure
+	for _, cb := range []*Breaker{before, c.breakers.get("after")} {
+		trip(cb)
+		if state := cb.State(); state != Open {
+			t.Errorf("Expected %s, got %s", Open, state)
+		}
+		if _, expiry := cb.stateExpiry(); time.Until(expiry) < 30*time.Second {
+			t.Errorf("Expected the reloaded timeout, got %s", time.Until(expiry))
+		}
+	}
+}
+
+func TestTripper_ForceState(t *testing.T) {
+	transport := NewRoundTripper(WithPerKeyBreakers())
+	cb := transport.RoundTripper.(*circuit).breakers.get("api")
+
+	transport.ForceState("api", Open)
+	_, err := cb.Execute(func() (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	if !errors.Is(err, ErrOpenState) {
+		t.Errorf("Expected %v, got %v", ErrOpenState, err)
+	}
+
+	transport.ForceState("api", Close)
+	for i := 0; i < 10; i++ {
+		trip(cb)
+	}
+	if state := cb.State(); state != Close {
+		t.Errorf("Expected %s, got %s", Close, state)
+	}
+
+	transport.ForceState("api", 0)
+	for i := 0; i < 10; i++ {
+		trip(cb)
+	}
+	if state := cb.State(); state != Open {
+		t.Errorf("Expected %s, got %s", Open, state)
+	}
+}
+
+func TestTripper_ForceStateUnknown(t *testing.T) {
+	transport := NewRoundTripper(
+		WithPerKeyBreakers(),
+		WithTransport(&http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy.example:3128"})}),
+		WithProxyBreakers(),
+	)
+	c := transport.RoundTripper.(*circuit)
+	c.breakers.get("api")
+	c.proxyBreakers.get("proxy.example:3128")
+
+	tests := []struct {
+		name  string
+		found bool
+	}{
+		{"api", true},
+		{"proxy.example:3128", true},
+		{"other", false},
+	}
+
+	for _, tt := range tests {
+		if found := transport.ForceState(tt.name, Open); found != tt.found {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.found, found)
+		}
+		if found := transport.ResetBreaker(tt.name); found != tt.found {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.found, found)
+		}
+	}
+	// the unknown names don't create breakers
+	if n := len(c.breakers.all()); n != 1 {
+		t.Errorf("Expected %d, got %d", 1, n)
+	}
+}
@@ -0,0 +1,221 @@
+package gcb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// maxReplayBytes is the most of a request body buffered for the retries, a
+// larger body is streamed to the first attempt and not retried
+const maxReplayBytes = 1 << 20
+
+var (
+	// replaySizes are the size classes of the pooled buffers
+	replaySizes = [...]int{4 << 10, 16 << 10, 64 << 10, 256 << 10, maxReplayBytes}
+	// replayPools recycle the buffers of the replayed request bodies, one
+	// pool per size class so the small bodies don't hold on to large buffers
+	replayPools [len(replaySizes)]sync.Pool
+
+	errReplayClosed = errors.New("read on closed request body")
+)
+
+type (
+	// replayBody gives every attempt a fresh copy of the request body
+	replayBody struct {
+		getBody func() (io.ReadCloser, error)
+		// buffer holds the body when the request can't rewind it itself
+		buffer *replayBuffer
+		// once is a body too large to buffer, it's sent a single time
+		once io.ReadCloser
+	}
+
+	// replayBuffer is a pooled buffer holding a request body, it goes back
+	// to its pool once released and all its readers closed
+	replayBuffer struct {
+		class int
+		buf   *[]byte
+		data  []byte
+
+		mu       sync.Mutex
+		readers  int
+		released bool
+	}
+
+	// replayReader reads a replayBuffer until closed
+	replayReader struct {
+		buffer *replayBuffer
+		r      bytes.Reader
+		closed bool
+	}
+)
+
+// newReplayBody prepares the body of the request to be sent again, it's
+// nil when there is no body
+func newReplayBody(req *http.Request) (*replayBody, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		return &replayBody{getBody: req.GetBody}, nil
+	}
+
+	buffer, complete, err := readReplayBuffer(req.Body, req.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+	if !complete {
+		// the buffer is copied out so the rest can be read at leisure
+		start := append([]byte(nil), buffer.data...)
+		buffer.release()
+		return &replayBody{once: struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(start), req.Body), req.Body}}, nil
+	}
+	_ = req.Body.Close()
+	return &replayBody{getBody: buffer.reader, buffer: buffer}, nil
+}
+
+// replayable reports whether the body can be sent again
+func (b *replayBody) replayable() bool {
+	return b == nil || b.once == nil
+}
+
+// rewind gives the attempt its copy of the body, the first attempt sends
+// the body of the request when it can be rewound. The attempt is copied
+// before being changed if it's the request itself.
+func (b *replayBody) rewind(req, attempt *http.Request, first bool) (*http.Request, error) {
+	if b == nil || (first && b.once == nil && b.buffer == nil) {
+		return attempt, nil
+	}
+	if b.once != nil && !first {
+		return nil, errBodyNotReplayable
+	}
+	if attempt == req {
+		attempt = req.WithContext(req.Context())
+	}
+
+	if b.once != nil {
+		attempt.Body, attempt.GetBody = b.once, nil
+		return attempt, nil
+	}
+	body, err := b.getBody()
+	if err != nil {
+		return nil, err
+	}
+	attempt.Body, attempt.GetBody = body, b.getBody
+	if b.buffer != nil {
+		attempt.ContentLength = int64(len(b.buffer.data))
+	}
+	return attempt, nil
+}
+
+// release gives the buffer back once the attempts are done with it
+func (b *replayBody) release() {
+	if b != nil && b.buffer != nil {
+		b.buffer.release()
+	}
+}
+
+// readReplayBuffer reads the body into a pooled buffer sized after the
+// content length, growing it as needed. complete is false when the body
+// fills the largest buffer.
+func readReplayBuffer(body io.Reader, size int64) (buffer *replayBuffer, complete bool, err error) {
+	class := 0
+	for class < len(replaySizes)-1 && int64(replaySizes[class]) < size {
+		class++
+	}
+	buffer = &replayBuffer{class: class, buf: getReplayBuffer(class)}
+
+	n := 0
+	for {
+		if n == len(*buffer.buf) {
+			if buffer.class == len(replaySizes)-1 {
+				buffer.data = (*buffer.buf)[:n]
+				return buffer, false, nil
+			}
+			grown := getReplayBuffer(buffer.class + 1)
+			copy(*grown, (*buffer.buf)[:n])
+			replayPools[buffer.class].Put(buffer.buf)
+			buffer.class, buffer.buf = buffer.class+1, grown
+		}
+
+		var m int
+		m, err = body.Read((*buffer.buf)[n:])
+		n += m
+		if err == io.EOF {
+			buffer.data = (*buffer.buf)[:n]
+			return buffer, true, nil
+		}
+		if err != nil {
+			buffer.release()
+			return nil, false, err
+		}
+	}
+}
+
+// getReplayBuffer returns a buffer of the size class
+func getReplayBuffer(class int) *[]byte {
+	if buf, ok := replayPools[class].Get().(*[]byte); ok {
+		return buf
+	}
+	buf := make([]byte, replaySizes[class])
+	return &buf
+}
+
+// reader returns a reader over the buffered body
+func (b *replayBuffer) reader() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf == nil {
+		return nil, errBodyNotReplayable
+	}
+	b.readers++
+	r := &replayReader{buffer: b}
+	r.r.Reset(b.data)
+	return r, nil
+}
+
+func (b *replayBuffer) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.released = true
+	b.recycle()
+}
+
+// recycle puts the buffer back in its pool when it's released and not read
+// anymore, the buffer must be locked
+func (b *replayBuffer) recycle() {
+	if b.released && b.readers == 0 && b.buf != nil {
+		replayPools[b.class].Put(b.buf)
+		b.buf, b.data = nil, nil
+	}
+}
+
+// Read is safe to call concurrently with Close, as the transports do
+func (r *replayReader) Read(p []byte) (int, error) {
+	r.buffer.mu.Lock()
+	defer r.buffer.mu.Unlock()
+
+	if r.closed {
+		return 0, errReplayClosed
+	}
+	return r.r.Read(p)
+}
+
+func (r *replayReader) Close() error {
+	r.buffer.mu.Lock()
+	defer r.buffer.mu.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		r.buffer.readers--
+		r.buffer.recycle()
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package gcb
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestReplayBody_Retries(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		getBody bool
+	}{
+		{"buffered", `{"id":1}`, false},
+		{"grown", strings.Repeat("x", 10<<10), false},
+		{"rewound", `{"id":1}`, true},
+	}
+
+	for _, tt := range tests {
+		unavailable := testutil.Step{Status: http.StatusServiceUnavailable}
+		recorder := testutil.NewAttemptRecorder(testutil.NewFaultTransport(unavailable, unavailable))
+		transport := NewRoundTripper(WithTransport(recorder), WithRetryWait(time.Millisecond, time.Millisecond))
+
+		req, _ := http.NewRequest(http.MethodPost, "http://upstream.example/items", strings.NewReader(tt.body))
+		if !tt.getBody {
+			req.Body, req.GetBody = ioutil.NopCloser(strings.NewReader(tt.body)), nil
+		}
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+
+		attempts := recorder.Attempts()
+		if len(attempts) != 3 || string(attempts[2].Body) != tt.body {
+			t.Errorf("%s: Expected %d attempts sending the body, got %d", tt.name, 3, len(attempts))
+		}
+		recorder.AssertIdenticalBodies(t)
+	}
+}
+
+func TestReplayBody_TooLarge(t *testing.T) {
+	unavailable := testutil.Step{Status: http.StatusServiceUnavailable}
+	fault := testutil.NewFaultTransport(unavailable, unavailable)
+	transport := NewRoundTripper(WithTransport(fault), WithRetryWait(time.Millisecond, time.Millisecond))
+
+	// the body is sent whole, once
+	body := strings.Repeat("x", maxReplayBytes+1)
+	req, _ := http.NewRequest(http.MethodPost, "http://upstream.example/upload", ioutil.NopCloser(strings.NewReader(body)))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	requests := fault.Requests()
+	if len(requests) != 1 || len(requests[0].Body) != len(body) {
+		t.Errorf("Expected a single attempt with the whole body, got %d", len(requests))
+	}
+}
+
+func TestReplayBuffer_Recycle(t *testing.T) {
+	buffer, complete, err := readReplayBuffer(strings.NewReader("payload"), -1)
+	if err != nil || !complete {
+		t.Fatalf("Expected the body to be buffered, got %v", err)
+	}
+	r, _ := buffer.reader()
+
+	// the buffer is kept while it's read
+	buffer.release()
+	if data, _ := ioutil.ReadAll(r); string(data) != "payload" {
+		t.Errorf("Expected %q, got %q", "payload", data)
+	}
+	_ = r.Close()
+	if buffer.buf != nil {
+		t.Errorf("Expected the buffer to be back in the pool")
+	}
+
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, errReplayClosed) {
+		t.Errorf("Expected %v, got %v", errReplayClosed, err)
+	}
+	if _, err := buffer.reader(); !errors.Is(err, errBodyNotReplayable) {
+		t.Errorf("Expected %v, got %v", errBodyNotReplayable, err)
+	}
+}
+
+func TestReadReplayBuffer_Error(t *testing.T) {
+	errRead := errors.New("read failed")
+	_, _, err := readReplayBuffer(io.MultiReader(strings.NewReader("start"), &failingReader{errRead}), 0)
+	if !errors.Is(err, errRead) {
+		t.Errorf("Expected %v, got %v", errRead, err)
+	}
+}
+
+// failingReader fails every read
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
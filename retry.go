@@ -3,19 +3,30 @@ package gcb
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 )
 
 var (
+	// makes sure the rate limiters can limit the retries
+	_ Limiter = (*rate.Limiter)(nil)
+
 	errMaxRetriesReached = errors.New("exceeded retry limit")
 
 	// Default retry configuration
 	defaultRetryWaitMin = 1 * time.Second
 	defaultRetryWaitMax = 30 * time.Second
 	defaultRetryMax     = uint32(4)
+
+	// timerPool recycles the timers of the backoff waits
+	timerPool sync.Pool
 )
 
 type (
@@ -29,6 +40,11 @@ type (
 	// response body before returning.
 	CheckRetry func(ctx context.Context, resp *http.Response, err error) (bool, error)
 
+	// Limiter tells whether an event may happen now, *rate.Limiter is one
+	Limiter interface {
+		Allow() bool
+	}
+
 	// Retrier
 	Retrier struct {
 		// Backoff specifies the policy for how long to wait between shouldRetry
@@ -42,8 +58,53 @@ type (
 		// after each request. The default policy is DefaultRetryPolicy.
 		CheckRetry CheckRetry
 
-		// Limiter specifies the policy that controls the request rate.
-		Limiter *rate.Limiter
+		// Limiter limits the rate of the retries. It's only asked about the
+		// outcomes CheckRetry retries, the first attempts and the outcomes
+		// kept never spend it. The retries aren't limited when nil.
+		Limiter Limiter
+
+		// ClassifyBody, if set, retries the responses CheckRetry doesn't
+		// depending on their body, see WithBodyClassifier
+		ClassifyBody BodyClassifier
+
+		// Classifier, if set, classifies the outcomes ahead of CheckRetry,
+		// see WithErrorClassifier
+		Classifier *ErrorClassifier
+
+		// OnSuccess and OnFailure, if set, are called with the outcome of
+		// the retry loop, see WithOnSuccess and WithOnFailure
+		OnSuccess RetryHook
+		OnFailure RetryHook
+
+		// OnRetry, if set, is called before the wait of every retry, see
+		// WithOnRetry. BackoffName is the name of Backoff it reports, set
+		// along with Backoff.
+		OnRetry     RetryListener
+		BackoffName string
+
+		// retryAfterHints waits as long as the Retry-After of the responses
+		// asks, see WithRetryAfterHints
+		retryAfterHints bool
+		// retryThrottled retries the 429 responses, waiting as long as
+		// their Retry-After asks, see WithThrottlingDetection
+		retryThrottled bool
+
+		// windows override the policy on a schedule
+		windows []*window
+
+		// lastErrorOnly leaves the previous attempts out of the exhaustion
+		// errors
+		lastErrorOnly bool
+
+		// clock tells the time and waits between the attempts
+		clock Clock
+
+		// rnd is the source of the jittered backoffs, guarded by rndMu
+		rnd   *rand.Rand
+		rndMu sync.Mutex
+
+		// mu guards RetryMax against reloads
+		mu sync.RWMutex
 	}
 )
 
@@ -60,25 +121,284 @@ func NewRetrier(opts ...Option) *Retrier {
 		opt(config)
 	}
 
-	return &Retrier{
+	src := config.randSource
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+	// the waits are precomputed for the most retries of the policies
+	tableRetries := config.maxRetries
+	for _, w := range config.windows {
+		if w.MaxRetries > tableRetries {
+			tableRetries = w.MaxRetries
+		}
+	}
+
+	r := &Retrier{
 		RetryMax:     config.maxRetries,
 		RetryWaitMin: config.minWait,
 		RetryWaitMax: config.maxWait,
 
 		CheckRetry: DefaultRetryPolicy,
-		Backoff:    DefaultBackoff,
+		Backoff:    newBackoffTable(config.minWait, config.maxWait, tableRetries).backoff,
 		Limiter:    rate.NewLimiter(rate.Every(5*time.Millisecond), 200),
+
+		windows: newWindows(config.windows),
+
+		ClassifyBody: config.bodyClassifier,
+		Classifier:   config.errorClassifier,
+		OnSuccess:    config.onRetrySuccess,
+		OnFailure:    config.onRetryFailure,
+		OnRetry:      config.onRetry,
+		BackoffName:  "gcb.DefaultBackoff",
+
+		retryAfterHints: config.retryAfterHints,
+		retryThrottled:  len(config.throttlingCodes) > 0,
+
+		lastErrorOnly: config.lastErrorOnly,
+		clock:         clockOf(config),
+		rnd:           rand.New(src),
+	}
+	if config.jitterBackoff != nil {
+		r.Backoff = r.jittered(config.jitterBackoff)
+		r.BackoffName = funcName(config.jitterBackoff)
+	}
+	if config.noRateLimit {
+		r.Limiter = nil
+	}
+	return r
+}
+
+// jittered binds the jittered backoff to the source of the retrier
+func (r *Retrier) jittered(backoff JitterBackoff) Backoff {
+	return func(min, max time.Duration, attemptNum uint32, resp *http.Response) time.Duration {
+		r.rndMu.Lock()
+		defer r.rndMu.Unlock()
+
+		return backoff(min, max, attemptNum, resp, r.rnd)
+	}
+}
+
+// WithOpenOnRetryAfter opens the breaker of the request key as soon as the
+// upstream answers 503 with a Retry-After header, for exactly the advertised
+// duration, instead of waiting for enough failures to trip it.
+func WithOpenOnRetryAfter() Option {
+	return func(config *Config) {
+		config.openOnRetryAfter = true
+	}
+}
+
+// WithRetryAfterHints has the retries of the responses with a Retry-After
+// header wait as long as the header asks instead of the backoff, up to the
+// maximum wait of WithRetryWait.
+func WithRetryAfterHints() Option {
+	return func(config *Config) {
+		config.retryAfterHints = true
+	}
+}
+
+// wait returns the wait before retrying the attempt, the wait of the backoff
+// and whether the Retry-After of the response overrode it
+func (r *Retrier) wait(attempt uint32, resp *http.Response) (wait, backoff time.Duration, hinted bool) {
+	backoff = r.Backoff(r.RetryWaitMin, r.RetryWaitMax, attempt, resp)
+	if resp != nil && (r.retryAfterHints || r.retryThrottled && resp.StatusCode == http.StatusTooManyRequests) {
+		if hint, ok := parseRetryAfter(resp, r.now()); ok {
+			if hint > r.RetryWaitMax {
+				hint = r.RetryWaitMax
+			}
+			return hint, backoff, true
+		}
+	}
+	return backoff, backoff, false
+}
+
+// parseRetryAfter reads the Retry-After header of the response, either in
+// seconds or as an HTTP date.
+func parseRetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		// beyond the range of a duration, the header makes no sense
+		if seconds < 0 || int64(seconds) > math.MaxInt64/int64(time.Second) {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// policy returns the maximum number of retries and the limiter in effect at t
+func (r *Retrier) policy(t time.Time) (uint32, Limiter) {
+	w := r.activeWindow(t)
+	if w == nil {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.RetryMax, r.Limiter
+	}
+	if w.Limit == 0 {
+		return w.MaxRetries, r.Limiter
 	}
+	return w.MaxRetries, w.limiter
 }
 
 func (r *Retrier) retryPolicy(ctx context.Context, res *http.Response, err error) (bool, error) {
-	// rate limiter allowance
-	if !r.Limiter.Allow() {
-		return false, rateLimitExceeded
+	shouldRetry, checkErr := r.checkRetry(ctx, res, err)
+	if !shouldRetry && err == nil && checkErr == nil && r.ClassifyBody != nil {
+		shouldRetry = retryableBody(res, r.ClassifyBody)
+	}
+	if !shouldRetry {
+		return false, checkErr
+	}
+
+	// rate limiter allowance, only spent on the outcomes to retry
+	_, limiter := r.policy(r.now())
+	if limiter != nil && !limiter.Allow() {
+		return false, &RateLimitedError{Err: err}
+	}
+	return true, checkErr
+}
+
+// checkRetry retries the outcomes classified as failures or throttles, and
+// the 429 responses with the throttling detection, the others are left to
+// CheckRetry. A done context is never retried.
+func (r *Retrier) checkRetry(ctx context.Context, res *http.Response, err error) (bool, error) {
+	if ctx.Err() == nil {
+		if class, ok := classify(r.Classifier, res, err); ok {
+			return class.retried(), nil
+		}
+		if r.retryThrottled && err == nil && res != nil && res.StatusCode == http.StatusTooManyRequests {
+			return true, nil
+		}
 	}
 	return r.CheckRetry(ctx, res, err)
 }
 
+// ShouldRetry tells whether a request must be retried after the given
+// outcome, applying the rate limit and CheckRetry of the policy in effect.
+// It lets other clients than the round tripper follow the same policy.
+func (r *Retrier) ShouldRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	return r.retryPolicy(ctx, resp, err)
+}
+
+// MaxRetries returns the maximum number of retries in effect now, which
+// follows the schedule windows
+func (r *Retrier) MaxRetries() uint32 {
+	retryMax, _ := r.policy(r.now())
+	return retryMax
+}
+
+// RateLimit returns the rate limit of the retries, false when the limiter
+// isn't a *rate.Limiter
+func (t *tripper) RateLimit() (rate.Limit, int, bool) {
+	r := t.RoundTripper.(*circuit).retrier
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	limiter, ok := r.Limiter.(*rate.Limiter)
+	if !ok {
+		return 0, 0, false
+	}
+	return limiter.Limit(), limiter.Burst(), true
+}
+
+// SetRateLimit adjusts the rate limit of the retries, false when the
+// limiter isn't a *rate.Limiter
+func (t *tripper) SetRateLimit(limit rate.Limit, burst int) bool {
+	r := t.RoundTripper.(*circuit).retrier
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	limiter, ok := r.Limiter.(*rate.Limiter)
+	if !ok {
+		return false
+	}
+	now := r.now()
+	limiter.SetLimitAt(now, limit)
+	limiter.SetBurstAt(now, burst)
+	t.audit("ratelimit", "", fmt.Sprintf("limit=%g burst=%d", float64(limit), burst))
+	return true
+}
+
+// now returns the time of the retrier clock
+func (r *Retrier) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
+// Wait waits d on the retrier clock, or until the context is done. On the
+// system clock it waits on a pooled timer, stopped when the context is done
+// first.
+func (r *Retrier) Wait(ctx context.Context, d time.Duration) error {
+	return r.sleep(ctx, d, nil)
+}
+
+// sleep is Wait, cut short with ErrShuttingDown once stop is closed
+func (r *Retrier) sleep(ctx context.Context, d time.Duration, stop <-chan struct{}) error {
+	if _, system := r.clock.(systemClock); r.clock != nil && !system {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stop:
+			return ErrShuttingDown
+		case <-r.clock.After(d):
+			return nil
+		}
+	}
+
+	timer := getTimer(d)
+	defer putTimer(timer)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stop:
+		return ErrShuttingDown
+	case <-timer.C:
+		return nil
+	}
+}
+
+// getTimer returns a pooled timer firing after d
+func getTimer(d time.Duration) *time.Timer {
+	if timer, ok := timerPool.Get().(*time.Timer); ok {
+		timer.Reset(d)
+		return timer
+	}
+	return time.NewTimer(d)
+}
+
+// putTimer stops and drains the timer before pooling it, so its next user
+// doesn't receive a stale tick
+func putTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timerPool.Put(timer)
+}
+
+// failures returns the list the failed attempts are collected in, nil when
+// only the last one is reported
+func (r *Retrier) failures() []AttemptError {
+	if r.lastErrorOnly {
+		return nil
+	}
+	return []AttemptError{}
+}
+
 // DefaultRetryPolicy provides a default callback for Client.CheckRetry, which
 // will retry on connection errors and server errors.
 func DefaultRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
@@ -0,0 +1,561 @@
+// Package retryablehttp is a drop-in replacement for the client of
+// hashicorp/go-retryablehttp, with a gcb breaker in front of the retries.
+// Migrating is a matter of changing the import path:
+//
+//	client := retryablehttp.NewClient()
+//	client.RetryMax = 3
+//	resp, err := client.Get("https://api.example.com/items")
+//
+// Every call goes through the Breaker of the client, its retries included:
+// a call failing after its retries is one failure of the breaker, and calls
+// made while it's open fail right away with gcb.ErrOpenState.
+package retryablehttp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+var (
+	// Default retry configuration
+	defaultRetryWaitMin = 1 * time.Second
+	defaultRetryWaitMax = 30 * time.Second
+	defaultRetryMax     = 4
+
+	// defaultLogger is the logger of the new clients
+	defaultLogger = log.New(os.Stderr, "", log.LstdFlags)
+
+	// We need to consume response bodies to maintain http connections, but
+	// limit the size we consume to respReadLimit.
+	respReadLimit = int64(4096)
+)
+
+type (
+	// ReaderFunc is the type of function that can be given natively to
+	// NewRequest
+	ReaderFunc func() (io.Reader, error)
+
+	// Request wraps the metadata needed to create HTTP requests
+	Request struct {
+		// body is a seekable reader over the request body payload, used to
+		// rewind the request data in between retries
+		body ReaderFunc
+
+		// Embed an HTTP request directly. This makes a *Request act exactly
+		// like an *http.Request so that all meta methods are supported.
+		*http.Request
+	}
+
+	// Logger interface allows to use other loggers than the standard log.Logger
+	Logger interface {
+		Printf(string, ...interface{})
+	}
+
+	// LeveledLogger is an interface that can be implemented by any logger or
+	// a logger wrapper to provide leveled logging. The methods accept a
+	// message string and a variadic number of key-value pairs.
+	LeveledLogger interface {
+		Error(msg string, keysAndValues ...interface{})
+		Info(msg string, keysAndValues ...interface{})
+		Debug(msg string, keysAndValues ...interface{})
+		Warn(msg string, keysAndValues ...interface{})
+	}
+
+	// RequestLogHook allows a function to run before each retry. The HTTP
+	// request which will be made, and the retry number (0 for the initial
+	// request) are available to users.
+	RequestLogHook func(Logger, *http.Request, int)
+
+	// ResponseLogHook is like RequestLogHook, but allows running a function
+	// on each HTTP response. The response body must not be consumed.
+	ResponseLogHook func(Logger, *http.Response)
+
+	// CheckRetry specifies a policy for handling retries, see gcb.CheckRetry
+	CheckRetry = gcb.CheckRetry
+
+	// Backoff specifies a policy for how long to wait between retries
+	Backoff func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration
+
+	// ErrorHandler is called if retries are expired, containing the last
+	// status from the http library. If not specified, default behavior for
+	// the library is to close the body and return an error indicating how
+	// many tries were attempted.
+	ErrorHandler func(resp *http.Response, err error, numTries int) (*http.Response, error)
+
+	// Client is used to make HTTP requests. It adds additional functionality
+	// like automatic retries to tolerate minor outages, and circuit breaking.
+	Client struct {
+		HTTPClient *http.Client // Internal HTTP client.
+		Logger     interface{}  // Customer logger instance. Can be either Logger or LeveledLogger
+
+		RetryWaitMin time.Duration // Minimum time to wait
+		RetryWaitMax time.Duration // Maximum time to wait
+		RetryMax     int           // Maximum number of retries
+
+		// RequestLogHook allows a user-supplied function to be called
+		// before each retry.
+		RequestLogHook RequestLogHook
+
+		// ResponseLogHook allows a user-supplied function to be called
+		// with the response from each HTTP request executed.
+		ResponseLogHook ResponseLogHook
+
+		// CheckRetry specifies the policy for handling retries, and is called
+		// after each request. The default policy is DefaultRetryPolicy.
+		CheckRetry CheckRetry
+
+		// Backoff specifies the policy for how long to wait between retries
+		Backoff Backoff
+
+		// ErrorHandler specifies the custom error handler to use, if any
+		ErrorHandler ErrorHandler
+
+		// Breaker guards the calls, retries included
+		Breaker *gcb.Breaker
+
+		loggerInit sync.Once
+	}
+
+	// RoundTripper implements the http.RoundTripper interface, using a
+	// retrying HTTP client to execute requests
+	RoundTripper struct {
+		// The client to use during requests. If nil, the default
+		// retryablehttp client and settings will be used.
+		Client *Client
+
+		// once ensures that the logic to initialize the default client runs
+		// at most once, in a single thread.
+		once sync.Once
+	}
+)
+
+// NewClient creates a new Client with default settings
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:   &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+		Logger:       defaultLogger,
+		RetryWaitMin: defaultRetryWaitMin,
+		RetryWaitMax: defaultRetryWaitMax,
+		RetryMax:     defaultRetryMax,
+		CheckRetry:   DefaultRetryPolicy,
+		Backoff:      DefaultBackoff,
+		Breaker:      gcb.NewBreaker(),
+	}
+}
+
+// DefaultRetryPolicy retries on connection errors and server errors, see
+// gcb.DefaultRetryPolicy
+func DefaultRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	return gcb.DefaultRetryPolicy(ctx, resp, err)
+}
+
+// DefaultBackoff provides a default callback for Client.Backoff which will
+// perform exponential backoff based on the attempt number and limited by
+// the provided minimum and maximum durations. It honours the Retry-After
+// header of the 429 and 503 responses.
+func DefaultBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Second * time.Duration(seconds)
+		}
+	}
+
+	mult := math.Pow(2, float64(attemptNum)) * float64(min)
+	sleep := time.Duration(mult)
+	if float64(sleep) != mult || sleep > max {
+		sleep = max
+	}
+	return sleep
+}
+
+// LinearJitterBackoff waits a random time between min and max times the
+// attempt number
+func LinearJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	// attemptNum always starts at zero but we want to start at 1 for multiplication
+	attemptNum++
+
+	if max <= min {
+		return min * time.Duration(attemptNum)
+	}
+
+	jitter := rand.Float64() * float64(max-min)
+	jitterMin := int64(jitter) + int64(min)
+	return time.Duration(jitterMin * int64(attemptNum))
+}
+
+// PassthroughErrorHandler is an ErrorHandler that directly passes through
+// the values from the net/http library for the final request
+func PassthroughErrorHandler(resp *http.Response, err error, _ int) (*http.Response, error) {
+	return resp, err
+}
+
+// NewRequest creates a new wrapped request. The body can be nil, a []byte,
+// a string, a *bytes.Buffer, a *bytes.Reader, a ReaderFunc, a
+// func() (io.Reader, error) or any io.Reader, which is read in memory to be
+// replayed on retries.
+func NewRequest(method, url string, rawBody interface{}) (*Request, error) {
+	bodyReader, contentLength, err := getBodyReaderAndContentLength(rawBody)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.ContentLength = contentLength
+
+	return &Request{body: bodyReader, Request: httpReq}, nil
+}
+
+// FromRequest wraps an http.Request in a retryablehttp.Request
+func FromRequest(r *http.Request) (*Request, error) {
+	var rawBody interface{}
+	if r.Body != nil && r.Body != http.NoBody {
+		rawBody = r.Body
+	}
+	bodyReader, _, err := getBodyReaderAndContentLength(rawBody)
+	if err != nil {
+		return nil, err
+	}
+	// Could assert contentLength == r.ContentLength
+	return &Request{body: bodyReader, Request: r}, nil
+}
+
+// WithContext returns wrapped Request with a shallow copy of underlying
+// *http.Request with its context changed to ctx
+func (r *Request) WithContext(ctx context.Context) *Request {
+	return &Request{body: r.body, Request: r.Request.WithContext(ctx)}
+}
+
+// BodyBytes allows accessing the request body. It is an analogue to
+// http.Request's Body variable, but it returns a copy of the underlying data
+// rather than consuming it.
+func (r *Request) BodyBytes() ([]byte, error) {
+	if r.body == nil {
+		return nil, nil
+	}
+	body, err := r.body()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(body)
+}
+
+func getBodyReaderAndContentLength(rawBody interface{}) (ReaderFunc, int64, error) {
+	var buf []byte
+	switch body := rawBody.(type) {
+	case nil:
+		return nil, 0, nil
+	case ReaderFunc:
+		return body, 0, nil
+	case func() (io.Reader, error):
+		return body, 0, nil
+	case []byte:
+		buf = body
+	case string:
+		buf = []byte(body)
+	case *bytes.Buffer:
+		buf = body.Bytes()
+	case *bytes.Reader:
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		buf = data
+	case io.Reader:
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		buf = data
+	default:
+		return nil, 0, fmt.Errorf("cannot handle type %T", rawBody)
+	}
+
+	return func() (io.Reader, error) {
+		return bytes.NewReader(buf), nil
+	}, int64(len(buf)), nil
+}
+
+func (c *Client) logger() interface{} {
+	c.loggerInit.Do(func() {
+		if c.Logger == nil {
+			return
+		}
+
+		switch c.Logger.(type) {
+		case Logger, LeveledLogger:
+			// ok
+		default:
+			// This should happen in dev when they are setting Logger and work on code, not in prod.
+			panic(fmt.Sprintf("invalid logger type passed, must be Logger or LeveledLogger, was %T", c.Logger))
+		}
+	})
+
+	return c.Logger
+}
+
+// Do wraps calling an HTTP method with retries, through the breaker
+func (c *Client) Do(req *Request) (*http.Response, error) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+	}
+
+	if c.Breaker == nil {
+		return c.do(req)
+	}
+
+	var resp *http.Response
+	var doErr error
+	_, err := c.Breaker.Execute(func() (*http.Response, error) {
+		resp, doErr = c.do(req)
+		return nil, doErr
+	})
+	if doErr == nil && err != nil {
+		// the breaker rejected the call
+		return nil, err
+	}
+	return resp, doErr
+}
+
+func (c *Client) do(req *Request) (*http.Response, error) {
+	logger := c.logger()
+
+	if logger != nil {
+		switch v := logger.(type) {
+		case Logger:
+			v.Printf("[DEBUG] %s %s", req.Method, req.URL)
+		case LeveledLogger:
+			v.Debug("performing request", "method", req.Method, "url", req.URL)
+		}
+	}
+
+	var resp *http.Response
+	var attempt int
+	var shouldRetry bool
+	var doErr, checkErr error
+
+	for i := 0; ; i++ {
+		attempt++
+
+		// Always rewind the request body when non-nil.
+		if req.body != nil {
+			body, err := req.body()
+			if err != nil {
+				c.HTTPClient.CloseIdleConnections()
+				return resp, err
+			}
+			if rc, ok := body.(io.ReadCloser); ok {
+				req.Body = rc
+			} else {
+				req.Body = ioutil.NopCloser(body)
+			}
+		}
+
+		if c.RequestLogHook != nil {
+			switch v := logger.(type) {
+			case LeveledLogger:
+				c.RequestLogHook(hookLogger{v}, req.Request, i)
+			case Logger:
+				c.RequestLogHook(v, req.Request, i)
+			default:
+				c.RequestLogHook(nil, req.Request, i)
+			}
+		}
+
+		// Attempt the request
+		resp, doErr = c.HTTPClient.Do(req.Request)
+
+		// Check if we should continue with retries.
+		shouldRetry, checkErr = c.CheckRetry(req.Context(), resp, doErr)
+
+		if doErr != nil {
+			switch v := logger.(type) {
+			case LeveledLogger:
+				v.Error("request failed", "error", doErr, "method", req.Method, "url", req.URL)
+			case Logger:
+				v.Printf("[ERR] %s %s request failed: %v", req.Method, req.URL, doErr)
+			}
+		} else if c.ResponseLogHook != nil {
+			// Call the response logger function if provided.
+			switch v := logger.(type) {
+			case LeveledLogger:
+				c.ResponseLogHook(hookLogger{v}, resp)
+			case Logger:
+				c.ResponseLogHook(v, resp)
+			default:
+				c.ResponseLogHook(nil, resp)
+			}
+		}
+
+		if !shouldRetry {
+			break
+		}
+
+		// We do this before drainBody because there's no need for the I/O if
+		// we're breaking out
+		remain := c.RetryMax - i
+		if remain <= 0 {
+			break
+		}
+
+		// We're going to retry, consume any response to reuse the connection.
+		if doErr == nil {
+			c.drainBody(resp.Body)
+		}
+
+		wait := c.Backoff(c.RetryWaitMin, c.RetryWaitMax, i, resp)
+		if logger != nil {
+			desc := fmt.Sprintf("%s %s", req.Method, req.URL)
+			if resp != nil {
+				desc = fmt.Sprintf("%s (status: %d)", desc, resp.StatusCode)
+			}
+			switch v := logger.(type) {
+			case LeveledLogger:
+				v.Debug("retrying request", "request", desc, "timeout", wait, "remaining", remain)
+			case Logger:
+				v.Printf("[DEBUG] %s: retrying in %s (%d left)", desc, wait, remain)
+			}
+		}
+		select {
+		case <-req.Context().Done():
+			c.HTTPClient.CloseIdleConnections()
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+
+	// this is the closest we have to success criteria
+	if doErr == nil && checkErr == nil && !shouldRetry {
+		return resp, nil
+	}
+
+	err := doErr
+	if checkErr != nil {
+		err = checkErr
+	}
+
+	if c.ErrorHandler != nil {
+		return c.ErrorHandler(resp, err, attempt)
+	}
+
+	// By default, we close the response body and return an error without
+	// returning the response
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	// this means CheckRetry thought the request was a failure, but didn't
+	// communicate why
+	if err == nil {
+		return nil, fmt.Errorf("%s %s giving up after %d attempt(s)",
+			req.Method, req.URL, attempt)
+	}
+
+	return nil, fmt.Errorf("%s %s giving up after %d attempt(s): %w",
+		req.Method, req.URL, attempt, err)
+}
+
+// Try to read the response body so we can reuse this connection.
+func (c *Client) drainBody(body io.ReadCloser) {
+	defer body.Close()
+	_, err := io.Copy(ioutil.Discard, io.LimitReader(body, respReadLimit))
+	if err != nil {
+		if c.logger() != nil {
+			switch v := c.logger().(type) {
+			case LeveledLogger:
+				v.Error("error reading response body", "error", err)
+			case Logger:
+				v.Printf("[ERR] error reading response body: %v", err)
+			}
+		}
+	}
+}
+
+// Get is a shortcut for doing a GET request without making a new client.
+func (c *Client) Get(url string) (*http.Response, error) {
+	req, err := NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Head is a shortcut for doing a HEAD request without making a new client.
+func (c *Client) Head(url string) (*http.Response, error) {
+	req, err := NewRequest("HEAD", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Post is a convenience method for doing simple POST requests.
+func (c *Client) Post(url, bodyType string, body interface{}) (*http.Response, error) {
+	req, err := NewRequest("POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", bodyType)
+	return c.Do(req)
+}
+
+// PostForm is a convenience method for doing simple POST operations using
+// pre-filled url.Values form data.
+func (c *Client) PostForm(url string, data url.Values) (*http.Response, error) {
+	return c.Post(url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+// StandardClient returns a stdlib *http.Client with a custom Transport,
+// which shims in a *retryablehttp.Client for added retries.
+func (c *Client) StandardClient() *http.Client {
+	return &http.Client{
+		Transport: &RoundTripper{Client: c},
+	}
+}
+
+// RoundTrip satisfies the http.RoundTripper interface
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.once.Do(rt.init)
+
+	// Convert the request to be retryable.
+	retryableReq, err := FromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute the request.
+	return rt.Client.Do(retryableReq)
+}
+
+func (rt *RoundTripper) init() {
+	if rt.Client == nil {
+		rt.Client = NewClient()
+	}
+}
+
+// hookLogger adapts an LeveledLogger to Logger for use by the existing hook
+// functions without changing the API.
+type hookLogger struct {
+	LeveledLogger
+}
+
+func (h hookLogger) Printf(s string, args ...interface{}) {
+	h.Info(fmt.Sprintf(s, args...))
+}
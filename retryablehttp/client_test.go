@@ -0,0 +1,86 @@
+package retryablehttp
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestClient_Do(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("Expected the body to be replayed, got %q", body)
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.Logger = nil
+	client.RetryWaitMin, client.RetryWaitMax = time.Millisecond, time.Millisecond
+
+	resp, err := client.Post(server.URL, "text/plain", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated || calls != 3 {
+		t.Errorf("Expected %d after 3 calls, got %d after %d", http.StatusCreated, resp.StatusCode, calls)
+	}
+}
+
+func TestClient_StandardClientBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.Logger = nil
+	client.RetryMax = 1
+	client.RetryWaitMin, client.RetryWaitMax = time.Millisecond, time.Millisecond
+	client.Breaker = gcb.NewBreaker(gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return true }))
+
+	standard := client.StandardClient()
+	if _, err := standard.Get(server.URL); err == nil {
+		t.Error("Expected the retries to run out")
+	}
+	if _, err := standard.Get(server.URL); !errors.Is(err, gcb.ErrOpenState) {
+		t.Errorf("Expected %v, got %v", gcb.ErrOpenState, err)
+	}
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	server := testutil.NewRateLimitServer(testutil.RateLimit{
+		Limited:    1,
+		Status:     http.StatusServiceUnavailable,
+		RetryAfter: time.Second,
+	})
+	defer server.Close()
+
+	client := NewClient()
+	client.Logger = nil
+	client.RetryWaitMin, client.RetryWaitMax = time.Millisecond, time.Millisecond
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || server.Count() != 2 {
+		t.Errorf("Expected %d after 2 calls, got %d after %d", http.StatusOK, resp.StatusCode, server.Count())
+	}
+	server.AssertWaited(t)
+}
@@ -0,0 +1,127 @@
+package gcb
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+type (
+	// AttemptStats describe the attempts the retry loop made for a request
+	AttemptStats struct {
+		// Attempts is the number of attempts made, the first one included
+		Attempts uint32
+		// Elapsed is the time from the first attempt to the outcome
+		Elapsed time.Duration
+		// Waited is the time spent in the backoffs between the attempts
+		Waited time.Duration
+		// Conns are the connection traces of the attempts, see
+		// WithConnTrace
+		Conns []ConnTrace
+	}
+
+	// RetryHook is called with the outcome of the retry loop for a request:
+	// the response or the error returned, and the attempts it took
+	RetryHook func(req *http.Request, resp *http.Response, err error, stats AttemptStats)
+
+	// RetryInfo describes a retry about to be made and why it waits as long
+	// as it does
+	RetryInfo struct {
+		// Attempt is the attempt retried, from 1
+		Attempt uint32
+		// StatusCode is the status of the response retried, 0 for an error
+		StatusCode int
+		Err        error
+		// Wait is the time waited before the retry, the wait chosen by the
+		// backoff unless the Retry-After of the response overrode it
+		Wait time.Duration
+		// Backoff is the wait chosen by the backoff named Strategy
+		Backoff  time.Duration
+		Strategy string
+		// ServerHint tells the Retry-After of the response set the wait,
+		// see WithRetryAfterHints and WithThrottlingDetection
+		ServerHint bool
+		// Conn is the connection trace of the attempt, see WithConnTrace
+		Conn ConnTrace
+	}
+
+	// RetryListener is called before the wait of every retry
+	RetryListener func(req *http.Request, info RetryInfo)
+)
+
+// WithOnSuccess calls fn when the retry loop ends with a response which
+// isn't retried, after however many attempts, e.g. to record the attempts
+// it takes to succeed. Unlike the breaker listeners, it sees every request
+// the retry loop runs, not the state changes.
+func WithOnSuccess(fn RetryHook) Option {
+	return func(config *Config) {
+		config.onRetrySuccess = fn
+	}
+}
+
+// WithOnFailure calls fn when the retry loop ends with an error: the
+// retries exhausted, refused by the rate limit or cut short by the context.
+// The rejections of the breaker happen before the retry loop and aren't
+// seen.
+func WithOnFailure(fn RetryHook) Option {
+	return func(config *Config) {
+		config.onRetryFailure = fn
+	}
+}
+
+// WithOnRetry calls fn before the wait of every retry, with the wait, the
+// backoff it came from and whether the upstream asked for it, e.g. to see
+// why a request took as long as it did while tuning the backoff.
+func WithOnRetry(fn RetryListener) Option {
+	return func(config *Config) {
+		config.onRetry = fn
+	}
+}
+
+func newRetryInfo(attempt uint32, resp *http.Response, err error, wait, backoff time.Duration, hinted bool, strategy string) RetryInfo {
+	info := RetryInfo{
+		Attempt:    attempt + 1,
+		Err:        err,
+		Wait:       wait,
+		Backoff:    backoff,
+		Strategy:   strategy,
+		ServerHint: hinted,
+	}
+	if resp != nil {
+		info.StatusCode = resp.StatusCode
+	}
+	return info
+}
+
+// funcName returns the name of the function without its package path, e.g.
+// gcb.ExponentialJitter
+func funcName(fn interface{}) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return ""
+	}
+	name := f.Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// retry runs the retry loop, cb is the breaker guarding the request if any
+func (c *circuit) retry(req *http.Request, cb *Breaker) (*http.Response, error) {
+	var stats AttemptStats
+	r := c.retrier
+	if r.OnSuccess == nil && r.OnFailure == nil {
+		return c.retryAttempts(req, cb, &stats)
+	}
+
+	start := r.now()
+	resp, err := c.retryAttempts(req, cb, &stats)
+	stats.Elapsed = r.now().Sub(start)
+	if err == nil && r.OnSuccess != nil {
+		r.OnSuccess(req, resp, nil, stats)
+	}
+	if err != nil && r.OnFailure != nil {
+		r.OnFailure(req, resp, err, stats)
+	}
+	return resp, err
+}
@@ -0,0 +1,125 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetrier_Hooks(t *testing.T) {
+	refused := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		outcomes []int
+		success  bool
+		status   int
+		attempts uint32
+	}{
+		{"first attempt", []int{http.StatusNotFound}, true, http.StatusNotFound, 1},
+		{"after retries", []int{http.StatusBadGateway, 0, http.StatusOK}, true, http.StatusOK, 3},
+		{"exhausted", []int{0, 0, 0}, false, 0, 3},
+		{"exhausted on status", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, false, http.StatusBadGateway, 3},
+	}
+
+	for _, tt := range tests {
+		type call struct {
+			success bool
+			resp    *http.Response
+			err     error
+			stats   AttemptStats
+		}
+		var calls []call
+		outcomes := tt.outcomes
+		transport := NewRoundTripper(
+			WithMaxRetries(2),
+			WithRetryWait(time.Millisecond, time.Millisecond),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+			WithOnSuccess(func(req *http.Request, resp *http.Response, err error, stats AttemptStats) {
+				calls = append(calls, call{true, resp, err, stats})
+			}),
+			WithOnFailure(func(req *http.Request, resp *http.Response, err error, stats AttemptStats) {
+				calls = append(calls, call{false, resp, err, stats})
+			}),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				status := outcomes[0]
+				outcomes = outcomes[1:]
+				if status == 0 {
+					return nil, refused
+				}
+				return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+			})),
+		)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		_, _ = transport.RoundTrip(req)
+
+		if len(calls) != 1 {
+			t.Errorf("%s: Expected a single call, got %d", tt.name, len(calls))
+			continue
+		}
+		got := calls[0]
+		if got.success != tt.success || (got.err == nil) != tt.success {
+			t.Errorf("%s: Expected success %v, got %v with %v", tt.name, tt.success, got.success, got.err)
+		}
+		var status int
+		if got.resp != nil {
+			status = got.resp.StatusCode
+		}
+		if status != tt.status {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.status, status)
+		}
+		if got.stats.Attempts != tt.attempts {
+			t.Errorf("%s: Expected %d attempts, got %d", tt.name, tt.attempts, got.stats.Attempts)
+		}
+		waited := time.Duration(tt.attempts-1) * time.Millisecond
+		if got.stats.Waited != waited || got.stats.Elapsed < waited {
+			t.Errorf("%s: Expected %s waited, got %+v", tt.name, waited, got.stats)
+		}
+	}
+}
+
+func TestWithOnRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		opts       []Option
+		expected   RetryInfo
+	}{
+		{"backoff", "0", nil, RetryInfo{1, http.StatusServiceUnavailable, nil, time.Millisecond, time.Millisecond, "gcb.DefaultBackoff", false, ConnTrace{}}},
+		{"no hint", "", []Option{WithRetryAfterHints()}, RetryInfo{1, http.StatusServiceUnavailable, nil, time.Millisecond, time.Millisecond, "gcb.DefaultBackoff", false, ConnTrace{}}},
+		{"server hint", "0", []Option{WithRetryAfterHints()}, RetryInfo{1, http.StatusServiceUnavailable, nil, 0, time.Millisecond, "gcb.DefaultBackoff", true, ConnTrace{}}},
+		{"capped hint", "60", []Option{WithRetryAfterHints()}, RetryInfo{1, http.StatusServiceUnavailable, nil, 4 * time.Millisecond, time.Millisecond, "gcb.DefaultBackoff", true, ConnTrace{}}},
+		{"jitter", "", []Option{WithJitterBackoff(ExponentialJitter)}, RetryInfo{1, http.StatusServiceUnavailable, nil, time.Millisecond, time.Millisecond, "gcb.ExponentialJitter", false, ConnTrace{}}},
+	}
+
+	for _, tt := range tests {
+		var retries []RetryInfo
+		opts := append([]Option{
+			WithMaxRetries(1),
+			WithRetryWait(time.Millisecond, 4*time.Millisecond),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+			WithOnRetry(func(req *http.Request, info RetryInfo) {
+				retries = append(retries, info)
+			}),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: http.NoBody}
+				if tt.retryAfter != "" {
+					resp.Header.Set("Retry-After", tt.retryAfter)
+				}
+				return resp, nil
+			})),
+		}, tt.opts...)
+		transport := NewRoundTripper(opts...)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		_, _ = transport.RoundTrip(req)
+
+		if len(retries) != 1 || retries[0] != tt.expected {
+			t.Errorf("%s: Expected %+v, got %+v", tt.name, tt.expected, retries)
+		}
+	}
+}
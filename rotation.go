@@ -0,0 +1,110 @@
+package gcb
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	// addressRotation dials the resolved addresses of a host one after the
+	// other, starting with the one after the last that failed
+	addressRotation struct {
+		// dial dials a single address
+		dial DialContextFunc
+		// lookup resolves the host
+		lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+		mu sync.Mutex
+		// first is the address of each host to dial first
+		first map[string]string
+	}
+)
+
+// WithAddressRotation has the transport gcb builds rotate through the
+// addresses the host resolves to, A and AAAA records alike. A dial starts
+// with the address after the last one that failed, then tries the others
+// in turn, so that a retry following a connection failure goes to another
+// address instead of the dialer picking the same dead one first again. The
+// addresses are dialed with WithDialContext if set. As WithDialContext, it
+// has no effect along with WithTransport.
+func WithAddressRotation() Option {
+	return func(config *Config) {
+		config.addressRotation = true
+	}
+}
+
+func newAddressRotation(dial DialContextFunc) *addressRotation {
+	if dial == nil {
+		// the dialer of http.DefaultTransport
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return &addressRotation{
+		dial:   dial,
+		lookup: net.DefaultResolver.LookupIPAddr,
+		first:  make(map[string]string),
+	}
+}
+
+// DialContext dials the addresses of the host of addr in turn
+func (r *addressRotation) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return r.dial(ctx, network, addr)
+	}
+	resolved, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0, len(resolved))
+	for _, ip := range resolved {
+		if (network == "tcp4" && ip.IP.To4() == nil) || (network == "tcp6" && ip.IP.To4() != nil) {
+			continue
+		}
+		ips = append(ips, ip.String())
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address found", Name: host}
+	}
+
+	start := r.start(host, ips)
+	var firstErr error
+	for i := range ips {
+		ip := ips[(start+i)%len(ips)]
+		conn, err := r.dial(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			r.setFirst(host, ip)
+			return conn, nil
+		}
+		// the next dial starts with the next address
+		r.setFirst(host, ips[(start+i+1)%len(ips)])
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// start returns the index of the address to dial first
+func (r *addressRotation) start(host string, ips []string) int {
+	r.mu.Lock()
+	first := r.first[host]
+	r.mu.Unlock()
+
+	for i, ip := range ips {
+		if ip == first {
+			return i
+		}
+	}
+	return 0
+}
+
+func (r *addressRotation) setFirst(host, ip string) {
+	r.mu.Lock()
+	r.first[host] = ip
+	r.mu.Unlock()
+}
@@ -0,0 +1,73 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestAddressRotation(t *testing.T) {
+	var dialed []string
+	dead := map[string]bool{"192.0.2.1:443": true, "[2001:db8::1]:443": true}
+	rotation := newAddressRotation(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if dead[addr] {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+		}
+		client, server := net.Pipe()
+		_ = server.Close()
+		return client, nil
+	})
+	rotation.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{
+			{IP: net.ParseIP("192.0.2.1")},
+			{IP: net.ParseIP("2001:db8::1")},
+			{IP: net.ParseIP("192.0.2.2")},
+		}, nil
+	}
+
+	tests := []struct {
+		name    string
+		network string
+		addr    string
+		dialed  []string
+		err     bool
+	}{
+		{"falls through the dead addresses", "tcp", "api.example:443", []string{"192.0.2.1:443", "[2001:db8::1]:443", "192.0.2.2:443"}, false},
+		{"starts with the last good one", "tcp", "api.example:443", []string{"192.0.2.2:443"}, false},
+		{"ipv4 only", "tcp4", "api.example:443", []string{"192.0.2.2:443"}, false},
+		{"ipv6 only", "tcp6", "api.example:443", []string{"[2001:db8::1]:443"}, true},
+		{"address", "tcp", "192.0.2.1:443", []string{"192.0.2.1:443"}, true},
+	}
+
+	for _, tt := range tests {
+		dialed = nil
+		conn, err := rotation.DialContext(context.Background(), tt.network, tt.addr)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: Expected error %v, got %v", tt.name, tt.err, err)
+		}
+		if conn != nil {
+			_ = conn.Close()
+		}
+		if !reflect.DeepEqual(dialed, tt.dialed) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.dialed, dialed)
+		}
+	}
+
+	// the last good address dies, the dials move on to the next one
+	rotation.first["api.example"] = "192.0.2.2"
+	dead["192.0.2.1:443"], dead["192.0.2.2:443"] = false, true
+	for _, expected := range [][]string{{"192.0.2.2:443", "192.0.2.1:443"}, {"192.0.2.1:443"}} {
+		dialed = nil
+		conn, err := rotation.DialContext(context.Background(), "tcp", "api.example:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+		if !reflect.DeepEqual(dialed, expected) {
+			t.Errorf("Expected %v, got %v", expected, dialed)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package gcb
+
+import (
+	"context"
+	"net/http"
+)
+
+type (
+	// Runner applies the breaker and retry policies to any operation, e.g. a
+	// Kafka publish or an SDK call, not just HTTP requests. An operation
+	// fails when it returns an error, the ignorable errors aside.
+	Runner struct {
+		breaker *Breaker
+		retrier *Retrier
+	}
+)
+
+// NewRunner creates a runner with its own breaker and retrier, configured
+// by the same options as the round tripper
+func NewRunner(opts ...Option) *Runner {
+	return &Runner{
+		breaker: NewBreaker(opts...),
+		retrier: NewRetrier(opts...),
+	}
+}
+
+// Breaker returns the breaker of the runner
+func (r *Runner) Breaker() *Breaker {
+	return r.breaker
+}
+
+// Run calls fn through the breaker, retrying it with backoff while the
+// retry policy allows it
+func (r *Runner) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := r.breaker.Execute(func() (*http.Response, error) {
+		return nil, r.retry(ctx, fn)
+	})
+	return err
+}
+
+// RunT is Run for operations returning a value
+func RunT[T any](ctx context.Context, r *Runner, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := r.Run(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+func (r *Runner) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	stormGuard.onRequest()
+	retryMax, _ := r.retrier.policy(r.retrier.now())
+	failures := r.retrier.failures()
+
+	state := r.breaker.State()
+
+	for attempt := uint32(0); ; attempt++ {
+		err := fn(withAttempt(ctx, attempt, retryMax, state))
+		if err == nil {
+			return nil
+		}
+
+		shouldRetry, checkErr := r.retrier.retryPolicy(ctx, nil, err)
+		if !shouldRetry {
+			if checkErr != nil {
+				err = checkErr
+			}
+			return err
+		}
+
+		failure := newAttemptError(attempt, nil, err)
+		if attempt >= retryMax {
+			return newRetryExhaustedError(retryMax+1, failure, failures)
+		}
+		if failures != nil {
+			failures = append(failures, failure)
+		}
+		if !stormGuard.allowRetry() {
+			return err
+		}
+
+		if err := r.retrier.Wait(ctx, r.retrier.Backoff(r.retrier.RetryWaitMin, r.retrier.RetryWaitMax, attempt, nil)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRunner_RunT(t *testing.T) {
+	errPublish := errors.New("broker unavailable")
+
+	tests := []struct {
+		failures int
+		calls    int
+		failed   bool
+	}{
+		{0, 1, false},
+		{2, 3, false},
+		{10, 3, true},
+	}
+
+	for _, tt := range tests {
+		runner := NewRunner(WithMaxRetries(2))
+		runner.retrier.Backoff = func(min, max time.Duration, attempt uint32, resp *http.Response) time.Duration {
+			return time.Millisecond
+		}
+
+		calls := 0
+		offset, err := RunT(context.Background(), runner, func(ctx context.Context) (int64, error) {
+			calls++
+			if calls <= tt.failures {
+				return 0, errPublish
+			}
+			return 42, nil
+		})
+
+		if calls != tt.calls {
+			t.Errorf("Expected %d, got %d", tt.calls, calls)
+		}
+		if tt.failed {
+			if !errors.Is(err, errMaxRetriesReached) || offset != 0 {
+				t.Errorf("Expected the retries to run out, got %d, %v", offset, err)
+			}
+		} else if err != nil || offset != 42 {
+			t.Errorf("Expected %d, got %d, %v", 42, offset, err)
+		}
+	}
+}
+
+func TestRunner_Open(t *testing.T) {
+	runner := NewRunner(WithMaxRetries(0), WithReadyToTrip(func(counts Counts) bool { return true }))
+
+	_ = runner.Run(context.Background(), func(ctx context.Context) error {
+		return errors.New("failed")
+	})
+	err := runner.Run(context.Background(), func(ctx context.Context) error {
+		t.Error("Expected the operation not to run")
+		return nil
+	})
+	if !errors.Is(err, ErrOpenState) || runner.Breaker().State() != Open {
+		t.Errorf("Expected %v, got %v", ErrOpenState, err)
+	}
+}
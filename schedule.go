@@ -0,0 +1,189 @@
+package gcb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type (
+	// Schedule is a parsed cron-like expression with the five standard
+	// fields: minute, hour, day of month, month and day of week. Fields accept
+	// "*", numbers, ranges "a-b", steps "*/n" or "a-b/n" and lists "a,b". As
+	// in cron, a step from a number "a/n" runs up to the last value of the
+	// field, "5/15" is "5-59/15".
+	Schedule struct {
+		minute, hour, dom, month, dow uint64
+		// like cron, when both days are restricted either can match
+		domStar, dowStar bool
+	}
+
+	// Window overrides the retry policy while its schedule matches, e.g. to
+	// be stricter during the published maintenance window of the upstream.
+	Window struct {
+		// Schedule tells when the window is active, a window is active for
+		// every minute the schedule matches. A window without one is
+		// never active, WithWindows leaves it out.
+		Schedule *Schedule
+		// MaxRetries replaces the maximum number of retries.
+		MaxRetries uint32
+		// Limit and Burst replace the rate limiter, a zero Limit keeps the
+		// default limiter.
+		Limit rate.Limit
+		Burst int
+	}
+
+	// window is a Window with its own limiter
+	window struct {
+		Window
+		limiter *rate.Limiter
+	}
+
+	// scheduleField describes the bounds of a cron field
+	scheduleField struct {
+		name     string
+		min, max int
+	}
+)
+
+var (
+	scheduleFields = []scheduleField{
+		{"minute", 0, 59},
+		{"hour", 0, 23},
+		{"day of month", 1, 31},
+		{"month", 1, 12},
+		{"day of week", 0, 6},
+	}
+)
+
+// ParseSchedule parses a cron-like expression, e.g. "0-30 2 * * 0" for
+// the first half hour after 2am every Sunday.
+func ParseSchedule(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("schedule %q: expected %d fields, got %d", expr, len(scheduleFields), len(fields))
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseScheduleField(field, scheduleFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", expr, err)
+		}
+		bits[i] = b
+	}
+
+	return &Schedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+// MustParseSchedule is like ParseSchedule but panics if the expression
+// can't be parsed.
+func MustParseSchedule(expr string) *Schedule {
+	s, err := ParseSchedule(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func parseScheduleField(expr string, field scheduleField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		step, stepped := 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s %q", field.name, part)
+			}
+			step, stepped = n, true
+			part = part[:i]
+		}
+
+		lo, hi := field.min, field.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %s %q", field.name, part)
+			}
+			if !stepped {
+				// a single value, a step from it runs to the max
+				hi = lo
+			}
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid %s %q", field.name, part)
+				}
+			}
+		}
+		if lo < field.min || hi > field.max || lo > hi {
+			return 0, fmt.Errorf("%s %q out of range %d-%d", field.name, part, field.min, field.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Matches reports whether the schedule matches the minute of t
+func (s *Schedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// WithWindows overrides the retry policy on a schedule. The first matching
+// window wins, outside of every window the default policy applies. The
+// windows without a schedule are left out.
+func WithWindows(windows ...Window) Option {
+	return func(config *Config) {
+		for _, w := range windows {
+			if w.Schedule != nil {
+				config.windows = append(config.windows, w)
+			}
+		}
+	}
+}
+
+func newWindows(windows []Window) []*window {
+	var ws []*window
+	for _, w := range windows {
+		ws = append(ws, &window{
+			Window:  w,
+			limiter: rate.NewLimiter(w.Limit, w.Burst),
+		})
+	}
+	return ws
+}
+
+// activeWindow returns the first window matching t, or nil
+func (r *Retrier) activeWindow(t time.Time) *window {
+	for _, w := range r.windows {
+		if w.Schedule.Matches(t) {
+			return w
+		}
+	}
+	return nil
+}
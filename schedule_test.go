@@ -0,0 +1,66 @@
+package gcb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule_Matches(t *testing.T) {
+	// Monday 2 March 2020, 10:15
+	monday := time.Date(2020, time.March, 2, 10, 15, 0, 0, time.UTC)
+
+	tt := []struct {
+		expr    string
+		matches bool
+	}{
+		{"* * * * *", true},
+		{"15 10 * * *", true},
+		{"0-14 10 * * *", false},
+		{"*/5 9-17 * * 1-5", true},
+		{"*/4 * * * *", false},
+		{"* * * * 0,6", false},
+		{"* * * 1-2 *", false},
+		// either day field matches when both are restricted
+		{"* * 1 * 1", true},
+		{"* * 2 * 0", true},
+		{"* * 1 * 0", false},
+		// a step from a number runs to the max
+		{"0/15 * * * *", true},
+		{"5/15 * * * *", false},
+		{"10/5 * * * *", true},
+		{"15/1 * * * *", true},
+		{"16/1 * * * *", false},
+	}
+
+	for _, ts := range tt {
+		s, err := ParseSchedule(ts.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Matches(monday) != ts.matches {
+			t.Errorf("%q: expected %t", ts.expr, ts.matches)
+		}
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestWithWindows_NilSchedule(t *testing.T) {
+	r := NewRetrier(
+		WithMaxRetries(1),
+		WithWindows(Window{MaxRetries: 5}, Window{Schedule: MustParseSchedule("* * * * *"), MaxRetries: 2}),
+	)
+
+	if len(r.windows) != 1 {
+		t.Fatalf("Expected %d window, got %d", 1, len(r.windows))
+	}
+	if w := r.activeWindow(time.Now()); w == nil || w.MaxRetries != 2 {
+		t.Errorf("Expected the window with a schedule to be active, got %+v", w)
+	}
+}
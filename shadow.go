@@ -0,0 +1,146 @@
+package gcb
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	// shadow requests are detached from the caller, but can't hang forever
+	defaultShadowTimeout = 30 * time.Second
+)
+
+type (
+	// ShadowStats compares the mirrored requests against their primary
+	// counterparts. A request counts as an error when the transport fails
+	// or the response status is in the 500 range.
+	ShadowStats struct {
+		Mirrored       uint64
+		PrimaryErrors  uint64
+		ShadowErrors   uint64
+		StatusMismatch uint64
+
+		// Cumulative latencies of the mirrored requests
+		PrimaryLatency time.Duration
+		ShadowLatency  time.Duration
+	}
+
+	// shadow mirrors a percentage of the traffic to a secondary backend
+	shadow struct {
+		target    *url.URL
+		percent   float64
+		transport http.RoundTripper
+
+		mu    sync.Mutex
+		rnd   *rand.Rand
+		stats ShadowStats
+	}
+
+	// shadowOutcome is the result of one side of a mirrored request
+	shadowOutcome struct {
+		status  int
+		failed  bool
+		latency time.Duration
+	}
+)
+
+// WithShadow mirrors percent (0-100) of the requests to the target base URL.
+// Shadow responses are discarded and their failures never reach the caller,
+// they are only recorded in the ShadowStats.
+func WithShadow(target *url.URL, percent float64) Option {
+	return func(config *Config) {
+		config.shadowTarget = target
+		config.shadowPercent = percent
+	}
+}
+
+// ShadowStats returns the comparative stats of the shadow traffic
+func (t *tripper) ShadowStats() ShadowStats {
+	c := t.RoundTripper.(*circuit)
+	if c.shadow == nil {
+		return ShadowStats{}
+	}
+	c.shadow.mu.Lock()
+	defer c.shadow.mu.Unlock()
+	return c.shadow.stats
+}
+
+func newShadow(target *url.URL, percent float64, transport http.RoundTripper) *shadow {
+	return &shadow{
+		target:    target,
+		percent:   percent,
+		transport: transport,
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// mirror starts the shadow request if the request is picked. The returned
+// channel must receive the primary outcome, it's nil when the request isn't
+// mirrored.
+func (s *shadow) mirror(req *http.Request) chan<- shadowOutcome {
+	s.mu.Lock()
+	picked := s.rnd.Float64()*100 < s.percent
+	s.mu.Unlock()
+	if !picked {
+		return nil
+	}
+
+	shadowReq, err := s.newRequest(req)
+	if err != nil {
+		return nil
+	}
+
+	primary := make(chan shadowOutcome, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultShadowTimeout)
+		defer cancel()
+
+		start := time.Now()
+		resp, err := s.transport.RoundTrip(shadowReq.WithContext(ctx))
+		out := shadowOutcome{latency: time.Since(start), failed: err != nil}
+		if resp != nil {
+			out.status = resp.StatusCode
+			out.failed = resp.StatusCode >= 500
+			_ = resp.Body.Close()
+		}
+		s.record(<-primary, out)
+	}()
+	return primary
+}
+
+// newRequest clones the request against the shadow target. Requests whose
+// body can't be replayed are not mirrored.
+func (s *shadow) newRequest(req *http.Request) (*http.Request, error) {
+	u := rebaseURL(req.URL, s.target)
+	shadowReq, err := http.NewRequest(req.Method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	shadowReq.Header = req.Header.Clone()
+	if err := copyBody(shadowReq, req); err != nil {
+		return nil, err
+	}
+	return shadowReq, nil
+}
+
+func (s *shadow) record(primary, shadow shadowOutcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Mirrored++
+	s.stats.PrimaryLatency += primary.latency
+	s.stats.ShadowLatency += shadow.latency
+	if primary.failed {
+		s.stats.PrimaryErrors++
+	}
+	if shadow.failed {
+		s.stats.ShadowErrors++
+	}
+	if primary.status != shadow.status {
+		s.stats.StatusMismatch++
+	}
+}
@@ -0,0 +1,49 @@
+package gcb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestCircuit_ShadowTraffic(t *testing.T) {
+	shadowURL, shadowMux, shadowTeardown := testutil.ServerMock()
+	defer shadowTeardown()
+	shadowMux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(503)
+	}))
+
+	target, _ := url.Parse(shadowURL)
+	transport := NewRoundTripper(WithShadow(target, 100))
+	client := http.Client{Transport: transport}
+
+	baseURL, mux, teardown := testutil.ServerMock()
+	defer teardown()
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	resp, err := client.Get(baseURL + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected %d, got %d", 200, resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for transport.ShadowStats().Mirrored == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := transport.ShadowStats()
+	if stats.Mirrored != 1 || stats.ShadowErrors != 1 || stats.PrimaryErrors != 0 || stats.StatusMismatch != 1 {
+		t.Errorf("Unexpected shadow stats %+v", stats)
+	}
+}
@@ -0,0 +1,143 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrShuttingDown is returned for the requests sent after Shutdown, and
+	// for those whose backoff Shutdown cut short
+	ErrShuttingDown = errors.New("round tripper is shutting down")
+)
+
+type (
+	// Flusher is implemented by the stores holding writes back, e.g. a
+	// CountsStore syncing on an interval. Shutdown flushes them.
+	Flusher interface {
+		Flush() error
+	}
+
+	// drainer tracks the requests in flight, to let them finish on
+	// shutdown while turning the new ones away
+	drainer struct {
+		inFlight int64
+		closing  int32
+		// idle is signalled when the last request in flight leaves after
+		// closing, stop is closed on closing
+		idle chan struct{}
+		stop chan struct{}
+		once sync.Once
+	}
+)
+
+func newDrainer() *drainer {
+	return &drainer{idle: make(chan struct{}, 1), stop: make(chan struct{})}
+}
+
+// enter admits a request, false when shutting down
+func (d *drainer) enter() bool {
+	atomic.AddInt64(&d.inFlight, 1)
+	if atomic.LoadInt32(&d.closing) == 1 {
+		d.leave()
+		return false
+	}
+	return true
+}
+
+// leave is called once an admitted request is done
+func (d *drainer) leave() {
+	if atomic.AddInt64(&d.inFlight, -1) == 0 && atomic.LoadInt32(&d.closing) == 1 {
+		select {
+		case d.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// closed reports whether the transport is shutting down, never for the
+// retry loops of RetryPolicy which have no drainer
+func (d *drainer) closed() bool {
+	return d != nil && atomic.LoadInt32(&d.closing) == 1
+}
+
+// stopped returns the channel closed on shutdown, nil without a drainer
+func (d *drainer) stopped() <-chan struct{} {
+	if d == nil {
+		return nil
+	}
+	return d.stop
+}
+
+// close turns the new requests away and waits for those in flight until
+// ctx is done
+func (d *drainer) close(ctx context.Context) error {
+	d.once.Do(func() {
+		atomic.StoreInt32(&d.closing, 1)
+		close(d.stop)
+	})
+	for atomic.LoadInt64(&d.inFlight) > 0 {
+		select {
+		case <-d.idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Shutdown stops the transport gracefully. The requests sent from then on
+// are rejected with ErrShuttingDown, the requests in flight aren't retried
+// anymore, their backoffs are cut short, and their attempts are waited for
+// until ctx is done. The metrics are then flushed a last time, the stores
+// implementing Flusher flushed, and the background work stopped: the
+// watchdogs, the offline queue delivery, the idle probing and the pub/sub
+// subscription. The coarse clocks are shared by the transports of the
+// process and keep running, the EventQueue given to WithEventQueue is left
+// to its owner.
+//
+// It returns ctx.Err() if the requests in flight didn't finish in time, or
+// the first error of the flushes, the background work is stopped in any
+// case. Calling it again waits for the requests in flight again.
+func (t *tripper) Shutdown(ctx context.Context) error {
+	return t.RoundTripper.(*circuit).shutdown(ctx)
+}
+
+func (c *circuit) shutdown(ctx context.Context) error {
+	err := c.drain.close(ctx)
+
+	c.stopOnce.Do(func() {
+		c.cancel()
+		if c.metrics != nil {
+			select {
+			case <-c.metrics.done:
+			case <-ctx.Done():
+			}
+		}
+		if c.queue != nil {
+			close(c.queue.stop)
+		}
+		c.breaker.stopBackground()
+		for _, cb := range c.allBreakers() {
+			cb.stopBackground()
+		}
+	})
+
+	var stores []interface{}
+	if c.breaker.countsStore != nil {
+		stores = append(stores, c.breaker.countsStore)
+	}
+	if c.queue != nil {
+		stores = append(stores, c.queue.store)
+	}
+	for _, store := range stores {
+		if flusher, ok := store.(Flusher); ok {
+			if flushErr := flusher.Flush(); flushErr != nil && err == nil {
+				err = flushErr
+			}
+		}
+	}
+	return err
+}
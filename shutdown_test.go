@@ -0,0 +1,138 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// flushingStore is a CountsStore holding its writes back
+type flushingStore struct {
+	fleetStore
+	flushes int
+}
+
+func (s *flushingStore) Flush() error {
+	s.flushes++
+	return nil
+}
+
+func TestTripper_Shutdown(t *testing.T) {
+	sent := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var flushed []Metrics
+	store := &flushingStore{fleetStore: fleetStore{available: true}}
+	transport := NewRoundTripper(
+		WithCountsStore(store),
+		WithWatchdog(time.Hour, time.Hour),
+		WithMetricsListener(func(metrics Metrics) { flushed = append(flushed, metrics) }, time.Hour),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sent <- struct{}{}
+			<-release
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+
+	inFlight := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		_, err := transport.RoundTrip(req)
+		inFlight <- err
+	}()
+	<-sent
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- transport.Shutdown(context.Background())
+	}()
+	for !transport.RoundTripper.(*circuit).drain.closed() {
+		time.Sleep(time.Millisecond)
+	}
+	// the requests sent once it's shutting down are turned away
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+	if _, err := transport.RoundTrip(req); err != ErrShuttingDown {
+		t.Errorf("Expected %v, got %v", ErrShuttingDown, err)
+	}
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Expected the shutdown to wait for the request in flight, got %v", err)
+	default:
+	}
+	close(release)
+	if err := <-inFlight; err != nil {
+		t.Errorf("Expected the request in flight to succeed, got %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Expected %v, got %v", nil, err)
+	}
+
+	if len(flushed) != 1 || flushed[0].Requests < 1 {
+		t.Errorf("Expected a last flush of the metrics, got %+v", flushed)
+	}
+	if store.flushes != 1 {
+		t.Errorf("Expected %d flush of the store, got %d", 1, store.flushes)
+	}
+	select {
+	case <-transport.RoundTripper.(*circuit).breaker.stop:
+	default:
+		t.Errorf("Expected the watchdog to be stopped")
+	}
+}
+
+func TestTripper_ShutdownBackoff(t *testing.T) {
+	waiting := make(chan struct{})
+	transport := NewRoundTripper(
+		WithMaxRetries(1),
+		WithRetryWait(time.Hour, time.Hour),
+		WithoutRateLimit(),
+		WithLogLevel(LevelOff),
+		WithOnRetry(func(req *http.Request, info RetryInfo) { close(waiting) }),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		})),
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		_, err := transport.RoundTrip(req)
+		done <- err
+	}()
+	<-waiting
+
+	// the backoff of an hour is cut short
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := transport.Shutdown(ctx); err != nil {
+		t.Errorf("Expected %v, got %v", nil, err)
+	}
+	if err := <-done; !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected %v, got %v", ErrShuttingDown, err)
+	}
+}
+
+func TestTripper_ShutdownDeadline(t *testing.T) {
+	sent := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	transport := NewRoundTripper(WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		close(sent)
+		<-release
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})))
+
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		_, _ = transport.RoundTrip(req)
+	}()
+	<-sent
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := transport.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,371 @@
+// Package sim replays a traffic profile against a gcb policy in virtual
+// time, to tune the thresholds before they meet production traffic.
+//
+//	report := sim.Run(sim.Profile{
+//		Duration: 10 * time.Minute,
+//		QPS:      sim.ConstantQPS(50),
+//		Failures: []sim.Window{{Start: 2 * time.Minute, End: 4 * time.Minute, Rate: 0.8, Status: 503}},
+//		Latency:  sim.NormalLatency(40*time.Millisecond, 10*time.Millisecond),
+//	}, gcb.WithMaxRetries(2), gcb.WithTimeout(30*time.Second))
+//	fmt.Printf("%+v\n", report)
+//
+// The requests go through a real gcb breaker and retrier whose clock is the
+// virtual one, so ten minutes of traffic take a fraction of a second. The
+// retries follow the CheckRetry, Backoff and maximum number of retries of the
+// policy, but not its retry rate limit. The breaker records the outcome of a
+// request when its last attempt is over, as the round tripper does.
+package sim
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/calvernaz/gcb"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// errUpstream is the failure of the attempts without a status code
+	errUpstream = errors.New("upstream unavailable")
+
+	// makes sure the scheduler can be the clock of the breaker and retrier
+	_ gcb.Clock = (*scheduler)(nil)
+)
+
+type (
+	// Profile is the traffic replayed against the policy
+	Profile struct {
+		// Duration of the simulation
+		Duration time.Duration
+		// QPS is the request rate at the given time since the start, the
+		// requests arrive as a Poisson process
+		QPS func(at time.Duration) float64
+		// Arrivals are the times since the start the requests arrive at,
+		// e.g. from an access log, in place of QPS
+		Arrivals []time.Duration
+		// Failures are the windows the upstream fails in
+		Failures []Window
+		// Latency draws the latency of an attempt, none by default
+		Latency func(rnd *rand.Rand) time.Duration
+		// Seed of the random draws, the same seed replays the same run
+		Seed int64
+	}
+
+	// Window is a period the upstream fails a share of the attempts in
+	Window struct {
+		Start, End time.Duration
+		// Rate is the share of the attempts failing, from 0 to 1
+		Rate float64
+		// Status is answered by the failed attempts, they fail with a
+		// connection error when it's zero
+		Status int
+	}
+
+	// Report tells how the policy coped with the traffic
+	Report struct {
+		// Requests is the number of requests sent by the clients
+		Requests int
+		// Succeeded and Failed are the requests that went through and the
+		// ones that failed or got a 5xx, after their retries
+		Succeeded int
+		Failed    int
+		// Shed is the number of requests the breaker rejected
+		Shed int
+		// Attempts is the number of attempts that reached the upstream,
+		// Retried the ones that were retries
+		Attempts int
+		Retried  int
+		// Openings is the number of times the breaker opened
+		Openings int
+	}
+
+	// scheduler is the virtual clock. It runs one event at a time, the
+	// arrival of a request or the end of a wait, and moves the time to the
+	// next event once every request is waiting.
+	scheduler struct {
+		mu      sync.Mutex
+		idle    *sync.Cond
+		now     time.Time
+		running int
+		// sleepers is the number of requests waiting on a timer
+		sleepers int
+		timers   timerHeap
+		seq      int
+	}
+
+	timer struct {
+		at  time.Time
+		seq int
+		c   chan time.Time
+		// sleeping is set for the waits of the requests
+		sleeping bool
+	}
+
+	timerHeap []*timer
+)
+
+// ConstantQPS is a flat request rate
+func ConstantQPS(qps float64) func(time.Duration) float64 {
+	return func(time.Duration) float64 {
+		return qps
+	}
+}
+
+// NormalLatency draws the latencies from a normal distribution, the negative
+// draws are zero
+func NormalLatency(mean, stddev time.Duration) func(*rand.Rand) time.Duration {
+	return func(rnd *rand.Rand) time.Duration {
+		latency := time.Duration(rnd.NormFloat64()*float64(stddev)) + mean
+		if latency < 0 {
+			return 0
+		}
+		return latency
+	}
+}
+
+// Run replays the profile against a breaker and a retrier configured by the
+// options
+func Run(profile Profile, opts ...gcb.Option) Report {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &scheduler{now: start}
+	s.idle = sync.NewCond(&s.mu)
+
+	opts = append(append([]gcb.Option{}, opts...), gcb.WithClock(s))
+	cb := gcb.NewBreaker(opts...)
+	retrier := gcb.NewRetrier(opts...)
+	retrier.Limiter = rate.NewLimiter(rate.Inf, 0)
+
+	rnd := rand.New(rand.NewSource(profile.Seed))
+	arrivals := profile.arrivals(rnd)
+
+	var report Report
+	state := cb.State()
+	for {
+		s.waitIdle()
+		// the breaker reads the clock, the scheduler mustn't be locked
+		if current := cb.State(); current != state {
+			if current == gcb.Open {
+				report.Openings++
+			}
+			state = current
+		}
+
+		s.mu.Lock()
+
+		// the next event is either an arrival or the end of a wait
+		var arrival *time.Duration
+		if len(arrivals) > 0 {
+			arrival = &arrivals[0]
+		}
+		var next *timer
+		if len(s.timers) > 0 {
+			next = s.timers[0]
+		}
+		switch {
+		// the timers of the breaker alone don't keep the simulation going
+		case arrival == nil && s.sleepers == 0:
+			s.mu.Unlock()
+			return report
+		case next == nil || (arrival != nil && !start.Add(*arrival).After(next.at)):
+			s.now = start.Add(*arrival)
+			arrivals = arrivals[1:]
+			s.running++
+			report.Requests++
+			go s.request(cb, retrier, profile, rnd, &report, start)
+		default:
+			heap.Pop(&s.timers)
+			s.now = next.at
+			if next.sleeping {
+				s.sleepers--
+				s.running++
+			}
+			next.c <- s.now
+		}
+		s.mu.Unlock()
+	}
+}
+
+// request sends one request through the breaker and the retrier
+func (s *scheduler) request(cb *gcb.Breaker, retrier *gcb.Retrier, profile Profile, rnd *rand.Rand, report *Report, start time.Time) {
+	defer s.done()
+
+	ctx := context.Background()
+	resp, err := cb.Execute(func() (*http.Response, error) {
+		for attempt := uint32(0); ; attempt++ {
+			s.count(func() {
+				report.Attempts++
+				if attempt > 0 {
+					report.Retried++
+				}
+			})
+			resp, err := profile.attempt(s.Now().Sub(start), rnd)
+			if profile.Latency != nil {
+				s.sleep(profile.Latency(rnd))
+			}
+
+			retry, checkErr := retrier.ShouldRetry(ctx, resp, err)
+			if !retry {
+				if checkErr != nil {
+					err = checkErr
+				}
+				return resp, err
+			}
+			if attempt >= retrier.MaxRetries() {
+				exhausted := &gcb.RetryExhaustedError{Attempts: attempt + 1, LastErr: err}
+				if resp != nil {
+					exhausted.LastStatus = resp.StatusCode
+				}
+				return nil, exhausted
+			}
+			s.sleep(retrier.Backoff(retrier.RetryWaitMin, retrier.RetryWaitMax, attempt, resp))
+		}
+	})
+
+	s.count(func() {
+		switch {
+		case errors.Is(err, gcb.ErrOpenState) || errors.Is(err, gcb.ErrTooManyRequests):
+			report.Shed++
+		case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+			report.Failed++
+		default:
+			report.Succeeded++
+		}
+	})
+}
+
+// arrivals returns the arrival times of the requests
+func (p Profile) arrivals(rnd *rand.Rand) []time.Duration {
+	if p.Arrivals != nil {
+		var arrivals []time.Duration
+		for _, at := range p.Arrivals {
+			if at <= p.Duration {
+				arrivals = append(arrivals, at)
+			}
+		}
+		return arrivals
+	}
+	if p.QPS == nil {
+		return nil
+	}
+
+	var arrivals []time.Duration
+	for at := time.Duration(0); ; {
+		qps := p.QPS(at)
+		if qps <= 0 {
+			at += time.Second
+		} else {
+			at += time.Duration(rnd.ExpFloat64() / qps * float64(time.Second))
+		}
+		if at > p.Duration {
+			return arrivals
+		}
+		if qps > 0 {
+			arrivals = append(arrivals, at)
+		}
+	}
+}
+
+// attempt returns the outcome of an attempt sent at the given time
+func (p Profile) attempt(at time.Duration, rnd *rand.Rand) (*http.Response, error) {
+	for _, w := range p.Failures {
+		if at < w.Start || at >= w.End || rnd.Float64() >= w.Rate {
+			continue
+		}
+		if w.Status == 0 {
+			return nil, errUpstream
+		}
+		return &http.Response{StatusCode: w.Status, Header: http.Header{}, Body: http.NoBody}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+}
+
+// Now returns the virtual time
+func (s *scheduler) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.now
+}
+
+// After fires once the virtual time reached d from now
+func (s *scheduler) After(d time.Duration) <-chan time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.schedule(d, false)
+}
+
+// sleep waits d of virtual time, letting the other events happen meanwhile
+func (s *scheduler) sleep(d time.Duration) {
+	s.mu.Lock()
+	c := s.schedule(d, true)
+	s.sleepers++
+	s.running--
+	s.idle.Broadcast()
+	s.mu.Unlock()
+	<-c
+}
+
+// schedule adds a timer, the scheduler must be locked
+func (s *scheduler) schedule(d time.Duration, sleeping bool) chan time.Time {
+	if d < 0 {
+		d = 0
+	}
+	s.seq++
+	t := &timer{at: s.now.Add(d), seq: s.seq, c: make(chan time.Time, 1), sleeping: sleeping}
+	heap.Push(&s.timers, t)
+	return t.c
+}
+
+// waitIdle blocks until every request is waiting
+func (s *scheduler) waitIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.running > 0 {
+		s.idle.Wait()
+	}
+}
+
+// done tells the scheduler a request is over
+func (s *scheduler) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running--
+	s.idle.Broadcast()
+}
+
+// count updates the report, the requests run one at a time but the
+// scheduler lock orders the updates for the race detector too
+func (s *scheduler) count(update func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update()
+}
+
+func (h timerHeap) Len() int { return len(h) }
+
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h timerHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *timerHeap) Push(x interface{}) { *h = append(*h, x.(*timer)) }
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
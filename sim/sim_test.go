@@ -0,0 +1,72 @@
+package sim
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestRun(t *testing.T) {
+	profile := Profile{
+		Duration: 10 * time.Minute,
+		QPS:      ConstantQPS(20),
+		Failures: []Window{{Start: 2 * time.Minute, End: 4 * time.Minute, Rate: 1, Status: 503}},
+		Latency:  NormalLatency(40*time.Millisecond, 10*time.Millisecond),
+		Seed:     1,
+	}
+	opts := []gcb.Option{
+		gcb.WithMaxRetries(2),
+		gcb.WithTimeout(30 * time.Second),
+		gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return counts.ConsecutiveFailures >= 5 }),
+	}
+
+	start := time.Now()
+	report := Run(profile, opts...)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the simulation to run in virtual time, took %s", elapsed)
+	}
+
+	if report.Requests < 10000 || report.Requests > 14000 {
+		t.Errorf("Expected about 12000 requests, got %d", report.Requests)
+	}
+	if sum := report.Succeeded + report.Failed + report.Shed; sum != report.Requests {
+		t.Errorf("Expected %d, got %d", report.Requests, sum)
+	}
+	if report.Openings < 2 {
+		t.Errorf("Expected the breaker to open a few times, got %d", report.Openings)
+	}
+	if report.Shed == 0 {
+		t.Errorf("Expected requests shed during the outage")
+	}
+	if report.Attempts != report.Requests-report.Shed+report.Retried {
+		t.Errorf("Expected %d, got %d", report.Requests-report.Shed+report.Retried, report.Attempts)
+	}
+
+	// the same seed replays the same run
+	if again := Run(profile, opts...); again != report {
+		t.Errorf("Expected %+v, got %+v", report, again)
+	}
+}
+
+func TestRun_Healthy(t *testing.T) {
+	report := Run(Profile{
+		Duration: time.Minute,
+		Arrivals: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 2 * time.Minute},
+	})
+	want := Report{Requests: 3, Succeeded: 3, Attempts: 3}
+	if report != want {
+		t.Errorf("Expected %+v, got %+v", want, report)
+	}
+}
+
+func TestNormalLatency(t *testing.T) {
+	latency := NormalLatency(time.Millisecond, time.Second)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		if d := latency(rnd); d < 0 {
+			t.Errorf("Expected a positive latency, got %s", d)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package gcb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type (
+	// BodyClassifier tells from the first bytes of a response body, at most
+	// 4KB of them and decompressed if gzip, whether the request must be
+	// retried even though its status doesn't say so
+	BodyClassifier func(resp *http.Response, prefix []byte) bool
+
+	// sniffedBody is the response body put back together after sniffing
+	sniffedBody struct {
+		io.Reader
+		io.Closer
+	}
+)
+
+// WithBodyClassifier retries the responses the retry policy would return
+// when the classifier says so after reading the first bytes of their body,
+// e.g. the HTML error pages some load balancers answer with a 200, or the
+// JSON envelopes flagging a retryable error. The caller still gets the whole
+// body, and the last response when the retries are exhausted.
+//
+//	gcb.WithBodyClassifier(func(resp *http.Response, prefix []byte) bool {
+//		return bytes.Contains(prefix, []byte(`"retryable":true`))
+//	})
+func WithBodyClassifier(fn BodyClassifier) Option {
+	return func(config *Config) {
+		config.bodyClassifier = fn
+	}
+}
+
+// retryableBody reports whether the classifier wants the response retried
+func retryableBody(resp *http.Response, classify BodyClassifier) bool {
+	if resp == nil || isStreaming(resp) {
+		return false
+	}
+	prefix, ok := sniffBody(resp)
+	return ok && classify(resp, prefix)
+}
+
+// sniffBody returns the first bytes of the response body, at most
+// respReadLimit of them, decompressed if gzip. The body is put back together
+// for the caller. It's false when there's no body or it couldn't be read.
+func sniffBody(resp *http.Response) ([]byte, bool) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, respReadLimit))
+	resp.Body = &sniffedBody{
+		Reader: io.MultiReader(bytes.NewReader(data), resp.Body),
+		Closer: resp.Body,
+	}
+	if err != nil {
+		return nil, false
+	}
+	if isGzipped(resp) {
+		data = gunzipPrefix(data)
+	}
+	return data, true
+}
+
+// isGzipped reports whether the response body is gzip encoded, which it
+// isn't anymore when the http.Transport decompressed it
+func isGzipped(resp *http.Response) bool {
+	encoding := strings.TrimSpace(resp.Header.Get("Content-Encoding"))
+	return !resp.Uncompressed && (strings.EqualFold(encoding, "gzip") || strings.EqualFold(encoding, "x-gzip"))
+}
+
+// gunzipPrefix decompresses the first bytes of a gzip body, at most
+// respReadLimit of them. The prefix being cut short isn't an error, what
+// could be decompressed is returned, nothing when it isn't gzip.
+func gunzipPrefix(data []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	plain, _ := ioutil.ReadAll(io.LimitReader(zr, respReadLimit))
+	return plain
+}
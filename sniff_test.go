@@ -0,0 +1,91 @@
+package gcb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWithBodyClassifier(t *testing.T) {
+	htmlPage := func(resp *http.Response, prefix []byte) bool {
+		return bytes.HasPrefix(prefix, []byte("<html"))
+	}
+
+	tests := []struct {
+		name     string
+		bodies   []string
+		attempts int
+		body     string
+		err      error
+	}{
+		{"not retried", []string{`{"id":1}`}, 1, `{"id":1}`, nil},
+		{"retried", []string{"<html>bad gateway</html>", `{"id":1}`}, 2, `{"id":1}`, nil},
+		{"exhausted", []string{"<html>1</html>", "<html>2</html>"}, 2, "<html>2</html>", nil},
+	}
+
+	for _, tt := range tests {
+		attempts := 0
+		var failure error
+		transport := NewRoundTripper(
+			WithMaxRetries(1),
+			WithRetryWait(0, 0),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+			WithBodyClassifier(htmlPage),
+			WithOnFailure(func(req *http.Request, resp *http.Response, err error, stats AttemptStats) {
+				failure = err
+			}),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				body := tt.bodies[attempts]
+				attempts++
+				return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+			})),
+		)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != tt.err {
+			t.Fatalf("%s: Expected %v, got %v", tt.name, tt.err, err)
+		}
+		// the caller reads the whole body, sniffed or not
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != tt.body {
+			t.Errorf("%s: Expected %q, got %q", tt.name, tt.body, body)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%s: Expected %d attempts, got %d", tt.name, tt.attempts, attempts)
+		}
+		if exhausted := errors.Is(failure, &RetryExhaustedError{}); exhausted != (tt.name == "exhausted") {
+			t.Errorf("%s: Expected the exhaustion %v, got %v", tt.name, !exhausted, failure)
+		}
+	}
+}
+
+func TestRetrier_ShouldRetryBody(t *testing.T) {
+	retrier := NewRetrier(WithoutRateLimit(), WithBodyClassifier(func(resp *http.Response, prefix []byte) bool {
+		return bytes.Contains(prefix, []byte(`"retryable":true`))
+	}))
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		retry  bool
+	}{
+		{"retryable envelope", http.StatusOK, `{"error":{"retryable":true}}`, true},
+		{"other envelope", http.StatusOK, `{"error":{"retryable":false}}`, false},
+		{"server error", http.StatusBadGateway, `{}`, true},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Body: ioutil.NopCloser(strings.NewReader(tt.body))}
+		retry, err := retrier.ShouldRetry(context.Background(), resp, nil)
+		if retry != tt.retry || err != nil {
+			t.Errorf("%s: Expected %v, got %v and %v", tt.name, tt.retry, retry, err)
+		}
+	}
+}
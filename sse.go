@@ -0,0 +1,263 @@
+package gcb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStreamInterval = time.Second
+	// streamBuffer is the number of state changes a client can be behind,
+	// the next ones are dropped until it catches up
+	streamBuffer = 64
+	// hystrixWindow is the rolling window reported for the breakers that
+	// never clear their counts
+	hystrixWindow = 30 * time.Second
+)
+
+type (
+	// StateStream serves the state changes and the rolling stats of the
+	// registered transports as server-sent events
+	StateStream struct {
+		registry *Registry
+		interval time.Duration
+
+		mu      sync.Mutex
+		clients map[chan StateChange]struct{}
+	}
+
+	// StateChange is a state change of a breaker, as streamed
+	StateChange struct {
+		Transport string      `json:"transport"`
+		Name      string      `json:"name"`
+		From      State       `json:"from"`
+		To        State       `json:"to"`
+		Counts    CountsStats `json:"counts"`
+		Time      time.Time   `json:"time"`
+	}
+
+	// hystrixCommand is a breaker in the format of the Hystrix metrics
+	// stream, gcb doesn't count the rejections per breaker and reports them
+	// as zero. The latencies are those of the attempts, gcb doesn't time
+	// the whole requests apart and reports them as the total latencies too.
+	hystrixCommand struct {
+		Type                            string         `json:"type"`
+		Name                            string         `json:"name"`
+		Group                           string         `json:"group"`
+		CurrentTime                     int64          `json:"currentTime"`
+		IsCircuitBreakerOpen            bool           `json:"isCircuitBreakerOpen"`
+		ErrorPercentage                 int            `json:"errorPercentage"`
+		ErrorCount                      uint32         `json:"errorCount"`
+		RequestCount                    uint32         `json:"requestCount"`
+		RollingCountSuccess             uint32         `json:"rollingCountSuccess"`
+		RollingCountFailure             uint32         `json:"rollingCountFailure"`
+		RollingCountShortCircuited      uint32         `json:"rollingCountShortCircuited"`
+		RollingCountTimeout             uint32         `json:"rollingCountTimeout"`
+		RollingCountThreadPoolRejected  uint32         `json:"rollingCountThreadPoolRejected"`
+		RollingCountSemaphoreRejected   uint32         `json:"rollingCountSemaphoreRejected"`
+		RollingCountBadRequests         uint32         `json:"rollingCountBadRequests"`
+		CurrentConcurrentExecutionCount int            `json:"currentConcurrentExecutionCount"`
+		LatencyExecuteMean              int            `json:"latencyExecute_mean"`
+		LatencyExecute                  map[string]int `json:"latencyExecute"`
+		LatencyTotalMean                int            `json:"latencyTotal_mean"`
+		LatencyTotal                    map[string]int `json:"latencyTotal"`
+		RollingWindow                   int64          `json:"propertyValue_metricsRollingStatisticalWindowInMilliseconds"`
+		ReportingHosts                  int            `json:"reportingHosts"`
+	}
+)
+
+var (
+	// hystrixPercentiles are the latency percentiles the Hystrix dashboard
+	// expects, by key
+	hystrixPercentiles = map[string]float64{"0": 0, "25": 25, "50": 50, "75": 75, "90": 90, "95": 95, "99": 99, "99.5": 99.5, "100": 100}
+)
+
+// NewStateStream returns a stream of the transports of the registry, which
+// sends their stats every interval, every second by default. The state
+// changes are streamed as they happen from the transports built with the
+// listener of the stream:
+//
+//	stream := gcb.NewStateStream(registry, 0)
+//	payments := gcb.NewRoundTripper(gcb.WithEventListener(stream.Listener("payments")))
+//	registry.Register("payments", payments)
+//	http.Handle("/gcb/stream", stream)
+//
+// A browser reads it with an EventSource, listening to the "stats" events,
+// which carry the Stats, and the "state" events. With ?format=hystrix the
+// stream follows the Hystrix metrics stream instead, for the Hystrix
+// dashboards, with one message per breaker named transport:breaker. Their
+// rolling window is the interval of the breaker.
+func NewStateStream(registry *Registry, interval time.Duration) *StateStream {
+	if interval <= 0 {
+		interval = defaultStreamInterval
+	}
+	return &StateStream{
+		registry: registry,
+		interval: interval,
+		clients:  make(map[chan StateChange]struct{}),
+	}
+}
+
+// Listener returns the event listener streaming the state changes of the
+// breakers of the named transport
+func (s *StateStream) Listener(transport string) EventListener {
+	return func(event Event) {
+		if event.Type != EventStateChange {
+			return
+		}
+		s.publish(StateChange{
+			Transport: transport,
+			Name:      event.Name,
+			From:      event.From,
+			To:        event.To,
+			Counts:    countsStats(event.Counts),
+			Time:      event.Time,
+		})
+	}
+}
+
+func (s *StateStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		adminMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	hystrix := r.URL.Query().Get("format") == "hystrix"
+
+	changes := s.subscribe()
+	defer s.unsubscribe(changes)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	err := s.writeStats(w, hystrix, time.Now())
+	for err == nil {
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case change := <-changes:
+			// the dashboards only know about the stats
+			if hystrix {
+				err = s.writeStats(w, true, change.Time)
+			} else {
+				err = writeEvent(w, "state", change)
+			}
+		case now := <-ticker.C:
+			err = s.writeStats(w, hystrix, now)
+		}
+	}
+}
+
+// publish sends the state change to every client, without waiting for
+// those behind
+func (s *StateStream) publish(change StateChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for client := range s.clients {
+		select {
+		case client <- change:
+		default:
+		}
+	}
+}
+
+func (s *StateStream) subscribe() chan StateChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := make(chan StateChange, streamBuffer)
+	s.clients[client] = struct{}{}
+	return client
+}
+
+func (s *StateStream) unsubscribe(client chan StateChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.clients, client)
+}
+
+// writeStats writes the stats of the transports, in a single event or one
+// Hystrix message per breaker
+func (s *StateStream) writeStats(w io.Writer, hystrix bool, now time.Time) error {
+	stats := NewStats(s.registry, now)
+	if !hystrix {
+		return writeEvent(w, "stats", stats)
+	}
+	for _, transport := range stats.Transports {
+		for _, breaker := range transport.Breakers {
+			if err := writeEvent(w, "", newHystrixCommand(transport.Name, breaker, now)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeEvent writes v as the JSON data of a server-sent event, the unnamed
+// events are delivered as messages
+func writeEvent(w io.Writer, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", name); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+func newHystrixCommand(transport string, breaker BreakerStats, now time.Time) hystrixCommand {
+	name := transport
+	if breaker.Name != "" {
+		name += ":" + breaker.Name
+	}
+	window := breaker.Settings.IntervalMs
+	if window == 0 {
+		window = hystrixWindow.Milliseconds()
+	}
+
+	latencies := make(map[string]int, len(hystrixPercentiles))
+	for key, p := range hystrixPercentiles {
+		latencies[key] = int(breaker.latency.percentile(p).Milliseconds())
+	}
+	mean := int(breaker.latency.mean().Milliseconds())
+
+	counts := breaker.Counts
+	return hystrixCommand{
+		Type:                 "HystrixCommand",
+		Name:                 name,
+		Group:                transport,
+		CurrentTime:          now.UnixNano() / int64(time.Millisecond),
+		IsCircuitBreakerOpen: breaker.State == Open,
+		ErrorPercentage:      int(counts.ErrorPercentage),
+		ErrorCount:           counts.TotalFailures,
+		RequestCount:         counts.Requests,
+		RollingCountSuccess:  counts.TotalSuccesses,
+		RollingCountFailure:  counts.TotalFailures,
+		LatencyExecuteMean:   mean,
+		LatencyExecute:       latencies,
+		LatencyTotalMean:     mean,
+		LatencyTotal:         latencies,
+		RollingWindow:        window,
+		ReportingHosts:       1,
+	}
+}
@@ -0,0 +1,130 @@
+package gcb
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the next server-sent event, its name and data
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+
+	var name, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStateStream(t *testing.T) {
+	registry := NewRegistry()
+	stream := NewStateStream(registry, time.Hour)
+	payments := NewRoundTripper(WithName("api"), WithEventListener(stream.Listener("payments")))
+	registry.Register("payments", payments)
+
+	server := httptest.NewServer(stream)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", got)
+	}
+	body := bufio.NewReader(resp.Body)
+
+	// the stats come first, once the client is subscribed
+	name, data := readEvent(t, body)
+	var stats Stats
+	if err := json.Unmarshal([]byte(data), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if name != "stats" || len(stats.Transports) != 1 || stats.Transports[0].Name != "payments" || stats.Transports[0].Breakers[0].State != Close {
+		t.Errorf("Expected the stats of payments, got %s %s", name, data)
+	}
+
+	payments.ForceState("api", Open)
+
+	name, data = readEvent(t, body)
+	var change StateChange
+	if err := json.Unmarshal([]byte(data), &change); err != nil {
+		t.Fatal(err)
+	}
+	if name != "state" {
+		t.Errorf("Expected %v, got %v", "state", name)
+	}
+	if change.Transport != "payments" || change.Name != "api" || change.From != Close || change.To != Open {
+		t.Errorf("Expected payments api from Close to Open, got %+v", change)
+	}
+}
+
+func TestStateStream_Hystrix(t *testing.T) {
+	registry := NewRegistry()
+	stream := NewStateStream(registry, time.Hour)
+	payments := NewRoundTripper(WithName("api"), WithEventListener(stream.Listener("payments")))
+	registry.Register("payments", payments)
+	registry.Register("search", NewRoundTripper())
+
+	server := httptest.NewServer(stream)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?format=hystrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+
+	tests := []struct {
+		name    string
+		command string
+		open    bool
+	}{
+		{"payments", "payments:api", false},
+		{"search", "search", false},
+		// a state change sends the stats right away
+		{"opened", "payments:api", true},
+	}
+
+	for i, tt := range tests {
+		if i == 2 {
+			payments.ForceState("api", Open)
+		}
+		event, data := readEvent(t, body)
+		var command hystrixCommand
+		if err := json.Unmarshal([]byte(data), &command); err != nil {
+			t.Fatal(err)
+		}
+		if event != "" || command.Type != "HystrixCommand" || command.Name != tt.command || command.IsCircuitBreakerOpen != tt.open {
+			t.Errorf("%s: Expected %s open %v, got %s %s", tt.name, tt.command, tt.open, event, data)
+		}
+	}
+}
+
+func TestStateStream_Method(t *testing.T) {
+	stream := NewStateStream(NewRegistry(), 0)
+
+	rec := httptest.NewRecorder()
+	stream.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
@@ -0,0 +1,268 @@
+package gcb
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// StatsVersion is the version of the schema of Stats. Within a version the
+// fields are only ever added: a field is never removed, renamed, retyped
+// nor given another meaning without the version being bumped, so tooling
+// reading a version keeps working as gcb evolves. The golden document of
+// every version is kept in testdata/stats.
+const StatsVersion = 1
+
+type (
+	// Stats is the snapshot of the transports exported by the admin handler
+	// and the state stream, in a stable JSON schema. The durations are in
+	// milliseconds.
+	Stats struct {
+		Version    int              `json:"version"`
+		Time       time.Time        `json:"time"`
+		Transports []TransportStats `json:"transports"`
+	}
+
+	// TransportStats are the stats of a transport and its breakers
+	TransportStats struct {
+		Name     string         `json:"name"`
+		Breakers []BreakerStats `json:"breakers"`
+		Retries  RetryStats     `json:"retries"`
+		// RateLimit is the rate limit of the retries, nil when there's none
+		// or it isn't a *rate.Limiter
+		RateLimit *RateLimitStats `json:"rateLimit,omitempty"`
+		// Throttle is the level of the client throttling, nil unless enabled
+		Throttle *ThrottleStats `json:"throttle,omitempty"`
+		// Health counts the failures of gcb itself
+		Health HealthStats `json:"health"`
+		// Audit is the trail of the last manual interventions, oldest first
+		Audit []AuditEntry `json:"audit,omitempty"`
+		// Tags count the tagged requests by breaker then tag
+		Tags []TagStats `json:"tags,omitempty"`
+	}
+
+	// BreakerStats are the state, the counts and the counting window of a
+	// breaker
+	BreakerStats struct {
+		Name  string `json:"name"`
+		State State  `json:"state"`
+		// Forced is the state the breaker is held in, empty when it isn't
+		Forced   string          `json:"forced,omitempty"`
+		Counts   CountsStats     `json:"counts"`
+		Window   WindowStats     `json:"window"`
+		Settings BreakerSettings `json:"settings"`
+		Latency  LatencyStats    `json:"latency"`
+
+		// latency is the histogram the percentiles are read off
+		latency latencySnapshot
+	}
+
+	// LatencyStats are the latencies of the attempts sent over the last 30
+	// to 60 seconds, zero without attempts. The percentiles are read off a
+	// histogram: a percentile is the upper bound of its bucket, capped at the
+	// slowest attempt.
+	LatencyStats struct {
+		Count  uint64  `json:"count"`
+		MeanMs float64 `json:"meanMs"`
+		P50Ms  float64 `json:"p50Ms"`
+		P90Ms  float64 `json:"p90Ms"`
+		P99Ms  float64 `json:"p99Ms"`
+		MaxMs  float64 `json:"maxMs"`
+	}
+
+	// CountsStats are the counts of the current window
+	CountsStats struct {
+		Requests             uint32 `json:"requests"`
+		TotalSuccesses       uint32 `json:"totalSuccesses"`
+		TotalFailures        uint32 `json:"totalFailures"`
+		ConsecutiveSuccesses uint32 `json:"consecutiveSuccesses"`
+		ConsecutiveFailures  uint32 `json:"consecutiveFailures"`
+		// ErrorPercentage is the share of failures among the requests
+		ErrorPercentage float64 `json:"errorPercentage"`
+	}
+
+	// WindowStats is the window the counts cover: the closed state
+	// interval, or the open or half-open state. ExpiresAt is the end of the
+	// window, nil when it doesn't end.
+	WindowStats struct {
+		ExpiresAt *time.Time `json:"expiresAt"`
+		// ExpiresInMs is the time left until ExpiresAt
+		ExpiresInMs int64 `json:"expiresInMs"`
+	}
+
+	// BreakerSettings are the settings of a breaker
+	BreakerSettings struct {
+		MaxRequests uint32 `json:"maxRequests"`
+		IntervalMs  int64  `json:"intervalMs"`
+		TimeoutMs   int64  `json:"timeoutMs"`
+	}
+
+	// RetryStats is the retry policy in effect
+	RetryStats struct {
+		MaxRetries uint32 `json:"maxRetries"`
+		WaitMinMs  int64  `json:"waitMinMs"`
+		WaitMaxMs  int64  `json:"waitMaxMs"`
+		// Window is the index of the schedule window in effect, nil
+		// outside of the windows
+		Window *int `json:"window"`
+	}
+
+	// RateLimitStats is a rate limit, in requests per second
+	RateLimitStats struct {
+		Limit float64 `json:"limit"`
+		Burst int     `json:"burst"`
+		// Unlimited is set for an infinite limit, Limit is 0 then
+		Unlimited bool `json:"unlimited,omitempty"`
+	}
+
+	// ThrottleStats is the level of the token bucket of the throttling
+	ThrottleStats struct {
+		Tokens    float64 `json:"tokens"`
+		MaxTokens float64 `json:"maxTokens"`
+	}
+
+	// StatsSource provides the stats of a transport, the round trippers of
+	// NewRoundTripper do
+	StatsSource interface {
+		Stats() TransportStats
+	}
+)
+
+// NewStats returns the stats of the transports of the registry, those
+// without stats only report the state and counts of their breakers
+func NewStats(registry *Registry, now time.Time) Stats {
+	stats := Stats{Version: StatsVersion, Time: now, Transports: []TransportStats{}}
+	for _, name := range registry.names() {
+		transport, ok := registry.lookup(name)
+		if !ok {
+			continue
+		}
+
+		var ts TransportStats
+		if source, ok := transport.(StatsSource); ok {
+			ts = source.Stats()
+		} else {
+			ts.Breakers = summaryStats(transport.Summaries())
+		}
+		ts.Name = name
+		stats.Transports = append(stats.Transports, ts)
+	}
+	return stats
+}
+
+// Stats returns the stats of the transport, without its name
+func (t *tripper) Stats() TransportStats {
+	c := t.RoundTripper.(*circuit)
+
+	stats := TransportStats{Breakers: []BreakerStats{}, Retries: c.retrier.stats()}
+	for _, cb := range c.allBreakers() {
+		stats.Breakers = append(stats.Breakers, cb.dump().stats())
+	}
+
+	c.retrier.mu.RLock()
+	stats.RateLimit = rateLimitStats(c.retrier.Limiter)
+	c.retrier.mu.RUnlock()
+
+	if c.throttle != nil {
+		c.throttle.mu.Lock()
+		stats.Throttle = &ThrottleStats{Tokens: c.throttle.tokens, MaxTokens: c.throttle.maxTokens}
+		c.throttle.mu.Unlock()
+	}
+	stats.Health = c.healthStats()
+	stats.Audit = c.audit.list()
+	stats.Tags = c.tags.list()
+	return stats
+}
+
+func (d breakerDump) stats() BreakerStats {
+	stats := BreakerStats{
+		Name:   d.name,
+		State:  d.state,
+		Forced: d.forced.String(),
+		Counts: countsStats(d.counts),
+		Settings: BreakerSettings{
+			MaxRequests: d.maxRequests,
+			IntervalMs:  d.interval.Milliseconds(),
+			TimeoutMs:   d.timeout.Milliseconds(),
+		},
+		Latency: LatencyStats{
+			Count:  d.latency.count(),
+			MeanMs: milliseconds(d.latency.mean()),
+			P50Ms:  milliseconds(d.latency.percentile(50)),
+			P90Ms:  milliseconds(d.latency.percentile(90)),
+			P99Ms:  milliseconds(d.latency.percentile(99)),
+			MaxMs:  milliseconds(time.Duration(d.latency.max)),
+		},
+		latency: d.latency,
+	}
+	if !d.expiry.IsZero() {
+		expiry := d.expiry
+		stats.Window = WindowStats{ExpiresAt: &expiry, ExpiresInMs: expiry.Sub(d.now).Milliseconds()}
+	}
+	return stats
+}
+
+func (r *Retrier) stats() RetryStats {
+	r.mu.RLock()
+	retryMax := r.RetryMax
+	r.mu.RUnlock()
+
+	stats := RetryStats{
+		MaxRetries: retryMax,
+		WaitMinMs:  r.RetryWaitMin.Milliseconds(),
+		WaitMaxMs:  r.RetryWaitMax.Milliseconds(),
+	}
+	active := r.activeWindow(r.now())
+	for i, w := range r.windows {
+		if w == active {
+			i := i
+			stats.Window = &i
+			stats.MaxRetries = w.MaxRetries
+		}
+	}
+	return stats
+}
+
+func summaryStats(summaries []BreakerSummary) []BreakerStats {
+	stats := make([]BreakerStats, 0, len(summaries))
+	for _, summary := range summaries {
+		stats = append(stats, BreakerStats{
+			Name:   summary.Name,
+			State:  summary.State,
+			Counts: countsStats(summary.Counts),
+		})
+	}
+	return stats
+}
+
+func countsStats(counts Counts) CountsStats {
+	stats := CountsStats{
+		Requests:             counts.Requests,
+		TotalSuccesses:       counts.TotalSuccesses,
+		TotalFailures:        counts.TotalFailures,
+		ConsecutiveSuccesses: counts.ConsecutiveSuccesses,
+		ConsecutiveFailures:  counts.ConsecutiveFailures,
+	}
+	if counts.Requests > 0 {
+		stats.ErrorPercentage = float64(counts.TotalFailures) * 100 / float64(counts.Requests)
+	}
+	return stats
+}
+
+// rateLimitStats returns the rate limit of the limiter, nil unless it's a
+// *rate.Limiter
+func rateLimitStats(limiter Limiter) *RateLimitStats {
+	l, ok := limiter.(*rate.Limiter)
+	if !ok {
+		return nil
+	}
+	if l.Limit() == rate.Inf {
+		return &RateLimitStats{Burst: l.Burst(), Unlimited: true}
+	}
+	return &RateLimitStats{Limit: float64(l.Limit()), Burst: l.Burst()}
+}
+
+// milliseconds returns d in fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
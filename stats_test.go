@@ -0,0 +1,137 @@
+package gcb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// populatedStats returns stats with every optional field of the schema set
+func populatedStats(t *testing.T) Stats {
+	t.Helper()
+
+	registry := NewRegistry()
+	payments := NewRoundTripper(
+		WithName("api"),
+		WithTimeout(time.Minute),
+		WithThrottle(10, 0.1),
+		WithWindows(Window{Schedule: MustParseSchedule("* * * * *"), MaxRetries: 1}),
+		WithReadyToTrip(func(counts Counts) bool { return true }),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})),
+	)
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+	if _, err := payments.RoundTrip(req.WithContext(ContextWithTag(req.Context(), "checkout"))); err != nil {
+		t.Fatal(err)
+	}
+	payments.ForceState("api", Open)
+	registry.Register("payments", payments)
+	return NewStats(registry, time.Now())
+}
+
+func TestNewStats(t *testing.T) {
+	registry := NewRegistry()
+	payments := NewRoundTripper(WithName("api"), WithMaxRetries(2), WithThrottle(10, 0.1), WithInterval(30*time.Second))
+	registry.Register("payments", payments)
+	registry.Register("search", NewRoundTripper(WithoutRateLimit()))
+	trip(payments.RoundTripper.(*circuit).breaker)
+
+	stats := NewStats(registry, time.Now())
+	if stats.Version != StatsVersion || len(stats.Transports) != 2 {
+		t.Fatalf("Expected version %d with 2 transports, got %+v", StatsVersion, stats)
+	}
+
+	got := stats.Transports[0]
+	want := TransportStats{
+		Name: "payments",
+		Breakers: []BreakerStats{{
+			Name:     "api",
+			State:    Close,
+			Counts:   CountsStats{Requests: 1, TotalFailures: 1, ConsecutiveFailures: 1, ErrorPercentage: 100},
+			Settings: BreakerSettings{MaxRequests: 1, IntervalMs: 30000, TimeoutMs: 60000},
+		}},
+		Retries:   RetryStats{MaxRetries: 2, WaitMinMs: 1000, WaitMaxMs: 30000},
+		RateLimit: &RateLimitStats{Limit: 200, Burst: 200},
+		Throttle:  &ThrottleStats{Tokens: 10, MaxTokens: 10},
+	}
+	// the closed state window ends at the next interval
+	if got.Breakers[0].Window.ExpiresAt == nil {
+		t.Errorf("Expected the end of the interval, got none")
+	}
+	got.Breakers[0].Window = WindowStats{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if search := stats.Transports[1]; search.RateLimit != nil || search.Throttle != nil {
+		t.Errorf("Expected no rate limit nor throttle, got %+v", search)
+	}
+}
+
+// TestStats_Schema makes sure the stats keep every field of the golden
+// document of their version, with the same JSON type. A field can be
+// added to the golden document, never removed or changed without bumping
+// StatsVersion.
+func TestStats_Schema(t *testing.T) {
+	golden, err := os.ReadFile(filepath.Join("testdata", "stats", fmt.Sprintf("v%d.json", StatsVersion)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want interface{}
+	if err := json.Unmarshal(golden, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(populatedStats(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := got.(map[string]interface{})["version"]; v != float64(StatsVersion) {
+		t.Errorf("Expected version %d, got %v", StatsVersion, v)
+	}
+	for _, problem := range schemaProblems("", want, got) {
+		t.Error(problem)
+	}
+}
+
+// schemaProblems lists the fields of want missing from got or of another
+// JSON type, the arrays are compared on their first element
+func schemaProblems(path string, want, got interface{}) []string {
+	if fmt.Sprintf("%T", want) != fmt.Sprintf("%T", got) {
+		return []string{fmt.Sprintf("%s: Expected %T, got %T", path, want, got)}
+	}
+
+	var problems []string
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got := got.(map[string]interface{})
+		for key, value := range want {
+			field, ok := got[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: Expected the field, got none", path, key))
+				continue
+			}
+			problems = append(problems, schemaProblems(path+"."+key, value, field)...)
+		}
+	case []interface{}:
+		got := got.([]interface{})
+		if len(want) > 0 && len(got) == 0 {
+			return []string{fmt.Sprintf("%s: Expected elements, got none", path)}
+		}
+		if len(want) > 0 {
+			problems = append(problems, schemaProblems(path+"[0]", want[0], got[0])...)
+		}
+	}
+	return problems
+}
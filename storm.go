@@ -0,0 +1,134 @@
+package gcb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// stormGuard watches the retries of every transport of the process
+	stormGuard = &retryStormGuard{}
+
+	defaultStormWindow      = 10 * time.Second
+	defaultStormMinRequests = uint64(20)
+)
+
+type (
+	// RetryStormGuard configures the process-wide guard against retry storms.
+	// When the ratio of retries to requests across all the transports goes
+	// over MaxRatio, transports only send the first attempt of each request
+	// until the ratio drops again.
+	RetryStormGuard struct {
+		// MaxRatio is the maximum number of retries per request, e.g. 0.1
+		// allows one retry every ten requests.
+		MaxRatio float64
+		// Window is the period the ratio is measured over. If Window is 0,
+		// it's set to 10 seconds.
+		Window time.Duration
+		// MinRequests is the number of requests in the window below which
+		// retries are never suppressed. If MinRequests is 0, it's set to 20.
+		MinRequests uint64
+	}
+
+	// retryStormGuard keeps a sliding window of requests and retries made of
+	// the current and the previous bucket. enabled is set along with config,
+	// it lets the requests skip the lock while the guard is disabled.
+	retryStormGuard struct {
+		enabled int32
+
+		mu     sync.Mutex
+		config *RetryStormGuard
+
+		start                     time.Time
+		requests, retries         uint64
+		prevRequests, prevRetries uint64
+	}
+)
+
+// SetRetryStormGuard enables the process-wide retry storm guard, a nil
+// guard disables it.
+func SetRetryStormGuard(guard *RetryStormGuard) {
+	var config *RetryStormGuard
+	if guard != nil {
+		g := *guard
+		if g.Window == 0 {
+			g.Window = defaultStormWindow
+		}
+		if g.MinRequests == 0 {
+			g.MinRequests = defaultStormMinRequests
+		}
+		config = &g
+	}
+
+	stormGuard.mu.Lock()
+	defer stormGuard.mu.Unlock()
+
+	stormGuard.config = config
+	var enabled int32
+	if config != nil {
+		enabled = 1
+	}
+	atomic.StoreInt32(&stormGuard.enabled, enabled)
+	stormGuard.start = time.Time{}
+	stormGuard.requests, stormGuard.retries = 0, 0
+	stormGuard.prevRequests, stormGuard.prevRetries = 0, 0
+}
+
+// onRequest records the first attempt of a request
+func (g *retryStormGuard) onRequest() {
+	if atomic.LoadInt32(&g.enabled) == 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.config == nil {
+		return
+	}
+	g.roll(time.Now())
+	g.requests++
+}
+
+// allowRetry reports whether a retry can be made and records it if so
+func (g *retryStormGuard) allowRetry() bool {
+	if atomic.LoadInt32(&g.enabled) == 0 {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.config == nil {
+		return true
+	}
+
+	now := time.Now()
+	g.roll(now)
+
+	// weight the previous bucket by how much of it still overlaps the window
+	overlap := 1 - float64(now.Sub(g.start))/float64(g.config.Window)
+	requests := float64(g.requests) + float64(g.prevRequests)*overlap
+	retries := float64(g.retries) + float64(g.prevRetries)*overlap
+
+	if requests >= float64(g.config.MinRequests) && retries+1 > requests*g.config.MaxRatio {
+		return false
+	}
+	g.retries++
+	return true
+}
+
+func (g *retryStormGuard) roll(now time.Time) {
+	elapsed := now.Sub(g.start)
+	if elapsed < g.config.Window {
+		return
+	}
+
+	if elapsed < 2*g.config.Window {
+		g.prevRequests, g.prevRetries = g.requests, g.retries
+		g.start = g.start.Add(g.config.Window)
+	} else {
+		g.prevRequests, g.prevRetries = 0, 0
+		g.start = now
+	}
+	g.requests, g.retries = 0, 0
+}
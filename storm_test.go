@@ -0,0 +1,54 @@
+package gcb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryStormGuard(t *testing.T) {
+	SetRetryStormGuard(&RetryStormGuard{MaxRatio: 0.5, Window: time.Minute, MinRequests: 10})
+	defer SetRetryStormGuard(nil)
+
+	for i := 0; i < 5; i++ {
+		stormGuard.onRequest()
+		if !stormGuard.allowRetry() {
+			t.Fatal("Expected retries to be allowed under the minimum requests")
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		stormGuard.onRequest()
+	}
+	if stormGuard.allowRetry() {
+		t.Fatal("Expected retries to be suppressed over the ratio")
+	}
+
+	for i := 0; i < 10; i++ {
+		stormGuard.onRequest()
+	}
+	if !stormGuard.allowRetry() {
+		t.Fatal("Expected retries to be allowed once the ratio drops")
+	}
+}
+
+func TestRetryStormGuard_Disabled(t *testing.T) {
+	SetRetryStormGuard(nil)
+
+	// the requests don't wait on the lock of the guard while it's disabled
+	stormGuard.mu.Lock()
+	defer stormGuard.mu.Unlock()
+
+	done := make(chan bool)
+	go func() {
+		stormGuard.onRequest()
+		done <- stormGuard.allowRetry()
+	}()
+	select {
+	case allowed := <-done:
+		if !allowed {
+			t.Error("Expected the retries to be allowed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the disabled guard not to take its lock")
+	}
+}
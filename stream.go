@@ -0,0 +1,90 @@
+package gcb
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// streamBody reports the drop of a streaming response to the breaker
+	streamBody struct {
+		body    io.ReadCloser
+		req     *http.Request
+		breaker *Breaker
+
+		mu     sync.Mutex
+		closed bool
+		done   bool
+	}
+)
+
+// isStreaming reports whether the response is a stream, server-sent events
+// or a successful chunked body of unknown length. Streams are handed to the
+// caller as soon as they start: they're never retried, drained nor closed.
+// A chunked error, e.g. a 500 written after a flush, is an error like any
+// other.
+func isStreaming(resp *http.Response) bool {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && mediaType == "text/event-stream" {
+		return true
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false
+	}
+	return resp.ContentLength < 0 && len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked"
+}
+
+// watchStream makes the stream of the request report its drop to the
+// breaker
+func watchStream(req *http.Request, resp *http.Response, cb *Breaker) {
+	resp.Body = &streamBody{body: resp.Body, req: req, breaker: cb}
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		report := !b.closed && !b.done && !b.hungUp(err)
+		b.done = true
+		b.mu.Unlock()
+
+		if report {
+			b.breaker.streamDisconnected(err, b.breaker.clock.Now())
+		}
+	}
+	return n, err
+}
+
+// hungUp reports whether the stream ended on the caller's side, its request
+// context is done, or on an error the breaker ignores: neither says the
+// upstream dropped it
+func (b *streamBody) hungUp(err error) bool {
+	return b.req.Context().Err() != nil || b.breaker.isIgnorable(err)
+}
+
+// Close closes the stream, the caller hanging up isn't a drop
+func (b *streamBody) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return b.body.Close()
+}
+
+// streamDisconnected records the drop of a stream as a failure, with its
+// own event
+func (cb *Breaker) streamDisconnected(err error, now time.Time) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	state, _ := cb.currentState(now)
+	cb.lastErr, cb.lastTag = err, ""
+	cb.emit(Event{Type: EventStreamDisconnect, From: state, To: state, Counts: cb.counts.load(), Err: err}, now)
+
+	if state == Close {
+		// the stream went through the breaker as a success already
+		cb.counts.onRequest()
+	}
+	cb.onFailure(state, now)
+}
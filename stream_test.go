@@ -0,0 +1,159 @@
+package gcb
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuit_StreamDisconnect(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+
+		// drop the connection in the middle of the stream
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		_ = buf.Flush()
+		_ = conn.Close()
+	}))
+	defer server.Close()
+
+	recorder := &eventRecorder{}
+	transport := NewRoundTripper(WithEventListener(recorder.record))
+	client := http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the stream isn't retried even though it answered 503
+	if calls != 1 {
+		t.Errorf("Expected %d, got %d", 1, calls)
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: first\n" {
+		t.Errorf("Expected the first event, got %q, %v", line, err)
+	}
+	if _, err := ioutil.ReadAll(resp.Body); err == nil {
+		t.Fatal("Expected the stream to drop")
+	}
+
+	event := recorder.waitFor(t, EventStreamDisconnect, Close)
+	if event.Err == nil || event.Counts.TotalFailures != 0 {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if counts := transport.RoundTripper.(*circuit).breaker.Counts(); counts.TotalFailures != 1 {
+		t.Errorf("Expected the drop to be a failure, got %+v", counts)
+	}
+}
+
+func TestCircuit_ChunkedStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		calls    int32
+		failures uint32
+	}{
+		{"stream", http.StatusOK, 1, 0},
+		{"flushed error", http.StatusInternalServerError, 3, 1},
+	}
+
+	for _, tt := range tests {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(tt.status)
+			_, _ = w.Write([]byte("partial"))
+			// a flush before the end sends the body chunked
+			w.(http.Flusher).Flush()
+		}))
+
+		transport := NewRoundTripper(
+			WithMaxRetries(2),
+			WithRetryWait(time.Millisecond, time.Millisecond),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+		)
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+		server.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: Expected %d calls, got %d", tt.name, tt.calls, calls)
+		}
+		if counts := transport.RoundTripper.(*circuit).breaker.Counts(); counts.TotalFailures != tt.failures {
+			t.Errorf("%s: Expected %d failures, got %+v", tt.name, tt.failures, counts)
+		}
+	}
+}
+
+func TestCircuit_StreamHangUp(t *testing.T) {
+	dropped := errors.New("stream dropped")
+	tests := []struct {
+		name   string
+		opts   []Option
+		cancel bool
+	}{
+		{"cancelled", nil, true},
+		{"ignored", []Option{WithIsIgnorable(func(err error) bool { return errors.Is(err, dropped) })}, false},
+	}
+
+	for _, tt := range tests {
+		recorder := &eventRecorder{}
+		opts := append([]Option{
+			WithEventListener(recorder.record),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": {"text/event-stream"}},
+					Body:       ioutil.NopCloser(&failingReader{err: dropped}),
+				}, nil
+			})),
+		}, tt.opts...)
+		transport := NewRoundTripper(opts...)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example/events", nil)
+		resp, err := transport.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.cancel {
+			cancel()
+		}
+		if _, err := ioutil.ReadAll(resp.Body); err == nil {
+			t.Fatalf("%s: Expected the stream to drop", tt.name)
+		}
+		cancel()
+
+		if counts := transport.RoundTripper.(*circuit).breaker.Counts(); counts.TotalFailures != 0 {
+			t.Errorf("%s: Expected %d failures, got %+v", tt.name, 0, counts)
+		}
+		recorder.mu.Lock()
+		for _, event := range recorder.events {
+			if event.Type == EventStreamDisconnect {
+				t.Errorf("%s: Unexpected event %+v", tt.name, event)
+			}
+		}
+		recorder.mu.Unlock()
+	}
+}
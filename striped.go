@@ -0,0 +1,105 @@
+package gcb
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// stripedCounts spread the closed state requests and successes over
+	// stripes, a request updates the stripe of its processor and the reads
+	// sum them up. The failures go through the breaker lock and stay in the
+	// counts.
+	stripedCounts struct {
+		stripes []countsStripe
+		next    uint32
+		pool    sync.Pool
+	}
+
+	// countsStripe is padded to a cache line of its own
+	countsStripe struct {
+		requests             uint32
+		totalSuccesses       uint32
+		consecutiveSuccesses uint32
+		_                    [52]byte
+	}
+)
+
+// WithStripedCounts spreads the counts of the breakers over stripes, one
+// per processor when stripes is 0, so the closed state requests of a very
+// hot breaker don't contend on the same counters. The counts given to
+// ReadyToTrip are summed up from the stripes and may miss the requests
+// updating them at that moment. It's ignored along WithCountsStore, whose
+// outcomes are recorded under the breaker lock.
+func WithStripedCounts(stripes int) Option {
+	return func(config *Config) {
+		config.stripedCounts = true
+		config.countsStripes = stripes
+	}
+}
+
+// newStripedCounts returns the striped counts of the config, nil if they
+// aren't enabled
+func newStripedCounts(config *Config) *stripedCounts {
+	if !config.stripedCounts || config.countsStore != nil {
+		return nil
+	}
+	n := config.countsStripes
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	s := &stripedCounts{stripes: make([]countsStripe, n)}
+	// the pool keeps a stripe per processor, the stripes handed out again
+	// after a collection are taken in turn
+	s.pool.New = func() interface{} {
+		return &s.stripes[int(atomic.AddUint32(&s.next, 1))%len(s.stripes)]
+	}
+	return s
+}
+
+// sum adds the stripes to the counts
+func (s *stripedCounts) sum(counts *Counts) {
+	for i := range s.stripes {
+		stripe := &s.stripes[i]
+		counts.Requests += atomic.LoadUint32(&stripe.requests)
+		counts.TotalSuccesses += atomic.LoadUint32(&stripe.totalSuccesses)
+		counts.ConsecutiveSuccesses += atomic.LoadUint32(&stripe.consecutiveSuccesses)
+	}
+}
+
+func (s *stripedCounts) onRequest() {
+	stripe := s.pool.Get().(*countsStripe)
+	atomic.AddUint32(&stripe.requests, 1)
+	s.pool.Put(stripe)
+}
+
+func (s *stripedCounts) onSuccess() {
+	stripe := s.pool.Get().(*countsStripe)
+	atomic.AddUint32(&stripe.totalSuccesses, 1)
+	atomic.AddUint32(&stripe.consecutiveSuccesses, 1)
+	s.pool.Put(stripe)
+}
+
+// onIgnore takes a request back, from any stripe as only their sum matters
+func (s *stripedCounts) onIgnore() {
+	stripe := s.pool.Get().(*countsStripe)
+	atomic.AddUint32(&stripe.requests, ^uint32(0))
+	s.pool.Put(stripe)
+}
+
+// breakStreak clears the consecutive successes of every stripe
+func (s *stripedCounts) breakStreak() {
+	for i := range s.stripes {
+		atomic.StoreUint32(&s.stripes[i].consecutiveSuccesses, 0)
+	}
+}
+
+func (s *stripedCounts) clear() {
+	for i := range s.stripes {
+		stripe := &s.stripes[i]
+		atomic.StoreUint32(&stripe.requests, 0)
+		atomic.StoreUint32(&stripe.totalSuccesses, 0)
+		atomic.StoreUint32(&stripe.consecutiveSuccesses, 0)
+	}
+}
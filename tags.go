@@ -0,0 +1,151 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// maxTagStats bounds the breaker and tag pairs counted per transport
+	maxTagStats = 1024
+	// otherTag counts the tags past maxTagStats
+	otherTag = "other"
+)
+
+type (
+	// TagStats count the requests carrying a tag through a breaker since
+	// the transport was created
+	TagStats struct {
+		Breaker   string `json:"breaker"`
+		Tag       string `json:"tag"`
+		Requests  uint64 `json:"requests"`
+		Successes uint64 `json:"successes"`
+		// Failures are the requests ending in an error or a server error,
+		// or classified as a failure by WithErrorClassifier
+		Failures uint64 `json:"failures"`
+		// Rejected are the requests the breaker turned away
+		Rejected uint64 `json:"rejected"`
+	}
+
+	// tagStats counts the tagged requests per breaker and tag
+	tagStats struct {
+		mu       sync.RWMutex
+		counters map[tagKey]*tagCounters
+		// classifier classifies the outcomes, if set
+		classifier *ErrorClassifier
+	}
+
+	tagKey struct {
+		breaker string
+		tag     string
+	}
+
+	tagCounters struct {
+		requests  uint64
+		successes uint64
+		failures  uint64
+		rejected  uint64
+	}
+
+	tagContextKey struct{}
+)
+
+// ContextWithTag tags the requests sent with the context, e.g. with the
+// tenant or the feature of the caller. The requests of a tag are counted
+// apart in TagStats, in the metrics, and the state changes they cause carry
+// the tag, without the tag getting a breaker of its own.
+func ContextWithTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, tagContextKey{}, tag)
+}
+
+// TagFromContext returns the tag of the context, see ContextWithTag
+func TagFromContext(ctx context.Context) (string, bool) {
+	tag, ok := ctx.Value(tagContextKey{}).(string)
+	return tag, ok
+}
+
+// TagStats returns the counts of the tagged requests, by breaker then tag.
+// Past 1024 breaker and tag pairs, the requests are counted under the
+// "other" tag of their breaker.
+func (t *tripper) TagStats() []TagStats {
+	return t.RoundTripper.(*circuit).tags.list()
+}
+
+func newTagStats(classifier *ErrorClassifier) *tagStats {
+	return &tagStats{counters: make(map[tagKey]*tagCounters), classifier: classifier}
+}
+
+// record counts the outcome of a tagged request through the breaker
+func (s *tagStats) record(breaker, tag string, resp *http.Response, err error) {
+	counters := s.get(tagKey{breaker, tag})
+	atomic.AddUint64(&counters.requests, 1)
+	class, classified := classify(s.classifier, resp, err)
+	switch {
+	case errors.Is(err, ErrOpenState), errors.Is(err, ErrTooManyRequests):
+		atomic.AddUint64(&counters.rejected, 1)
+	case classified:
+		if class.failed() {
+			atomic.AddUint64(&counters.failures, 1)
+		} else {
+			atomic.AddUint64(&counters.successes, 1)
+		}
+	case err != nil || resp.StatusCode >= 500:
+		atomic.AddUint64(&counters.failures, 1)
+	default:
+		atomic.AddUint64(&counters.successes, 1)
+	}
+}
+
+// get returns the counters of the key, created on first use
+func (s *tagStats) get(key tagKey) *tagCounters {
+	s.mu.RLock()
+	counters, ok := s.counters[key]
+	s.mu.RUnlock()
+	if ok {
+		return counters
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if counters, ok := s.counters[key]; ok {
+		return counters
+	}
+	if len(s.counters) >= maxTagStats {
+		key.tag = otherTag
+		if counters, ok := s.counters[key]; ok {
+			return counters
+		}
+	}
+	counters = &tagCounters{}
+	s.counters[key] = counters
+	return counters
+}
+
+// list returns the counts by breaker then tag, nil when there are none
+func (s *tagStats) list() []TagStats {
+	s.mu.RLock()
+	var stats []TagStats
+	for key, counters := range s.counters {
+		stats = append(stats, TagStats{
+			Breaker:   key.breaker,
+			Tag:       key.tag,
+			Requests:  atomic.LoadUint64(&counters.requests),
+			Successes: atomic.LoadUint64(&counters.successes),
+			Failures:  atomic.LoadUint64(&counters.failures),
+			Rejected:  atomic.LoadUint64(&counters.rejected),
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Breaker != stats[j].Breaker {
+			return stats[i].Breaker < stats[j].Breaker
+		}
+		return stats[i].Tag < stats[j].Tag
+	})
+	return stats
+}
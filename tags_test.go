@@ -0,0 +1,80 @@
+package gcb
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTagStats(t *testing.T) {
+	var events []Event
+	var metrics []Metrics
+	transport := NewRoundTripper(
+		WithName("api"),
+		WithoutRetries(),
+		WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures > 0 }),
+		WithEventListener(func(event Event) { events = append(events, event) }),
+		WithMetricsListener(func(m Metrics) { metrics = append(metrics, m) }, time.Hour),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			status := http.StatusOK
+			if req.URL.Path == "/search" {
+				status = http.StatusBadGateway
+			}
+			return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+		})),
+	)
+
+	for _, tagged := range []struct{ tag, path string }{
+		{"checkout", "/pay"},
+		{"search", "/search"},
+		// the breaker opened on the failure of search
+		{"checkout", "/pay"},
+		{"", "/pay"},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example"+tagged.path, nil)
+		if tagged.tag != "" {
+			req = req.WithContext(ContextWithTag(req.Context(), tagged.tag))
+		}
+		_, _ = transport.RoundTrip(req)
+	}
+
+	want := []TagStats{
+		{Breaker: "api", Tag: "checkout", Requests: 2, Successes: 1, Rejected: 1},
+		{Breaker: "api", Tag: "search", Requests: 1, Failures: 1},
+	}
+	if got := transport.TagStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if len(events) != 1 || events[0].To != Open || events[0].Tag != "search" {
+		t.Errorf("Expected the opening tagged search, got %+v", events)
+	}
+
+	transport.RoundTripper.(*circuit).metrics.flush(time.Second)
+	if len(metrics) != 1 || !reflect.DeepEqual(metrics[0].Tags, want) {
+		t.Errorf("Expected the tags in the metrics, got %+v", metrics)
+	}
+}
+
+func TestTagStats_Overflow(t *testing.T) {
+	tags := newTagStats(nil)
+	for i := 0; i < maxTagStats+2; i++ {
+		tags.record("api", fmt.Sprintf("tenant-%d", i), &http.Response{StatusCode: http.StatusOK}, nil)
+	}
+
+	stats := tags.list()
+	if len(stats) != maxTagStats+1 {
+		t.Fatalf("Expected %d, got %d", maxTagStats+1, len(stats))
+	}
+	var other uint64
+	for _, s := range stats {
+		if s.Tag == otherTag {
+			other = s.Requests
+		}
+	}
+	if other != 2 {
+		t.Errorf("Expected %d, got %d", 2, other)
+	}
+}
@@ -0,0 +1,49 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// The helpers are generic over the State and Counts methods of the breaker,
+// so that testutil doesn't import gcb, whose own tests use testutil:
+//
+//	testutil.AssertState(t, cb, gcb.Open)
+//	testutil.AssertCounts(t, cb, gcb.Counts{Requests: 3, TotalFailures: 3, ConsecutiveFailures: 3})
+
+// AssertState fails the test unless the breaker is in the state
+func AssertState[S comparable, B interface{ State() S }](t testing.TB, b B, want S) {
+	t.Helper()
+
+	if got := b.State(); got != want {
+		t.Errorf("Expected the breaker to be %v, got %v", want, got)
+	}
+}
+
+// AssertCounts fails the test unless the breaker has the counts
+func AssertCounts[C comparable, B interface{ Counts() C }](t testing.TB, b B, want C) {
+	t.Helper()
+
+	if got := b.Counts(); got != want {
+		t.Errorf("Expected the breaker counts to be %+v, got %+v", want, got)
+	}
+}
+
+// WaitForState fails the test unless the breaker reaches the state within
+// the timeout, e.g. after a timer transition or a state received from a peer
+func WaitForState[S comparable, B interface{ State() S }](t testing.TB, b B, want S, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		got := b.State()
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("Expected the breaker to be %v within %s, still %v", want, timeout, got)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
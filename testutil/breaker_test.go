@@ -0,0 +1,34 @@
+package testutil
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestBreakerAssertions(t *testing.T) {
+	cb := gcb.NewBreaker(
+		gcb.WithTimeout(10*time.Millisecond),
+		gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return counts.ConsecutiveFailures >= 2 }),
+	)
+	fail := func() (*http.Response, error) { return nil, errors.New("unavailable") }
+
+	_, _ = cb.Execute(fail)
+	AssertState(t, cb, gcb.Close)
+	AssertCounts(t, cb, gcb.Counts{Requests: 1, TotalFailures: 1, ConsecutiveFailures: 1})
+
+	_, _ = cb.Execute(fail)
+	AssertState(t, cb, gcb.Open)
+	WaitForState(t, cb, gcb.HalfOpen, time.Second)
+
+	rt := &recordingT{TB: t}
+	AssertState(rt, cb, gcb.Close)
+	AssertCounts(rt, cb, gcb.Counts{Requests: 1})
+	WaitForState(rt, cb, gcb.Open, 5*time.Millisecond)
+	if rt.failures != 3 {
+		t.Errorf("Expected %d, got %d", 3, rt.failures)
+	}
+}
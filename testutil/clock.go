@@ -0,0 +1,86 @@
+package testutil
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// FakeClock is a clock that only moves when told to, it implements
+	// gcb.Clock:
+	//
+	//	clock := testutil.NewFakeClock(time.Now())
+	//	transport := gcb.NewRoundTripper(gcb.WithClock(clock))
+	//
+	// A request waiting on a retry backoff resumes once the clock is
+	// advanced past the wait, BlockUntilTimers tells when it's waiting.
+	FakeClock struct {
+		mu     sync.Mutex
+		cond   *sync.Cond
+		now    time.Time
+		timers []*fakeTimer
+	}
+
+	fakeTimer struct {
+		at time.Time
+		c  chan time.Time
+	}
+)
+
+// NewFakeClock returns a clock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After returns a channel receiving the time once the clock is advanced by d
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		timer.c <- c.now
+		return timer.c
+	}
+	c.timers = append(c.timers, timer)
+	c.cond.Broadcast()
+	return timer.c
+}
+
+// Advance moves the clock forward by d, firing the timers that expire
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.c <- c.now
+	}
+	c.timers = pending
+}
+
+// BlockUntilTimers blocks until at least n timers are waiting for the clock
+// to be advanced
+func (c *FakeClock) BlockUntilTimers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
@@ -0,0 +1,36 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	short := clock.After(time.Second)
+	long := clock.After(time.Minute)
+	clock.BlockUntilTimers(2)
+
+	clock.Advance(2 * time.Second)
+	select {
+	case at := <-short:
+		if !at.Equal(start.Add(2 * time.Second)) {
+			t.Errorf("Expected %s, got %s", start.Add(2*time.Second), at)
+		}
+	default:
+		t.Errorf("Expected the short timer to fire")
+	}
+	select {
+	case <-long:
+		t.Errorf("Expected the long timer to wait")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	<-long
+	if now := clock.Now(); !now.Equal(start.Add(62 * time.Second)) {
+		t.Errorf("Expected %s, got %s", start.Add(62*time.Second), now)
+	}
+}
@@ -0,0 +1,143 @@
+package testutil
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+type (
+	// EventRecorder captures the events of a breaker into a log comparable
+	// against a golden file, its Record method is the listener:
+	//
+	//	recorder := testutil.NewEventRecorder[gcb.Event]()
+	//	cb := gcb.NewBreaker(gcb.WithEventListener(recorder.Record), gcb.WithClock(clock))
+	//	...
+	//	recorder.AssertGolden(t, "testdata/trip.golden")
+	//
+	// The log is normalized so that it doesn't change from one run to the
+	// next: the times are rebased on the first event and rounded to
+	// Precision, the errors are reduced to their message and the zero
+	// fields without a name left out.
+	EventRecorder[E any] struct {
+		// Precision the times are rounded to, 100ms by default
+		Precision time.Duration
+
+		mu     sync.Mutex
+		events []E
+	}
+)
+
+// NewEventRecorder returns an empty recorder
+func NewEventRecorder[E any]() *EventRecorder[E] {
+	return &EventRecorder[E]{}
+}
+
+// Record records an event, it doesn't block
+func (r *EventRecorder[E]) Record(event E) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+// Events returns the events recorded so far
+func (r *EventRecorder[E]) Events() []E {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]E{}, r.events...)
+}
+
+// Log describes the events one per line, normalized
+func (r *EventRecorder[E]) Log() string {
+	precision := r.Precision
+	if precision == 0 {
+		precision = 100 * time.Millisecond
+	}
+
+	var b strings.Builder
+	var start time.Time
+	for _, event := range r.Events() {
+		v := reflect.ValueOf(event)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			fmt.Fprintf(&b, "%v\n", event)
+			continue
+		}
+
+		// the last time field is the time of the event, the others are
+		// logged by name, relative to the first event too
+		stamp := -1
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() && v.Type().Field(i).Type == timeType {
+				stamp = i
+			}
+		}
+		if stamp >= 0 && start.IsZero() {
+			start = v.Field(stamp).Interface().(time.Time)
+		}
+
+		var fields []string
+		for i := 0; i < v.NumField(); i++ {
+			field, value := v.Type().Field(i), v.Field(i)
+			if !field.IsExported() || value.IsZero() && !namedZero(value) {
+				continue
+			}
+			if field.Type == timeType {
+				offset := "+" + value.Interface().(time.Time).Sub(start).Round(precision).String()
+				if i == stamp {
+					fields = append([]string{offset}, fields...)
+				} else {
+					fields = append(fields, field.Name+"="+offset)
+				}
+				continue
+			}
+			fields = append(fields, field.Name+"="+formatField(value, precision))
+		}
+		b.WriteString(strings.Join(fields, " "))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// AssertGolden fails the test when the log differs from the golden file, or
+// writes the file when UPDATE_GOLDEN is set
+func (r *EventRecorder[E]) AssertGolden(t testing.TB, path string) {
+	t.Helper()
+
+	assertGolden(t, path, r.Log())
+}
+
+// namedZero tells a zero value with a name, e.g. the first value of an enum
+func namedZero(value reflect.Value) bool {
+	if value.Type() == durationType || value.Type() == timeType {
+		return false
+	}
+	stringer, ok := value.Interface().(fmt.Stringer)
+	return ok && stringer.String() != ""
+}
+
+// formatField formats a field of an event
+func formatField(value reflect.Value, precision time.Duration) string {
+	switch v := value.Interface().(type) {
+	case error:
+		return strconv.Quote(v.Error())
+	case time.Duration:
+		return v.Round(precision).String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprintf("%+v", value.Interface())
+}
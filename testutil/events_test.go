@@ -0,0 +1,37 @@
+package testutil
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestEventRecorder(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	recorder := NewEventRecorder[gcb.Event]()
+	cb := gcb.NewBreaker(
+		gcb.WithName("upstream"),
+		gcb.WithClock(clock),
+		gcb.WithTimeout(10*time.Second),
+		gcb.WithEventListener(recorder.Record),
+		gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return counts.ConsecutiveFailures >= 2 }),
+	)
+	fail := func() (*http.Response, error) { return nil, errors.New("unavailable") }
+	succeed := func() (*http.Response, error) { return &http.Response{StatusCode: http.StatusOK}, nil }
+
+	// trip, probe, reopen, probe and close
+	_, _ = cb.Execute(fail)
+	_, _ = cb.Execute(fail)
+	clock.Advance(11 * time.Second)
+	_, _ = cb.Execute(fail)
+	clock.Advance(11 * time.Second)
+	_, _ = cb.Execute(succeed)
+
+	if n := len(recorder.Events()); n != 5 {
+		t.Errorf("Expected %d, got %d", 5, n)
+	}
+	recorder.AssertGolden(t, "testdata/events.golden")
+}
@@ -0,0 +1,137 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+type (
+	// Script scripts the answers of a flaky server. The server answers the
+	// Statuses in order, one per request, or FailFirst requests with
+	// FailStatus when there are no Statuses, then Status for good.
+	Script struct {
+		// Statuses are answered in order
+		Statuses []int
+		// FailFirst is the number of requests failed, when there are no
+		// Statuses
+		FailFirst int
+		// FailStatus is the status of the failed requests, 500 by default
+		FailStatus int
+		// Status is answered once the script is over, 200 by default
+		Status int
+		// Body is written with every answer
+		Body string
+		// Header is sent with every answer
+		Header http.Header
+
+		// Latency delays every answer, Latencies delays the answers in
+		// order, ahead of Latency
+		Latency   time.Duration
+		Latencies []time.Duration
+	}
+
+	// RecordedRequest is a request received by a flaky server
+	RecordedRequest struct {
+		Method string
+		Path   string
+		Header http.Header
+		Body   []byte
+		// Time is when the request was received
+		Time time.Time
+	}
+
+	// FlakyServer is an HTTP server following a script and recording the
+	// requests it receives
+	FlakyServer struct {
+		*httptest.Server
+		script Script
+
+		mu       sync.Mutex
+		requests []RecordedRequest
+	}
+)
+
+// NewFlakyServer starts a server following the script, it must be closed
+func NewFlakyServer(script Script) *FlakyServer {
+	if script.FailStatus == 0 {
+		script.FailStatus = http.StatusInternalServerError
+	}
+	if script.Status == 0 {
+		script.Status = http.StatusOK
+	}
+
+	s := &FlakyServer{script: script}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Requests returns the requests received so far
+func (s *FlakyServer) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]RecordedRequest{}, s.requests...)
+}
+
+// Count returns the number of requests received so far
+func (s *FlakyServer) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.requests)
+}
+
+// record records the request and returns its number, counted from 0
+func (s *FlakyServer) record(r *http.Request) int {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Header: r.Header.Clone(),
+		Body:   body,
+		Time:   time.Now(),
+	})
+	return len(s.requests) - 1
+}
+
+func (s *FlakyServer) serve(w http.ResponseWriter, r *http.Request) {
+	n := s.record(r)
+
+	latency := s.script.Latency
+	if n < len(s.script.Latencies) {
+		latency = s.script.Latencies[n]
+	}
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for name, values := range s.script.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(s.status(n))
+	_, _ = w.Write([]byte(s.script.Body))
+}
+
+// status returns the status of the nth request, counted from 0
+func (s *FlakyServer) status(n int) int {
+	switch {
+	case len(s.script.Statuses) > 0:
+		if n < len(s.script.Statuses) {
+			return s.script.Statuses[n]
+		}
+	case n < s.script.FailFirst:
+		return s.script.FailStatus
+	}
+	return s.script.Status
+}
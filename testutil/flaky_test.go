@@ -0,0 +1,68 @@
+package testutil
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlakyServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		script Script
+		want   []int
+	}{
+		{"fail first", Script{FailFirst: 2}, []int{500, 500, 200, 200}},
+		{"fail status", Script{FailFirst: 1, FailStatus: 503, Status: 204}, []int{503, 204, 204, 204}},
+		{"statuses", Script{Statuses: []int{429, 502, 200, 500}}, []int{429, 502, 200, 500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewFlakyServer(tt.script)
+			defer server.Close()
+
+			var got []int
+			for range tt.want {
+				resp, err := http.Get(server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = resp.Body.Close()
+				got = append(got, resp.StatusCode)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFlakyServer_Recording(t *testing.T) {
+	server := NewFlakyServer(Script{Latencies: []time.Duration{20 * time.Millisecond}})
+	defer server.Close()
+
+	start := time.Now()
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/orders", strings.NewReader(`{"id":1}`))
+	req.Header.Set("Idempotency-Key", "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected the latency to be injected, took %s", elapsed)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("Expected %d, got %d", 1, len(requests))
+	}
+	got := requests[0]
+	if got.Method != http.MethodPost || got.Path != "/orders" || string(got.Body) != `{"id":1}` ||
+		got.Header.Get("Idempotency-Key") != "abc" || got.Time.Before(start) {
+		t.Errorf("Unexpected %+v", got)
+	}
+}
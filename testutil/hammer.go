@@ -0,0 +1,111 @@
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// HammerFailEvery is how often the hammered server fails, one request in
+// HammerFailEvery is answered with 503
+const HammerFailEvery = 5
+
+type (
+	// HammerResult adds up what a HammerTransport run sent and got back
+	HammerResult struct {
+		// Requests is the number of requests sent by the clients, every one
+		// of them ends with either a response or an error
+		Requests  int64
+		Responses int64
+		Errors    int64
+		// Received is the number of requests the server received, retries
+		// included
+		Received int64
+	}
+)
+
+// HammerTransport drives the client from concurrency goroutines for the
+// duration, against a mock server failing one request in HammerFailEvery,
+// and fails the test when the invariants break:
+//
+//   - every request ends with exactly one response or one error
+//   - every response answers the request it was sent for
+//   - the server received at least one request per response
+//
+// The client must only route the requests, e.g. through a gcb transport. Run
+// it with -race, concurrency is where the breaker bugs hide.
+func HammerTransport(t testing.TB, client *http.Client, concurrency int, duration time.Duration) HammerResult {
+	t.Helper()
+
+	var result HammerResult
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&result.Received, 1)%HammerFailEvery == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("X-Hammer-Id")))
+	}))
+	defer server.Close()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []string
+		next     int64
+	)
+	fail := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	deadline := time.Now().Add(duration)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				id := strconv.FormatInt(atomic.AddInt64(&next, 1), 10)
+				atomic.AddInt64(&result.Requests, 1)
+
+				req, _ := http.NewRequest(http.MethodGet, server.URL+"/hammer", nil)
+				req.Header.Set("X-Hammer-Id", id)
+				resp, err := client.Do(req)
+				switch {
+				case err != nil && resp != nil:
+					fail("request %s got both a response and %v", id, err)
+				case err != nil:
+					atomic.AddInt64(&result.Errors, 1)
+				case resp == nil:
+					fail("request %s got neither a response nor an error", id)
+				default:
+					atomic.AddInt64(&result.Responses, 1)
+					body, _ := ioutil.ReadAll(resp.Body)
+					_ = resp.Body.Close()
+					if resp.StatusCode == http.StatusOK && string(body) != id {
+						fail("request %s got the response of request %s", id, body)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.Received = atomic.LoadInt64(&result.Received)
+	for _, failure := range failures {
+		t.Errorf("Hammering: %s", failure)
+	}
+	if result.Responses+result.Errors != result.Requests {
+		t.Errorf("Expected %d outcomes, got %d responses and %d errors", result.Requests, result.Responses, result.Errors)
+	}
+	if result.Received < result.Responses {
+		t.Errorf("Expected at least %d requests received, got %d", result.Responses, result.Received)
+	}
+	return result
+}
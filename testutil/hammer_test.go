@@ -0,0 +1,45 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestHammerTransport(t *testing.T) {
+	// the breakers trip on the first 503, so that the rejections mix with
+	// the responses
+	tripOnFailure := gcb.WithReadyToTrip(func(counts gcb.Counts) bool { return counts.ConsecutiveFailures > 0 })
+
+	tests := []struct {
+		name string
+		opts []gcb.Option
+	}{
+		{"shared breaker", []gcb.Option{gcb.WithMaxRetries(0), tripOnFailure, gcb.WithTimeout(10 * time.Millisecond)}},
+		{"per key breakers", []gcb.Option{gcb.WithMaxRetries(0), tripOnFailure, gcb.WithPerKeyBreakers()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: gcb.NewRoundTripper(tt.opts...)}
+			result := HammerTransport(t, client, 8, 100*time.Millisecond)
+			if result.Requests == 0 || result.Errors == 0 {
+				t.Errorf("Expected requests and failures, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestHammerTransport_CrossedResponses(t *testing.T) {
+	// answers every request with the response of the first one
+	crossed := NewFaultTransport()
+	crossed.Default = Step{Body: "1"}
+
+	recorder := &recordingT{TB: t}
+	HammerTransport(recorder, &http.Client{Transport: crossed}, 2, 10*time.Millisecond)
+	if recorder.failures == 0 {
+		t.Errorf("Expected the crossed responses to fail the test")
+	}
+}
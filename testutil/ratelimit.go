@@ -0,0 +1,107 @@
+package testutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	// RateLimit configures a rate limiting server
+	RateLimit struct {
+		// Limited is the number of requests answered with Status before the
+		// requests go through
+		Limited int
+		// Status of the limited requests, 429 by default
+		Status int
+		// RetryAfter is advertised by the limited answers, in seconds or as
+		// an HTTP date with RetryAfterDate. Zero sends no Retry-After.
+		RetryAfter     time.Duration
+		RetryAfterDate bool
+
+		// Limit, when set, is sent as X-RateLimit-Limit along with
+		// X-RateLimit-Remaining and X-RateLimit-Reset, the Unix time the
+		// window resets at, RetryAfter from now
+		Limit int
+	}
+
+	// RateLimitServer answers the first requests with 429 or 503 and the
+	// rate limit headers, then lets the requests through with 200. It
+	// records the requests and when the client was told to come back.
+	RateLimitServer struct {
+		*FlakyServer
+		limit RateLimit
+
+		mu sync.Mutex
+		// notBefore[n] is when the request n+1 may come, zero if any time
+		notBefore []time.Time
+	}
+)
+
+// NewRateLimitServer starts a rate limiting server, it must be closed
+func NewRateLimitServer(limit RateLimit) *RateLimitServer {
+	if limit.Status == 0 {
+		limit.Status = http.StatusTooManyRequests
+	}
+
+	s := &RateLimitServer{FlakyServer: &FlakyServer{}, limit: limit}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AssertWaited fails the test for every request that came before the time
+// advertised by the previous answer
+func (s *RateLimitServer) AssertWaited(t testing.TB) {
+	t.Helper()
+
+	requests := s.Requests()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n := 1; n < len(requests) && n <= len(s.notBefore); n++ {
+		notBefore := s.notBefore[n-1]
+		if !notBefore.IsZero() && requests[n].Time.Before(notBefore) {
+			t.Errorf("Request %d came %s before the advertised time", n+1, notBefore.Sub(requests[n].Time))
+		}
+	}
+}
+
+func (s *RateLimitServer) serve(w http.ResponseWriter, r *http.Request) {
+	n := s.record(r)
+	now := time.Now()
+	limited := n < s.limit.Limited
+
+	var notBefore time.Time
+	if limited && s.limit.RetryAfter > 0 {
+		notBefore = now.Add(s.limit.RetryAfter)
+		if s.limit.RetryAfterDate {
+			// the date has a resolution of a second
+			notBefore = notBefore.Truncate(time.Second)
+			w.Header().Set("Retry-After", notBefore.UTC().Format(http.TimeFormat))
+		} else {
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.limit.RetryAfter/time.Second)))
+		}
+	}
+	s.mu.Lock()
+	s.notBefore = append(s.notBefore, notBefore)
+	s.mu.Unlock()
+
+	if s.limit.Limit > 0 {
+		remaining := 0
+		if !limited {
+			remaining = s.limit.Limit - 1
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.limit.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(s.limit.RetryAfter).Unix(), 10))
+	}
+
+	if limited {
+		w.WriteHeader(s.limit.Status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
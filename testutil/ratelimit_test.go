@@ -0,0 +1,76 @@
+package testutil
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// recordingT records the failures of the assertions
+type recordingT struct {
+	testing.TB
+	failures int
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.failures++
+}
+
+func TestRateLimitServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    RateLimit
+		status   int
+		wait     bool
+		failures int
+	}{
+		{"waited", RateLimit{Limited: 1, RetryAfter: time.Second, Limit: 10}, http.StatusTooManyRequests, true, 0},
+		{"came back too early", RateLimit{Limited: 1, RetryAfter: time.Second, Limit: 10}, http.StatusTooManyRequests, false, 1},
+		{"date", RateLimit{Limited: 1, Status: http.StatusServiceUnavailable, RetryAfter: time.Second, RetryAfterDate: true}, http.StatusServiceUnavailable, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewRateLimitServer(tt.limit)
+			defer server.Close()
+
+			resp, err := http.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected %d, got %d", tt.status, resp.StatusCode)
+			}
+			if tt.limit.Limit > 0 {
+				if remaining, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); remaining != 0 {
+					t.Errorf("Expected %d, got %d", 0, remaining)
+				}
+			}
+			if resp.Header.Get("Retry-After") == "" {
+				t.Errorf("Expected a Retry-After header")
+			}
+
+			if tt.wait {
+				time.Sleep(tt.limit.RetryAfter)
+			}
+			resp, err = http.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected %d, got %d", http.StatusOK, resp.StatusCode)
+			}
+
+			rt := &recordingT{TB: t}
+			server.AssertWaited(rt)
+			if rt.failures != tt.failures {
+				t.Errorf("Expected %d, got %d", tt.failures, rt.failures)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// UpdateGoldenEnv is the environment variable rewriting the golden files
+// with the transcripts when set, instead of comparing them:
+//
+//	UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+type (
+	// RecordedAttempt is an attempt seen by an AttemptRecorder
+	RecordedAttempt struct {
+		Method string
+		URL    *url.URL
+		Header http.Header
+		Body   []byte
+		// Time is when the attempt was sent, Interval the time since the
+		// previous one, zero for the first one
+		Time     time.Time
+		Interval time.Duration
+		// Status of the answer, zero when the attempt failed with Err
+		Status int
+		Err    error
+	}
+
+	// AttemptRecorder is a round tripper recording the exact sequence of
+	// attempts it forwards to Transport, to assert on what the retries
+	// sent and when:
+	//
+	//	recorder := testutil.NewAttemptRecorder(testutil.NewFaultTransport(...))
+	//	transport := gcb.NewRoundTripper(gcb.WithTransport(recorder))
+	//	...
+	//	recorder.AssertGolden(t, "testdata/retries.golden")
+	AttemptRecorder struct {
+		// Transport sends the attempts, http.DefaultTransport by default
+		Transport http.RoundTripper
+		// Clock tells the time of the attempts, a FakeClock makes the
+		// intervals exact. The wall clock by default.
+		Clock interface{ Now() time.Time }
+		// Precision the transcript rounds the intervals to, 100ms by default
+		Precision time.Duration
+
+		mu       sync.Mutex
+		attempts []RecordedAttempt
+	}
+)
+
+// NewAttemptRecorder returns a recorder forwarding to transport
+func NewAttemptRecorder(transport http.RoundTripper) *AttemptRecorder {
+	return &AttemptRecorder{Transport: transport}
+}
+
+// Attempts returns the attempts recorded so far
+func (r *AttemptRecorder) Attempts() []RecordedAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]RecordedAttempt{}, r.attempts...)
+}
+
+// Intervals returns the time between the attempts
+func (r *AttemptRecorder) Intervals() []time.Duration {
+	var intervals []time.Duration
+	for n, attempt := range r.Attempts() {
+		if n > 0 {
+			intervals = append(intervals, attempt.Interval)
+		}
+	}
+	return intervals
+}
+
+// Transcript describes the attempts one per line, with the request URI
+// rather than the URL so that it doesn't change with the port of a test
+// server, and the intervals rounded to Precision
+func (r *AttemptRecorder) Transcript() string {
+	precision := r.Precision
+	if precision == 0 {
+		precision = 100 * time.Millisecond
+	}
+
+	var b strings.Builder
+	for n, attempt := range r.Attempts() {
+		fmt.Fprintf(&b, "%d %s %s", n+1, attempt.Method, attempt.URL.RequestURI())
+		if n > 0 {
+			fmt.Fprintf(&b, " +%s", attempt.Interval.Round(precision))
+		}
+		if attempt.Err != nil {
+			fmt.Fprintf(&b, " error=%s", strconv.Quote(attempt.Err.Error()))
+		} else {
+			fmt.Fprintf(&b, " %d", attempt.Status)
+		}
+		if len(attempt.Body) > 0 {
+			fmt.Fprintf(&b, " body=%s", strconv.Quote(string(attempt.Body)))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// AssertGolden fails the test when the transcript differs from the golden
+// file, or writes the file when UPDATE_GOLDEN is set
+func (r *AttemptRecorder) AssertGolden(t testing.TB, path string) {
+	t.Helper()
+
+	assertGolden(t, path, r.Transcript())
+}
+
+// assertGolden compares got with the golden file, or writes it
+func assertGolden(t testing.TB, path, got string) {
+	t.Helper()
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading the golden file, run with %s=1 to write it: %v", UpdateGoldenEnv, err)
+	}
+	if got != string(want) {
+		t.Errorf("Expected the content of %s:\n%s\ngot:\n%s", path, want, got)
+	}
+}
+
+// AssertIntervals fails the test unless the intervals between the attempts
+// are the wanted ones, give or take tolerance
+func (r *AttemptRecorder) AssertIntervals(t testing.TB, want []time.Duration, tolerance time.Duration) {
+	t.Helper()
+
+	got := r.Intervals()
+	if len(got) != len(want) {
+		t.Errorf("Expected %d intervals, got %v", len(want), got)
+		return
+	}
+	for i := range want {
+		if diff := got[i] - want[i]; diff > tolerance || diff < -tolerance {
+			t.Errorf("Expected the interval %d to be %s, got %s", i+1, want[i], got[i])
+		}
+	}
+}
+
+// AssertIdenticalBodies fails the test unless every attempt sent the same
+// body
+func (r *AttemptRecorder) AssertIdenticalBodies(t testing.TB) {
+	t.Helper()
+
+	attempts := r.Attempts()
+	for n := 1; n < len(attempts); n++ {
+		if !bytes.Equal(attempts[n].Body, attempts[0].Body) {
+			t.Errorf("Expected the attempt %d to send %q, got %q", n+1, attempts[0].Body, attempts[n].Body)
+		}
+	}
+}
+
+func (r *AttemptRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the body is read to be recorded and replayed to the transport
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		body, _ = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	now := time.Now()
+	if r.Clock != nil {
+		now = r.Clock.Now()
+	}
+	attempt := RecordedAttempt{
+		Method: req.Method,
+		URL:    req.URL,
+		Header: req.Header.Clone(),
+		Body:   body,
+		Time:   now,
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		attempt.Err = err
+	} else {
+		attempt.Status = resp.StatusCode
+	}
+
+	r.mu.Lock()
+	if n := len(r.attempts); n > 0 {
+		attempt.Interval = attempt.Time.Sub(r.attempts[n-1].Time)
+	}
+	r.attempts = append(r.attempts, attempt)
+	r.mu.Unlock()
+
+	return resp, err
+}
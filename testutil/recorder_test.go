@@ -0,0 +1,57 @@
+package testutil
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb"
+)
+
+func TestAttemptRecorder(t *testing.T) {
+	unavailable := Step{Status: http.StatusServiceUnavailable}
+	recorder := NewAttemptRecorder(NewFaultTransport(unavailable, unavailable, unavailable))
+	clock := NewFakeClock(time.Now())
+	recorder.Clock = clock
+
+	transport := gcb.NewRoundTripper(gcb.WithTransport(recorder), gcb.WithClock(clock), gcb.WithMaxRetries(3))
+	req, _ := http.NewRequest(http.MethodGet, "http://upstream.example/items?page=2", nil)
+	done := make(chan error)
+	go func() {
+		_, err := transport.RoundTrip(req)
+		done <- err
+	}()
+	for _, wait := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		clock.BlockUntilTimers(1)
+		clock.Advance(wait)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.AssertIntervals(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, 0)
+	recorder.AssertGolden(t, "testdata/retries.golden")
+}
+
+func TestAttemptRecorder_Bodies(t *testing.T) {
+	fault := NewFaultTransport()
+	recorder := NewAttemptRecorder(fault)
+	for _, body := range []string{"a", "a", "b"} {
+		req, _ := http.NewRequest(http.MethodPost, "http://upstream.example/items", strings.NewReader(body))
+		if _, err := recorder.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the transport still gets the bodies
+	if body := string(fault.Requests()[2].Body); body != "b" {
+		t.Errorf("Expected %q, got %q", "b", body)
+	}
+
+	failing := &recordingT{TB: t}
+	recorder.AssertIdenticalBodies(failing)
+	if failing.failures != 1 {
+		t.Errorf("Expected %d, got %d", 1, failing.failures)
+	}
+}
@@ -0,0 +1,131 @@
+package testutil
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+// errRejected is returned by a StubBreaker rejecting a call without Err
+var errRejected = errors.New("rejected by the stub breaker")
+
+type (
+	// StubLimiter is a limiter answering a script instead of a rate, it
+	// implements gcb.Limiter so it can stand in for the retry limiter or
+	// the limiter of gcb.RateLimitPolicy:
+	//
+	//	retrier.Limiter = testutil.DenyAll()
+	StubLimiter struct {
+		// Script is answered in order, one per call, then Default for good
+		Script  []bool
+		Default bool
+
+		mu    sync.Mutex
+		calls int
+	}
+
+	// StubBreaker has the Execute method of gcb.Breaker and rejects the
+	// calls on demand, so that the code embedding a breaker can be tested
+	// against rejections without real thresholds nor timing. A call is
+	// rejected when the Script says so, then when Reject is set, then at
+	// RejectRate.
+	StubBreaker struct {
+		// Script tells the calls rejected, in order, one per call
+		Script []bool
+		// Reject rejects every call after the script
+		Reject bool
+		// RejectRate is the share of the calls rejected after the script,
+		// drawn from Seed
+		RejectRate float64
+		Seed       int64
+		// Err is returned by the rejected calls, e.g. gcb.ErrOpenState
+		Err error
+
+		mu       sync.Mutex
+		rnd      *rand.Rand
+		calls    int
+		rejected int
+	}
+)
+
+// AllowAll returns a limiter allowing everything
+func AllowAll() *StubLimiter {
+	return &StubLimiter{Default: true}
+}
+
+// DenyAll returns a limiter denying everything
+func DenyAll() *StubLimiter {
+	return &StubLimiter{}
+}
+
+// NewStubLimiter returns a limiter answering the script, then allowing
+// everything
+func NewStubLimiter(script ...bool) *StubLimiter {
+	return &StubLimiter{Script: script, Default: true}
+}
+
+// Allow answers the next step of the script
+func (l *StubLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	allow := l.Default
+	if l.calls < len(l.Script) {
+		allow = l.Script[l.calls]
+	}
+	l.calls++
+	return allow
+}
+
+// Calls returns the number of calls so far
+func (l *StubLimiter) Calls() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.calls
+}
+
+// Execute runs req unless the call is rejected
+func (b *StubBreaker) Execute(req func() (*http.Response, error)) (*http.Response, error) {
+	if b.reject() {
+		if b.Err != nil {
+			return nil, b.Err
+		}
+		return nil, errRejected
+	}
+	return req()
+}
+
+// Calls returns the number of calls so far, and how many were rejected
+func (b *StubBreaker) Calls() (calls, rejected int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.calls, b.rejected
+}
+
+// reject tells whether the next call is rejected
+func (b *StubBreaker) reject() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var reject bool
+	switch {
+	case b.calls < len(b.Script):
+		reject = b.Script[b.calls]
+	case b.Reject:
+		reject = true
+	case b.RejectRate > 0:
+		if b.rnd == nil {
+			b.rnd = rand.New(rand.NewSource(b.Seed))
+		}
+		reject = b.rnd.Float64() < b.RejectRate
+	}
+
+	b.calls++
+	if reject {
+		b.rejected++
+	}
+	return reject
+}
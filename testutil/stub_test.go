@@ -0,0 +1,72 @@
+package testutil
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/calvernaz/gcb"
+)
+
+// makes sure the stubs stand in for the real ones
+var (
+	_ gcb.Limiter = (*StubLimiter)(nil)
+	_ interface {
+		Execute(func() (*http.Response, error)) (*http.Response, error)
+	} = (*StubBreaker)(nil)
+)
+
+func TestStubLimiter(t *testing.T) {
+	limiter := NewStubLimiter(false, true, false)
+	transport := gcb.NewPipeline(NewFaultTransport(), gcb.RateLimitPolicy(limiter))
+
+	var limited []bool
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+		_, err := transport.RoundTrip(req)
+		var rateLimited *gcb.RateLimitedError
+		limited = append(limited, errors.As(err, &rateLimited))
+	}
+
+	want := []bool{true, false, true, false}
+	for i := range want {
+		if limited[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, limited)
+			break
+		}
+	}
+	if limiter.Calls() != 4 || DenyAll().Allow() || !AllowAll().Allow() {
+		t.Errorf("Unexpected limiter answers")
+	}
+}
+
+func TestStubBreaker(t *testing.T) {
+	ok := func() (*http.Response, error) { return &http.Response{StatusCode: http.StatusOK}, nil }
+
+	tests := []struct {
+		name     string
+		breaker  *StubBreaker
+		rejected int
+	}{
+		{"script", &StubBreaker{Script: []bool{true, false, true}}, 2},
+		{"reject", &StubBreaker{Script: []bool{false}, Reject: true}, 99},
+		{"rate", &StubBreaker{RejectRate: 0.5, Seed: 1}, 51},
+		{"none", &StubBreaker{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				_, _ = tt.breaker.Execute(ok)
+			}
+			if _, rejected := tt.breaker.Calls(); rejected != tt.rejected {
+				t.Errorf("Expected %d, got %d", tt.rejected, rejected)
+			}
+		})
+	}
+
+	breaker := &StubBreaker{Reject: true, Err: gcb.ErrOpenState}
+	if _, err := breaker.Execute(ok); !errors.Is(err, gcb.ErrOpenState) {
+		t.Errorf("Expected %v, got %v", gcb.ErrOpenState, err)
+	}
+}
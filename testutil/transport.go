@@ -0,0 +1,107 @@
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Step is what a FaultTransport does with one call: wait Delay, then
+	// fail with Err if set, or answer Status, 200 by default, with Body
+	Step struct {
+		Delay  time.Duration
+		Err    error
+		Status int
+		Header http.Header
+		Body   string
+	}
+
+	// FaultTransport is a round tripper playing its steps in order, one per
+	// call, then Default for good. It records the requests and never opens
+	// a socket, so the retry and breaker logic can be tested in memory.
+	FaultTransport struct {
+		Steps   []Step
+		Default Step
+
+		mu       sync.Mutex
+		requests []RecordedRequest
+	}
+)
+
+// NewFaultTransport returns a transport playing the steps
+func NewFaultTransport(steps ...Step) *FaultTransport {
+	return &FaultTransport{Steps: steps}
+}
+
+// Calls returns the number of calls so far
+func (f *FaultTransport) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.requests)
+}
+
+// Requests returns the requests received so far
+func (f *FaultTransport) Requests() []RecordedRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]RecordedRequest{}, f.requests...)
+}
+
+func (f *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+	}
+
+	f.mu.Lock()
+	step := f.Default
+	if n := len(f.requests); n < len(f.Steps) {
+		step = f.Steps[n]
+	}
+	f.requests = append(f.requests, RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Header: req.Header.Clone(),
+		Body:   body,
+		Time:   time.Now(),
+	})
+	f.mu.Unlock()
+
+	if step.Delay > 0 {
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(step.Delay):
+		}
+	}
+	if step.Err != nil {
+		return nil, step.Err
+	}
+
+	status := step.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := step.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(step.Body)),
+		ContentLength: int64(len(step.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFaultTransport(t *testing.T) {
+	errReset := errors.New("connection reset")
+	transport := NewFaultTransport(
+		Step{Err: errReset},
+		Step{Status: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"1"}}},
+	)
+	transport.Default = Step{Body: "ok"}
+
+	var got []interface{}
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.example/items", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			got = append(got, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		got = append(got, resp.StatusCode, resp.Header.Get("Retry-After"), string(body))
+	}
+
+	want := []interface{}{errReset, http.StatusServiceUnavailable, "1", "", http.StatusOK, "", "ok"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if transport.Calls() != 3 || transport.Requests()[2].Path != "/items" {
+		t.Errorf("Unexpected %+v", transport.Requests())
+	}
+}
+
+func TestFaultTransport_Delay(t *testing.T) {
+	transport := NewFaultTransport(Step{Delay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, "http://upstream.example", nil)
+	if _, err := transport.RoundTrip(req.WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
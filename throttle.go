@@ -0,0 +1,86 @@
+package gcb
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrThrottled is returned when the client throttling drops a request
+	ErrThrottled = errors.New("request throttled")
+)
+
+type (
+	// throttle implements the gRPC client throttling algorithm: every
+	// failure takes a token, every success gives back a fraction of one, and
+	// requests are dropped while at most half of the tokens are left.
+	// Dropped requests give back a fraction of a token too, otherwise a
+	// throttled client would never send the requests that let it recover.
+	throttle struct {
+		mu         sync.Mutex
+		maxTokens  float64
+		tokenRatio float64
+		tokens     float64
+	}
+)
+
+// WithThrottle puts the gRPC-style client throttling in front of the breaker.
+// Unlike the binary open/closed state of the breaker, the share of dropped
+// requests follows the recent failure rate, which suits high-QPS clients.
+// Only the failures the breaker counts take a token: the requests rejected
+// before being sent, the cancelled ones and the ignored errors don't.
+// maxTokens is the size of the bucket, e.g. 10, and tokenRatio the amount
+// given back on success, e.g. 0.1.
+func WithThrottle(maxTokens, tokenRatio float64) Option {
+	return func(config *Config) {
+		config.throttleMaxTokens = maxTokens
+		config.throttleTokenRatio = tokenRatio
+	}
+}
+
+func newThrottle(maxTokens, tokenRatio float64) *throttle {
+	return &throttle{
+		maxTokens:  maxTokens,
+		tokenRatio: tokenRatio,
+		tokens:     maxTokens,
+	}
+}
+
+// allow reports whether the request can be sent
+func (t *throttle) allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tokens > t.maxTokens/2 {
+		return true
+	}
+	t.tokens += t.tokenRatio
+	return false
+}
+
+// rejected reports whether the request was turned away before being sent,
+// by the breaker, the maintenance, the shutdown or the offline queue
+func rejected(err error) bool {
+	return errors.Is(err, ErrOpenState) || errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrMaintenance) ||
+		errors.Is(err, ErrShuttingDown) || errors.Is(err, ErrQueued)
+}
+
+func (t *throttle) onSuccess() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tokens += t.tokenRatio
+	if t.tokens > t.maxTokens {
+		t.tokens = t.maxTokens
+	}
+}
+
+func (t *throttle) onFailure() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tokens--
+	if t.tokens < 0 {
+		t.tokens = 0
+	}
+}
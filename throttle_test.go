@@ -0,0 +1,86 @@
+package gcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	th := newThrottle(10, 0.5)
+
+	for i := 0; i < 5; i++ {
+		if !th.allow() {
+			t.Fatalf("Expected request %d to be allowed", i)
+		}
+		th.onFailure()
+	}
+	if th.allow() {
+		t.Fatal("Expected the request to be dropped with half of the tokens left")
+	}
+	if !th.allow() {
+		t.Fatal("Expected dropped requests to give back tokens")
+	}
+
+	th.onSuccess()
+	if !th.allow() {
+		t.Fatal("Expected successes to give back tokens")
+	}
+}
+
+func TestCircuit_ThrottleFailures(t *testing.T) {
+	refused := errors.New("connection refused")
+	tests := []struct {
+		name   string
+		opts   []Option
+		status int
+		open   bool
+		cancel bool
+		tokens float64
+	}{
+		{"upstream failure", nil, 0, false, false, 7},
+		{"server error", nil, http.StatusServiceUnavailable, false, false, 7},
+		{"success", nil, http.StatusOK, false, false, 10},
+		{"open breaker", nil, 0, true, false, 10},
+		{"cancelled", nil, 0, false, true, 10},
+		{"ignored", []Option{WithIgnoredErrors(refused)}, 0, false, false, 10},
+	}
+
+	for _, tt := range tests {
+		opts := append([]Option{
+			WithThrottle(10, 0.1),
+			WithoutRetries(),
+			WithLogLevel(LevelOff),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if err := req.Context().Err(); err != nil {
+					return nil, err
+				}
+				if tt.status != 0 {
+					return &http.Response{StatusCode: tt.status, Body: http.NoBody}, nil
+				}
+				return nil, refused
+			})),
+		}, tt.opts...)
+		transport := NewRoundTripper(opts...)
+		c := transport.RoundTripper.(*circuit)
+		if tt.open {
+			c.breaker.force(Open, time.Now())
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if tt.cancel {
+			cancel()
+		}
+		for i := 0; i < 3; i++ {
+			req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+			_, _ = transport.RoundTrip(req.WithContext(ctx))
+		}
+		cancel()
+
+		if tokens := c.throttle.tokens; tokens != tt.tokens {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.tokens, tokens)
+		}
+	}
+}
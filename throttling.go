@@ -0,0 +1,81 @@
+package gcb
+
+import (
+	"bytes"
+	"net/http"
+)
+
+var (
+	// defaultThrottlingCodes are the error codes of the well-known APIs
+	// that mean the client is throttled, whatever the status code
+	defaultThrottlingCodes = []string{
+		// AWS
+		"Throttling",
+		"ThrottlingException",
+		"ThrottledException",
+		"RequestThrottled",
+		"RequestThrottledException",
+		"TooManyRequestsException",
+		"RequestLimitExceeded",
+		"ProvisionedThroughputExceededException",
+		"SlowDown",
+		// GCP
+		"rateLimitExceeded",
+		"userRateLimitExceeded",
+		"RESOURCE_EXHAUSTED",
+	}
+)
+
+// WithThrottlingDetection looks for throttling error codes in the JSON and
+// XML bodies of the 4xx responses, e.g. an AWS ThrottlingException answered
+// with a 400. The matching responses are turned into 429, and the 429 are
+// retried like the server errors: after the backoff, or as long as their
+// Retry-After asks up to the maximum wait of WithRetryWait. Only the first
+// bytes of the body are read, the caller still gets the whole body. The
+// codes default to the AWS and GCP ones. The gzip bodies are looked at
+// decompressed, the caller still gets them compressed.
+func WithThrottlingDetection(codes ...string) Option {
+	return func(config *Config) {
+		if len(codes) == 0 {
+			codes = defaultThrottlingCodes
+		}
+		config.throttlingCodes = codes
+	}
+}
+
+// detectThrottling turns the 4xx responses carrying a throttling code into 429
+func detectThrottling(resp *http.Response, codes [][]byte) {
+	if resp.StatusCode < 400 || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return
+	}
+	data, ok := sniffBody(resp)
+	if !ok {
+		return
+	}
+
+	for _, code := range codes {
+		if containsCode(data, code) {
+			resp.StatusCode = http.StatusTooManyRequests
+			resp.Status = "429 " + http.StatusText(http.StatusTooManyRequests)
+			return
+		}
+	}
+}
+
+// containsCode reports whether the code shows up as a whole JSON string, XML
+// element or AWS "__type" suffix, not as part of a longer word
+func containsCode(data, code []byte) bool {
+	for i := 0; ; {
+		j := bytes.Index(data[i:], code)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(code)
+		if start > 0 && end < len(data) &&
+			bytes.IndexByte([]byte(`"#>`), data[start-1]) >= 0 &&
+			bytes.IndexByte([]byte(`"<`), data[end]) >= 0 {
+			return true
+		}
+		i = start + 1
+	}
+}
@@ -0,0 +1,142 @@
+package gcb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottlingDetection(t *testing.T) {
+	long := `{"message":"` + strings.Repeat("x", int(respReadLimit)) + `"}`
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		gzipped bool
+		want    int
+	}{
+		{"aws json", http.StatusBadRequest, `{"__type":"com.amazon.coral.availability#ThrottlingException","message":"Rate exceeded"}`, false, http.StatusTooManyRequests},
+		{"aws xml", http.StatusBadRequest, `<Response><Errors><Error><Code>RequestLimitExceeded</Code></Error></Errors></Response>`, false, http.StatusTooManyRequests},
+		{"gcp json", http.StatusForbidden, `{"error":{"code":403,"errors":[{"reason":"rateLimitExceeded"}]}}`, false, http.StatusTooManyRequests},
+		{"other code", http.StatusBadRequest, `{"__type":"ValidationException","message":"Throttling is not the issue"}`, false, http.StatusBadRequest},
+		{"longer word", http.StatusBadRequest, `{"code":"SlowDownPlease"}`, false, http.StatusBadRequest},
+		{"server error", http.StatusInternalServerError, `{"code":"ThrottlingException"}`, false, http.StatusInternalServerError},
+		{"past the cap", http.StatusBadRequest, long + `{"code":"ThrottlingException"}`, false, http.StatusBadRequest},
+		{"gzip", http.StatusBadRequest, `{"code":"ThrottlingException"}`, true, http.StatusTooManyRequests},
+		// the cap applies to the decompressed bytes too
+		{"gzip past the cap", http.StatusBadRequest, long + `{"code":"ThrottlingException"}`, true, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(tt.body)
+			if tt.gzipped {
+				var buf bytes.Buffer
+				zw := gzip.NewWriter(&buf)
+				_, _ = zw.Write(body)
+				_ = zw.Close()
+				body = buf.Bytes()
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.gzipped {
+					w.Header().Set("Content-Encoding", "gzip")
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write(body)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: NewRoundTripper(WithMaxRetries(0), WithThrottlingDetection())}
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			// asked for explicitly, the body isn't decompressed by the http.Transport
+			req.Header.Set("Accept-Encoding", "gzip")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, resp.StatusCode)
+			}
+			read, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(read, body) {
+				t.Errorf("Expected the whole body to be readable, got %d bytes", len(read))
+			}
+		})
+	}
+}
+
+func TestThrottlingDetection_Retry(t *testing.T) {
+	tests := []struct {
+		name       string
+		throttled  int
+		retryAfter string
+		calls      int
+		want       int
+		hinted     bool
+	}{
+		{"retried", 1, "", 2, http.StatusOK, false},
+		{"retry after", 1, "1", 2, http.StatusOK, true},
+		{"exhausted", 3, "", 3, http.StatusTooManyRequests, false},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls <= tt.throttled {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"ThrottlingException"}`))
+			}
+		}))
+
+		var retries []RetryInfo
+		transport := NewRoundTripper(
+			WithMaxRetries(2),
+			WithRetryWait(time.Millisecond, 20*time.Millisecond),
+			WithoutRateLimit(),
+			WithLogLevel(LevelOff),
+			WithThrottlingDetection(),
+			WithOnRetry(func(req *http.Request, info RetryInfo) { retries = append(retries, info) }),
+		)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := transport.RoundTrip(req)
+		server.Close()
+		if err != nil {
+			var exhausted *RetryExhaustedError
+			if !errors.As(err, &exhausted) || resp == nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.want, resp.StatusCode)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: Expected %d calls, got %d", tt.name, tt.calls, calls)
+		}
+		for _, info := range retries {
+			if info.StatusCode != http.StatusTooManyRequests || info.ServerHint != tt.hinted {
+				t.Errorf("%s: Unexpected retry %+v", tt.name, info)
+			}
+			if tt.hinted && info.Wait != 20*time.Millisecond {
+				t.Errorf("%s: Expected the Retry-After capped to %s, got %s", tt.name, 20*time.Millisecond, info.Wait)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package gcb
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithOpenStateResponse has the transport answer the requests rejected by
+// an open breaker with a 503 response instead of an ErrOpenState error. The
+// response carries a Retry-After header set to the time left before the
+// breaker lets a probe through, for the frameworks handling responses better
+// than transport errors. The response is made up, it doesn't come from the
+// upstream.
+func WithOpenStateResponse() Option {
+	return func(config *Config) {
+		config.openStateResponse = true
+	}
+}
+
+// openStateResponse makes up the 503 response answering a request rejected
+// by an open breaker, if err is one
+func openStateResponse(req *http.Request, err error) (*http.Response, bool) {
+	var openErr *BreakerOpenError
+	if !errors.As(err, &openErr) {
+		return nil, false
+	}
+
+	body := openErr.Error() + "\n"
+	header := make(http.Header)
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Retry-After", strconv.Itoa(retryAfterSeconds(openErr.RetryAfter)))
+	return &http.Response{
+		Status:        strconv.Itoa(http.StatusServiceUnavailable) + " " + http.StatusText(http.StatusServiceUnavailable),
+		StatusCode:    http.StatusServiceUnavailable,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, true
+}
+
+// retryAfterSeconds rounds the wait up to the whole seconds of a Retry-After
+// header, at least one
+func retryAfterSeconds(retryAfter time.Duration) int {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -0,0 +1,92 @@
+package gcb
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+func TestWithOpenStateResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		status   int
+		err      error
+		upstream int
+	}{
+		{"error", nil, 0, ErrOpenState, 1},
+		{"response", []Option{WithOpenStateResponse()}, http.StatusServiceUnavailable, nil, 1},
+	}
+
+	for _, tt := range tests {
+		clock := testutil.NewFakeClock(time.Now())
+		upstream := 0
+		transport := NewRoundTripper(append([]Option{
+			WithName("api"),
+			WithClock(clock),
+			WithTimeout(90 * time.Second),
+			WithMaxRetries(0),
+			WithReadyToTrip(func(counts Counts) bool { return counts.ConsecutiveFailures > 0 }),
+			WithLogLevel(LevelOff),
+			WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				upstream++
+				return nil, errors.New("connection refused")
+			})),
+		}, tt.opts...)...)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.example", nil)
+		// the first failure trips the breaker, the upstream errors are kept
+		if _, err := transport.RoundTrip(req); err == nil || errors.Is(err, ErrOpenState) {
+			t.Errorf("%s: Expected the upstream error, got %v", tt.name, err)
+		}
+		clock.Advance(30 * time.Second)
+
+		resp, err := transport.RoundTrip(req)
+		if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.err, err)
+		}
+		if upstream != tt.upstream {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.upstream, upstream)
+		}
+		if tt.status == 0 {
+			if resp != nil {
+				t.Errorf("%s: Expected no response, got %v", tt.name, resp.Status)
+			}
+			continue
+		}
+
+		if resp.StatusCode != tt.status || resp.Request != req {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "60" {
+			t.Errorf("%s: Expected %s, got %s", tt.name, "60", retryAfter)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != "circuit breaker is open: api\n" || resp.ContentLength != int64(len(body)) {
+			t.Errorf("%s: Expected the open breaker, got %q", tt.name, body)
+		}
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		expected   int
+	}{
+		{0, 1},
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{time.Minute, 60},
+	}
+
+	for _, tt := range tests {
+		if seconds := retryAfterSeconds(tt.retryAfter); seconds != tt.expected {
+			t.Errorf("%s: Expected %d, got %d", tt.retryAfter, tt.expected, seconds)
+		}
+	}
+}
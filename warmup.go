@@ -0,0 +1,79 @@
+package gcb
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	defaultWarmUpTimeout = 10 * time.Second
+)
+
+type (
+	// ProbeFunc builds a synthetic request against the target URL
+	ProbeFunc func(target *url.URL) (*http.Request, error)
+
+	// warmUp sends a burst of requests after a breaker closes following an
+	// outage, to re-establish the connection pools and warm the upstream
+	// caches before the full traffic resumes
+	warmUp struct {
+		count int
+		probe ProbeFunc
+
+		// targets holds the last URL seen by each breaker
+		targets sync.Map
+	}
+)
+
+// WithWarmUp sends count warm-up requests when a breaker closes after an
+// outage. The requests are built by probe against the URL of the last request
+// seen by the breaker, a nil probe sends HEAD requests to that URL. Warm-up
+// responses are discarded and aren't recorded by the breaker.
+func WithWarmUp(count int, probe ProbeFunc) Option {
+	return func(config *Config) {
+		config.warmUpCount = count
+		config.warmUpProbe = probe
+	}
+}
+
+func newWarmUp(count int, probe ProbeFunc) *warmUp {
+	if probe == nil {
+		probe = headProbe
+	}
+	return &warmUp{count: count, probe: probe}
+}
+
+// headProbe is the default warm-up request
+func headProbe(target *url.URL) (*http.Request, error) {
+	return http.NewRequest(http.MethodHead, target.String(), nil)
+}
+
+// track remembers the request URL as the warm-up target of the breaker
+func (w *warmUp) track(cb *Breaker, req *http.Request) {
+	w.targets.Store(cb, req.URL)
+}
+
+func (w *warmUp) run(cb *Breaker, transport http.RoundTripper) {
+	target, ok := w.targets.Load(cb)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultWarmUpTimeout)
+	defer cancel()
+
+	for i := 0; i < w.count; i++ {
+		req, err := w.probe(target.(*url.URL))
+		if err != nil {
+			return
+		}
+		resp, err := transport.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+	}
+}
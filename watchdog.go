@@ -0,0 +1,81 @@
+package gcb
+
+import "time"
+
+// WithWatchdog checks the breaker every interval and emits an EventStuckOpen
+// when it's been open for longer than its timeout plus stuckAfter. Open
+// breakers only move to half-open when a request comes in, so a breaker
+// without traffic can look open long after its timeout.
+func WithWatchdog(interval, stuckAfter time.Duration) Option {
+	return func(config *Config) {
+		config.watchdogInterval = interval
+		config.watchdogStuckAfter = stuckAfter
+	}
+}
+
+// WithTimerTransitions moves the breaker from open to half-open on a timer
+// as soon as the timeout expires, rather than on the next request.
+func WithTimerTransitions() Option {
+	return func(config *Config) {
+		config.timerTransitions = true
+	}
+}
+
+func (cb *Breaker) watchdog(interval, stuckAfter time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cb.stop:
+			return
+		case now := <-ticker.C:
+			cb.checkStuck(now, stuckAfter)
+		}
+	}
+}
+
+// checkStuck emits an EventStuckOpen once per open period
+func (cb *Breaker) checkStuck(now time.Time, stuckAfter time.Duration) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state != Open || cb.stuckGeneration == cb.generation {
+		return
+	}
+	if now.After(cb.expiry.Add(stuckAfter)) {
+		cb.stuckGeneration = cb.generation
+		cb.emit(Event{
+			Type:     EventStuckOpen,
+			From:     Open,
+			To:       Open,
+			Counts:   cb.counts.load(),
+			Duration: now.Sub(cb.openedAt),
+		}, now)
+	}
+}
+
+// scheduleTransition moves the breaker to half-open once the open timeout
+// expires, the breaker must be locked
+func (cb *Breaker) scheduleTransition() {
+	expired := cb.clock.After(cb.expiry.Sub(cb.clock.Now()))
+	go func() {
+		select {
+		case <-cb.stop:
+			return
+		case <-expired:
+		}
+
+		cb.mutex.Lock()
+		defer cb.mutex.Unlock()
+
+		cb.currentState(cb.clock.Now())
+	}()
+}
+
+// stopBackground terminates the background goroutines of the breaker
+func (cb *Breaker) stopBackground() {
+	cb.stopOnce.Do(func() {
+		close(cb.stop)
+	})
+}
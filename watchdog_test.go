@@ -0,0 +1,88 @@
+package gcb
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/calvernaz/gcb/testutil"
+)
+
+// makes sure the fake clock can stand in for the system one
+var _ Clock = (*testutil.FakeClock)(nil)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) record(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) waitFor(t *testing.T, typ EventType, to State) Event {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		for _, event := range r.events {
+			if event.Type == typ && event.To == to {
+				r.mu.Unlock()
+				return event
+			}
+		}
+		r.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected a %s event to %s", typ, to)
+	return Event{}
+}
+
+func trip(cb *Breaker) {
+	_, _ = cb.Execute(func() (*http.Response, error) {
+		return nil, errors.New("failed")
+	})
+}
+
+func TestBreaker_TimerTransitions(t *testing.T) {
+	recorder := &eventRecorder{}
+	clock := testutil.NewFakeClock(time.Now())
+	cb := NewBreaker(
+		WithTimeout(time.Minute),
+		WithReadyToTrip(func(counts Counts) bool { return true }),
+		WithTimerTransitions(),
+		WithEventListener(recorder.record),
+		WithClock(clock),
+	)
+
+	trip(cb)
+	recorder.waitFor(t, EventStateChange, Open)
+
+	// no request is needed to leave the open state
+	clock.BlockUntilTimers(1)
+	clock.Advance(time.Minute + time.Second)
+	event := recorder.waitFor(t, EventStateChange, HalfOpen)
+	if event.Duration != time.Minute+time.Second {
+		t.Errorf("Expected the breaker to stay open for the timeout, got %s", event.Duration)
+	}
+}
+
+func TestBreaker_WatchdogStuckOpen(t *testing.T) {
+	recorder := &eventRecorder{}
+	cb := NewBreaker(
+		WithTimeout(10*time.Millisecond),
+		WithReadyToTrip(func(counts Counts) bool { return true }),
+		WithWatchdog(5*time.Millisecond, 10*time.Millisecond),
+		WithEventListener(recorder.record),
+	)
+	defer close(cb.stop)
+
+	trip(cb)
+	event := recorder.waitFor(t, EventStuckOpen, Open)
+	if event.Duration < 20*time.Millisecond {
+		t.Errorf("Expected the breaker to be stuck past timeout and grace, got %s", event.Duration)
+	}
+}
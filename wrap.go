@@ -0,0 +1,69 @@
+package gcb
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type (
+	// DialContextFunc dials the connections of the transport
+	DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+)
+
+// WithTransport sets the transport the requests are sent with, instead of
+// http.DefaultTransport
+func WithTransport(transport http.RoundTripper) Option {
+	return func(config *Config) {
+		config.transport = transport
+	}
+}
+
+// WithDialContext sets the dialer of the transport gcb builds on top of
+// http.DefaultTransport, e.g. for SOCKS or in-memory pipes in tests. It has
+// no effect along with WithTransport, whose transport is used as is.
+func WithDialContext(dial DialContextFunc) Option {
+	return func(config *Config) {
+		config.dialContext = dial
+	}
+}
+
+// WithUnixSocket sends every request to the Unix socket at path, whatever
+// the host of the request URL
+func WithUnixSocket(path string) Option {
+	return WithDialContext(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", path)
+	})
+}
+
+// baseTransport returns the transport the requests are sent with
+func baseTransport(config *Config) http.RoundTripper {
+	if config.transport != nil {
+		return config.transport
+	}
+	if config.dialContext != nil || config.addressRotation || config.redialOnRetry || config.flushOnOpen {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if config.dialContext != nil {
+			transport.DialContext = config.dialContext
+		}
+		if config.addressRotation {
+			transport.DialContext = newAddressRotation(config.dialContext).DialContext
+		}
+		return transport
+	}
+	return http.DefaultTransport
+}
+
+// WrapClient returns a copy of the client with gcb layered on top of its
+// transport. The jar, the timeout and the redirect policy of the client are
+// kept as is, a nil transport stands for http.DefaultTransport.
+func WrapClient(c *http.Client, opts ...Option) *http.Client {
+	wrapped := *c
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	wrapped.Transport = NewRoundTripper(append(append([]Option{}, opts...), WithTransport(transport))...)
+	return &wrapped
+}
@@ -0,0 +1,74 @@
+package gcb
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWrapClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Sdk") != "1" {
+			t.Errorf("Expected the client transport to be used")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	errNoRedirect := errors.New("no redirect")
+	sdk := &http.Client{
+		Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Sdk", "1")
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+		Jar:           jar,
+		Timeout:       5 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return errNoRedirect },
+	}
+
+	client := WrapClient(sdk, WithMaxRetries(1))
+	if client.Jar != sdk.Jar || client.Timeout != sdk.Timeout || client.CheckRedirect == nil {
+		t.Errorf("Expected the client settings to be kept")
+	}
+	if _, ok := client.Transport.(*tripper); !ok {
+		t.Errorf("Expected the transport to be wrapped, got %T", client.Transport)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestWithUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gcb.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &httptest.Server{
+		Listener: listener,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		})},
+	}
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRoundTripper(WithUnixSocket(path))}
+	resp, err := client.Get("http://unix/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected %d, got %d", http.StatusAccepted, resp.StatusCode)
+	}
+}